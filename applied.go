@@ -0,0 +1,133 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AppliedMigration is a migration recorded in the schema table.
+type AppliedMigration struct {
+	// Version of the applied migration.
+	Version int
+
+	// Name recorded when the migration ran.
+	Name string
+
+	// Md5 is the checksum recorded when the migration ran.
+	Md5 string
+
+	// RunAt is when the migration ran. It is the zero time if unknown.
+	RunAt time.Time
+
+	// Metadata is the deploy metadata recorded with Config.CaptureEnv, or nil
+	// if none was recorded.
+	Metadata map[string]string
+}
+
+// Orders of applied migrations accepted by SortApplied.
+const (
+	// OrderVersion sorts by version number.
+	OrderVersion = "version"
+	// OrderRunAt sorts by when each migration ran, oldest first, which keeps
+	// the history in the order it happened when int and timestamp versions
+	// are mixed.
+	OrderRunAt = "run_at"
+)
+
+// SortApplied sorts applied migrations by order, OrderVersion or OrderRunAt.
+// With OrderRunAt, migrations whose run time is unknown, recorded by an older
+// schema table, come first, and ties are broken by version.
+func SortApplied(applied []AppliedMigration, order string) error {
+	switch order {
+	case OrderVersion:
+		sort.SliceStable(applied, func(i, j int) bool { return applied[i].Version < applied[j].Version })
+	case OrderRunAt:
+		sort.SliceStable(applied, func(i, j int) bool {
+			if !applied[i].RunAt.Equal(applied[j].RunAt) {
+				return applied[i].RunAt.Before(applied[j].RunAt)
+			}
+			return applied[i].Version < applied[j].Version
+		})
+	default:
+		return fmt.Errorf("unknown order %q, must be one of: %s or %s", order, OrderVersion, OrderRunAt)
+	}
+	return nil
+}
+
+// runAtLayouts are the formats run_at values may be returned in.
+var runAtLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
+// GetAppliedMigrations returns the migrations recorded in the schema table in
+// ascending version order. It returns no rows if the table does not exist,
+// and leaves fields empty for columns a table created by an older version
+// lacks, so it never needs to create or alter the table.
+func (g *Gostgrator) GetAppliedMigrations(ctx context.Context) ([]AppliedMigration, error) {
+	columns, err := g.client.SchemaColumns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	rows, err := g.client.QueryContext(ctx, g.client.GetAppliedColumnsSql(columns))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var applied []AppliedMigration
+	for rows.Next() {
+		var a AppliedMigration
+		var name, md5, metadata sql.NullString
+		var runAt any
+		if err := rows.Scan(&a.Version, &name, &md5, &runAt, &metadata); err != nil {
+			return nil, err
+		}
+		a.Name = name.String
+		a.Md5 = md5.String
+		if a.RunAt, err = parseRunAt(runAt); err != nil {
+			return nil, fmt.Errorf("invalid run_at for migration [%d]: %v", a.Version, err)
+		}
+		if metadata.Valid {
+			if err := json.Unmarshal([]byte(metadata.String), &a.Metadata); err != nil {
+				return nil, fmt.Errorf("invalid metadata for migration [%d]: %v", a.Version, err)
+			}
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// parseRunAt converts a run_at value as returned by the driver into a time.
+func parseRunAt(v any) (time.Time, error) {
+	var s string
+	switch t := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return t, nil
+	case string:
+		s = t
+	case []byte:
+		s = string(t)
+	default:
+		return time.Time{}, fmt.Errorf("unexpected type %T", v)
+	}
+	s = strings.TrimSpace(s)
+	for _, layout := range runAtLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", s)
+}
@@ -0,0 +1,126 @@
+package gostgrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// destructivePattern finds statements that drop or delete data.
+var destructivePattern = regexp.MustCompile(`(?i)\b(?:DROP|TRUNCATE|DELETE\s+FROM)\b`)
+
+// backupTimeLayout names backups so they sort oldest first.
+const backupTimeLayout = "20060102T150405.000Z"
+
+// Backup writes a consistent copy of a SQLite database into dir with VACUUM
+// INTO and returns its path, named after the database file and the time,
+// e.g. "app-20240102T030405.000Z-manual.bak". It is only supported by the
+// sqlite3 driver.
+func (g *Gostgrator) Backup(ctx context.Context, dir string) (string, error) {
+	return g.backup(ctx, dir, "manual")
+}
+
+// backup is Backup with the reason the backup was taken in its name.
+func (g *Gostgrator) backup(ctx context.Context, dir, reason string) (string, error) {
+	if _, ok := g.client.(*Sqlite3Client); !ok {
+		return "", fmt.Errorf("backups are only supported for sqlite3, not %s", g.cfg.Driver)
+	}
+	base, err := g.sqliteBaseName(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s-%s.bak", base, g.cfg.now().UTC().Format(backupTimeLayout), reason)
+	path := filepath.Join(dir, name)
+	if _, err := g.client.ExecContext(ctx, "VACUUM INTO "+quoteLiteral("sqlite3", path)+";"); err != nil {
+		return "", fmt.Errorf("failed to back up database: %w", err)
+	}
+	return path, nil
+}
+
+// autoBackup backs up a SQLite database before a destructive operation when
+// Config.SQLiteBackupDir is set, then removes the oldest backups beyond
+// Config.SQLiteBackupKeep. Other drivers are left untouched.
+func (g *Gostgrator) autoBackup(ctx context.Context, reason string) error {
+	if _, ok := g.client.(*Sqlite3Client); !ok || g.cfg.SQLiteBackupDir == "" {
+		return nil
+	}
+	if _, err := g.backup(ctx, g.cfg.SQLiteBackupDir, reason); err != nil {
+		return err
+	}
+	if g.cfg.SQLiteBackupKeep <= 0 {
+		return nil
+	}
+	base, err := g.sqliteBaseName(ctx)
+	if err != nil {
+		return err
+	}
+	backups, err := filepath.Glob(filepath.Join(g.cfg.SQLiteBackupDir, base+"-[0-9]*.bak"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(backups)
+	for len(backups) > g.cfg.SQLiteBackupKeep {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// destructive reports whether running migrations could lose data: any undo,
+// or a do migration that drops, truncates or deletes. Files large enough to
+// be streamed are not read and count as destructive.
+func (g *Gostgrator) destructive(migrations []Migration) (bool, error) {
+	for _, m := range migrations {
+		if m.Action != "do" {
+			return true, nil
+		}
+		stream, err := g.streams(m)
+		if err != nil {
+			return false, err
+		}
+		if stream {
+			return true, nil
+		}
+		script, err := g.sql(m)
+		if err != nil {
+			return false, err
+		}
+		if destructivePattern.MatchString(stripComments(script)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sqliteBaseName returns the name of the main database file without its
+// extension, or "memory" for an in-memory database.
+func (g *Gostgrator) sqliteBaseName(ctx context.Context) (string, error) {
+	rows, err := g.client.QueryContext(ctx, "SELECT file FROM pragma_database_list WHERE name = 'main';")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var file string
+	if rows.Next() {
+		if err := rows.Scan(&file); err != nil {
+			return "", err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if file == "" {
+		return "memory", nil
+	}
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base)), nil
+}
@@ -0,0 +1,88 @@
+package gostgrator_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// benchMigrationCount is the size of the generated migration sets.
+const benchMigrationCount = 10000
+
+// writeBenchMigrations writes count do and undo migrations to a temporary
+// directory and returns their glob pattern.
+func writeBenchMigrations(b *testing.B, count int) string {
+	b.Helper()
+	dir := b.TempDir()
+	for i := 1; i <= count; i++ {
+		do := fmt.Sprintf("-- gostgrator: environments=bench\nCREATE TABLE t%d (id INTEGER PRIMARY KEY, name TEXT);\n", i)
+		undo := fmt.Sprintf("DROP TABLE t%d;\n", i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%05d.do.table-%d.sql", i, i)), []byte(do), 0644); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%05d.undo.table-%d.sql", i, i)), []byte(undo), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "*.sql")
+}
+
+// BenchmarkGetMigrations measures loading a large migration set from disk.
+func BenchmarkGetMigrations(b *testing.B) {
+	pattern := writeBenchMigrations(b, benchMigrationCount)
+	cfg := gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: pattern,
+		Newline:          "LF",
+	}
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for b.Loop() {
+		if _, err := g.GetMigrations(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMigrate measures applying a large migration set to a fresh SQLite
+// database.
+func BenchmarkMigrate(b *testing.B) {
+	pattern := writeBenchMigrations(b, benchMigrationCount)
+	dir := b.TempDir()
+	i := 0
+	for b.Loop() {
+		i++
+		db, err := sql.Open("sqlite3", filepath.Join(dir, fmt.Sprintf("bench%d.db", i)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		g, err := gostgrator.NewGostgrator(gostgrator.Config{
+			Driver:           "sqlite3",
+			MigrationPattern: pattern,
+			Environment:      "bench",
+		}, db)
+		if err != nil {
+			b.Fatal(err)
+		}
+		applied, err := g.Migrate(context.Background(), "max")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(applied) != benchMigrationCount {
+			b.Fatalf("expected %d migrations applied, got %d", benchMigrationCount, len(applied))
+		}
+		db.Close()
+	}
+}
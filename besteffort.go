@@ -0,0 +1,134 @@
+package gostgrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultBestEffortCodes are the SQLSTATE codes best-effort migrations
+// tolerate when Config.BestEffortCodes is empty: objects that already exist
+// or do not exist.
+var DefaultBestEffortCodes = []string{
+	"42P07", // duplicate_table, also for indexes, views and sequences
+	"42701", // duplicate_column
+	"42710", // duplicate_object, such as a constraint or trigger
+	"42P06", // duplicate_schema
+	"42723", // duplicate_function
+	"42P01", // undefined_table
+	"42703", // undefined_column
+	"42704", // undefined_object
+	"42883", // undefined_function
+	"3F000", // invalid_schema_name
+}
+
+// Warning is an error a best-effort migration tolerated.
+type Warning struct {
+	// Statement is the number of the statement that failed, counted from 1.
+	Statement int `json:"statement"`
+	// Code is the error's SQLSTATE, or its equivalent for SQLite.
+	Code string `json:"code"`
+	// Message is the error message.
+	Message string `json:"message"`
+}
+
+// Savepoints let a statement fail inside a transaction without aborting it.
+const (
+	bestEffortSavepoint = "SAVEPOINT gostgrator_best_effort;"
+	bestEffortRollback  = "ROLLBACK TO SAVEPOINT gostgrator_best_effort;"
+	bestEffortRelease   = "RELEASE SAVEPOINT gostgrator_best_effort;"
+)
+
+// bestEffort reports whether m runs in best-effort mode: its "best-effort"
+// directive, e.g. "-- gostgrator: best-effort=true", if it has one, and
+// Config.BestEffort otherwise.
+func (g *Gostgrator) bestEffort(m Migration) (bool, error) {
+	value, ok := m.Directives["best-effort"]
+	if !ok {
+		return g.cfg.BestEffort, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid best-effort directive in %s: %q, expected true or false", m.Filename, value)
+	}
+	return enabled, nil
+}
+
+// execStatement runs statement i of m, counted from zero. In best-effort
+// mode an error with a tolerated code is appended to m.Warnings instead of
+// returned; inside a transaction the statement runs under a savepoint so the
+// transaction survives the error.
+func (g *Gostgrator) execStatement(ctx context.Context, m *Migration, bestEffort bool, i int, stmt string) error {
+	if !bestEffort {
+		if _, err := g.client.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("statement %d of migration [%d] failed: %w", i+1, m.Version, err)
+		}
+		return nil
+	}
+	if g.inTx {
+		if _, err := g.client.ExecContext(ctx, bestEffortSavepoint); err != nil {
+			return err
+		}
+	}
+	_, err := g.client.ExecContext(ctx, stmt)
+	code := errorCode(err)
+	if err != nil && !g.tolerated(code) {
+		return fmt.Errorf("statement %d of migration [%d] failed: %w", i+1, m.Version, err)
+	}
+	if err != nil {
+		m.Warnings = append(m.Warnings, Warning{Statement: i + 1, Code: code, Message: err.Error()})
+	}
+	if g.inTx {
+		if err != nil {
+			if _, err := g.client.ExecContext(ctx, bestEffortRollback); err != nil {
+				return err
+			}
+		}
+		if _, err := g.client.ExecContext(ctx, bestEffortRelease); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tolerated reports whether best-effort migrations treat errors with code as
+// warnings.
+func (g *Gostgrator) tolerated(code string) bool {
+	codes := g.cfg.BestEffortCodes
+	if len(codes) == 0 {
+		codes = DefaultBestEffortCodes
+	}
+	return code != "" && slices.ContainsFunc(codes, func(c string) bool { return strings.EqualFold(c, code) })
+}
+
+// errorCode returns the SQLSTATE of err. SQLite reports no codes, so its
+// messages for objects that already exist or do not exist are mapped to the
+// codes PostgreSQL uses for the same failures. Other errors have no code.
+func errorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		return state.SQLState()
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "duplicate column name"):
+		return "42701"
+	case strings.Contains(msg, "no such column"):
+		return "42703"
+	case strings.Contains(msg, "no such table"), strings.Contains(msg, "no such view"):
+		return "42P01"
+	case strings.Contains(msg, "no such index"), strings.Contains(msg, "no such trigger"):
+		return "42704"
+	case strings.HasPrefix(msg, "trigger ") && strings.Contains(msg, "already exists"):
+		return "42710"
+	case strings.Contains(msg, "already exists"):
+		return "42P07"
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeDriftedMigrations writes files, keyed by name, into a temporary
+// directory and returns their glob pattern.
+func writeDriftedMigrations(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, "*.sql")
+}
+
+// TestBestEffort verifies that tolerated errors become warnings and the rest
+// of the migration still runs, in and out of transactions.
+func TestBestEffort(t *testing.T) {
+	ctx := context.Background()
+	pattern := writeDriftedMigrations(t, map[string]string{
+		"001.do.a.sql": "CREATE TABLE a (id INTEGER);\nCREATE TABLE b (id INTEGER);",
+		"002.do.b.sql": "ALTER TABLE b ADD COLUMN name TEXT;\nDROP INDEX missing_idx;\nCREATE TABLE c (id INTEGER);",
+	})
+	for _, transaction := range []string{"none", "each", "all"} {
+		t.Run(transaction, func(t *testing.T) {
+			db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "drifted.db"))
+			if err != nil {
+				t.Fatalf("failed to open sqlite3 db: %v", err)
+			}
+			defer db.Close()
+			if _, err := db.Exec("CREATE TABLE a (id INTEGER); CREATE TABLE b (id INTEGER, name TEXT);"); err != nil {
+				t.Fatalf("failed to drift the database: %v", err)
+			}
+			cfg := Config{Driver: "sqlite3", MigrationPattern: pattern, Transaction: transaction, BestEffort: true}
+			g, err := NewGostgrator(cfg, db)
+			if err != nil {
+				t.Fatalf("failed to create gostgrator: %v", err)
+			}
+			applied, err := g.Migrate(ctx, "max")
+			if err != nil || len(applied) != 2 {
+				t.Fatalf("expected both migrations to be applied, got %d (%v)", len(applied), err)
+			}
+			var got [][]string
+			for _, m := range applied {
+				for _, w := range m.Warnings {
+					got = append(got, []string{m.Filename[len(m.Filename)-12:], w.Code, strings.Fields(w.Message)[0]})
+				}
+				if m.Version == 1 && (len(m.Warnings) != 2 || m.Warnings[1].Statement != 2) {
+					t.Errorf("expected warnings for statements 1 and 2 of version 1, got %+v", m.Warnings)
+				}
+			}
+			want := [][]string{
+				{"001.do.a.sql", "42P07", "table"},
+				{"001.do.a.sql", "42P07", "table"},
+				{"002.do.b.sql", "42701", "duplicate"},
+				{"002.do.b.sql", "42704", "no"},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("warnings = %v, want %v", got, want)
+			}
+			if !tableExists(t, db, "c") {
+				t.Error("expected statements after a tolerated error to run")
+			}
+		})
+	}
+}
+
+// TestBestEffortFailures verifies that errors outside BestEffortCodes still
+// fail the migration and that the directive overrides the config.
+func TestBestEffortFailures(t *testing.T) {
+	ctx := context.Background()
+	pattern := writeDriftedMigrations(t, map[string]string{
+		"001.do.a.sql": "-- gostgrator: best-effort=false\nCREATE TABLE a (id INTEGER);",
+		"002.do.b.sql": "-- gostgrator: best-effort=true\nCREATE TABLE b (id INTEGER);",
+		"003.do.c.sql": "CREATE TABLE b (id INTEGER);\nSELEC 1;",
+	})
+	open := func(t *testing.T, cfg Config) (*Gostgrator, *sql.DB) {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "failures.db"))
+		if err != nil {
+			t.Fatalf("failed to open sqlite3 db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if _, err := db.Exec("CREATE TABLE a (id INTEGER); CREATE TABLE b (id INTEGER);"); err != nil {
+			t.Fatalf("failed to drift the database: %v", err)
+		}
+		cfg.Driver = "sqlite3"
+		cfg.MigrationPattern = pattern
+		g, err := NewGostgrator(cfg, db)
+		if err != nil {
+			t.Fatalf("failed to create gostgrator: %v", err)
+		}
+		return g, db
+	}
+
+	g, _ := open(t, Config{BestEffort: true})
+	if _, err := g.Migrate(ctx, "1"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected best-effort=false to opt the file out, got %v", err)
+	}
+
+	g, _ = open(t, Config{})
+	if _, err := g.Migrate(ctx, "1"); err == nil {
+		t.Error("expected migrations to fail on drift without best-effort")
+	}
+	g, db := open(t, Config{})
+	if _, err := db.Exec("DROP TABLE a;"); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := g.Migrate(ctx, "2")
+	if err != nil || len(applied) != 2 || len(applied[1].Warnings) != 1 {
+		t.Fatalf("expected best-effort=true to opt the file in, got %v (%v)", applied, err)
+	}
+	g, err = NewGostgrator(Config{Driver: "sqlite3", MigrationPattern: pattern, BestEffort: true}, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	_, err = g.Migrate(ctx, "3")
+	var partial *PartialApplyError
+	if !errors.As(err, &partial) || !strings.Contains(err.Error(), "statement 2 of migration [3]") {
+		t.Errorf("expected an untolerated error to fail the migration, got %v", err)
+	}
+
+	g, db = open(t, Config{BestEffort: true, BestEffortCodes: []string{"42701"}})
+	if _, err := db.Exec("DROP TABLE a;"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Migrate(ctx, "2"); err == nil || !strings.Contains(err.Error(), "statement 1 of migration [2]") {
+		t.Errorf("expected codes outside BestEffortCodes to fail, got %v", err)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{sqlStateError("42P07"), "42P07"},
+		{errors.New("table users already exists"), "42P07"},
+		{errors.New("index users_idx already exists"), "42P07"},
+		{errors.New("trigger audit already exists"), "42710"},
+		{errors.New("duplicate column name: email"), "42701"},
+		{errors.New("no such table: users"), "42P01"},
+		{errors.New("no such column: email"), "42703"},
+		{errors.New("no such index: users_idx"), "42704"},
+		{errors.New(`near "SELEC": syntax error`), ""},
+		{nil, ""},
+	} {
+		if got := errorCode(tt.err); got != tt.want {
+			t.Errorf("errorCode(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
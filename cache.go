@@ -0,0 +1,108 @@
+package gostgrator
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+)
+
+// migrationCache is the on-disk cache of parsed migration files. Entries are
+// reused while a file's modification time and size are unchanged, so large
+// migration sets are not re-read and re-hashed on every run.
+type migrationCache struct {
+	// Newline and ChecksumCompat are the settings the checksums were
+	// computed with; a cache written with different settings is discarded.
+	Newline        string                         `json:"newline"`
+	ChecksumCompat string                         `json:"checksumCompat,omitempty"`
+	Files          map[string]migrationCacheEntry `json:"files"`
+
+	// previous holds the entries loaded from disk.
+	previous map[string]migrationCacheEntry
+}
+
+// migrationCacheEntry caches the parsed state of one migration file.
+type migrationCacheEntry struct {
+	ModTime    int64             `json:"modTime"`
+	Size       int64             `json:"size"`
+	Md5        string            `json:"md5"`
+	Directives map[string]string `json:"directives,omitempty"`
+}
+
+// loadMigrationCache reads the cache at path. A missing, unreadable or
+// outdated cache yields an empty one that is rebuilt on the next save.
+func loadMigrationCache(path string, style checksumStyle) *migrationCache {
+	cache := &migrationCache{
+		Newline:        style.newline,
+		ChecksumCompat: style.compat,
+		Files:          make(map[string]migrationCacheEntry),
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	var stored migrationCache
+	if err := json.Unmarshal(data, &stored); err != nil || stored.Newline != style.newline || stored.ChecksumCompat != style.compat {
+		return cache
+	}
+	cache.previous = stored.Files
+	return cache
+}
+
+// parse returns the checksum and directives of file, from the cache when the
+// file is unchanged. A nil cache always parses the file.
+func (c *migrationCache) parse(file string, style checksumStyle) (string, map[string]string, error) {
+	if c == nil {
+		return parseMigrationFile(nil, file, style)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", nil, err
+	}
+	if entry, ok := c.previous[file]; ok && entry.ModTime == info.ModTime().UnixNano() && entry.Size == info.Size() {
+		c.Files[file] = entry
+		return entry.Md5, entry.Directives, nil
+	}
+	md5sum, directives, err := parseMigrationFile(nil, file, style)
+	if err != nil {
+		return "", nil, err
+	}
+	c.Files[file] = migrationCacheEntry{
+		ModTime:    info.ModTime().UnixNano(),
+		Size:       info.Size(),
+		Md5:        md5sum,
+		Directives: directives,
+	}
+	return md5sum, directives, nil
+}
+
+// save writes the cache to path if any entry changed since it was loaded.
+// The file is replaced atomically so concurrent runs never read a partial cache.
+func (c *migrationCache) save(path string) error {
+	if c == nil || maps.EqualFunc(c.Files, c.previous, func(a, b migrationCacheEntry) bool {
+		return a.ModTime == b.ModTime && a.Size == b.Size && a.Md5 == b.Md5
+	}) {
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write migration cache %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write migration cache %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write migration cache %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write migration cache %s: %w", path, err)
+	}
+	return nil
+}
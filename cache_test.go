@@ -0,0 +1,75 @@
+package gostgrator
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMigrationCacheReuse verifies that unchanged files are served from the cache
+// and changed files are re-parsed.
+func TestMigrationCacheReuse(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "001.do.sql")
+	if err := os.WriteFile(file, []byte("SELECT 1;"), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	cfg := Config{
+		MigrationPattern: filepath.Join(tmpDir, "*.sql"),
+		CacheFile:        filepath.Join(tmpDir, "cache.json"),
+	}
+
+	migs, err := getMigrations(cfg)
+	if err != nil {
+		t.Fatalf("getMigrations failed: %v", err)
+	}
+	realMd5 := migs[0].Md5
+
+	// Tamper with the cached checksum to prove the cache is read.
+	var cache migrationCache
+	data, err := os.ReadFile(cfg.CacheFile)
+	if err != nil {
+		t.Fatalf("expected cache file to be written: %v", err)
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		t.Fatalf("failed to decode cache: %v", err)
+	}
+	entry := cache.Files[file]
+	entry.Md5 = "from-cache"
+	cache.Files[file] = entry
+	data, _ = json.Marshal(cache)
+	if err := os.WriteFile(cfg.CacheFile, data, 0644); err != nil {
+		t.Fatalf("failed to write cache: %v", err)
+	}
+
+	migs, err = getMigrations(cfg)
+	if err != nil {
+		t.Fatalf("getMigrations failed: %v", err)
+	}
+	if migs[0].Md5 != "from-cache" {
+		t.Errorf("Expected cached checksum to be used, got %s", migs[0].Md5)
+	}
+
+	// Changing the file size invalidates the entry.
+	if err := os.WriteFile(file, []byte("SELECT 2; -- changed"), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	migs, err = getMigrations(cfg)
+	if err != nil {
+		t.Fatalf("getMigrations failed: %v", err)
+	}
+	if migs[0].Md5 == "from-cache" || migs[0].Md5 == realMd5 {
+		t.Errorf("Expected checksum to be recomputed for the changed file, got %s", migs[0].Md5)
+	}
+
+	// A different newline setting discards the whole cache.
+	cfg.Newline = "LF"
+	if _, err := getMigrations(cfg); err != nil {
+		t.Fatalf("getMigrations failed: %v", err)
+	}
+	reloaded := loadMigrationCache(cfg.CacheFile, checksumStyle{newline: "CRLF"})
+	if reloaded.previous != nil {
+		t.Errorf("Expected a cache written for LF to be ignored for CRLF")
+	}
+}
@@ -3,11 +3,39 @@ package gostgrator
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
-	"time"
+	"sync"
 )
 
+// registeredClients holds the Client constructors added with RegisterClient.
+var (
+	registeredClientsMu sync.RWMutex
+	registeredClients   = map[string]func(cfg Config, db *sql.DB) Client{}
+)
+
+// RegisterClient makes a Client implementation available as Config.Driver
+// name, for databases other than the built-in "pg" and "sqlite3". Like
+// database/sql.Register, it is meant to be called from an init function and
+// panics if newClient is nil or name is already taken. newClient may be
+// given a nil db, when the Gostgrator needs no database; its queries should
+// then fail with ErrNoDatabase, as the built-in clients' do. Validate an
+// implementation with the clienttest package.
+func RegisterClient(name string, newClient func(cfg Config, db *sql.DB) Client) {
+	registeredClientsMu.Lock()
+	defer registeredClientsMu.Unlock()
+	name = strings.ToLower(name)
+	if newClient == nil {
+		panic("gostgrator: RegisterClient constructor is nil")
+	}
+	if _, dup := registeredClients[name]; dup || name == "pg" || name == "sqlite3" {
+		panic("gostgrator: RegisterClient called twice for driver " + name)
+	}
+	registeredClients[name] = newClient
+}
+
 // NewClient creates a new Client based on the provided configuration and database connection.
 func NewClient(cfg Config, db *sql.DB) (Client, error) {
 	switch strings.ToLower(cfg.Driver) {
@@ -15,65 +43,279 @@ func NewClient(cfg Config, db *sql.DB) (Client, error) {
 		return NewPostgresClient(cfg, db), nil
 	case "sqlite3":
 		return NewSqlite3Client(cfg, db), nil
-	default:
-		return nil, fmt.Errorf("db driver '%s' not supported. Must be one of: sqlite3 or pg", cfg.Driver)
 	}
+	registeredClientsMu.RLock()
+	newClient, ok := registeredClients[strings.ToLower(cfg.Driver)]
+	registeredClientsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("db driver '%s' not supported. Must be one of: %s", cfg.Driver, strings.Join(clientNames(), ", "))
+	}
+	return newClient(cfg, db), nil
 }
 
-// Client defines the interface for migration clients.
+// clientNames lists the built-in and registered driver names.
+func clientNames() []string {
+	registeredClientsMu.RLock()
+	defer registeredClientsMu.RUnlock()
+	names := []string{"pg", "sqlite3"}
+	for name := range registeredClients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Client defines the interface for migration clients. Capabilities added
+// since Client was published with RegisterClient are separate optional
+// interfaces, such as Freezer, which a Client may also implement; the
+// features that need one fail with an error wrapping errors.ErrUnsupported
+// without it.
 type Client interface {
 	QueryContext(ctx context.Context, query string) (*sql.Rows, error)
 	ExecContext(ctx context.Context, script string) (sql.Result, error)
 	GetDatabaseVersionSql() string
+	GetDatabaseVersionColumnsSql(columns map[string]bool) string
 	HasVersionTable(ctx context.Context) (bool, error)
+	SchemaColumns(ctx context.Context) (map[string]bool, error)
 	EnsureTable(ctx context.Context) error
+	UpgradeTable(ctx context.Context) error
+	DropTableSql(opts DropOptions) string
 	GetMd5Sql(m Migration) string
+	GetAppliedSql() string
+	GetAppliedColumnsSql(columns map[string]bool) string
 	PersistActionSql(m Migration) string
+	EnsureProgressTable(ctx context.Context) error
+	GetProgressSql(m Migration) string
+	PersistProgressSql(m Migration, statement int, md5 string) string
+	ClearProgressSql(m Migration) string
+	EnsureHistoryTable(ctx context.Context) error
+	PersistHistorySql(m Migration) string
+	EnsureLockTable(ctx context.Context) error
+	AcquireLockSql(holder string) string
+	GetLockSql() string
+	ReleaseLockSql(holder string) string
+	GolangMigrateVersion(ctx context.Context) (int, bool, error)
+	BeginTx(ctx context.Context) (Client, *sql.Tx, error)
+}
+
+// ArgsClient is implemented by Clients that can pass the values they record,
+// such as the time a migration ran, its name and its checksum, as query
+// arguments instead of quoting them into the SQL. Each method returns the
+// statement of the matching *Sql method and its arguments. Gostgrator runs
+// the *Sql statements of a Client without it. The built-in clients implement
+// it.
+type ArgsClient interface {
+	ExecArgsContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PersistActionArgs(m Migration) (string, []any)
+	PersistProgressArgs(m Migration, statement int, md5 string) (string, []any)
+	PersistHistoryArgs(m Migration) (string, []any)
+	AcquireLockArgs(holder string) (string, []any)
+	FreezeArgs(reason string) (string, []any)
+}
+
+// execArgs runs the statement args builds on c when c is an ArgsClient, and
+// the one query builds otherwise.
+func execArgs(ctx context.Context, c Client, args func(ArgsClient) (string, []any), query func() string) (sql.Result, error) {
+	if ac, ok := c.(ArgsClient); ok {
+		q, a := args(ac)
+		return ac.ExecArgsContext(ctx, q, a...)
+	}
+	return c.ExecContext(ctx, query())
+}
+
+// Freezer is implemented by Clients that can keep a freeze, set with
+// Gostgrator.Freeze, in the schema table. The built-in clients implement it.
+type Freezer interface {
+	EnsureFreezeColumns(ctx context.Context) error
+	FreezeSql(reason string) string
+	GetFreezeSql() string
+	UnfreezeSql() string
+}
+
+// DropOptions controls how the migration table is dropped.
+type DropOptions struct {
+	// IfExists makes dropping a table that does not exist succeed.
+	IfExists bool
+	// Cascade also drops objects that depend on the table, where the driver supports it.
+	Cascade bool
+	// OnlyCore drops the schema table alone, leaving its _lock, _history,
+	// _progress and _snapshot companions in place.
+	OnlyCore bool
 }
 
 // baseClient provides common functionality.
 type baseClient struct {
 	cfg Config
 	db  *sql.DB
+	// tx, when set, is the transaction every query runs in.
+	tx *sql.Tx
 
 	// Function pointers for driver-specific SQL generators.
-	getColumnsSqlFn func() string
-	getAddNameSqlFn func() string
-	getAddMd5SqlFn  func() string
+	getColumnsSqlFn  func() string
+	getAddNameSqlFn  func() string
+	getAddMd5SqlFn   func() string
 	getAddRunAtSqlFn func() string
+	// getTableSqlFn returns SQL yielding a row if the table exists.
+	getTableSqlFn func(table string) string
+	// getZonelessColumnsSqlFn, if set, returns SQL listing the columns of the
+	// migration table that hold timestamps without a time zone.
+	getZonelessColumnsSqlFn func() string
+	// getIndexesSqlFn, if set, returns SQL listing the names of the indexes
+	// on the migration table.
+	getIndexesSqlFn func() string
 }
 
 // quotedSchemaTable quotes the schemaTable if using PostgreSQL.
 func (c *baseClient) quotedSchemaTable() string {
-	if strings.ToLower(c.cfg.Driver) == "pg" {
-		parts := strings.Split(c.cfg.SchemaTable, ".")
-		for i, part := range parts {
-			parts[i] = fmt.Sprintf(`"%s"`, part)
-		}
-		return strings.Join(parts, ".")
+	return quoteQualified(c.cfg.SchemaTable)
+}
+
+// runAtIndex is the name of the index on the run_at column of the migration
+// table. It is unqualified, as PostgreSQL creates indexes in the schema of
+// their table.
+func (c *baseClient) runAtIndex() string {
+	table := c.cfg.SchemaTable
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		table = table[i+1:]
 	}
-	return c.cfg.SchemaTable
+	return table + "_run_at_idx"
+}
+
+// quotedProgressTable quotes the table recording per-statement progress,
+// which lives next to the schemaTable with a "_progress" suffix.
+func (c *baseClient) quotedProgressTable() string {
+	return quoteQualified(c.cfg.SchemaTable + "_progress")
+}
+
+// quotedHistoryTable quotes the table recording every do and undo in audit
+// mode, which lives next to the schemaTable with a "_history" suffix.
+func (c *baseClient) quotedHistoryTable() string {
+	return quoteQualified(c.cfg.SchemaTable + "_history")
+}
+
+// quotedLockTable quotes the table holding the migration lock, which lives
+// next to the schemaTable with a "_lock" suffix.
+func (c *baseClient) quotedLockTable() string {
+	return quoteQualified(c.cfg.SchemaTable + "_lock")
 }
 
-// Exposes the QueryContext method from the configured db connection.
+// execer is the part of *sql.DB and *sql.Tx used to run SQL.
+type execer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// ErrNoDatabase is returned by methods that query the database when the
+// Client, or the Gostgrator, was created with a nil *sql.DB, as it may be
+// for creating, linting and exporting migrations.
+var ErrNoDatabase = errors.New("no database connection; pass a *sql.DB to NewGostgrator")
+
+// noDatabase stands in for the database of a client created without one,
+// failing every query with ErrNoDatabase.
+type noDatabase struct{}
+
+func (noDatabase) QueryContext(context.Context, string, ...any) (*sql.Rows, error) {
+	return nil, ErrNoDatabase
+}
+
+func (noDatabase) ExecContext(context.Context, string, ...any) (sql.Result, error) {
+	return nil, ErrNoDatabase
+}
+
+// conn returns the transaction queries run in, or the database outside one.
+func (c *baseClient) conn() execer {
+	if c.tx != nil {
+		return c.tx
+	}
+	if c.db == nil {
+		return noDatabase{}
+	}
+	return c.db
+}
+
+// Exposes the QueryContext method from the configured db connection, masking
+// any credentials in the returned error.
 func (c *baseClient) QueryContext(ctx context.Context, query string) (*sql.Rows, error) {
-	return c.db.QueryContext(ctx, query)
+	rows, err := c.conn().QueryContext(ctx, query)
+	return rows, redactError(err)
 }
 
-// Exposing ExecContext from the configured db connection.
+// Exposing ExecContext from the configured db connection, masking any
+// credentials in the returned error.
 func (c *baseClient) ExecContext(ctx context.Context, script string) (sql.Result, error) {
-	return c.db.ExecContext(ctx, script)
+	result, err := c.conn().ExecContext(ctx, script)
+	return result, redactError(err)
+}
+
+// ExecArgsContext runs query with args on the configured db connection,
+// masking any credentials in the returned error.
+func (c *baseClient) ExecArgsContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := c.conn().ExecContext(ctx, query, args...)
+	return result, redactError(err)
 }
 
-// PersistActionSql generates SQL to record a migration action.
+// values returns a sqlValues writing values for the client's driver, as
+// arguments when bind is set and as literals otherwise.
+func (c *baseClient) values(bind bool) *sqlValues {
+	return &sqlValues{driver: c.cfg.Driver, bind: bind}
+}
+
+// begin starts a transaction on the configured db connection.
+func (c *baseClient) begin(ctx context.Context) (*sql.Tx, error) {
+	if c.tx != nil {
+		return nil, errors.New("a transaction is already in progress")
+	}
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+	tx, err := c.db.BeginTx(ctx, nil)
+	return tx, redactError(err)
+}
+
+// PersistActionSql generates SQL to record a migration action. With
+// Config.AuditHistory, undo sets undone_at on the version's row instead of
+// deleting it, and do replaces a row left behind by an earlier undo. With
+// Config.CaptureEnv, do also records the deploy metadata.
 func (c *baseClient) PersistActionSql(m Migration) string {
+	return c.persistAction(m, c.values(false))
+}
+
+// PersistActionArgs is PersistActionSql with the values as arguments.
+func (c *baseClient) PersistActionArgs(m Migration) (string, []any) {
+	v := c.values(true)
+	query := c.persistAction(m, v)
+	return query, v.args
+}
+
+func (c *baseClient) persistAction(m Migration, v *sqlValues) string {
 	action := strings.ToLower(m.Action)
-	if action == "do" {
-		runAt := time.Now().UTC().Format("2006-01-02 15:04:05")
+	var runAt, metadataColumn, metadataValue, metadataUpdate string
+	if action == "do" || action == "undo" && c.cfg.AuditHistory {
+		runAt = v.time(c.cfg.now())
+	}
+	if action == "do" && len(c.cfg.CaptureEnv) > 0 {
+		metadataColumn = ", metadata"
+		metadataValue = ", " + v.text(captureMetadata(c.cfg.CaptureEnv))
+		metadataUpdate = ", metadata = excluded.metadata"
+	}
+	if action == "do" && c.cfg.AuditHistory {
+		return fmt.Sprintf(`
+          INSERT INTO %s (version, name, md5, run_at%s)
+          VALUES (%d, %s, %s, %s%s)
+          ON CONFLICT (version) DO UPDATE
+          SET name = excluded.name, md5 = excluded.md5, run_at = excluded.run_at%s, undone_at = NULL;
+        `, c.quotedSchemaTable(), metadataColumn, m.Version, v.text(m.Name), v.text(m.Md5), runAt, metadataValue, metadataUpdate)
+	} else if action == "do" {
 		return fmt.Sprintf(`
-          INSERT INTO %s (version, name, md5, run_at)
-          VALUES (%d, '%s', '%s', '%s');
-        `, c.quotedSchemaTable(), m.Version, m.Name, m.Md5, runAt)
+          INSERT INTO %s (version, name, md5, run_at%s)
+          VALUES (%d, %s, %s, %s%s);
+        `, c.quotedSchemaTable(), metadataColumn, m.Version, v.text(m.Name), v.text(m.Md5), runAt, metadataValue)
+	} else if action == "undo" && c.cfg.AuditHistory {
+		return fmt.Sprintf(`
+          UPDATE %s
+          SET undone_at = %s
+          WHERE version = %d;
+        `, c.quotedSchemaTable(), runAt, m.Version)
 	} else if action == "undo" {
 		return fmt.Sprintf(`
           DELETE FROM %s
@@ -92,14 +334,59 @@ func (c *baseClient) GetMd5Sql(m Migration) string {
     `, c.quotedSchemaTable(), m.Version)
 }
 
-// GetDatabaseVersionSql returns SQL to fetch the highest applied migration version.
+// GetAppliedSql returns SQL to fetch every recorded migration, excluding the
+// seeded version 0 row. The metadata column is only read with
+// Config.CaptureEnv.
+func (c *baseClient) GetAppliedSql() string {
+	return c.GetAppliedColumnsSql(map[string]bool{"name": true, "md5": true, "run_at": true, "metadata": len(c.cfg.CaptureEnv) > 0})
+}
+
+// GetAppliedColumnsSql is like GetAppliedSql for a schema table that only has
+// the given columns, selecting NULL for any of name, md5, run_at and metadata
+// that the table lacks, so it can be read without altering it. Rows marked
+// undone in audit mode are left out.
+func (c *baseClient) GetAppliedColumnsSql(columns map[string]bool) string {
+	selected := []string{"version"}
+	for _, column := range []string{"name", "md5", "run_at", "metadata"} {
+		if columns[column] {
+			selected = append(selected, column)
+		} else {
+			selected = append(selected, "NULL")
+		}
+	}
+	return fmt.Sprintf(`
+      SELECT %s
+      FROM %s
+      WHERE version > 0%s
+      ORDER BY version;
+    `, strings.Join(selected, ", "), c.quotedSchemaTable(), notUndone(columns))
+}
+
+// notUndone returns the condition excluding rows marked undone, if the
+// schema table has an undone_at column.
+func notUndone(columns map[string]bool) string {
+	if columns["undone_at"] {
+		return " AND undone_at IS NULL"
+	}
+	return ""
+}
+
+// GetDatabaseVersionSql returns SQL to fetch the highest applied migration
+// version. Undone migrations are ignored, and an empty table, for example one
+// whose seeded version 0 row was deleted by hand, yields 0.
 func (c *baseClient) GetDatabaseVersionSql() string {
+	return c.GetDatabaseVersionColumnsSql(map[string]bool{"undone_at": c.cfg.AuditHistory})
+}
+
+// GetDatabaseVersionColumnsSql is like GetDatabaseVersionSql for a schema
+// table with the given columns, ignoring rows marked undone if it has an
+// undone_at column.
+func (c *baseClient) GetDatabaseVersionColumnsSql(columns map[string]bool) string {
 	return fmt.Sprintf(`
-      SELECT version
+      SELECT COALESCE(MAX(version), 0)
       FROM %s
-      ORDER BY version DESC
-      LIMIT 1;
-    `, c.quotedSchemaTable())
+      WHERE version > 0%s;
+    `, c.quotedSchemaTable(), notUndone(columns))
 }
 
 // HasVersionTable checks for the existence of the migration table.
@@ -117,12 +404,13 @@ func (c *baseClient) HasVersionTable(ctx context.Context) (bool, error) {
 	return false, nil
 }
 
-// EnsureTable creates the migration table if it does not exist and adds missing columns.
-func (c *baseClient) EnsureTable(ctx context.Context) error {
+// SchemaColumns returns the lowercased column names of the migration table,
+// or none if it does not exist. It only reads the catalog.
+func (c *baseClient) SchemaColumns(ctx context.Context) (map[string]bool, error) {
 	query := c.getColumnsSqlFn()
 	rows, err := c.QueryContext(ctx, query)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -130,10 +418,55 @@ func (c *baseClient) EnsureTable(ctx context.Context) error {
 	for rows.Next() {
 		var colName string
 		if err := rows.Scan(&colName); err != nil {
-			return err
+			return nil, err
 		}
 		columns[strings.ToLower(colName)] = true
 	}
+	return columns, rows.Err()
+}
+
+// EnsureTable creates the migration table if it does not exist and adds
+// missing columns. With Config.AutoUpgradeSchemaTable set to false, an
+// existing table missing columns is an error instead; see UpgradeTable.
+func (c *baseClient) EnsureTable(ctx context.Context) error {
+	return c.ensureTable(ctx, c.cfg.AutoUpgradeSchemaTable == nil || *c.cfg.AutoUpgradeSchemaTable)
+}
+
+// UpgradeTable creates the migration table if it does not exist and adds
+// missing columns, regardless of Config.AutoUpgradeSchemaTable.
+func (c *baseClient) UpgradeTable(ctx context.Context) error {
+	return c.ensureTable(ctx, true)
+}
+
+// ensureTable creates the migration table if it does not exist. Missing
+// columns of an existing table are added if upgrade is set and reported as an
+// error otherwise. Upgrading also converts timestamp columns without a time
+// zone on PostgreSQL to TIMESTAMP WITH TIME ZONE, reading them as UTC, and
+// creates the index on run_at that status and history queries sort by if a
+// table from an older version lacks it.
+func (c *baseClient) ensureTable(ctx context.Context, upgrade bool) error {
+	columns, err := c.SchemaColumns(ctx)
+	if err != nil {
+		return err
+	}
+	required := []string{"name", "md5", "run_at"}
+	if c.cfg.AuditHistory {
+		required = append(required, "undone_at")
+	}
+	if len(c.cfg.CaptureEnv) > 0 {
+		required = append(required, "metadata")
+	}
+	if len(columns) > 0 && !upgrade {
+		var missing []string
+		for _, column := range required {
+			if !columns[column] {
+				missing = append(missing, column)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("schema table %s is missing columns %s and automatic upgrades are disabled; upgrade it with UpgradeSchemaTable or the upgrade-schema-table command", c.cfg.SchemaTable, strings.Join(missing, ", "))
+		}
+	}
 	var sqls []string
 	if len(columns) == 0 {
 		colType := "BIGINT"
@@ -142,12 +475,12 @@ func (c *baseClient) EnsureTable(ctx context.Context) error {
 		} else if strings.ToLower(c.cfg.Driver) == "pg" {
 			parts := strings.Split(c.cfg.SchemaTable, ".")
 			if len(parts) > 1 {
-				sqls = append(sqls, fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS "%s";`, parts[0]))
+				sqls = append(sqls, fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS %s;`, quoteIdentifier(parts[0])))
 			}
 		}
 		sqls = append(sqls, fmt.Sprintf(`
           CREATE TABLE %s (
-            version %s PRIMARY KEY
+            version %s NOT NULL PRIMARY KEY
           );
         `, c.quotedSchemaTable(), colType))
 		sqls = append(sqls, fmt.Sprintf(`
@@ -164,6 +497,44 @@ func (c *baseClient) EnsureTable(ctx context.Context) error {
 	if !columns["run_at"] {
 		sqls = append(sqls, c.getAddRunAtSqlFn())
 	}
+	if c.cfg.AuditHistory && !columns["undone_at"] {
+		sqls = append(sqls, fmt.Sprintf(`
+          ALTER TABLE %s
+          ADD COLUMN undone_at TIMESTAMP WITH TIME ZONE;
+        `, c.quotedSchemaTable()))
+	}
+	if len(c.cfg.CaptureEnv) > 0 && !columns["metadata"] {
+		metadataType := "TEXT"
+		if strings.ToLower(c.cfg.Driver) == "pg" {
+			metadataType = "JSONB"
+		}
+		sqls = append(sqls, fmt.Sprintf(`
+          ALTER TABLE %s
+          ADD COLUMN metadata %s;
+        `, c.quotedSchemaTable(), metadataType))
+	}
+	indexed := false
+	if len(columns) > 0 && upgrade {
+		zoneless, err := c.zonelessColumns(ctx)
+		if err != nil {
+			return err
+		}
+		for _, column := range zoneless {
+			sqls = append(sqls, fmt.Sprintf(`
+          ALTER TABLE %s
+          ALTER COLUMN %s TYPE TIMESTAMP WITH TIME ZONE USING %s AT TIME ZONE 'UTC';
+        `, c.quotedSchemaTable(), quoteIdentifier(column), quoteIdentifier(column)))
+		}
+		if indexed, err = c.hasRunAtIndex(ctx); err != nil {
+			return err
+		}
+	}
+	if (len(columns) == 0 || upgrade) && !indexed {
+		sqls = append(sqls, fmt.Sprintf(`
+          CREATE INDEX IF NOT EXISTS %s
+          ON %s (run_at);
+        `, quoteIdentifier(c.runAtIndex()), c.quotedSchemaTable()))
+	}
 	for _, sqlStmt := range sqls {
 		if _, err := c.ExecContext(ctx, sqlStmt); err != nil {
 			return err
@@ -171,3 +542,308 @@ func (c *baseClient) EnsureTable(ctx context.Context) error {
 	}
 	return nil
 }
+
+// zonelessColumns returns the timestamp columns of the migration table that
+// lack a time zone, as created by tools or versions that used TIMESTAMP. The
+// times gostgrator wrote to them are in UTC.
+func (c *baseClient) zonelessColumns(ctx context.Context) ([]string, error) {
+	if c.getZonelessColumnsSqlFn == nil {
+		return nil, nil
+	}
+	rows, err := c.QueryContext(ctx, c.getZonelessColumnsSqlFn())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// hasRunAtIndex reports whether the migration table has its index on run_at.
+func (c *baseClient) hasRunAtIndex(ctx context.Context) (bool, error) {
+	if c.getIndexesSqlFn == nil {
+		return true, nil
+	}
+	rows, err := c.QueryContext(ctx, c.getIndexesSqlFn())
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var index string
+		if err := rows.Scan(&index); err != nil {
+			return false, err
+		}
+		if index == c.runAtIndex() {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// EnsureProgressTable creates the per-statement progress table if it does not exist.
+func (c *baseClient) EnsureProgressTable(ctx context.Context) error {
+	colType := "BIGINT"
+	if strings.ToLower(c.cfg.Driver) == "sqlite3" {
+		colType = "INTEGER"
+	}
+	_, err := c.ExecContext(ctx, fmt.Sprintf(`
+      CREATE TABLE IF NOT EXISTS %s (
+        version %s NOT NULL,
+        action TEXT NOT NULL,
+        statement INTEGER NOT NULL,
+        md5 TEXT,
+        run_at TIMESTAMP WITH TIME ZONE,
+        PRIMARY KEY (version, action, statement)
+      );
+    `, c.quotedProgressTable(), colType))
+	return err
+}
+
+// GetProgressSql returns SQL to fetch the statements of a migration that have already run.
+func (c *baseClient) GetProgressSql(m Migration) string {
+	return fmt.Sprintf(`
+      SELECT statement, md5
+      FROM %s
+      WHERE version = %d AND action = %s;
+    `, c.quotedProgressTable(), m.Version, quoteLiteral(c.cfg.Driver, strings.ToLower(m.Action)))
+}
+
+// PersistProgressSql generates SQL to record that a statement of a migration has run.
+func (c *baseClient) PersistProgressSql(m Migration, statement int, md5 string) string {
+	return c.persistProgress(m, statement, md5, c.values(false))
+}
+
+// PersistProgressArgs is PersistProgressSql with the values as arguments.
+func (c *baseClient) PersistProgressArgs(m Migration, statement int, md5 string) (string, []any) {
+	v := c.values(true)
+	query := c.persistProgress(m, statement, md5, v)
+	return query, v.args
+}
+
+func (c *baseClient) persistProgress(m Migration, statement int, md5 string, v *sqlValues) string {
+	return fmt.Sprintf(`
+      INSERT INTO %s (version, action, statement, md5, run_at)
+      VALUES (%d, %s, %d, %s, %s);
+    `, c.quotedProgressTable(), m.Version, v.text(strings.ToLower(m.Action)), statement, v.text(md5), v.time(c.cfg.now()))
+}
+
+// ClearProgressSql generates SQL to forget the statement progress of a completed migration.
+func (c *baseClient) ClearProgressSql(m Migration) string {
+	return fmt.Sprintf(`
+      DELETE FROM %s
+      WHERE version = %d AND action = %s;
+    `, c.quotedProgressTable(), m.Version, quoteLiteral(c.cfg.Driver, strings.ToLower(m.Action)))
+}
+
+// EnsureHistoryTable creates the audit history table if it does not exist.
+func (c *baseClient) EnsureHistoryTable(ctx context.Context) error {
+	idType := "BIGSERIAL PRIMARY KEY"
+	if strings.ToLower(c.cfg.Driver) == "sqlite3" {
+		idType = "INTEGER PRIMARY KEY"
+	}
+	_, err := c.ExecContext(ctx, fmt.Sprintf(`
+      CREATE TABLE IF NOT EXISTS %s (
+        id %s,
+        version BIGINT NOT NULL,
+        action TEXT NOT NULL,
+        name TEXT,
+        md5 TEXT,
+        run_at TIMESTAMP WITH TIME ZONE
+      );
+    `, c.quotedHistoryTable(), idType))
+	return err
+}
+
+// PersistHistorySql generates SQL to append a migration action to the audit
+// history table.
+func (c *baseClient) PersistHistorySql(m Migration) string {
+	return c.persistHistory(m, c.values(false))
+}
+
+// PersistHistoryArgs is PersistHistorySql with the values as arguments.
+func (c *baseClient) PersistHistoryArgs(m Migration) (string, []any) {
+	v := c.values(true)
+	query := c.persistHistory(m, v)
+	return query, v.args
+}
+
+func (c *baseClient) persistHistory(m Migration, v *sqlValues) string {
+	return fmt.Sprintf(`
+      INSERT INTO %s (version, action, name, md5, run_at)
+      VALUES (%d, %s, %s, %s, %s);
+    `, c.quotedHistoryTable(), m.Version, v.text(strings.ToLower(m.Action)), v.text(m.Name), v.text(m.Md5), v.time(c.cfg.now()))
+}
+
+// EnsureLockTable creates the migration lock table if it does not exist. The
+// lock is its single row, with id 1. It is created before the schema table,
+// so it creates the PostgreSQL schema the tables live in as well.
+func (c *baseClient) EnsureLockTable(ctx context.Context) error {
+	if parts := strings.Split(c.cfg.SchemaTable, "."); strings.ToLower(c.cfg.Driver) == "pg" && len(parts) > 1 {
+		if _, err := c.ExecContext(ctx, fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS %s;`, quoteIdentifier(parts[0]))); err != nil {
+			return err
+		}
+	}
+	_, err := c.ExecContext(ctx, fmt.Sprintf(`
+      CREATE TABLE IF NOT EXISTS %s (
+        id INTEGER PRIMARY KEY,
+        holder TEXT NOT NULL,
+        locked_at TIMESTAMP WITH TIME ZONE
+      );
+    `, c.quotedLockTable()))
+	return err
+}
+
+// AcquireLockSql generates SQL that takes the migration lock for holder. It
+// fails with a primary key violation if the lock is already held.
+func (c *baseClient) AcquireLockSql(holder string) string {
+	return c.acquireLock(holder, c.values(false))
+}
+
+// AcquireLockArgs is AcquireLockSql with the values as arguments.
+func (c *baseClient) AcquireLockArgs(holder string) (string, []any) {
+	v := c.values(true)
+	query := c.acquireLock(holder, v)
+	return query, v.args
+}
+
+func (c *baseClient) acquireLock(holder string, v *sqlValues) string {
+	return fmt.Sprintf(`
+      INSERT INTO %s (id, holder, locked_at)
+      VALUES (1, %s, %s);
+    `, c.quotedLockTable(), v.text(holder), v.time(c.cfg.now()))
+}
+
+// GetLockSql returns SQL to fetch the holder of the migration lock and when
+// it was taken.
+func (c *baseClient) GetLockSql() string {
+	return fmt.Sprintf(`
+      SELECT holder, locked_at
+      FROM %s
+      WHERE id = 1;
+    `, c.quotedLockTable())
+}
+
+// ReleaseLockSql generates SQL to release the migration lock held by holder,
+// or by anyone if holder is empty.
+func (c *baseClient) ReleaseLockSql(holder string) string {
+	if holder == "" {
+		return fmt.Sprintf(`
+      DELETE FROM %s;
+    `, c.quotedLockTable())
+	}
+	return fmt.Sprintf(`
+      DELETE FROM %s
+      WHERE holder = %s;
+    `, c.quotedLockTable(), quoteLiteral(c.cfg.Driver, holder))
+}
+
+// EnsureFreezeColumns creates the schema table if it does not exist and adds
+// the frozen_at and frozen_reason columns the freeze is kept in.
+func (c *baseClient) EnsureFreezeColumns(ctx context.Context) error {
+	if err := c.EnsureTable(ctx); err != nil {
+		return err
+	}
+	columns, err := c.SchemaColumns(ctx)
+	if err != nil {
+		return err
+	}
+	for _, column := range []string{"frozen_at TIMESTAMP WITH TIME ZONE", "frozen_reason TEXT"} {
+		name, _, _ := strings.Cut(column, " ")
+		if columns[name] {
+			continue
+		}
+		if _, err := c.ExecContext(ctx, fmt.Sprintf(`
+          ALTER TABLE %s
+          ADD COLUMN %s;
+        `, c.quotedSchemaTable(), column)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FreezeSql generates SQL that freezes migrations with reason, stored on the
+// schema table's version 0 row, which is created if it was deleted.
+func (c *baseClient) FreezeSql(reason string) string {
+	return c.freeze(reason, c.values(false))
+}
+
+// FreezeArgs is FreezeSql with the values as arguments.
+func (c *baseClient) FreezeArgs(reason string) (string, []any) {
+	v := c.values(true)
+	query := c.freeze(reason, v)
+	return query, v.args
+}
+
+func (c *baseClient) freeze(reason string, v *sqlValues) string {
+	return fmt.Sprintf(`
+      INSERT INTO %s (version, frozen_at, frozen_reason)
+      VALUES (0, %s, %s)
+      ON CONFLICT (version) DO UPDATE
+      SET frozen_at = excluded.frozen_at, frozen_reason = excluded.frozen_reason;
+    `, c.quotedSchemaTable(), v.time(c.cfg.now()), v.text(reason))
+}
+
+// GetFreezeSql returns SQL to fetch the reason migrations are frozen and
+// since when, or no rows if they are not frozen.
+func (c *baseClient) GetFreezeSql() string {
+	return fmt.Sprintf(`
+      SELECT frozen_reason, frozen_at
+      FROM %s
+      WHERE version = 0 AND frozen_at IS NOT NULL;
+    `, c.quotedSchemaTable())
+}
+
+// UnfreezeSql generates SQL that lifts a freeze.
+func (c *baseClient) UnfreezeSql() string {
+	return fmt.Sprintf(`
+      UPDATE %s
+      SET frozen_at = NULL, frozen_reason = NULL
+      WHERE version = 0;
+    `, c.quotedSchemaTable())
+}
+
+// tableExists reports whether table exists.
+func (c *baseClient) tableExists(ctx context.Context, table string) (bool, error) {
+	rows, err := c.QueryContext(ctx, c.getTableSqlFn(table))
+	if err != nil {
+		return false, err
+	}
+	exists := rows.Next()
+	return exists, rows.Close()
+}
+
+// GolangMigrateVersion reads the version and dirty flag golang-migrate
+// recorded in Config.GolangMigrateTable, or 0 if the table does not exist or
+// is empty.
+func (c *baseClient) GolangMigrateVersion(ctx context.Context) (int, bool, error) {
+	exists, err := c.tableExists(ctx, c.cfg.GolangMigrateTable)
+	if err != nil || !exists {
+		return 0, false, err
+	}
+	rows, err := c.QueryContext(ctx, fmt.Sprintf(`
+      SELECT version, dirty
+      FROM %s
+      LIMIT 1;
+    `, quoteQualified(c.cfg.GolangMigrateTable)))
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+	var version int
+	var dirty bool
+	if rows.Next() {
+		if err := rows.Scan(&version, &dirty); err != nil {
+			return 0, false, err
+		}
+	}
+	return version, dirty, rows.Err()
+}
@@ -1,9 +1,9 @@
 package gostgrator
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"strings"
 )
 
 // PostgresClient implements the Client interface for PostgreSQL.
@@ -24,25 +24,75 @@ func NewPostgresClient(cfg Config, db *sql.DB) Client {
 	pgClient.getAddNameSqlFn = pgClient.getAddNameSql
 	pgClient.getAddMd5SqlFn = pgClient.getAddMd5Sql
 	pgClient.getAddRunAtSqlFn = pgClient.getAddRunAtSql
+	pgClient.getTableSqlFn = pgClient.getTableSql
+	pgClient.getZonelessColumnsSqlFn = pgClient.getZonelessColumnsSql
+	pgClient.getIndexesSqlFn = pgClient.getIndexesSql
 	return pgClient
 }
 
-func (c *PostgresClient) getColumnsSql() string {
-	var tableCatalogSql string
-	parts := strings.Split(c.cfg.SchemaTable, ".")
-	tableName := parts[0]
-	var schemaSql string
-	if len(parts) > 1 {
-		tableName = parts[1]
-		schemaSql = fmt.Sprintf("AND table_schema = '%s'", parts[0])
+// BeginTx starts a transaction and returns a copy of the client that runs
+// every query in it.
+func (c *PostgresClient) BeginTx(ctx context.Context) (Client, *sql.Tx, error) {
+	tx, err := c.begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	txClient := *c
+	txClient.tx = tx
+	return &txClient, tx, nil
+}
+
+// pgTableFilter returns the WHERE conditions matching table in
+// INFORMATION_SCHEMA. An unqualified name is looked up in current_schema(),
+// the first schema on the search_path and the one an unqualified CREATE TABLE
+// uses, so a table of the same name in another schema is not mistaken for it.
+func pgTableFilter(table string) string {
+	schemaSql := "current_schema()"
+	if schema, name, ok := splitQualified(table); ok {
+		schemaSql = quoteLiteral("pg", schema)
+		table = name
 	}
+	return fmt.Sprintf("table_name = %s\n      AND table_schema = %s", quoteLiteral("pg", table), schemaSql)
+}
+
+func (c *PostgresClient) getColumnsSql() string {
+	return fmt.Sprintf(`
+      SELECT column_name
+      FROM INFORMATION_SCHEMA.COLUMNS
+      WHERE %s;
+    `, pgTableFilter(c.cfg.SchemaTable))
+}
+
+func (c *PostgresClient) getZonelessColumnsSql() string {
 	return fmt.Sprintf(`
       SELECT column_name
       FROM INFORMATION_SCHEMA.COLUMNS
-      WHERE table_name = '%s'
-      %s
-      %s;
-    `, tableName, tableCatalogSql, schemaSql)
+      WHERE %s
+      AND data_type = 'timestamp without time zone';
+    `, pgTableFilter(c.cfg.SchemaTable))
+}
+
+func (c *PostgresClient) getIndexesSql() string {
+	schemaSql := "current_schema()"
+	table := c.cfg.SchemaTable
+	if schema, name, ok := splitQualified(table); ok {
+		schemaSql = quoteLiteral("pg", schema)
+		table = name
+	}
+	return fmt.Sprintf(`
+      SELECT indexname
+      FROM pg_indexes
+      WHERE tablename = %s
+      AND schemaname = %s;
+    `, quoteLiteral("pg", table), schemaSql)
+}
+
+func (c *PostgresClient) getTableSql(table string) string {
+	return fmt.Sprintf(`
+      SELECT table_name
+      FROM INFORMATION_SCHEMA.TABLES
+      WHERE %s;
+    `, pgTableFilter(table))
 }
 
 func (c *PostgresClient) getAddNameSql() string {
@@ -65,3 +115,17 @@ func (c *PostgresClient) getAddRunAtSql() string {
       ADD COLUMN run_at TIMESTAMP WITH TIME ZONE;
     `, c.quotedSchemaTable())
 }
+
+// DropTableSql returns SQL to drop the migration table.
+func (c *PostgresClient) DropTableSql(opts DropOptions) string {
+	var ifExists, cascade string
+	if opts.IfExists {
+		ifExists = "IF EXISTS "
+	}
+	if opts.Cascade {
+		cascade = " CASCADE"
+	}
+	return fmt.Sprintf(`
+      DROP TABLE %s%s%s;
+    `, ifExists, c.quotedSchemaTable(), cascade)
+}
@@ -1,6 +1,7 @@
 package gostgrator
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 )
@@ -23,14 +24,43 @@ func NewSqlite3Client(cfg Config, db *sql.DB) Client {
 	sqliteClient.getAddNameSqlFn = sqliteClient.getAddNameSql
 	sqliteClient.getAddMd5SqlFn = sqliteClient.getAddMd5Sql
 	sqliteClient.getAddRunAtSqlFn = sqliteClient.getAddRunAtSql
+	sqliteClient.getTableSqlFn = sqliteClient.getTableSql
+	sqliteClient.getIndexesSqlFn = sqliteClient.getIndexesSql
 	return sqliteClient
 }
 
+// BeginTx starts a transaction and returns a copy of the client that runs
+// every query in it.
+func (c *Sqlite3Client) BeginTx(ctx context.Context) (Client, *sql.Tx, error) {
+	tx, err := c.begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	txClient := *c
+	txClient.tx = tx
+	return &txClient, tx, nil
+}
+
 func (c *Sqlite3Client) getColumnsSql() string {
 	return fmt.Sprintf(`
       SELECT name AS column_name
-      FROM pragma_table_info('%s');
-    `, c.cfg.SchemaTable)
+      FROM pragma_table_info(%s);
+    `, quoteLiteral("sqlite3", c.cfg.SchemaTable))
+}
+
+func (c *Sqlite3Client) getIndexesSql() string {
+	return fmt.Sprintf(`
+      SELECT name
+      FROM pragma_index_list(%s);
+    `, quoteLiteral("sqlite3", c.cfg.SchemaTable))
+}
+
+func (c *Sqlite3Client) getTableSql(table string) string {
+	return fmt.Sprintf(`
+      SELECT name
+      FROM sqlite_master
+      WHERE type = 'table' AND name = %s;
+    `, quoteLiteral("sqlite3", table))
 }
 
 func (c *Sqlite3Client) getAddNameSql() string {
@@ -53,3 +83,15 @@ func (c *Sqlite3Client) getAddRunAtSql() string {
       ADD COLUMN run_at TIMESTAMP WITH TIME ZONE;
     `, c.quotedSchemaTable())
 }
+
+// DropTableSql returns SQL to drop the migration table.
+// SQLite has no CASCADE clause, so opts.Cascade is ignored.
+func (c *Sqlite3Client) DropTableSql(opts DropOptions) string {
+	var ifExists string
+	if opts.IfExists {
+		ifExists = "IF EXISTS "
+	}
+	return fmt.Sprintf(`
+      DROP TABLE %s%s;
+    `, ifExists, c.quotedSchemaTable())
+}
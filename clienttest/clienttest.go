@@ -0,0 +1,467 @@
+// Package clienttest provides a conformance suite for gostgrator Client
+// implementations, such as third-party drivers added with
+// gostgrator.RegisterClient.
+package clienttest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// conformanceMigrations are portable migrations every driver must run.
+func conformanceMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"001.do.a.sql":   {Data: []byte("CREATE TABLE conformance_a (id INTEGER);\n")},
+		"001.undo.a.sql": {Data: []byte("DROP TABLE conformance_a;\n")},
+		"002.do.b.sql":   {Data: []byte("CREATE TABLE conformance_b (id INTEGER);\n")},
+		"002.undo.b.sql": {Data: []byte("DROP TABLE conformance_b;\n")},
+		"003.do.c.sql":   {Data: []byte("CREATE TABLE conformance_c (id INTEGER);\n")},
+		"003.undo.c.sql": {Data: []byte("DROP TABLE conformance_c;\n")},
+	}
+}
+
+// RunConformance runs the conformance suite against the Client for driver, a
+// Config.Driver name such as one added with gostgrator.RegisterClient. open
+// must return a connection to a new, empty database each time it is called;
+// every subtest calls it once.
+//
+// The suite checks the client itself, creating the schema table, persisting
+// and reading back versions and checksums, transactions and table and
+// migration names that need quoting, and then migrations end to end through
+// a Gostgrator: migrating up and down, checksum validation, transaction
+// modes, the migration lock, audit history, and migrators racing to apply the
+// same migrations over separate connections. A new Client implementation can
+// be validated with:
+//
+//	func TestConformance(t *testing.T) {
+//		clienttest.RunConformance(t, "mydriver", openEmptyDatabase)
+//	}
+func RunConformance(t *testing.T, driver string, open func(t *testing.T) *sql.DB) {
+	newClient := func(t *testing.T, cfg gostgrator.Config) gostgrator.Client {
+		t.Helper()
+		cfg.Driver = driver
+		client, err := gostgrator.NewClient(cfg, open(t))
+		if err != nil {
+			t.Fatalf("NewClient failed: %v", err)
+		}
+		return client
+	}
+	config := func(schemaTable string) gostgrator.Config {
+		return gostgrator.Config{SchemaTable: schemaTable, ValidateChecksums: true}
+	}
+	newGostgrator := func(t *testing.T, db *sql.DB, cfg gostgrator.Config) *gostgrator.Gostgrator {
+		t.Helper()
+		cfg.Driver = driver
+		if cfg.FS == nil {
+			cfg.FS = conformanceMigrations()
+		}
+		cfg.MigrationPattern = "*.sql"
+		g, err := gostgrator.NewGostgrator(cfg, db)
+		if err != nil {
+			t.Fatalf("NewGostgrator failed: %v", err)
+		}
+		return g
+	}
+	wantDatabaseVersion := func(t *testing.T, g *gostgrator.Gostgrator, want int) {
+		t.Helper()
+		if version, err := g.GetDatabaseVersion(context.Background()); err != nil || version != want {
+			t.Fatalf("expected version %d, got %d (%v)", want, version, err)
+		}
+	}
+
+	t.Run("EnsureTable", func(t *testing.T) {
+		ctx := context.Background()
+		c := newClient(t, config("schemaversion"))
+		if exists, err := c.HasVersionTable(ctx); err != nil || exists {
+			t.Fatalf("expected no schema table in an empty database, got %v (%v)", exists, err)
+		}
+		for i := range 2 {
+			if err := c.EnsureTable(ctx); err != nil {
+				t.Fatalf("EnsureTable call %d failed: %v", i+1, err)
+			}
+		}
+		if exists, err := c.HasVersionTable(ctx); err != nil || !exists {
+			t.Fatalf("expected the schema table after EnsureTable, got %v (%v)", exists, err)
+		}
+		columns, err := c.SchemaColumns(ctx)
+		if err != nil {
+			t.Fatalf("SchemaColumns failed: %v", err)
+		}
+		for _, column := range []string{"version", "name", "md5", "run_at"} {
+			if !columns[column] {
+				t.Errorf("expected schema table column %s, got %v", column, columns)
+			}
+		}
+		wantVersion(t, c, 0)
+	})
+
+	t.Run("VersionPersistence", func(t *testing.T) {
+		ctx := context.Background()
+		c := newClient(t, config("schemaversion"))
+		ensureTable(t, c)
+		for _, version := range []int{1, 3} {
+			persist(t, c, gostgrator.Migration{Version: version, Action: "do", Name: fmt.Sprintf("m%d", version)})
+		}
+		wantVersion(t, c, 3)
+		rows, err := c.QueryContext(ctx, c.GetAppliedSql())
+		if err != nil {
+			t.Fatalf("GetAppliedSql failed: %v", err)
+		}
+		defer rows.Close()
+		var versions []int
+		for rows.Next() {
+			var version int
+			var name, md5, runAt, metadata any
+			if err := rows.Scan(&version, &name, &md5, &runAt, &metadata); err != nil {
+				t.Fatalf("failed to scan applied migration: %v", err)
+			}
+			if runAt == nil {
+				t.Errorf("expected run_at to be recorded for version %d", version)
+			}
+			versions = append(versions, version)
+		}
+		if err := rows.Err(); err != nil || fmt.Sprint(versions) != "[1 3]" {
+			t.Fatalf("expected applied versions [1 3] in order, got %v (%v)", versions, err)
+		}
+		persist(t, c, gostgrator.Migration{Version: 3, Action: "undo"})
+		wantVersion(t, c, 1)
+	})
+
+	t.Run("Md5", func(t *testing.T) {
+		m := gostgrator.Migration{Version: 1, Action: "do", Name: "checksum", Md5: "0cc175b9c0f1b6a831c399e269772661"}
+		c := newClient(t, config("schemaversion"))
+		ensureTable(t, c)
+		persist(t, c, m)
+		if got := queryString(t, c, c.GetMd5Sql(m)); got != m.Md5 {
+			t.Errorf("expected md5 %s, got %q", m.Md5, got)
+		}
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		ctx := context.Background()
+		c := newClient(t, config("schemaversion"))
+		ensureTable(t, c)
+		txClient, tx, err := c.BeginTx(ctx)
+		if err != nil {
+			t.Fatalf("BeginTx failed: %v", err)
+		}
+		persist(t, txClient, gostgrator.Migration{Version: 1, Action: "do"})
+		wantVersion(t, txClient, 1)
+		if err := tx.Rollback(); err != nil {
+			t.Fatalf("Rollback failed: %v", err)
+		}
+		wantVersion(t, c, 0)
+	})
+
+	t.Run("Freeze", func(t *testing.T) {
+		ctx := context.Background()
+		c := newClient(t, config("schemaversion"))
+		f, ok := c.(gostgrator.Freezer)
+		if !ok {
+			t.Skip("the client does not implement gostgrator.Freezer")
+		}
+		if err := f.EnsureFreezeColumns(ctx); err != nil {
+			t.Fatalf("EnsureFreezeColumns failed: %v", err)
+		}
+		if got := queryString(t, c, f.GetFreezeSql()); got != "" {
+			t.Fatalf("expected no freeze, got %q", got)
+		}
+		if _, err := c.ExecContext(ctx, f.FreezeSql("it's an incident")); err != nil {
+			t.Fatalf("FreezeSql failed: %v", err)
+		}
+		if got := queryString(t, c, f.GetFreezeSql()); got != "it's an incident" {
+			t.Errorf("expected the freeze reason, got %q", got)
+		}
+		wantVersion(t, c, 0)
+		if _, err := c.ExecContext(ctx, f.UnfreezeSql()); err != nil {
+			t.Fatalf("UnfreezeSql failed: %v", err)
+		}
+		if got := queryString(t, c, f.GetFreezeSql()); got != "" {
+			t.Errorf("expected the freeze to be lifted, got %q", got)
+		}
+	})
+
+	t.Run("Quoting", func(t *testing.T) {
+		for _, table := range []string{"SchemaVersion", "order", "schema version", `odd"name`, "it's"} {
+			t.Run(table, func(t *testing.T) {
+				ctx := context.Background()
+				c := newClient(t, config(table))
+				ensureTable(t, c)
+				m := gostgrator.Migration{Version: 1, Action: "do", Name: "o'brien", Md5: "abc"}
+				persist(t, c, m)
+				wantVersion(t, c, 1)
+				if got := queryString(t, c, c.GetMd5Sql(m)); got != "abc" {
+					t.Errorf("expected md5 abc, got %q", got)
+				}
+				if err := c.EnsureLockTable(ctx); err != nil {
+					t.Fatalf("EnsureLockTable failed: %v", err)
+				}
+				if _, err := c.ExecContext(ctx, c.AcquireLockSql("host:1'2")); err != nil {
+					t.Fatalf("AcquireLockSql failed: %v", err)
+				}
+				if ac, ok := c.(gostgrator.ArgsClient); ok {
+					m := gostgrator.Migration{Version: 2, Action: "do", Name: `back\slash`, Md5: `it's\`}
+					query, args := ac.PersistActionArgs(m)
+					if _, err := ac.ExecArgsContext(ctx, query, args...); err != nil {
+						t.Fatalf("PersistActionArgs failed: %v", err)
+					}
+					if got := queryString(t, c, c.GetMd5Sql(m)); got != m.Md5 {
+						t.Errorf("expected md5 %q, got %q", m.Md5, got)
+					}
+				}
+				if _, err := c.ExecContext(ctx, c.DropTableSql(gostgrator.DropOptions{})); err != nil {
+					t.Fatalf("DropTableSql failed: %v", err)
+				}
+				if exists, err := c.HasVersionTable(ctx); err != nil || exists {
+					t.Errorf("expected the schema table to be dropped, got %v (%v)", exists, err)
+				}
+			})
+		}
+	})
+
+	t.Run("MigrateAndDown", func(t *testing.T) {
+		ctx := context.Background()
+		g := newGostgrator(t, open(t), gostgrator.Config{})
+		wantDatabaseVersion(t, g, 0)
+		applied, err := g.Migrate(ctx, "max")
+		if err != nil || len(applied) != 3 {
+			t.Fatalf("expected 3 migrations to apply, got %d (%v)", len(applied), err)
+		}
+		wantDatabaseVersion(t, g, 3)
+		recorded, err := g.GetAppliedMigrations(ctx)
+		if err != nil || len(recorded) != 3 {
+			t.Fatalf("expected 3 applied migrations, got %d (%v)", len(recorded), err)
+		}
+		if _, err := g.Down(ctx, 1); err != nil {
+			t.Fatalf("Down failed: %v", err)
+		}
+		wantDatabaseVersion(t, g, 2)
+		if _, err := g.Migrate(ctx, "0"); err != nil {
+			t.Fatalf("Migrate to 0 failed: %v", err)
+		}
+		wantDatabaseVersion(t, g, 0)
+	})
+
+	t.Run("Checksums", func(t *testing.T) {
+		ctx := context.Background()
+		db := open(t)
+		if _, err := newGostgrator(t, db, gostgrator.Config{}).Migrate(ctx, "2"); err != nil {
+			t.Fatalf("Migrate failed: %v", err)
+		}
+		edited := conformanceMigrations()
+		edited["001.do.a.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE conformance_a (id INTEGER, name TEXT);\n")}
+		_, err := newGostgrator(t, db, gostgrator.Config{FS: edited}).Migrate(ctx, "max")
+		if err == nil || !strings.Contains(err.Error(), "MD5 checksum failed") {
+			t.Fatalf("expected a checksum error for an edited migration, got %v", err)
+		}
+	})
+
+	t.Run("TransactionEach", func(t *testing.T) {
+		ctx := context.Background()
+		db := open(t)
+		failing := conformanceMigrations()
+		failing["002.do.b.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE conformance_b (id INTEGER);\nSELECT * FROM conformance_missing;\n")}
+		g := newGostgrator(t, db, gostgrator.Config{FS: failing, Transaction: "each"})
+		_, err := g.Migrate(ctx, "max")
+		var partial *gostgrator.PartialApplyError
+		if !errors.As(err, &partial) || partial.Failed.Version != 2 {
+			t.Fatalf("expected version 2 to fail, got %v", err)
+		}
+		wantDatabaseVersion(t, g, 1)
+		if _, err := db.ExecContext(ctx, "SELECT * FROM conformance_b"); err == nil {
+			t.Error("expected the failed migration's table to be rolled back")
+		}
+	})
+
+	t.Run("Lock", func(t *testing.T) {
+		ctx := context.Background()
+		db := open(t)
+		holder := newGostgrator(t, db, gostgrator.Config{})
+		other := newGostgrator(t, db, gostgrator.Config{})
+		if err := holder.Lock(ctx); err != nil {
+			t.Fatalf("Lock failed: %v", err)
+		}
+		if _, err := other.Migrate(ctx, "max"); !errors.Is(err, gostgrator.ErrLocked) {
+			t.Fatalf("expected ErrLocked while the lock is held, got %v", err)
+		}
+		if err := holder.Unlock(ctx); err != nil {
+			t.Fatalf("Unlock failed: %v", err)
+		}
+		if _, err := other.Migrate(ctx, "max"); err != nil {
+			t.Fatalf("Migrate after Unlock failed: %v", err)
+		}
+	})
+
+	t.Run("AuditHistory", func(t *testing.T) {
+		ctx := context.Background()
+		g := newGostgrator(t, open(t), gostgrator.Config{AuditHistory: true})
+		if _, err := g.Migrate(ctx, "2"); err != nil {
+			t.Fatalf("Migrate failed: %v", err)
+		}
+		if _, err := g.Down(ctx, 1); err != nil {
+			t.Fatalf("Down failed: %v", err)
+		}
+		wantDatabaseVersion(t, g, 1)
+		if _, err := g.Migrate(ctx, "max"); err != nil {
+			t.Fatalf("Migrate after Down failed: %v", err)
+		}
+		recorded, err := g.GetAppliedMigrations(ctx)
+		if err != nil || len(recorded) != 3 {
+			t.Fatalf("expected 3 applied migrations, got %d (%v)", len(recorded), err)
+		}
+	})
+
+	t.Run("SchemaTable", func(t *testing.T) {
+		ctx := context.Background()
+		g := newGostgrator(t, open(t), gostgrator.Config{})
+		if err := g.EnsureSchemaTable(ctx); err != nil {
+			t.Fatalf("EnsureSchemaTable failed: %v", err)
+		}
+		if err := g.EnsureSchemaTable(ctx); err != nil {
+			t.Fatalf("EnsureSchemaTable is not idempotent: %v", err)
+		}
+		if err := g.DropSchemaTable(ctx); err != nil {
+			t.Fatalf("DropSchemaTable failed: %v", err)
+		}
+		wantDatabaseVersion(t, g, 0)
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		ctx := context.Background()
+		db := open(t)
+		// Create the schema and lock tables first, as a deploy's first run
+		// would, since concurrent CREATE TABLE IF NOT EXISTS statements can
+		// conflict in PostgreSQL's catalog.
+		setup := newGostgrator(t, db, gostgrator.Config{})
+		if err := setup.EnsureSchemaTable(ctx); err != nil {
+			t.Fatalf("EnsureSchemaTable failed: %v", err)
+		}
+		if err := setup.Lock(ctx); err != nil {
+			t.Fatalf("Lock failed: %v", err)
+		}
+		if err := setup.Unlock(ctx); err != nil {
+			t.Fatalf("Unlock failed: %v", err)
+		}
+
+		// Each migrator writes the schema table over its own connections
+		// from db's pool, all starting at once.
+		const workers = 8
+		migrators := make([]*gostgrator.Gostgrator, workers)
+		for i := range migrators {
+			migrators[i] = newGostgrator(t, db, gostgrator.Config{})
+		}
+		applied := make([][]gostgrator.Migration, workers)
+		errs := make([]error, workers)
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for i, g := range migrators {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				applied[i], errs[i] = g.Migrate(ctx, "max")
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		total := 0
+		for i, err := range errs {
+			if err != nil && !errors.Is(err, gostgrator.ErrLocked) {
+				t.Errorf("migrator %d failed: %v", i, err)
+			}
+			total += len(applied[i])
+		}
+		if total != 3 {
+			t.Errorf("expected the migrators to apply 3 migrations between them, got %d", total)
+		}
+		recorded, err := setup.GetAppliedMigrations(ctx)
+		if err != nil {
+			t.Fatalf("GetAppliedMigrations failed: %v", err)
+		}
+		var versions []int
+		for _, a := range recorded {
+			versions = append(versions, a.Version)
+		}
+		if fmt.Sprint(versions) != "[1 2 3]" {
+			t.Errorf("expected each version recorded once, got %v", versions)
+		}
+		if err := setup.Lock(ctx); err != nil {
+			t.Errorf("expected the lock to be released, got %v", err)
+		}
+	})
+}
+
+// ensureTable creates the schema table or fails the test.
+func ensureTable(t *testing.T, c gostgrator.Client) {
+	t.Helper()
+	if err := c.EnsureTable(context.Background()); err != nil {
+		t.Fatalf("EnsureTable failed: %v", err)
+	}
+}
+
+// persist records migration m or fails the test.
+func persist(t *testing.T, c gostgrator.Client, m gostgrator.Migration) {
+	t.Helper()
+	if _, err := c.ExecContext(context.Background(), c.PersistActionSql(m)); err != nil {
+		t.Fatalf("PersistActionSql(%d %s) failed: %v", m.Version, m.Action, err)
+	}
+}
+
+// wantVersion fails the test unless the client reports version want.
+func wantVersion(t *testing.T, c gostgrator.Client, want int) {
+	t.Helper()
+	rows, err := c.QueryContext(context.Background(), c.GetDatabaseVersionSql())
+	if err != nil {
+		t.Fatalf("GetDatabaseVersionSql failed: %v", err)
+	}
+	defer rows.Close()
+	var version int
+	if rows.Next() {
+		if err := rows.Scan(&version); err != nil {
+			t.Fatalf("failed to scan the database version: %v", err)
+		}
+	}
+	if err := rows.Err(); err != nil || version != want {
+		t.Fatalf("expected version %d, got %d (%v)", want, version, err)
+	}
+}
+
+// queryString returns the first column of the first row query returns as a
+// string, or "" if it returns no rows.
+func queryString(t *testing.T, c gostgrator.Client, query string) string {
+	t.Helper()
+	rows, err := c.QueryContext(context.Background(), query)
+	if err != nil {
+		t.Fatalf("query failed: %v\n%s", err, query)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		return ""
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("failed to read columns: %v", err)
+	}
+	values := make([]any, len(columns))
+	var s sql.NullString
+	values[0] = &s
+	for i := 1; i < len(values); i++ {
+		values[i] = new(any)
+	}
+	if err := rows.Scan(values...); err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+	return s.String
+}
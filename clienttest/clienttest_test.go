@@ -0,0 +1,52 @@
+package clienttest_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/bcomnes/gostgrator/clienttest"
+	"github.com/bcomnes/gostgrator/gostgratortest"
+	_ "github.com/mattn/go-sqlite3"
+	_ "modernc.org/sqlite"
+)
+
+// TestSqlite3Client runs the conformance suite against Sqlite3Client.
+func TestSqlite3Client(t *testing.T) {
+	clienttest.RunConformance(t, "sqlite3", func(t *testing.T) *sql.DB {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "client.db"))
+		if err != nil {
+			t.Fatalf("failed to open sqlite3 db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+// TestSqlite3ClientModernc runs the conformance suite against Sqlite3Client
+// over the pure Go modernc.org/sqlite driver, with the busy timeout
+// mattn/go-sqlite3 sets by default.
+func TestSqlite3ClientModernc(t *testing.T) {
+	clienttest.RunConformance(t, "sqlite3", func(t *testing.T) *sql.DB {
+		db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "client.db")+"?_pragma=busy_timeout(5000)")
+		if err != nil {
+			t.Fatalf("failed to open sqlite db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+// TestPostgresClient runs the conformance suite against PostgresClient,
+// skipping when no server can be started.
+func TestPostgresClient(t *testing.T) {
+	pg, err := gostgratortest.StartPostgres(context.Background())
+	if err != nil {
+		t.Skipf("no PostgreSQL server available: %v", err)
+	}
+	defer pg.Close()
+	clienttest.RunConformance(t, "pg", func(t *testing.T) *sql.DB {
+		return pg.NewDatabase(t)
+	})
+}
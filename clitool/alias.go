@@ -0,0 +1,93 @@
+package clitool
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// commands are the built-in commands, which aliases cannot replace.
+var commands = []string{
+	"migrate", "down", "reset", "new", "drop-schema", "upgrade-schema-table",
+	"unlock", "freeze", "unfreeze", "list", "explain-version", "export-undo",
+	"lint", "verify", "reconstruct", "drift-check", "exec", "batch", "ui", "fleet-status", "postgrator", "help", "config",
+}
+
+// isCommand reports whether name is a built-in command or one of the Tool's.
+func isCommand(name string) bool {
+	return slices.Contains(commands, name) || slices.ContainsFunc(tool.Commands, func(c Command) bool { return c.Name == name })
+}
+
+// expandAlias replaces a command named in the "aliases" field of the config
+// file at configPath with what it stands for, so a team can share shortcuts
+// like "deploy": ["migrate", "max"]. An alias may name another alias. Flags
+// may appear anywhere in an alias; they are applied before the flags on the
+// command line, which win, and the arguments after the alias are appended to
+// its own. Errors loading the config file are left for the command to report.
+func expandAlias(configPath string) error {
+	args := flag.Args()
+	if configPath == "" || len(args) == 0 || isCommand(args[0]) {
+		return nil
+	}
+	var cfg gostgrator.Config
+	if err := loadConfig(configPath, &cfg); err != nil || len(cfg.Aliases) == 0 {
+		return nil
+	}
+	cmdFlags := os.Args[1 : len(os.Args)-len(args)]
+	var aliasFlags []string
+	seen := make(map[string]bool)
+	for len(args) > 0 && !isCommand(args[0]) {
+		name := args[0]
+		expansion, ok := cfg.Aliases[name]
+		if !ok {
+			break
+		}
+		if seen[name] {
+			return fmt.Errorf("alias %q expands to itself", name)
+		}
+		seen[name] = true
+		if len(expansion) == 0 {
+			return fmt.Errorf("alias %q is empty", name)
+		}
+		flags, rest := splitFlags(expansion)
+		// Flags of an alias override those of the aliases it names.
+		aliasFlags = append(flags, aliasFlags...)
+		args = append(rest, args[1:]...)
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	return flag.CommandLine.Parse(slices.Concat(aliasFlags, cmdFlags, args))
+}
+
+// splitFlags separates the flags in args, with their values, from the other
+// arguments, wherever they appear.
+func splitFlags(args []string) (flags, rest []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			rest = append(rest, arg)
+			continue
+		}
+		flags = append(flags, arg)
+		name := strings.TrimLeft(arg, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if f := flag.Lookup(name); f != nil && !isBoolFlag(f) && i+1 < len(args) {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+	return flags, rest
+}
+
+// isBoolFlag reports whether f is set without a value, like -json.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
@@ -0,0 +1,111 @@
+package clitool
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// githubAnnotations is set by -format github: failures of lint, verify,
+// migrate, down and reset are also printed as GitHub Actions error
+// annotations, so they show up on the migration files in a pull request.
+var githubAnnotations bool
+
+// annotate prints err as an error annotation titled title on each migration
+// file it names, or on none if it names no file. It does nothing without
+// -format github.
+func annotate(g *gostgrator.Gostgrator, title string, err error) {
+	if !githubAnnotations || err == nil {
+		return
+	}
+	var partial *gostgrator.PartialApplyError
+	if errors.As(err, &partial) {
+		annotateFile(partial.Failed.Filename, errorLine(partial.Failed, partial.Err), title, err.Error())
+		return
+	}
+	msg := err.Error()
+	migs, _ := g.GetMigrations()
+	found := false
+	for _, m := range migs {
+		if strings.Contains(msg, m.Filename) || strings.Contains(msg, filepath.Base(m.Filename)) ||
+			m.Action == "do" && strings.Contains(msg, fmt.Sprintf("migration [%d]", m.Version)) {
+			annotateFile(m.Filename, 0, title, msg)
+			found = true
+		}
+	}
+	if !found {
+		annotateFile("", 0, title, msg)
+	}
+}
+
+// annotateFile prints an error annotation on line of file, leaving out
+// whichever is unknown. file is made relative to $GITHUB_WORKSPACE, or the
+// working directory, as GitHub expects.
+func annotateFile(file string, line int, title, message string) {
+	if !githubAnnotations {
+		return
+	}
+	var props []string
+	if file != "" {
+		base := os.Getenv("GITHUB_WORKSPACE")
+		if base == "" {
+			base, _ = os.Getwd()
+		}
+		if abs, err := filepath.Abs(file); err == nil {
+			if rel, err := filepath.Rel(base, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				file = rel
+			}
+		}
+		props = append(props, "file="+escapeProperty(filepath.ToSlash(file)))
+	}
+	if line > 0 {
+		props = append(props, fmt.Sprintf("line=%d", line))
+	}
+	props = append(props, "title="+escapeProperty(title))
+	fmt.Fprintf(stdout, "::error %s::%s\n", strings.Join(props, ","), escapeData(message))
+}
+
+// escapeData escapes an annotation message as GitHub's workflow commands
+// require.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes an annotation property such as a file name.
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// annotationConfig is the configuration the command runs with, used to tell
+// whether an error position can be mapped to a line of the file.
+var annotationConfig gostgrator.Config
+
+// errorLine returns the line of m's file err points at, or 0 when that is
+// unknown. Error positions, from the Tool's ErrorPosition, count from the
+// start of the query, which is the file itself only when it runs as a
+// single batch.
+func errorLine(m gostgrator.Migration, err error) int {
+	if tool.ErrorPosition == nil {
+		return 0
+	}
+	position := tool.ErrorPosition(err)
+	if position <= 0 {
+		return 0
+	}
+	separator := cmp.Or(m.Directives["separator"], annotationConfig.BatchSeparator)
+	if separator != "" && !strings.EqualFold(separator, "none") || annotationConfig.RecordProgress ||
+		cmp.Or(m.Directives["best-effort"], fmt.Sprint(annotationConfig.BestEffort)) == "true" {
+		return 0
+	}
+	content, rerr := os.ReadFile(m.Filename)
+	runes := []rune(string(content))
+	if rerr != nil || position > len(runes) {
+		return 0
+	}
+	return 1 + strings.Count(string(runes[:position-1]), "\n")
+}
@@ -0,0 +1,21 @@
+package clitool
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnnotateFile(t *testing.T) {
+	var out strings.Builder
+	saved := stdout
+	stdout = &lineWriter{w: &out}
+	defer func() { stdout = saved }()
+	githubAnnotations = true
+	defer func() { githubAnnotations = false }()
+	t.Setenv("GITHUB_WORKSPACE", "/work")
+	annotateFile("/work/migrations/001.do.a,b.sql", 3, "gostgrator migrate", "100% broken\nsee: docs")
+	expected := "::error file=migrations/001.do.a%2Cb.sql,line=3,title=gostgrator migrate::100%25 broken%0Asee: docs\n"
+	if out.String() != expected {
+		t.Errorf("got %q, expected %q", out.String(), expected)
+	}
+}
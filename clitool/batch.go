@@ -0,0 +1,143 @@
+package clitool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// batchStep is one command of a batch script.
+type batchStep struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+func (s batchStep) String() string {
+	return strings.Join(append([]string{s.Command}, s.Args...), " ")
+}
+
+// parseBatch reads a batch script from r. It is either one command per line,
+// skipping blank lines and '#' comments, or a JSON array whose elements are
+// command lines ("migrate 12") or objects ({"command": "migrate", "args": ["12"]}).
+// Every step is checked before any of them runs.
+func parseBatch(r io.Reader) ([]batchStep, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var steps []batchStep
+	if text := strings.TrimSpace(string(data)); strings.HasPrefix(text, "[") {
+		var items []json.RawMessage
+		if err := json.Unmarshal([]byte(text), &items); err != nil {
+			return nil, fmt.Errorf("invalid JSON batch: %v", err)
+		}
+		for i, item := range items {
+			var line string
+			if json.Unmarshal(item, &line) == nil {
+				steps = append(steps, parseBatchLine(line))
+				continue
+			}
+			var step batchStep
+			if err := json.Unmarshal(item, &step); err != nil {
+				return nil, fmt.Errorf("invalid batch step %d: %v", i+1, err)
+			}
+			steps = append(steps, step)
+		}
+	} else {
+		for _, line := range strings.Split(text, "\n") {
+			if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			steps = append(steps, parseBatchLine(line))
+		}
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("no batch steps found")
+	}
+	for i, step := range steps {
+		if err := checkBatchStep(step); err != nil {
+			return nil, fmt.Errorf("batch step %d (%s): %v", i+1, step, err)
+		}
+	}
+	return steps, nil
+}
+
+// parseBatchLine splits a command line such as "migrate 12" into a step.
+func parseBatchLine(line string) batchStep {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return batchStep{}
+	}
+	return batchStep{Command: fields[0], Args: fields[1:]}
+}
+
+// checkBatchStep validates a step's command and arguments.
+func checkBatchStep(step batchStep) error {
+	maxArgs := 0
+	switch step.Command {
+	case "migrate":
+		maxArgs = 1
+	case "down":
+		maxArgs = 1
+		if len(step.Args) > 0 {
+			if _, err := strconv.Atoi(step.Args[0]); err != nil {
+				return fmt.Errorf("invalid rollback steps: %s", step.Args[0])
+			}
+		}
+	case "verify", "lint", "version":
+	default:
+		return fmt.Errorf("unknown command %q; batch supports migrate, down, verify, lint and version", step.Command)
+	}
+	if len(step.Args) > maxArgs {
+		return fmt.Errorf("too many arguments")
+	}
+	return nil
+}
+
+// runBatch runs steps in order against one connection, stopping at the first
+// step that fails. Each successful down is followed by the Tool's AfterDrop.
+func runBatch(g *gostgrator.Gostgrator, ctx context.Context, steps []batchStep) error {
+	for i, step := range steps {
+		fmt.Fprintf(stdout, "[%s] Batch step %d/%d: %s\n", time.Now().Format(time.Kitchen), i+1, len(steps), step)
+		var err error
+		switch step.Command {
+		case "migrate":
+			target := "max"
+			if len(step.Args) > 0 {
+				target = step.Args[0]
+			}
+			err = Migrate(g, ctx, target)
+		case "down":
+			n := 1
+			if len(step.Args) > 0 {
+				n, _ = strconv.Atoi(step.Args[0])
+			}
+			if err = runDown(g, ctx, n); err == nil {
+				afterDrop(g, ctx)
+			}
+		case "verify":
+			err = runVerify(g, ctx)
+		case "lint":
+			err = runLint(g)
+		case "version":
+			var current int
+			if current, err = g.GetDatabaseVersion(ctx); err != nil {
+				fmt.Fprintf(stderr, "Error fetching current database version: %v\n", err)
+			} else {
+				fmt.Fprintf(stdout, "Current database migration version: %d\n", current)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Batch stopped at step %d (%s); %d later step(s) were not run.\n", i+1, step, len(steps)-i-1)
+			return err
+		}
+	}
+	fmt.Fprintf(stdout, "[%s] Batch completed %d step(s).\n", time.Now().Format(time.Kitchen), len(steps))
+	return nil
+}
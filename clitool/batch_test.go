@@ -0,0 +1,40 @@
+package clitool
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseBatch verifies line and JSON batch scripts, and that invalid steps
+// are rejected before anything runs.
+func TestParseBatch(t *testing.T) {
+	want := []batchStep{{Command: "migrate", Args: []string{"12"}}, {Command: "verify", Args: []string{}}, {Command: "migrate", Args: []string{"max"}}}
+	for _, script := range []string{
+		"# deploy\nmigrate 12\n\nverify\nmigrate max\n",
+		`["migrate 12", "verify", {"command": "migrate", "args": ["max"]}]`,
+	} {
+		steps, err := parseBatch(strings.NewReader(script))
+		if err != nil {
+			t.Fatalf("unexpected error parsing %q: %v", script, err)
+		}
+		if len(steps) != len(want) {
+			t.Fatalf("expected %d steps, got %v", len(want), steps)
+		}
+		for i := range want {
+			if steps[i].String() != want[i].String() {
+				t.Errorf("step %d: expected %q, got %q", i+1, want[i], steps[i])
+			}
+		}
+	}
+	for script, msg := range map[string]string{
+		"migrate\nnew thing\n": `batch step 2 (new thing): unknown command "new"`,
+		"down two":             "invalid rollback steps: two",
+		"verify now":           "too many arguments",
+		"[1]":                  "invalid batch step 1",
+		"\n# nothing\n":        "no batch steps found",
+	} {
+		if _, err := parseBatch(strings.NewReader(script)); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("expected %q for %q, got %v", msg, script, err)
+		}
+	}
+}
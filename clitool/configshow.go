@@ -0,0 +1,154 @@
+package clitool
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// configSetting is one setting of the effective configuration, as printed by
+// config show.
+type configSetting struct {
+	Key    string `json:"key"`
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+}
+
+// configFlags maps config keys to the flags that set them, beyond the flags
+// whose help text names the key they override.
+var configFlags = map[string][]string{
+	"conn":             {"conn", "conn-file", "conn-env"},
+	"verifyConn":       {"verify-conn"},
+	"secondaryConn":    {"secondary-conn"},
+	"schemaTable":      {"schema-table"},
+	"migrationPattern": {"migration-pattern"},
+	"cacheFile":        {"cache-file"},
+	"recordProgress":   {"record-progress"},
+	"bestEffort":       {"best-effort"},
+	"auditHistory":     {"audit-history"},
+	"webhookURL":       {"webhook-url"},
+}
+
+// configEnv returns a map of config keys to the environment variables that
+// set them.
+func configEnv() map[string]string {
+	return map[string]string{
+		"conn":          tool.ConnEnv,
+		"verifyConn":    tool.VerifyConnEnv,
+		"secondaryConn": tool.SecondaryConnEnv,
+		"webhookURL":    "GOSTGRATOR_WEBHOOK_URL",
+		"webhookSecret": "GOSTGRATOR_WEBHOOK_SECRET",
+	}
+}
+
+// overridesPattern finds the config key a flag's help text says it overrides.
+var overridesPattern = regexp.MustCompile(`overrides "(\w+)" in -config`)
+
+// runConfigShow prints every setting of cliConfig, the configuration after
+// flags, environment variables, the -config file and built-in defaults are
+// merged, with where its value came from. Connection URLs are shown with
+// their credentials redacted and the webhook secret only as set or not.
+// It fails if the configuration is invalid, after printing it.
+func runConfigShow(cliConfig gostgrator.Config, configPath, flagConn, flagVerifyConn, flagSecondaryConn string) error {
+	configEnv := configEnv()
+	cliConfig.Conn = firstNonEmpty(flagConn, getenv(configEnv["conn"]), cliConfig.Conn)
+	cliConfig.VerifyConn = firstNonEmpty(flagVerifyConn, getenv(configEnv["verifyConn"]), cliConfig.VerifyConn)
+	cliConfig.SecondaryConn = firstNonEmpty(flagSecondaryConn, getenv(configEnv["secondaryConn"]), cliConfig.SecondaryConn)
+
+	fileValues := make(map[string]json.RawMessage)
+	var fileConfig gostgrator.Config
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err == nil {
+			err = json.Unmarshal(data, &fileValues)
+		}
+		if err == nil {
+			err = loadConfig(configPath, &fileConfig)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	flagsFor := make(map[string][]string, len(configFlags))
+	for key, names := range configFlags {
+		flagsFor[key] = names
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		if m := overridesPattern.FindStringSubmatch(f.Usage); m != nil {
+			flagsFor[m[1]] = append(flagsFor[m[1]], f.Name)
+		}
+	})
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var settings []configSetting
+	v, defaults, file := reflect.ValueOf(cliConfig), reflect.ValueOf(gostgrator.NewConfig()), reflect.ValueOf(fileConfig)
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		value := v.Field(i).Interface()
+		source := "default"
+		for _, name := range flagsFor[key] {
+			if set[name] {
+				source = "flag -" + name
+			}
+		}
+		if source == "default" && project != nil {
+			switch {
+			case key == "migrationPattern" && value == project.MigrationPattern,
+				key == "schemaTable" && project.SchemaTable != "" && value == project.SchemaTable:
+				source = "project " + project.Name
+			}
+		}
+		if source == "default" {
+			if env := configEnv[key]; env != "" && os.Getenv(env) != "" && os.Getenv(env) == value {
+				source = "env " + env
+			} else if _, ok := fileValues[key]; ok && reflect.DeepEqual(file.Field(i).Interface(), value) {
+				source = "file"
+			}
+		}
+		if source == "default" && v.Field(i).IsZero() {
+			value = defaults.Field(i).Interface()
+		}
+		switch key {
+		case "conn", "verifyConn", "secondaryConn", "webhookURL":
+			value = gostgrator.RedactCredentials(value.(string))
+		case "webhookSecret":
+			value = value != ""
+		}
+		settings = append(settings, configSetting{Key: key, Value: value, Source: source})
+	}
+
+	if jsonOutput {
+		if err := json.NewEncoder(stdout).Encode(settings); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+		for _, s := range settings {
+			value, err := json.Marshal(s.Value)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, value, s.Source)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := cliConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+	return nil
+}
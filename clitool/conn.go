@@ -0,0 +1,69 @@
+package clitool
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// resolveConn follows secret indirection in a connection string so it can be
+// kept out of process arguments: "env://NAME" reads the environment variable
+// NAME and, with the Tool's ConnFiles, "file:///path" reads the file at path.
+// Any other value, such as a SQLite "file:" URI, is returned unchanged.
+func resolveConn(conn string) (string, error) {
+	if name, ok := strings.CutPrefix(conn, "env://"); ok {
+		value := strings.TrimSpace(os.Getenv(name))
+		if value == "" {
+			return "", fmt.Errorf("environment variable %s referenced by the connection is not set", name)
+		}
+		return value, nil
+	}
+	if path, ok := strings.CutPrefix(conn, "file://"); ok && tool.ConnFiles {
+		return readConnFile(path)
+	}
+	return conn, nil
+}
+
+// readConnFile reads a connection string from a secrets file, ignoring
+// surrounding whitespace such as a trailing newline.
+func readConnFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read connection file: %w", err)
+	}
+	conn := strings.TrimSpace(string(data))
+	if conn == "" {
+		return "", fmt.Errorf("connection file %s is empty", path)
+	}
+	return conn, nil
+}
+
+// readConnStdin reads a connection string from the first line of stdin, for
+// "-conn -". It reads a byte at a time and stops at the newline, leaving the
+// rest of stdin to commands that prompt or read a batch from it.
+func readConnStdin() (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read connection from stdin: %w", err)
+		}
+	}
+	conn := strings.TrimSpace(string(line))
+	if conn == "" {
+		return "", errors.New("no connection URL on stdin")
+	}
+	return conn, nil
+}
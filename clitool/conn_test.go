@@ -0,0 +1,45 @@
+package clitool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestResolveConn checks env:// and file:// secret indirection.
+func TestResolveConn(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "db_url")
+	if err := os.WriteFile(secretFile, []byte("postgres://file-host/db\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret file: %v", err)
+	}
+	t.Setenv("GOSTGRATOR_TEST_CONN", "postgres://env-host/db")
+	tool.ConnFiles = true
+	defer func() { tool.ConnFiles = false }()
+
+	cases := map[string]string{
+		"postgres://plain-host/db":   "postgres://plain-host/db",
+		"env://GOSTGRATOR_TEST_CONN": "postgres://env-host/db",
+		"file://" + secretFile:       "postgres://file-host/db",
+	}
+	for conn, expected := range cases {
+		got, err := resolveConn(conn)
+		if err != nil {
+			t.Errorf("resolveConn(%q) failed: %v", conn, err)
+			continue
+		}
+		if got != expected {
+			t.Errorf("resolveConn(%q) = %q, expected %q", conn, got, expected)
+		}
+	}
+
+	if _, err := resolveConn("env://GOSTGRATOR_TEST_UNSET"); err == nil {
+		t.Error("expected an error for an unset environment variable")
+	}
+	if _, err := resolveConn("file://" + filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing secret file")
+	}
+	tool.ConnFiles = false
+	if got, err := resolveConn("file:///app.db"); err != nil || got != "file:///app.db" {
+		t.Errorf("expected a file: URI to be left alone without ConnFiles, got %q (%v)", got, err)
+	}
+}
@@ -0,0 +1,42 @@
+package clitool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// errDrift is returned by runDriftCheck when the database differs from its
+// schema snapshot.
+var errDrift = errors.New("the schema has drifted from its snapshot")
+
+// runDriftCheck compares the database with the schema snapshot taken after
+// the last migrate and lists every difference, as JSON with -json. It
+// returns errDrift if there are any.
+func runDriftCheck(g *gostgrator.Gostgrator, ctx context.Context) error {
+	drift, err := g.DetectDrift(ctx)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return err
+	}
+	if jsonOutput {
+		if err := json.NewEncoder(stdout).Encode(drift); err != nil {
+			return err
+		}
+	} else if len(drift.Differences) == 0 {
+		fmt.Fprintf(stdout, "No drift: the schema matches the snapshot taken at version %d on %s.\n", drift.Version, drift.TakenAt.Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(stdout, "The schema differs from the snapshot taken at version %d on %s:\n", drift.Version, drift.TakenAt.Format(time.RFC3339))
+		for _, d := range drift.Differences {
+			fmt.Fprintf(stdout, "  - %s\n", d)
+		}
+	}
+	if len(drift.Differences) > 0 {
+		return errDrift
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package clitool
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// runExec runs the SQL file at path with ExecFile, under the lock, transaction
+// mode and webhook of migrations, reporting how long it took or the error.
+func runExec(g *gostgrator.Gostgrator, ctx context.Context, path string) error {
+	fmt.Fprintf(stdout, "[%s] Running %s...\n", time.Now().Format(time.Kitchen), path)
+	m, err := g.ExecFile(ctx, path)
+	if err = warnNotify(err); err != nil {
+		fmt.Fprintf(stderr, "Exec error: %v\n", err)
+		annotateFile(path, errorLine(m, err), "gostgrator exec", err.Error())
+		return err
+	}
+	fmt.Fprintf(stdout, "[%s] Ran %s in %s.\n", time.Now().Format(time.Kitchen), path, m.Duration.Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,86 @@
+package clitool
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// printVersionDetails prints everything known about one migration version:
+// its status, files and checksums, directives, recorded metadata and SQL.
+func printVersionDetails(d gostgrator.VersionDetails) {
+	name := ""
+	for _, m := range d.Migrations {
+		if name = m.Name; name != "" {
+			break
+		}
+	}
+	if name == "" && d.Applied != nil {
+		name = d.Applied.Name
+	}
+	fmt.Fprintf(stdout, "Version %d: %s\n", d.Version, name)
+	switch {
+	case d.Applied != nil && d.Applied.RunAt.IsZero():
+		fmt.Fprintf(stdout, "Status: applied (run time not recorded); database version %d\n", d.DatabaseVersion)
+	case d.Applied != nil:
+		fmt.Fprintf(stdout, "Status: applied at %s; database version %d\n", d.Applied.RunAt.Format(time.RFC3339), d.DatabaseVersion)
+	case d.Version <= d.DatabaseVersion:
+		fmt.Fprintf(stdout, "Status: not applied, below database version %d so migrate will not run it\n", d.DatabaseVersion)
+	default:
+		fmt.Fprintf(stdout, "Status: pending; database version %d\n", d.DatabaseVersion)
+	}
+
+	fmt.Fprintln(stdout, "Files:")
+	if len(d.Migrations) == 0 {
+		fmt.Fprintln(stdout, "  (none; the version is only recorded in the schema table)")
+	}
+	for _, m := range d.Migrations {
+		fmt.Fprintf(stdout, "  %-5s %s (md5 %s)\n", m.Action, m.Filename, m.Md5)
+	}
+	if d.Applied != nil {
+		status := "no do file to compare"
+		for _, m := range d.Migrations {
+			if m.Action != "do" {
+				continue
+			}
+			switch {
+			case d.Applied.Md5 == "":
+				status = "not recorded"
+			case d.Applied.Md5 == m.Md5:
+				status = "matches the do file"
+			default:
+				status = "MISMATCH: the do file changed after it was applied"
+			}
+		}
+		fmt.Fprintf(stdout, "Recorded checksum: %s (%s)\n", d.Applied.Md5, status)
+	}
+
+	for _, m := range d.Migrations {
+		if len(m.Directives) > 0 {
+			fmt.Fprintf(stdout, "Directives (%s): %s\n", m.Action, formatPairs(m.Directives))
+		}
+	}
+	if d.Applied != nil && len(d.Applied.Metadata) > 0 {
+		fmt.Fprintf(stdout, "Metadata: %s\n", formatPairs(d.Applied.Metadata))
+	}
+
+	for _, m := range d.Migrations {
+		fmt.Fprintf(stdout, "--- %s (%s)\n%s\n", m.Filename, m.Action, strings.TrimRight(d.SQL[m.Filename], "\n"))
+	}
+}
+
+// formatPairs formats a map as "key=value" pairs sorted by key.
+func formatPairs(pairs map[string]string) string {
+	keys := make([]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = k + "=" + pairs[k]
+	}
+	return strings.Join(keys, ", ")
+}
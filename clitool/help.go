@@ -0,0 +1,301 @@
+package clitool
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+)
+
+// commandHelp is the help of a command: its line in the command list of
+// -help, and the long help printed by "help <command>" and "<command> -help".
+type commandHelp struct {
+	name     string
+	usage    string   // the command and its arguments, e.g. "migrate [target]"
+	summary  string   // the description in the command list
+	details  []string // further lines of the long help (optional)
+	flags    []string // the options that matter to the command, without "-"
+	examples []string // example arguments, after the binary's name
+	exits    []int    // exit codes besides ExitOK, ExitFailure and ExitUsage
+}
+
+// lockExits are the exit codes of commands that take the migration lock and
+// refuse to run while migrations are frozen.
+var lockExits = []int{ExitLocked, ExitFrozen}
+
+// runFlags are the options of every command that runs migrations.
+var runFlags = []string{
+	"checksum-compat", "transaction", "wait-for-lock", "timeout", "warn-after", "env", "ignore-windows", "best-effort",
+	"record-progress", "translate-sql", "verify-signatures", "trusted-keys", "auto-upgrade-schema-table", "audit-history",
+	"snapshot-schema", "emit-schema", "webhook-url", "notify-on", "capture-env", "lock-wait-report", "format", "json",
+}
+
+// builtinHelp is the help of the built-in commands, in the order -help lists
+// them.
+var builtinHelp = []commandHelp{{
+	name:    "migrate",
+	usage:   "migrate [target]",
+	summary: `Migrate the schema to a target version (default: "max").`,
+	details: []string{`The target is a version number or "max" for the latest; a target below the database version rolls back to it.`},
+	flags:   slices.Concat([]string{"to-date", "expect-version", "max-apply", "check-data-loss", "acknowledge-data-loss", "include-tag", "exclude-tag", "allow-out-of-order", "secondary-conn"}, runFlags),
+	examples: []string{
+		"migrate",
+		"migrate 42",
+		"-to-date 2024-06-30 migrate",
+		"-max-apply 1 -wait-for-lock 5m migrate",
+		"-expect-version 41 migrate 43",
+		"-warn-after 2m -timeout 2h migrate",
+	},
+	exits: []int{ExitLocked, ExitFrozen, ExitPending},
+}, {
+	name:     "down",
+	usage:    "down [steps|all]",
+	summary:  "Roll back the specified number of migrations (default: 1), or all of them after confirmation.",
+	details:  []string{"With -dry-run, print the undo migrations, the tables they touch and later migrations that reference them instead.", "With -check-data-loss, refuse to drop tables or columns that hold data unless -acknowledge-data-loss is passed."},
+	flags:    slices.Concat([]string{"dry-run", "check-data-loss", "data-loss-threshold", "acknowledge-data-loss", "yes", "non-interactive"}, runFlags),
+	examples: []string{"down", "down 3", "-dry-run down 3", "-check-data-loss -dry-run down 3", "-check-data-loss -acknowledge-data-loss down", "-yes down all"},
+	exits:    lockExits,
+}, {
+	name:     "reset",
+	usage:    "reset",
+	summary:  "Roll back every migration, then migrate to the latest version, after confirmation.",
+	flags:    slices.Concat([]string{"check-data-loss", "data-loss-threshold", "acknowledge-data-loss", "yes", "non-interactive"}, runFlags),
+	examples: []string{"-yes reset"},
+	exits:    lockExits,
+}, {
+	name:     "new",
+	usage:    "new <desc>",
+	summary:  "Create a new empty migration pair with the provided description.",
+	details:  []string{"No connection is needed."},
+	flags:    []string{"mode", "style", "filename-policy"},
+	examples: []string{"new add-users-table", "-mode timestamp new add-users-table"},
+}, {
+	name:     "drop-schema",
+	usage:    "drop-schema",
+	summary:  "Drop the schema version table and its lock, history, progress and snapshot tables.",
+	flags:    []string{"if-exists", "only-core", "cascade"},
+	examples: []string{"-if-exists drop-schema"},
+}, {
+	name:     "upgrade-schema-table",
+	usage:    "upgrade-schema-table",
+	summary:  "Create the schema version table or add the columns newer versions need.",
+	flags:    []string{"auto-upgrade-schema-table"},
+	examples: []string{"upgrade-schema-table"},
+}, {
+	name:     "unlock",
+	usage:    "unlock",
+	summary:  "Release a migration lock left behind by a process that was killed.",
+	examples: []string{"unlock"},
+}, {
+	name:     "freeze",
+	usage:    "freeze [reason]",
+	summary:  "Make migrate, down and reset fail with exit code 4 until unfreeze runs.",
+	examples: []string{"freeze incident 1234"},
+}, {
+	name:     "unfreeze",
+	usage:    "unfreeze",
+	summary:  "Lift a freeze so migrations can run again.",
+	examples: []string{"unfreeze"},
+}, {
+	name:     "list",
+	usage:    "list",
+	summary:  "List available migrations and annotate the migration matching the database version.",
+	flags:    []string{"pending", "applied", "since", "grep", "order", "versions-only", "verify-conn"},
+	examples: []string{"list", "-pending list", "-applied -order run_at list", "-pending -versions-only list"},
+}, {
+	name:     "explain-version",
+	usage:    "explain-version <v>",
+	summary:  "Print the files, checksums, status, run time, directives, metadata and SQL of one version.",
+	flags:    []string{"verify-conn"},
+	examples: []string{"explain-version 42"},
+}, {
+	name:     "export-undo",
+	usage:    "export-undo",
+	summary:  "Write a script of the undo migrations from -from down to -to, with transactions and schema table updates, for a DBA to run.",
+	details:  []string{"No connection is needed."},
+	flags:    []string{"from", "to", "o"},
+	examples: []string{"-from 42 -to 40 -o rollback.sql export-undo"},
+}, {
+	name:     "lint",
+	usage:    "lint",
+	summary:  "Check migration filenames against the filename policy, and signatures with -verify-signatures.",
+	details:  []string{"No connection is needed."},
+	flags:    []string{"filename-policy", "verify-signatures", "trusted-keys", "format"},
+	examples: []string{"lint", "-format github lint"},
+}, {
+	name:     "verify",
+	usage:    "verify",
+	summary:  "Check filenames, signatures with -verify-signatures, that applied migrations still match their recorded checksums, and that none were skipped below the current version.",
+	flags:    []string{"with-tests", "check-data-loss", "data-loss-threshold", "checksum-compat", "filename-policy", "verify-signatures", "trusted-keys", "verify-conn", "format"},
+	examples: []string{"verify", "-with-tests verify"},
+}, {
+	name:     "reconstruct",
+	usage:    "reconstruct [plan]",
+	summary:  "Propose schema table rows for a lost schema table from the objects the migrations created, then record them after confirmation, or write them to -o for review and record that plan later.",
+	flags:    []string{"o", "yes", "non-interactive"},
+	examples: []string{"reconstruct", "-o plan.json reconstruct", "reconstruct plan.json"},
+	exits:    []int{ExitLocked},
+}, {
+	name:     "drift-check",
+	usage:    "drift-check",
+	summary:  "Compare the database with the schema snapshot taken by migrate with -snapshot-schema and list changes made outside of migrations.",
+	details:  []string{"Exits with code 1 when the database drifted."},
+	flags:    []string{"verify-conn"},
+	examples: []string{"drift-check"},
+}, {
+	name:     "exec",
+	usage:    "exec <file.sql>",
+	summary:  "Run an SQL file with the lock, transaction mode and webhook of migrations, without recording a version.",
+	flags:    []string{"transaction", "wait-for-lock", "timeout", "env", "webhook-url", "notify-on"},
+	examples: []string{"exec scripts/backfill.sql"},
+	exits:    lockExits,
+}, {
+	name:     "batch",
+	usage:    "batch [file]",
+	summary:  "Run commands (migrate, down, verify, lint, version) read from <file> or stdin, one per line or as a JSON array, over one connection.",
+	details:  []string{"Every step is checked before the first one runs, and the batch stops at the first failure."},
+	flags:    slices.Concat([]string{"max-apply"}, runFlags),
+	examples: []string{"batch steps.txt", `batch < steps.txt`},
+	exits:    []int{ExitLocked, ExitFrozen, ExitPending},
+}, {
+	name:     "ui",
+	usage:    "ui",
+	summary:  "Browse, inspect and step through migrations in a full-screen terminal UI.",
+	details:  []string{"Move with the arrow keys, press enter to read the SQL of the selected migration, u to apply the next one, d to roll back the current one and m to migrate to the selected one, one migration at a time with live progress."},
+	flags:    []string{"non-interactive"},
+	examples: []string{"ui"},
+}, {
+	name:     "fleet-status",
+	usage:    "fleet-status <file>",
+	summary:  "Report the version of every database listed in <file> against the latest migration.",
+	details:  []string{"The file lists one connection URL per line; lines starting with # are ignored.", "Exits with code 1 when a database is behind or cannot be reached."},
+	examples: []string{"fleet-status databases.txt"},
+}, {
+	name:    "postgrator",
+	usage:   "postgrator [version] [options]",
+	summary: "Migrate with postgrator-cli's options, as a drop-in replacement while npm scripts are converted.",
+	details: []string{
+		"It must be the first argument; a binary named postgrator, e.g. a symlink, reads its whole command line this way.",
+		"Supported: --to/-t, --driver/-r, --host/-h, --port/-o, --database/-d, --username/-u, --password/-p, --migration-pattern/-m, --schema-table/-s, --ssl, --config/-c (a JSON file), --no-config, --version/-v and --help.",
+		"Checksums are computed as postgrator does, and this binary's own options may be mixed in.",
+	},
+	flags:    []string{"checksum-compat", "conn"},
+	examples: []string{"postgrator --to 5 --database app --username deploy", "postgrator max -c postgrator.json"},
+	exits:    lockExits,
+}, {
+	name:     "help",
+	usage:    "help [command]",
+	summary:  "Show the options, examples and exit codes of a command.",
+	examples: []string{"help migrate", "migrate -help"},
+}, {
+	name:     "config",
+	usage:    "config show",
+	summary:  "Print the effective configuration and whether each value came from a flag, the environment, -config or the defaults.",
+	details:  []string{"Credentials are redacted."},
+	flags:    []string{"json"},
+	examples: []string{"-config gostgrator.json config show", "-json config show"},
+}}
+
+// exitDescriptions describe the exit codes in the long help.
+var exitDescriptions = map[int]string{
+	ExitOK:      "the command succeeded",
+	ExitFailure: "the command ran but failed",
+	ExitUsage:   "invalid flags, arguments or configuration",
+	ExitLocked:  "another process holds the migration lock",
+	ExitFrozen:  "migrations are frozen",
+	ExitPending: "migrate stopped at -max-apply with migrations still pending",
+}
+
+// commandHelps returns the help of the built-in commands and the Tool's, in
+// the order -help lists them: the Tool's come before help and config show.
+func commandHelps() []commandHelp {
+	helps := slices.Clone(builtinHelp)
+	i := slices.IndexFunc(helps, func(h commandHelp) bool { return h.name == "help" })
+	var extra []commandHelp
+	for _, c := range tool.Commands {
+		extra = append(extra, commandHelp{name: c.Name, usage: c.Usage, summary: c.Summary, details: c.Details, flags: c.Flags, examples: c.Examples, exits: c.Exits})
+	}
+	return slices.Insert(helps, i, extra...)
+}
+
+// printCommandList prints the command list of -help.
+func printCommandList() {
+	for _, h := range commandHelps() {
+		if len(h.usage) > 19 {
+			fmt.Fprintf(stderr, "  %s\n  %19s %s\n", h.usage, "", h.summary)
+			continue
+		}
+		fmt.Fprintf(stderr, "  %-19s %s\n", h.usage, h.summary)
+	}
+}
+
+// helpCommand returns the command whose long help the arguments ask for, and
+// whether they ask for help at all: "help [command]", "-help <command>" or
+// "<command> -help". The command is empty when the arguments ask for -help.
+func helpCommand(helpFlag bool, args []string) (string, bool) {
+	switch {
+	case len(args) > 0 && args[0] == "help":
+		if len(args) > 1 {
+			return args[1], true
+		}
+		return "", true
+	case helpFlag:
+		if len(args) > 0 {
+			return args[0], true
+		}
+		return "", true
+	case len(args) > 1 && slices.ContainsFunc(args[1:], func(arg string) bool {
+		return slices.Contains([]string{"-h", "-help", "--h", "--help"}, arg)
+	}):
+		return args[0], true
+	}
+	return "", false
+}
+
+// printCommandHelp prints the long help of the command name: its usage,
+// description, options, examples and exit codes.
+func printCommandHelp(name string) error {
+	helps := commandHelps()
+	i := slices.IndexFunc(helps, func(h commandHelp) bool { return h.name == name })
+	if i < 0 {
+		return fmt.Errorf("unknown command: %s", name)
+	}
+	h := helps[i]
+	if h.name == postgratorCommand {
+		// It reads the whole command line, so no options come before it.
+		fmt.Fprintf(stderr, "Usage:\n  %s %s\n\n", tool.Name, h.usage)
+	} else {
+		fmt.Fprintf(stderr, "Usage:\n  %s [options] %s\n\n", tool.Name, h.usage)
+	}
+	fmt.Fprintln(stderr, h.summary)
+	for _, line := range h.details {
+		fmt.Fprintln(stderr, line)
+	}
+	fs := flag.NewFlagSet(tool.Name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	for _, name := range h.flags {
+		if f := flag.Lookup(name); f != nil {
+			fs.Var(f.Value, f.Name, f.Usage)
+			fs.Lookup(name).DefValue = f.DefValue
+		}
+	}
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintln(stderr, "\nOptions:")
+		fs.PrintDefaults()
+	}
+	fmt.Fprintf(stderr, "\nOptions for connecting, configuration and logging, such as -conn, -config and -log-file, apply to every command; run \"%s -help\" to list them all.\n", tool.Name)
+	if len(h.examples) > 0 {
+		fmt.Fprintln(stderr, "\nExamples:")
+		for _, example := range h.examples {
+			fmt.Fprintf(stderr, "  %s %s\n", tool.Name, example)
+		}
+	}
+	fmt.Fprintln(stderr, "\nExit codes:")
+	codes := slices.Concat([]int{ExitOK, ExitFailure, ExitUsage}, h.exits)
+	slices.Sort(codes)
+	for _, code := range slices.Compact(codes) {
+		fmt.Fprintf(stderr, "  %d  %s\n", code, exitDescriptions[code])
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package clitool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// listFilter narrows the migrations printed by list.
+type listFilter struct {
+	pending bool
+	applied bool
+	since   time.Time
+	grep    string
+}
+
+// sinceLayouts are the accepted formats of the -since flag.
+var sinceLayouts = []string{time.DateOnly, time.RFC3339}
+
+// newListFilter validates the list filter flags.
+func newListFilter(pending, applied bool, since, grep string) (listFilter, error) {
+	if pending && applied {
+		return listFilter{}, errors.New("-pending and -applied cannot be used together")
+	}
+	f := listFilter{pending: pending, applied: applied, grep: strings.ToLower(grep)}
+	if since != "" {
+		var err error
+		for _, layout := range sinceLayouts {
+			if f.since, err = time.Parse(layout, since); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return listFilter{}, fmt.Errorf("invalid -since date %q: expected YYYY-MM-DD or RFC 3339", since)
+		}
+	}
+	return f, nil
+}
+
+// active reports whether any filter is set.
+func (f listFilter) active() bool {
+	return f.pending || f.applied || !f.since.IsZero() || f.grep != ""
+}
+
+// apply returns the migrations that pass every filter. Migrations at or
+// below current count as applied; -since compares against the time each
+// version was recorded as applied in the schema table.
+func (f listFilter) apply(ctx context.Context, g *gostgrator.Gostgrator, migs []gostgrator.Migration, current int) ([]gostgrator.Migration, error) {
+	runAt := make(map[int]time.Time)
+	if !f.since.IsZero() {
+		applied, err := g.GetAppliedMigrations(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range applied {
+			runAt[a.Version] = a.RunAt
+		}
+	}
+	var matched []gostgrator.Migration
+	for _, m := range migs {
+		isApplied := m.Version <= current
+		switch {
+		case f.pending && isApplied, f.applied && !isApplied:
+			continue
+		case f.grep != "" && !strings.Contains(strings.ToLower(m.Name), f.grep) && !strings.Contains(strings.ToLower(m.Filename), f.grep):
+			continue
+		}
+		if !f.since.IsZero() {
+			at, ok := runAt[m.Version]
+			if !ok || !isApplied || at.Before(f.since) {
+				continue
+			}
+		}
+		matched = append(matched, m)
+	}
+	return matched, nil
+}
+
+// printVersions prints the version of each migration once, one per line, in
+// the order of migs.
+func printVersions(migs []gostgrator.Migration) {
+	seen := make(map[int]bool, len(migs))
+	for _, m := range migs {
+		if !seen[m.Version] {
+			seen[m.Version] = true
+			fmt.Fprintln(stdout, m.Version)
+		}
+	}
+}
+
+// orderByRunAt puts the recorded migrations among migs first, in the order
+// they ran, followed by the rest in version order, so the list reads as a
+// history even when int and timestamp versions are mixed.
+func orderByRunAt(ctx context.Context, g *gostgrator.Gostgrator, migs []gostgrator.Migration) ([]gostgrator.Migration, error) {
+	applied, err := g.GetAppliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := gostgrator.SortApplied(applied, gostgrator.OrderRunAt); err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int][]gostgrator.Migration, len(migs))
+	for _, m := range migs {
+		byVersion[m.Version] = append(byVersion[m.Version], m)
+	}
+	ordered := make([]gostgrator.Migration, 0, len(migs))
+	for _, a := range applied {
+		ordered = append(ordered, byVersion[a.Version]...)
+		delete(byVersion, a.Version)
+	}
+	for _, m := range migs {
+		if _, ok := byVersion[m.Version]; ok {
+			ordered = append(ordered, m)
+		}
+	}
+	return ordered, nil
+}
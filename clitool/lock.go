@@ -0,0 +1,91 @@
+package clitool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// waitForLock is set from -wait-for-lock: how long migrate, down and batch
+// wait for another process to release the migration lock.
+var waitForLock time.Duration
+
+// lockPollInterval is how often a waiting command retries the lock.
+var lockPollInterval = time.Second
+
+// spinnerFrames animate the wait for the migration lock on a terminal.
+var spinnerFrames = []string{"|", "/", "-", `\`}
+
+// WithLock runs f holding the migration lock, waiting up to waitForLock for
+// another process to release it, and releases the lock afterwards so it is
+// never left behind by the exit that follows a failure.
+func WithLock(g *gostgrator.Gostgrator, ctx context.Context, f func() error) error {
+	if err := acquireLock(g, ctx); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return err
+	}
+	err := f()
+	if uerr := g.Unlock(context.WithoutCancel(ctx)); uerr != nil {
+		fmt.Fprintf(stderr, "Error releasing the migration lock: %v\n", uerr)
+		if err == nil {
+			err = uerr
+		}
+	}
+	return err
+}
+
+// acquireLock takes the migration lock, retrying while another process holds
+// it until waitForLock has passed. A spinner shows the wait on a terminal.
+func acquireLock(g *gostgrator.Gostgrator, ctx context.Context) error {
+	err := g.Lock(ctx)
+	if !errors.Is(err, gostgrator.ErrLocked) || waitForLock <= 0 {
+		return err
+	}
+	fmt.Fprintf(stderr, "[%s] %v; waiting up to %s...\n", time.Now().Format(time.Kitchen), err, waitForLock)
+	spin := isTerminal(os.Stderr)
+	start := time.Now()
+	defer func() {
+		if spin {
+			fmt.Fprint(os.Stderr, "\r\033[K")
+		}
+	}()
+	for i := 0; ; i++ {
+		if spin {
+			fmt.Fprintf(os.Stderr, "\r%s waiting for the migration lock (%s)", spinnerFrames[i%len(spinnerFrames)], time.Since(start).Round(time.Second))
+		}
+		if time.Since(start) >= waitForLock {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+		if err = g.Lock(ctx); !errors.Is(err, gostgrator.ErrLocked) {
+			return err
+		}
+	}
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ExitCode is the exit code for a command that failed with err.
+func ExitCode(err error) int {
+	switch {
+	case errors.Is(err, gostgrator.ErrLocked):
+		return ExitLocked
+	case errors.Is(err, gostgrator.ErrFrozen):
+		return ExitFrozen
+	case errors.Is(err, ErrMorePending):
+		return ExitPending
+	}
+	return ExitFailure
+}
@@ -0,0 +1,52 @@
+package clitool
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// runLockstep migrates the database of g and the secondary database
+// secondaryConn points at to target together, applying each migration to
+// the secondary first and to the main database only if that succeeded. It
+// reports the run as migrate does and returns an error when it fails.
+func runLockstep(g *gostgrator.Gostgrator, ctx context.Context, cliConfig gostgrator.Config, secondaryConn, target string) error {
+	db, err := tool.Open(mainConn(cliConfig, secondaryConn))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error opening secondary database: %v\n", err)
+		return err
+	}
+	defer db.Close()
+	// Only the main database reports the run.
+	cliConfig.WebhookURL = ""
+	secondary, err := gostgrator.NewGostgrator(cliConfig, db)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error initializing gostgrator: %v\n", err)
+		return err
+	}
+
+	if !jsonOutput {
+		fmt.Fprintf(stdout, "[%s] Starting lockstep migration of the secondary and main databases to version %s...\n", time.Now().Format(time.Kitchen), target)
+	}
+	start := time.Now()
+	applied, err := g.MigrateLockstep(ctx, secondary, target)
+	err = warnNotify(err)
+	summary := newRunSummary(g, ctx, "migrate", applied, time.Since(start), err)
+	if err != nil {
+		fmt.Fprintf(stderr, "Migration error: %v\n", err)
+		printPartialApply(err)
+		annotate(g, "gostgrator migrate", err)
+		summary.print()
+		return err
+	}
+	if !jsonOutput {
+		fmt.Fprintf(stdout, "[%s] Applied %d migrations to both databases:\n", time.Now().Format(time.Kitchen), len(applied))
+		for _, m := range applied {
+			fmt.Fprintf(stdout, "  - Version %d: %s (%s)\n", m.Version, m.Name, m.Filename)
+		}
+	}
+	summary.print()
+	return emitSchema(g, ctx)
+}
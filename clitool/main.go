@@ -0,0 +1,1408 @@
+// Package clitool builds gostgrator command-line tools. gostgrator-pg and
+// gostgrator-sqlite are built with it, and teams can build their own
+// migrator binaries, with another driver, custom authentication or extra
+// commands, without copying either:
+//
+//	func main() {
+//		clitool.Main(clitool.Tool{
+//			Name:     "acme-migrate",
+//			Driver:   "pg",
+//			Database: "PostgreSQL",
+//			ConnEnv:  "ACME_DATABASE_URL",
+//			Open: func(conn string) (*sql.DB, error) {
+//				return pgopen.Open(conn, pgopen.Options{TLSConfig: acmeTLS})
+//			},
+//		})
+//	}
+//
+// Main parses flag.CommandLine, so a binary defines its own flags on it
+// before calling Main and reads them in Tool.Configure, Tool.Open or its
+// Tool.Commands. Every command of the pg and sqlite CLIs is available, with
+// the same flags, configuration precedence, output and exit codes.
+package clitool
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+var versionString = gostgrator.Version
+
+// usage prints the help text.
+func usage() {
+	fmt.Fprintf(stderr, "Usage:\n  %s [command] [arguments] [options]\n\nCommands:\n", tool.Name)
+	printCommandList()
+	fmt.Fprintln(stderr, `  <alias> [args]      Run an alias defined in the "aliases" field of -config, e.g. "deploy": ["migrate", "max"].`)
+	fmt.Fprintln(stderr, "\nOptions:")
+	flag.PrintDefaults()
+}
+
+// Main runs the command line of the binary t describes and exits when the
+// command is done, with one of the exit codes below on failure. It is meant
+// to be called once, from the binary's main function.
+func Main(t Tool) {
+	tool = t
+	// Define global flags.
+	connStr := flag.String("conn", "", fmt.Sprintf("%s connection URL, or \"-\" to read it from the first line of stdin. %s.", t.Database, overrides(t.ConnEnv, "conn")))
+	connFile := flag.String("conn-file", "", "Read the connection URL from this file (e.g. a mounted secret) instead of passing it on the command line")
+	connEnv := flag.String("conn-env", "", "Read the connection URL from this environment variable instead of passing it on the command line")
+	verifyConn := flag.String("verify-conn", "", fmt.Sprintf("Read-only %s connection URL used by list, explain-version, verify and drift-check, which open it read-only. %s; falls back to the main connection when unset.", t.Database, overrides(t.VerifyConnEnv, "verifyConn")))
+	secondaryConn := new(string)
+	if t.SecondaryConnEnv != "" {
+		flag.StringVar(secondaryConn, "secondary-conn", "", fmt.Sprintf("%s connection URL of a secondary database, e.g. the green side of a blue/green cutover, to migrate in lockstep: each migration is applied to it first and to the main database only if that succeeded. %s (migrate)", t.Database, overrides(t.SecondaryConnEnv, "secondaryConn")))
+	}
+	configPath := flag.String("config", "", "Path to JSON configuration file (optional)")
+	workspacePath := flag.String("workspace", "", "Path of the workspace file listing a monorepo's migration projects (default: "+workspaceFile+" in the working directory or its parents)")
+	projectName := flag.String("project", "", "Run the command for this project of the workspace file, with its migration pattern, schema table and connection variable")
+	allProjects := flag.Bool("all-projects", false, "Run the command once for every project of the workspace file, in order, and exit with the first failing project's exit code")
+	chdir := flag.String("C", "", "Change to this directory before reading -config and resolving -migration-pattern and other relative paths, like git -C")
+	flag.StringVar(chdir, "chdir", "", "Same as -C")
+	migrationPattern := flag.String("migration-pattern", "", "Glob pattern for migration files (default \"migrations/*.sql\")")
+	excludePattern := flag.String("exclude-pattern", "", "Glob of migration files to ignore, e.g. \"**/draft_*.sql\"; \"**\" matches any directories (overrides \"excludePattern\" in -config)")
+	schemaTable := flag.String("schema-table", "", "Name of the schema table (default \"schemaversion\")")
+	mode := flag.String("mode", "int", "Migration numbering mode (\"int\" or \"timestamp\") for new command")
+	style := flag.String("style", "", "Naming of files created by new: \"do-undo\", \"up-down\" or \"golang-migrate\" (overrides \"filenameStyle\" in -config; default \"do-undo\")")
+	checksumCompat := flag.String("checksum-compat", "", "Compute migration checksums as \"gostgrator\" or \"postgrator\" does, so md5 values recorded by node-postgrator validate as they are (overrides \"checksumCompat\" in -config; default \"gostgrator\")")
+	migrationFormat := flag.String("migration-format", "", "Also read golang-migrate's 001_name.up.sql files with \"golang-migrate\" (overrides \"migrationFormat\" in -config; default \"gostgrator\")")
+	golangMigrateTable := flag.String("golang-migrate-table", "", "Count the version recorded in this golang-migrate table, e.g. schema_migrations, as applied (overrides \"golangMigrateTable\" in -config)")
+	environment := flag.String("env", "", "Environment to run in; migrations with an \"environments\" directive that does not list it are recorded without running (overrides \"environment\" in -config)")
+	filenamePolicy := flag.String("filename-policy", "", "Regular expression, or preset \"kebab-case\" or \"ticket\", that migration filenames must match; checked by new, lint and verify (overrides \"filenamePolicy\" in -config)")
+	verifySignatures := flag.Bool("verify-signatures", false, "Refuse to run migrations without a valid <file>.sig SSH signature, made with \"ssh-keygen -Y sign -n gostgrator\", from a key in -trusted-keys; also checked by lint and verify (overrides \"verifySignatures\" in -config)")
+	trustedKeys := flag.String("trusted-keys", "", "File of SSH public keys allowed to sign migrations, in authorized_keys or allowed_signers format (overrides \"trustedKeysFile\" in -config)")
+	transaction := flag.String("transaction", "", "Transaction mode: \"none\" runs migrations as they are, \"each\" runs every migration with its version row in one transaction, \"all\" runs the whole command in one (overrides \"transaction\" in -config; default \"none\")")
+	autoUpgrade := flag.Bool("auto-upgrade-schema-table", true, "Let migrate and down add missing columns to an older schema table; when false they fail until upgrade-schema-table runs (overrides \"autoUpgradeSchemaTable\" in -config)")
+	auditHistory := flag.Bool("audit-history", false, "Keep undone migrations in the schema table marked with undone_at and log every do and undo to <schemaTable>_history")
+	snapshotSchema := flag.Bool("snapshot-schema", false, "Store the structure of the database in <schemaTable>_snapshot after each run that changes it, for drift-check (overrides \"snapshotSchema\" in -config)")
+	flag.StringVar(&emitSchemaPath, "emit-schema", "", "After a successful migrate, down or reset, write the database's tables, columns and indexes to this file, as JSON if it ends in .json and Markdown otherwise")
+	webhookURL := flag.String("webhook-url", "", "Post a JSON summary of each migrate, down and reset to this Slack-compatible or generic webhook, signed with $GOSTGRATOR_WEBHOOK_SECRET when set (overrides $GOSTGRATOR_WEBHOOK_URL and \"webhookURL\" in -config)")
+	notifyOn := flag.String("notify-on", "", "When to post to -webhook-url: \"always\" or \"failure\" (overrides \"notifyOn\" in -config; default \"always\")")
+	captureEnv := flag.String("capture-env", "", "Comma-separated environment variables, e.g. GIT_SHA,CI_PIPELINE_ID, recorded with the hostname as JSON in the schema table's metadata column (overrides \"captureEnv\" in -config)")
+	bestEffort := flag.Bool("best-effort", false, "Tolerate errors about objects that already exist or do not exist (\"bestEffortCodes\" in -config, e.g. 42P07) as warnings, recording migrations as applied and listing the warnings at the end, to rebuild drifted environments; files opt out with \"-- gostgrator: best-effort=false\"")
+	includeTags := flag.String("include-tag", "", "Comma-separated tags; migrate only runs migrations whose \"tags\" directive lists one, e.g. for a maintenance window (overrides \"includeTags\" in -config)")
+	excludeTags := flag.String("exclude-tag", "", "Comma-separated tags; migrate leaves out migrations whose \"tags\" directive lists one (overrides \"excludeTags\" in -config)")
+	allowOutOfOrder := flag.Bool("allow-out-of-order", false, "Let migrate apply migrations above ones left pending by -include-tag or -exclude-tag, and run pending migrations below the database version (overrides \"allowOutOfOrder\" in -config)")
+	expectVersion := flag.Int("expect-version", 0, "Only migrate if the database is at this version once the migration lock is taken, e.g. the version a reviewed plan was made against; otherwise fail without changing anything (migrate)")
+	toDate := flag.String("to-date", "", "Migrate to the highest timestamp version at or before this date, YYYY-MM-DD (through the end of that day, UTC) or RFC 3339, instead of a target version (migrate)")
+	checkDataLoss := flag.Bool("check-data-loss", false, "Count the rows in the tables and columns undo migrations drop; down -dry-run and verify report them, and rollbacks that would destroy data refuse to run without -acknowledge-data-loss (overrides \"checkDataLoss\" in -config)")
+	dataLossThreshold := flag.Int64("data-loss-threshold", 0, "Number of rows a dropped table or column may hold before -check-data-loss reports it (overrides \"dataLossThreshold\" in -config)")
+	acknowledgeDataLoss := flag.Bool("acknowledge-data-loss", false, "Let down, reset and migrate to a lower version run undo migrations that -check-data-loss found would destroy data")
+	maxApply := flag.Int("max-apply", 0, "Apply at most this many migrations per migrate, e.g. 1 to ship one schema change per deploy; exits with code 5 while more are pending (overrides \"maxApplyPerRun\" in -config)")
+	ignoreWindows := flag.Bool("ignore-windows", false, "Run migrations outside the maintenance window of their \"window\" directive instead of deferring them, for emergencies (overrides \"ignoreWindows\" in -config)")
+	translateSQL := flag.Bool("translate-sql", false, "Rewrite SERIAL, TIMESTAMPTZ and INTEGER PRIMARY KEY AUTOINCREMENT columns written for the other database before running migrations; best effort, for simple schemas (overrides \"translateSql\" in -config)")
+	recordProgress := flag.Bool("record-progress", false, "Run migrations statement by statement and record progress so a failed migration resumes where it stopped")
+	ifExists := flag.Bool("if-exists", false, "Succeed when the schema table does not exist (drop-schema)")
+	onlyCore := flag.Bool("only-core", false, "Drop only the schema table, keeping its lock, history, progress and snapshot tables (drop-schema)")
+	cascade := flag.Bool("cascade", false, "Drop objects that depend on the schema table too; SQLite has no CASCADE and ignores it (drop-schema)")
+	pending := flag.Bool("pending", false, "Only list migrations that have not been applied (list)")
+	applied := flag.Bool("applied", false, "Only list migrations that have been applied (list)")
+	since := flag.String("since", "", "Only list migrations applied on or after this date, YYYY-MM-DD or RFC 3339 (list)")
+	grep := flag.String("grep", "", "Only list migrations whose name or filename contains this text, ignoring case (list)")
+	order := flag.String("order", gostgrator.OrderVersion, "Order of the list: \"version\", or \"run_at\" for applied migrations in the order they ran, then the rest by version (list)")
+	versionsOnly := flag.Bool("versions-only", false, "Print only the version numbers, one per line and without the header, for shell loops (list)")
+	withTests := flag.Bool("with-tests", false, "Also run the test migrations (e.g. 001.test.sql) of applied versions, each in a rolled-back transaction on the main connection rather than -verify-conn (verify)")
+	fromVersion := flag.Int("from", 0, "Version to roll back from, usually the deployed one (export-undo)")
+	toVersion := flag.Int("to", 0, "Version to roll back to (export-undo)")
+	outPath := flag.String("o", "", "Write the rollback script (export-undo), or the proposed rows (reconstruct), to this file instead of stdout")
+	dryRun := flag.Bool("dry-run", false, "Print the migrations down would roll back, the tables they touch and later migrations that reference them, without running anything")
+	cacheFile := flag.String("cache-file", "", "Cache migration checksums in this file between runs, keyed by file modification time and size (optional)")
+	timeout := flag.Duration("timeout", 10*time.Minute, "How long a command may run before it is canceled, stopping the migration it is running, e.g. 2h for long backfills")
+	warnAfter := flag.Duration("warn-after", 0, "Print a warning, and post it to -webhook-url, when a migration has run this long, e.g. 2m, while letting it run on until -timeout (default off)")
+	waitLock := flag.Duration("wait-for-lock", 0, "How long migrate, down and batch wait for another process to release the migration lock, e.g. 5m (default: fail with exit code 3 at once)")
+	yes := flag.Bool("yes", false, "Skip the confirmation prompt of reset, down all and reconstruct")
+	nonInteractive := flag.Bool("non-interactive", false, "Never prompt for input; commands that prompt, like ui, fail with exit code 2 instead")
+	logFilePath := flag.String("log-file", "", "Append timestamped output to this file as well as stdout and stderr")
+	logMaxSize := flag.Int64("log-max-size", 10, "Rotate -log-file once it would grow past this many megabytes (0 disables rotation)")
+	logMaxFiles := flag.Int("log-max-files", 5, "Number of rotated -log-file copies to keep as <file>.1, <file>.2, ...")
+	helpFlag := flag.Bool("help", false, "Show help message; with a command, e.g. \"-help migrate\", show only its options, examples and exit codes")
+	versionFlag := flag.Bool("version", false, "Show version")
+	format := flag.String("format", "text", "Output format: \"text\", or \"github\" to also print lint, verify, migrate, down and reset failures as GitHub Actions annotations on the migration files")
+	jsonFlag := flag.Bool("json", false, "Print JSON instead of text: with -version, the version, git commit, Go version and supported drivers; with migrate and down, the run summary")
+
+	flag.Usage = usage
+	flag.CommandLine.SetOutput(stderr)
+	if args, ok := postgratorArgs(os.Args); ok {
+		translated, err := translatePostgratorArgs(args)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			exit(ExitUsage)
+		}
+		os.Args = append(os.Args[:1:1], translated...)
+	}
+	flag.Parse()
+	defer closeOutput()
+	startDir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		exit(ExitFailure)
+	}
+	if *chdir != "" {
+		if err := os.Chdir(*chdir); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			exit(ExitUsage)
+		}
+	}
+	if err := expandAlias(*configPath); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		exit(ExitUsage)
+	}
+	jsonOutput = *jsonFlag
+	switch *format {
+	case "text":
+	case "github":
+		githubAnnotations = true
+	default:
+		fmt.Fprintf(stderr, "Error: unknown -format %q, must be one of: text or github\n", *format)
+		exit(ExitUsage)
+	}
+	if *timeout <= 0 {
+		fmt.Fprintf(stderr, "Error: -timeout must be positive, got %s\n", *timeout)
+		exit(ExitUsage)
+	}
+	commandTimeout = *timeout
+	waitForLock = *waitLock
+	verifyWithTests = *withTests
+
+	if *logFilePath != "" {
+		f, err := openRotatingFile(*logFilePath, *logMaxSize<<20, *logMaxFiles)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			exit(ExitUsage)
+		}
+		logFile = f
+	}
+
+	if name, ok := helpCommand(*helpFlag, flag.Args()); ok {
+		if name == "" {
+			usage()
+			exit(ExitOK)
+		}
+		if err := printCommandHelp(name); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			usage()
+			exit(ExitUsage)
+		}
+		exit(ExitOK)
+	}
+
+	// Safeguard: check for any flag-like arguments after positional arguments.
+	for _, arg := range flag.Args() {
+		if strings.HasPrefix(arg, "-") {
+			fmt.Fprintln(stderr, "Error: Flags must be specified before the command. Please reorder your arguments.")
+			usage()
+			exit(ExitUsage)
+		}
+	}
+
+	// Process global flags.
+	if *versionFlag {
+		if *jsonFlag {
+			if err := json.NewEncoder(stdout).Encode(gostgrator.VersionInfo()); err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+				exit(ExitFailure)
+			}
+			exit(ExitOK)
+		}
+		fmt.Fprintln(stdout, t.Name+" version:", versionString)
+		exit(ExitOK)
+	}
+
+	// Select a project of the workspace file, or run every one of them.
+	if *projectName != "" && *allProjects {
+		fmt.Fprintln(stderr, "Error: -project and -all-projects cannot be used together.")
+		exit(ExitUsage)
+	}
+	if *projectName != "" || *allProjects {
+		projects, err := loadWorkspace(*workspacePath)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			exit(ExitUsage)
+		}
+		if *allProjects {
+			if flag.NArg() == 0 {
+				fmt.Fprintln(stderr, "Error: no command provided.")
+				usage()
+				exit(ExitUsage)
+			}
+			if *connStr == "-" {
+				fmt.Fprintln(stderr, "Error: -conn - cannot be used with -all-projects; give each project a connEnv instead.")
+				exit(ExitUsage)
+			}
+			exit(runAllProjects(projects, startDir))
+		}
+		if project, err = selectProject(projects, *projectName); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			exit(ExitUsage)
+		}
+	}
+
+	// ------------------------------------------------------------------
+	// Configuration precedence:
+	//   1. Flags supplied by the user
+	//   2. Values from the -project of the workspace file
+	//   3. Values from the JSON config file
+	//   4. Built‑in defaults
+	// ------------------------------------------------------------------
+
+	// Refuse misspelled keys in the config file unless it opts out.
+	strictConfig := true
+	cliConfig := gostgrator.Config{Driver: t.Driver, StrictConfig: &strictConfig}
+
+	// 3. Load JSON config if provided.
+	if *configPath != "" {
+		if err := loadConfig(*configPath, &cliConfig); err != nil {
+			fmt.Fprintf(stderr, "Error loading config file: %v\n", err)
+			exit(ExitUsage)
+		}
+	}
+
+	// 2. Apply the workspace project over the config file.
+	if project != nil {
+		cliConfig.MigrationPattern = project.MigrationPattern
+		if project.SchemaTable != "" {
+			cliConfig.SchemaTable = project.SchemaTable
+		}
+		if project.ConnEnv != "" {
+			tool.ConnEnv = project.ConnEnv
+		}
+	}
+
+	// 4. Fill defaults.
+	if cliConfig.SchemaTable == "" {
+		cliConfig.SchemaTable = "schemaversion"
+	}
+	if cliConfig.MigrationPattern == "" {
+		cliConfig.MigrationPattern = "migrations/*.sql"
+	}
+
+	// 1. Let explicitly‑passed flags win (empty means the user didn't set it).
+	if *schemaTable != "" {
+		cliConfig.SchemaTable = *schemaTable
+	}
+	if *migrationPattern != "" {
+		cliConfig.MigrationPattern = *migrationPattern
+	}
+	if *excludePattern != "" {
+		cliConfig.ExcludePattern = *excludePattern
+	}
+	if *style != "" {
+		cliConfig.FilenameStyle = *style
+	}
+	if *migrationFormat != "" {
+		cliConfig.MigrationFormat = *migrationFormat
+	}
+	if *checksumCompat != "" {
+		cliConfig.ChecksumCompat = *checksumCompat
+	}
+	if *golangMigrateTable != "" {
+		cliConfig.GolangMigrateTable = *golangMigrateTable
+	}
+	if *cacheFile != "" {
+		cliConfig.CacheFile = *cacheFile
+	}
+	if *transaction != "" {
+		cliConfig.Transaction = *transaction
+	}
+	if *recordProgress {
+		cliConfig.RecordProgress = true
+	}
+	if *bestEffort {
+		cliConfig.BestEffort = true
+	}
+	if *auditHistory {
+		cliConfig.AuditHistory = true
+	}
+	if *snapshotSchema {
+		cliConfig.SnapshotSchema = true
+	}
+	cliConfig.WebhookURL = firstNonEmpty(*webhookURL, os.Getenv("GOSTGRATOR_WEBHOOK_URL"), cliConfig.WebhookURL)
+	cliConfig.WebhookSecret = firstNonEmpty(os.Getenv("GOSTGRATOR_WEBHOOK_SECRET"), cliConfig.WebhookSecret)
+	if *notifyOn != "" {
+		cliConfig.NotifyOn = *notifyOn
+	}
+	if *captureEnv != "" {
+		cliConfig.CaptureEnv = commaList(*captureEnv)
+	}
+	if *includeTags != "" {
+		cliConfig.IncludeTags = commaList(*includeTags)
+	}
+	if *excludeTags != "" {
+		cliConfig.ExcludeTags = commaList(*excludeTags)
+	}
+	if *allowOutOfOrder {
+		cliConfig.AllowOutOfOrder = true
+	}
+	if *ignoreWindows {
+		cliConfig.IgnoreWindows = true
+	}
+	if *translateSQL {
+		cliConfig.TranslateSQL = true
+	}
+	if *checkDataLoss {
+		cliConfig.CheckDataLoss = true
+	}
+	if *dataLossThreshold != 0 {
+		cliConfig.DataLossThreshold = *dataLossThreshold
+	}
+	cliConfig.AcknowledgeDataLoss = *acknowledgeDataLoss
+	if *maxApply != 0 {
+		cliConfig.MaxApplyPerRun = *maxApply
+	}
+	maxApplyPerRun = cliConfig.MaxApplyPerRun
+	verifyDataLoss = cliConfig.CheckDataLoss
+	cliConfig.WarnAfter = *warnAfter
+	cliConfig.OnSlowMigration = func(m gostgrator.Migration) {
+		fmt.Fprintf(stderr, "[%s] WARNING: version %d (%s) has been running for %s; letting it continue until -timeout %s\n", time.Now().Format(time.Kitchen), m.Version, m.Name, *warnAfter, commandTimeout)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "auto-upgrade-schema-table":
+			cliConfig.AutoUpgradeSchemaTable = autoUpgrade
+		case "expect-version":
+			expectedVersion = expectVersion
+		}
+	})
+	if *environment != "" {
+		cliConfig.Environment = *environment
+	}
+	if *filenamePolicy != "" {
+		cliConfig.FilenamePolicy = *filenamePolicy
+	}
+	if *verifySignatures {
+		cliConfig.VerifySignatures = true
+	}
+	if *trustedKeys != "" {
+		cliConfig.TrustedKeysFile = *trustedKeys
+	}
+
+	if t.Configure != nil {
+		if err := t.Configure(&cliConfig); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			exit(ExitUsage)
+		}
+	}
+	annotationConfig = cliConfig
+
+	// Read the connection from a secrets file, stdin or an environment
+	// variable so it never appears in process args.
+	if *connFile != "" && *connEnv != "" || *connStr != "" && (*connFile != "" || *connEnv != "") {
+		fmt.Fprintln(stderr, "Error: -conn, -conn-file and -conn-env cannot be used together.")
+		exit(ExitUsage)
+	}
+	var conn string
+	switch {
+	case *connStr == "-":
+		conn, err = readConnStdin()
+	case *connFile != "":
+		conn, err = readConnFile(*connFile)
+	case *connEnv != "":
+		conn, err = resolveConn("env://" + *connEnv)
+	default:
+		conn = *connStr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		exit(ExitFailure)
+	}
+	*connStr = conn
+	connFlag = *connStr
+
+	// Process positional arguments.
+	args := flag.Args()
+	if len(args) < 1 {
+		fmt.Fprintln(stderr, "Error: no command provided.")
+		usage()
+		exit(ExitUsage)
+	}
+	command := args[0]
+
+	// Report a bad configuration before connecting. config show prints it
+	// first, to help find where a bad value came from.
+	if command != "config" {
+		if err := cliConfig.Validate(); err != nil {
+			fmt.Fprintf(stderr, "Error: invalid configuration: %v\n", err)
+			exit(ExitUsage)
+		}
+	}
+
+	switch command {
+	case "migrate":
+		target := "max"
+		if len(args) > 1 {
+			target = args[1]
+		}
+		var at time.Time
+		if *toDate != "" {
+			if len(args) > 1 {
+				fmt.Fprintln(stderr, "Error: -to-date cannot be used with a target version.")
+				exit(ExitUsage)
+			}
+			var err error
+			if at, err = parseToDate(*toDate); err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+				exit(ExitUsage)
+			}
+		}
+		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			if !at.IsZero() {
+				version, err := g.VersionAt(at)
+				if err != nil {
+					fmt.Fprintf(stderr, "Error loading migrations: %v\n", err)
+					exit(ExitFailure)
+				}
+				if !jsonOutput {
+					fmt.Fprintf(stdout, "[%s] Version %d is the latest at or before %s.\n", time.Now().Format(time.Kitchen), version, at.Format(time.RFC3339))
+				}
+				target = strconv.Itoa(version)
+			}
+			if secondary := firstNonEmpty(*secondaryConn, getenv(t.SecondaryConnEnv), cliConfig.SecondaryConn); t.SecondaryConnEnv != "" && secondary != "" {
+				if expectedVersion != nil {
+					fmt.Fprintln(stderr, "Error: -expect-version cannot be used with a secondary connection.")
+					exit(ExitUsage)
+				}
+				if err := WithLock(g, ctx, func() error { return runLockstep(g, ctx, cliConfig, secondary, target) }); err != nil {
+					exit(ExitCode(err))
+				}
+				return
+			}
+			if err := WithLock(g, ctx, func() error { return Migrate(g, ctx, target) }); err != nil {
+				exit(ExitCode(err))
+			}
+		})
+	case "down":
+		steps := 1
+		if len(args) > 1 && args[1] == "all" {
+			steps = allSteps
+		} else if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				fmt.Fprintf(stderr, "Invalid rollback steps: %s\n", args[1])
+				exit(ExitUsage)
+			}
+		}
+		if steps == allSteps && !*dryRun {
+			confirm("down all rolls back every applied migration", *yes, *nonInteractive)
+		}
+		if *dryRun {
+			withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
+				impacts, err := g.PlanDown(ctx, steps)
+				if err != nil {
+					fmt.Fprintf(stderr, "Rollback planning error: %v\n", err)
+					exit(ExitFailure)
+				}
+				printRollbackPlan(impacts)
+			})
+			return
+		}
+		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			if err := WithLock(g, ctx, func() error { return runDown(g, ctx, steps) }); err != nil {
+				exit(ExitCode(err))
+			}
+			afterDrop(g, ctx)
+		})
+	case "reset":
+		confirm("reset rolls back every applied migration before migrating to the latest version", *yes, *nonInteractive)
+		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			if err := WithLock(g, ctx, func() error { return runReset(g, ctx) }); err != nil {
+				exit(ExitCode(err))
+			}
+		})
+	case "drop-schema":
+		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			fmt.Fprintf(stdout, "[%s] Dropping schema table...\n", time.Now().Format(time.Kitchen))
+			opts := gostgrator.DropOptions{IfExists: *ifExists, Cascade: *cascade, OnlyCore: *onlyCore}
+			if err := g.DropSchemaTableWithOptions(ctx, opts); err != nil {
+				fmt.Fprintf(stderr, "Error dropping schema table: %v\n", err)
+				exit(ExitFailure)
+			}
+			fmt.Fprintf(stdout, "[%s] Schema table dropped.\n", time.Now().Format(time.Kitchen))
+			afterDrop(g, ctx)
+		})
+	case "upgrade-schema-table":
+		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			fmt.Fprintf(stdout, "[%s] Upgrading schema table...\n", time.Now().Format(time.Kitchen))
+			if err := g.UpgradeSchemaTable(ctx); err != nil {
+				fmt.Fprintf(stderr, "Error upgrading schema table: %v\n", err)
+				exit(ExitFailure)
+			}
+			fmt.Fprintf(stdout, "[%s] Schema table is up to date.\n", time.Now().Format(time.Kitchen))
+		})
+	case "unlock":
+		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			if err := g.ForceUnlock(ctx); err != nil {
+				fmt.Fprintf(stderr, "Error releasing the migration lock: %v\n", err)
+				exit(ExitFailure)
+			}
+			fmt.Fprintf(stdout, "[%s] Migration lock released.\n", time.Now().Format(time.Kitchen))
+		})
+	case "freeze":
+		reason := strings.Join(args[1:], " ")
+		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			if err := g.Freeze(ctx, reason); err != nil {
+				fmt.Fprintf(stderr, "Error freezing migrations: %v\n", err)
+				exit(ExitFailure)
+			}
+			fmt.Fprintf(stdout, "[%s] Migrations frozen; migrate, down and reset fail until unfreeze runs.\n", time.Now().Format(time.Kitchen))
+		})
+	case "unfreeze":
+		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			if err := g.Unfreeze(ctx); err != nil {
+				fmt.Fprintf(stderr, "Error unfreezing migrations: %v\n", err)
+				exit(ExitFailure)
+			}
+			fmt.Fprintf(stdout, "[%s] Migrations unfrozen.\n", time.Now().Format(time.Kitchen))
+		})
+	case "new":
+		if len(args) < 2 {
+			fmt.Fprintln(stderr, "Error: a description is required for the new command.")
+			usage()
+			exit(ExitUsage)
+		}
+		description := args[1]
+		withoutDB(cliConfig, func(g *gostgrator.Gostgrator) {
+			fmt.Fprintf(stdout, "[%s] Creating new migration with description '%s' in %s mode...\n", time.Now().Format(time.Kitchen), description, *mode)
+			if err := g.CreateMigration(description, *mode); err != nil {
+				fmt.Fprintf(stderr, "Error creating new migration: %v\n", err)
+				exit(ExitFailure)
+			}
+			fmt.Fprintf(stdout, "[%s] New migration created successfully.\n", time.Now().Format(time.Kitchen))
+		})
+	case "list":
+		filter, err := newListFilter(*pending, *applied, *since, *grep)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			exit(ExitUsage)
+		}
+		if err := gostgrator.SortApplied(nil, *order); err != nil {
+			fmt.Fprintf(stderr, "Error: invalid -order: %v\n", err)
+			exit(ExitUsage)
+		}
+		withReadDB(cliConfig, *connStr, *verifyConn, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			current, err := g.GetDatabaseVersion(ctx)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error fetching current database version: %v\n", err)
+				exit(ExitFailure)
+			}
+			migs, err := g.GetMigrations()
+			if err != nil {
+				fmt.Fprintf(stderr, "Error loading migrations: %v\n", err)
+				exit(ExitFailure)
+			}
+			sort.Slice(migs, func(i, j int) bool { return migs[i].Version < migs[j].Version })
+			header := "Available migrations:"
+			if filter.active() {
+				if migs, err = filter.apply(ctx, g, migs, current); err != nil {
+					fmt.Fprintf(stderr, "Error filtering migrations: %v\n", err)
+					exit(ExitFailure)
+				}
+				header = "Matching migrations:"
+			}
+			if *order == gostgrator.OrderRunAt {
+				if migs, err = orderByRunAt(ctx, g, migs); err != nil {
+					fmt.Fprintf(stderr, "Error ordering migrations: %v\n", err)
+					exit(ExitFailure)
+				}
+			}
+
+			if *versionsOnly {
+				printVersions(migs)
+				return
+			}
+			fmt.Fprintf(stdout, "Current database migration version: %d\n", current)
+			fmt.Fprintln(stdout, header)
+			for _, m := range migs {
+				annot := ""
+				if m.Version == current {
+					annot = " <== current"
+				}
+				fmt.Fprintf(stdout, "Version %d: %s (%s)%s\n", m.Version, m.Name, m.Filename, annot)
+			}
+		})
+	case "explain-version":
+		if len(args) < 2 {
+			fmt.Fprintln(stderr, "Error: a version is required for the explain-version command.")
+			usage()
+			exit(ExitUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Fprintf(stderr, "Invalid version: %s\n", args[1])
+			exit(ExitUsage)
+		}
+		withReadDB(cliConfig, *connStr, *verifyConn, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			details, err := g.ExplainVersion(ctx, version)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+				exit(ExitFailure)
+			}
+			printVersionDetails(details)
+		})
+	case "lint":
+		withoutDB(cliConfig, func(g *gostgrator.Gostgrator) {
+			if err := runLint(g); err != nil {
+				exit(ExitFailure)
+			}
+		})
+	case "export-undo":
+		set := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if !set["from"] || !set["to"] {
+			fmt.Fprintln(stderr, "Error: export-undo requires -from and -to.")
+			usage()
+			exit(ExitUsage)
+		}
+		withoutDB(cliConfig, func(g *gostgrator.Gostgrator) {
+			if err := runExportUndo(g, *fromVersion, *toVersion, *outPath); err != nil {
+				exit(ExitFailure)
+			}
+		})
+	case "verify":
+		run := func(g *gostgrator.Gostgrator, ctx context.Context) {
+			if err := runVerify(g, ctx); err != nil {
+				exit(ExitFailure)
+			}
+		}
+		// Test migrations write fixtures, so -with-tests needs the main
+		// connection rather than the read-only one.
+		if verifyWithTests {
+			withDB(cliConfig, *connStr, run)
+		} else {
+			withReadDB(cliConfig, *connStr, *verifyConn, run)
+		}
+	case "reconstruct":
+		if len(args) > 2 {
+			fmt.Fprintln(stderr, "Error: reconstruct takes at most one plan file.")
+			usage()
+			exit(ExitUsage)
+		}
+		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			var err error
+			if len(args) == 2 {
+				err = runReconstructPlan(g, ctx, args[1])
+			} else {
+				err = runReconstruct(g, ctx, *outPath, *yes, *nonInteractive)
+			}
+			if err != nil {
+				exit(ExitCode(err))
+			}
+		})
+	case "drift-check":
+		withReadDB(cliConfig, *connStr, *verifyConn, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			if err := runDriftCheck(g, ctx); err != nil {
+				exit(ExitFailure)
+			}
+		})
+	case "batch":
+		in := io.Reader(os.Stdin)
+		if len(args) > 1 && args[1] != "-" {
+			f, err := os.Open(args[1])
+			if err != nil {
+				fmt.Fprintf(stderr, "Error opening batch file: %v\n", err)
+				exit(ExitUsage)
+			}
+			defer f.Close()
+			in = f
+		}
+		steps, err := parseBatch(in)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error reading batch: %v\n", err)
+			exit(ExitUsage)
+		}
+		// Scan migration files once for the whole batch.
+		cliConfig.ScanOnce = true
+		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			if err := WithLock(g, ctx, func() error { return runBatch(g, ctx, steps) }); err != nil {
+				exit(ExitCode(err))
+			}
+		})
+	case "exec":
+		if len(args) != 2 {
+			fmt.Fprintln(stderr, "Error: exec requires one SQL file.")
+			usage()
+			exit(ExitUsage)
+		}
+		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
+			if err := WithLock(g, ctx, func() error { return runExec(g, ctx, args[1]) }); err != nil {
+				exit(ExitCode(err))
+			}
+		})
+	case "ui":
+		if *nonInteractive {
+			fmt.Fprintln(stderr, "Error: ui needs a terminal and cannot run with -non-interactive.")
+			exit(ExitUsage)
+		}
+		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, _ context.Context) {
+			if err := runUI(g); err != nil {
+				fmt.Fprintf(stderr, "UI error: %v\n", err)
+				exit(ExitFailure)
+			}
+		})
+	case "fleet-status":
+		// Require a file of connection URLs, one per line.
+		if len(args) < 2 {
+			fmt.Fprintln(stderr, "Error: a file of connection URLs is required for the fleet-status command.")
+			usage()
+			exit(ExitUsage)
+		}
+		ok, err := fleetStatus(cliConfig, args[1])
+		if err != nil {
+			fmt.Fprintf(stderr, "Error running fleet-status: %v\n", err)
+			exit(ExitFailure)
+		}
+		if !ok {
+			exit(ExitFailure)
+		}
+	case postgratorCommand:
+		fmt.Fprintf(stderr, "Error: postgrator must be the first argument, e.g. %s postgrator --to max --database app\n", t.Name)
+		exit(ExitUsage)
+	case "config":
+		if len(args) != 2 || args[1] != "show" {
+			fmt.Fprintln(stderr, "Error: config requires the subcommand show.")
+			exit(ExitUsage)
+		}
+		if err := runConfigShow(cliConfig, *configPath, *connStr, *verifyConn, *secondaryConn); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			exit(ExitUsage)
+		}
+	default:
+		for _, c := range t.Commands {
+			if c.Name == command {
+				if err := c.Run(cliConfig, args[1:]); err != nil {
+					exit(ExitCode(err))
+				}
+				return
+			}
+		}
+		fmt.Fprintf(stderr, "Unknown command: %s\n", command)
+		usage()
+		exit(ExitUsage)
+	}
+}
+
+// overrides describes what a connection flag overrides in its help text: the
+// environment variable env, when there is one, and key in -config.
+func overrides(env, key string) string {
+	if env == "" {
+		return fmt.Sprintf("Overrides the %q field in -config", key)
+	}
+	return fmt.Sprintf("Overrides %s and the %q field in -config", env, key)
+}
+
+// getenv is os.Getenv, returning "" for an empty name.
+func getenv(name string) string {
+	if name == "" {
+		return ""
+	}
+	return os.Getenv(name)
+}
+
+// afterDrop runs the Tool's AfterDrop hook, exiting when it fails.
+func afterDrop(g *gostgrator.Gostgrator, ctx context.Context) {
+	if tool.AfterDrop == nil {
+		return
+	}
+	if err := tool.AfterDrop(g, ctx); err != nil {
+		exit(ExitFailure)
+	}
+}
+
+// maxApplyPerRun is the cap on migrations applied by one migrate, from
+// -max-apply or "maxApplyPerRun" in -config.
+var maxApplyPerRun int
+
+// expectedVersion is the version from -expect-version, or nil when unset.
+var expectedVersion *int
+
+// ErrMorePending is returned by Migrate when -max-apply stopped it with
+// migrations still pending, so the run exits with ExitPending.
+var ErrMorePending = errors.New("migrations are still pending")
+
+// Migrate migrates to target, reporting the applied migrations or the error.
+func Migrate(g *gostgrator.Gostgrator, ctx context.Context, target string) error {
+	if !jsonOutput {
+		fmt.Fprintf(stdout, "[%s] Starting migration to version %s...\n", time.Now().Format(time.Kitchen), target)
+	}
+	start := time.Now()
+	var applied []gostgrator.Migration
+	var err error
+	if expectedVersion != nil {
+		applied, err = g.MigrateIfCurrent(ctx, *expectedVersion, target)
+	} else {
+		applied, err = g.Migrate(ctx, target)
+	}
+	err = warnNotify(err)
+	summary := newRunSummary(g, ctx, "migrate", applied, time.Since(start), err)
+	if err != nil {
+		fmt.Fprintf(stderr, "Migration error: %v\n", err)
+		printPartialApply(err)
+		printDataLossHint(err)
+		annotate(g, "gostgrator migrate", err)
+		summary.print()
+		return err
+	}
+	if !jsonOutput {
+		fmt.Fprintf(stdout, "[%s] Applied %d migrations:\n", time.Now().Format(time.Kitchen), len(applied))
+		for _, m := range applied {
+			fmt.Fprintf(stdout, "  - Version %d: %s (%s)\n", m.Version, m.Name, m.Filename)
+		}
+	}
+	if deferred, err := g.Deferred(ctx, target); err == nil && len(deferred) > 0 {
+		if !jsonOutput {
+			fmt.Fprintf(stdout, "Deferred %d migration(s) to their maintenance window:\n", len(deferred))
+		}
+		for _, m := range deferred {
+			summary.Deferred = append(summary.Deferred, m.Version)
+			if window, ok := m.Directives["window"]; ok && !jsonOutput {
+				fmt.Fprintf(stdout, "  - Version %d: %s (window %s)\n", m.Version, m.Name, window)
+			} else if !jsonOutput {
+				fmt.Fprintf(stdout, "  - Version %d: %s (waits for an earlier one)\n", m.Version, m.Name)
+			}
+		}
+	}
+	if maxApplyPerRun > 0 {
+		remaining, err := g.Plan(ctx, target)
+		if err != nil {
+			err = fmt.Errorf("failed to count the migrations still pending after -max-apply: %w", err)
+			fmt.Fprintf(stderr, "Migration error: %v\n", err)
+			summary.Error = err.Error()
+			summary.print()
+			return err
+		}
+		summary.Pending = len(remaining)
+	}
+	summary.print()
+	if err := emitSchema(g, ctx); err != nil {
+		return err
+	}
+	if summary.Pending > 0 {
+		if !jsonOutput {
+			fmt.Fprintf(stdout, "Stopped at -max-apply %d with %d migration(s) still pending; run migrate again to continue.\n", maxApplyPerRun, summary.Pending)
+		}
+		return ErrMorePending
+	}
+	return nil
+}
+
+// parseToDate parses -to-date. A bare date covers that whole day in UTC.
+func parseToDate(value string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -to-date %q: expected YYYY-MM-DD or RFC 3339", value)
+	}
+	return day.Add(24*time.Hour - time.Second), nil
+}
+
+// allSteps is the rollback step count of "down all", more than any database
+// has applied, so -dry-run plans every rollback too.
+const allSteps = math.MaxInt32
+
+// runDown rolls back steps migrations, or all of them for allSteps,
+// reporting them or the error.
+func runDown(g *gostgrator.Gostgrator, ctx context.Context, steps int) error {
+	if !jsonOutput && steps == allSteps {
+		fmt.Fprintf(stdout, "[%s] Rolling back all migrations...\n", time.Now().Format(time.Kitchen))
+	} else if !jsonOutput {
+		fmt.Fprintf(stdout, "[%s] Rolling back %d migration(s)...\n", time.Now().Format(time.Kitchen), steps)
+	}
+	start := time.Now()
+	var applied []gostgrator.Migration
+	var err error
+	if steps == allSteps {
+		applied, err = g.DownAll(ctx)
+	} else {
+		applied, err = g.Down(ctx, steps)
+	}
+	err = warnNotify(err)
+	summary := newRunSummary(g, ctx, "down", applied, time.Since(start), err)
+	if err != nil {
+		fmt.Fprintf(stderr, "Rollback error: %v\n", err)
+		printPartialApply(err)
+		printDataLossHint(err)
+		annotate(g, "gostgrator down", err)
+		summary.print()
+		return err
+	}
+	if !jsonOutput {
+		fmt.Fprintf(stdout, "[%s] Rolled back %d migration(s):\n", time.Now().Format(time.Kitchen), len(applied))
+		for _, m := range applied {
+			fmt.Fprintf(stdout, "  - Rolled back version %d: %s (%s)\n", m.Version, m.Name, m.Filename)
+		}
+	}
+	summary.print()
+	return emitSchema(g, ctx)
+}
+
+// runReset rolls back every migration and migrates to the latest version,
+// reporting the migrations that ran or the error.
+func runReset(g *gostgrator.Gostgrator, ctx context.Context) error {
+	if !jsonOutput {
+		fmt.Fprintf(stdout, "[%s] Resetting: rolling back all migrations, then migrating to the latest version...\n", time.Now().Format(time.Kitchen))
+	}
+	start := time.Now()
+	ran, err := g.Reset(ctx)
+	err = warnNotify(err)
+	summary := newRunSummary(g, ctx, "reset", ran, time.Since(start), err)
+	if err != nil {
+		fmt.Fprintf(stderr, "Reset error: %v\n", err)
+		printPartialApply(err)
+		printDataLossHint(err)
+		annotate(g, "gostgrator reset", err)
+		summary.print()
+		return err
+	}
+	if !jsonOutput {
+		fmt.Fprintf(stdout, "[%s] Ran %d migration(s):\n", time.Now().Format(time.Kitchen), len(ran))
+		for _, m := range ran {
+			fmt.Fprintf(stdout, "  - Version %d %s: %s (%s)\n", m.Version, m.Action, m.Name, m.Filename)
+		}
+	}
+	summary.print()
+	return emitSchema(g, ctx)
+}
+
+// confirm asks on stdin before a command that rolls back every migration,
+// exiting unless the answer is "yes". The -yes flag skips the prompt; with
+// -non-interactive and without -yes the command is refused.
+func confirm(what string, yes, nonInteractive bool) {
+	if yes {
+		return
+	}
+	if nonInteractive {
+		fmt.Fprintf(stderr, "Error: %s; pass -yes to run it with -non-interactive.\n", what)
+		exit(ExitUsage)
+	}
+	fmt.Fprintf(stdout, "Warning: %s. Type \"yes\" to continue: ", what)
+	stdout.Flush()
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != "yes" {
+		fmt.Fprintln(stderr, "Aborted.")
+		exit(ExitFailure)
+	}
+}
+
+// runLint checks the migration files without touching the database.
+func runLint(g *gostgrator.Gostgrator) error {
+	migs, err := g.GetMigrations()
+	if err != nil {
+		fmt.Fprintf(stderr, "Error loading migrations: %v\n", err)
+		return err
+	}
+	if err := g.CheckFilenames(); err != nil {
+		fmt.Fprintf(stderr, "Lint error: %v\n", err)
+		annotate(g, "gostgrator lint", err)
+		return err
+	}
+	if err := g.CheckSignatures(); err != nil {
+		fmt.Fprintf(stderr, "Lint error: %v\n", err)
+		annotate(g, "gostgrator lint", err)
+		return err
+	}
+	fmt.Fprintf(stdout, "[%s] Checked %d migration files; no problems found.\n", time.Now().Format(time.Kitchen), len(migs))
+	return nil
+}
+
+// runExportUndo writes the script rolling back from version from to version
+// to into path, or to stdout when path is empty, for a DBA to review and run.
+func runExportUndo(g *gostgrator.Gostgrator, from, to int, path string) error {
+	var script strings.Builder
+	undos, err := g.ExportUndo(&script, from, to)
+	if err != nil {
+		fmt.Fprintf(stderr, "Export error: %v\n", err)
+		return err
+	}
+	if path == "" {
+		_, err := io.WriteString(stdout, script.String())
+		return err
+	}
+	if err := os.WriteFile(path, []byte(script.String()), 0o644); err != nil {
+		fmt.Fprintf(stderr, "Error writing the rollback script: %v\n", err)
+		return err
+	}
+	fmt.Fprintf(stdout, "[%s] Wrote %d undo migration(s) rolling back from version %d to %d to %s.\n", time.Now().Format(time.Kitchen), len(undos), from, to, path)
+	return nil
+}
+
+// verifyWithTests is set from -with-tests: verify then also runs the test
+// migrations of applied versions.
+var verifyWithTests bool
+
+// verifyDataLoss is set from -check-data-loss or "checkDataLoss" in -config:
+// verify then also warns about the data rolling back would destroy.
+var verifyDataLoss bool
+
+// runVerify checks filenames, signatures when they are required, that
+// applied migrations still match the checksums recorded when they ran and
+// that no migration was left behind below the current version, and runs the
+// test migrations with -with-tests.
+func runVerify(g *gostgrator.Gostgrator, ctx context.Context) error {
+	if err := g.CheckFilenames(); err != nil {
+		fmt.Fprintf(stderr, "Verify error: %v\n", err)
+		annotate(g, "gostgrator verify", err)
+		return err
+	}
+	if err := g.CheckSignatures(); err != nil {
+		fmt.Fprintf(stderr, "Verify error: %v\n", err)
+		annotate(g, "gostgrator verify", err)
+		return err
+	}
+	current, err := g.GetDatabaseVersion(ctx)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error fetching current database version: %v\n", err)
+		return err
+	}
+	if err := g.ValidateMigrations(ctx, current); err != nil {
+		fmt.Fprintf(stderr, "Verify error: %v\n", err)
+		annotate(g, "gostgrator verify", err)
+		return err
+	}
+	skipped, err := g.GetSkippedMigrations(ctx)
+	if err != nil {
+		fmt.Fprintf(stderr, "Verify error: %v\n", err)
+		annotate(g, "gostgrator verify", err)
+		return err
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(stderr, "Verify error: %d migration(s) at or below version %d were never applied and will not run, since versions are compared as numbers:\n", len(skipped), current)
+		for _, m := range skipped {
+			fmt.Fprintf(stderr, "  - Version %d: %s (%s)\n", m.Version, m.Name, m.Filename)
+			annotateFile(m.Filename, 0, "gostgrator verify", fmt.Sprintf("Migration [%d] was never applied and will not run, since version %d is already applied", m.Version, current))
+		}
+		return fmt.Errorf("%d unapplied migration(s) below the current version", len(skipped))
+	}
+	fmt.Fprintf(stdout, "[%s] Verified migrations up to version %d: filenames and checksums match.\n", time.Now().Format(time.Kitchen), current)
+	if verifyDataLoss {
+		losses, err := g.DataLoss(ctx, "0")
+		if err != nil {
+			fmt.Fprintf(stderr, "Verify error: %v\n", err)
+			return err
+		}
+		for _, l := range losses {
+			fmt.Fprintf(stdout, "WARNING: rolling back %s\n", l)
+		}
+	}
+	if verifyWithTests {
+		return runTests(g, ctx)
+	}
+	return nil
+}
+
+// runTests runs the test migrations of applied versions and reports each
+// file's result.
+func runTests(g *gostgrator.Gostgrator, ctx context.Context) error {
+	results, err := g.RunTests(ctx)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error running tests: %v\n", err)
+		return err
+	}
+	fmt.Fprintf(stdout, "[%s] Ran %d test file(s):\n", time.Now().Format(time.Kitchen), len(results))
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(stdout, "  FAIL %s (%s): %v\n", r.Migration.Filename, roundDuration(r.Duration), r.Err)
+			annotateFile(r.Migration.Filename, errorLine(r.Migration, r.Err), "gostgrator verify", r.Err.Error())
+			continue
+		}
+		fmt.Fprintf(stdout, "  ok   %s (%s)\n", r.Migration.Filename, roundDuration(r.Duration))
+	}
+	if failed > 0 {
+		err := fmt.Errorf("%d of %d test file(s) failed", failed, len(results))
+		fmt.Fprintf(stderr, "Verify error: %v\n", err)
+		annotate(g, "gostgrator verify", err)
+		return err
+	}
+	return nil
+}
+
+// printPartialApply lists the migrations that were applied before a failed
+// run, so operators know where the database was left.
+func printPartialApply(err error) {
+	var partial *gostgrator.PartialApplyError
+	if !errors.As(err, &partial) {
+		return
+	}
+	fmt.Fprintf(stderr, "Applied %d migration(s) before %s failed:\n", len(partial.Applied), partial.Failed.Filename)
+	for _, m := range partial.Applied {
+		fmt.Fprintf(stderr, "  - Version %d %s: %s (%s)\n", m.Version, m.Action, m.Name, m.Filename)
+	}
+}
+
+// printDataLossHint tells how to proceed when a rollback was refused because
+// it would destroy data.
+func printDataLossHint(err error) {
+	if errors.Is(err, gostgrator.ErrDataLoss) {
+		fmt.Fprintln(stderr, "Nothing was rolled back. Back up the data, then pass -acknowledge-data-loss to roll back anyway.")
+	}
+}
+
+// printRollbackPlan prints what a dry-run down would do: each undo file, the
+// tables it touches, any later-applied migration referencing those tables and,
+// with -check-data-loss, the rows it would destroy.
+func printRollbackPlan(impacts []gostgrator.RollbackImpact) {
+	fmt.Fprintf(stdout, "Dry run: would roll back %d migration(s):\n", len(impacts))
+	var rows int64
+	for _, impact := range impacts {
+		m := impact.Migration
+		fmt.Fprintf(stdout, "  - Version %d: %s (%s)\n", m.Version, m.Name, m.Filename)
+		if len(impact.Tables) == 0 {
+			fmt.Fprintln(stdout, "      touches tables: (none detected)")
+		} else {
+			fmt.Fprintf(stdout, "      touches tables: %s\n", strings.Join(impact.Tables, ", "))
+		}
+		for _, d := range impact.Dependents {
+			fmt.Fprintf(stdout, "      warning: version %d (%s), applied after version %d, references these tables\n", d.Version, d.Filename, m.Version)
+		}
+		for _, l := range impact.DataLoss {
+			fmt.Fprintf(stdout, "      DATA LOSS: drops %s holding %d rows\n", l.Object, l.Rows)
+			rows += l.Rows
+		}
+	}
+	if rows > 0 {
+		fmt.Fprintf(stdout, "WARNING: rolling back will destroy %d rows; down refuses to run without -acknowledge-data-loss.\n", rows)
+	}
+}
+
+// withDB opens the database flagConn, or the main connection when it is
+// empty, points at and calls f with a Gostgrator for it, exiting when the
+// database cannot be opened.
+func withDB(cliConfig gostgrator.Config, flagConn string, f func(g *gostgrator.Gostgrator, ctx context.Context)) {
+	withOpenDB(cliConfig, tool.Open, mainConn(cliConfig, flagConn), f)
+}
+
+// withOpenDB opens conn with open and calls f with a Gostgrator for it,
+// exiting when the database cannot be opened.
+func withOpenDB(cliConfig gostgrator.Config, open func(conn string) (*sql.DB, error), conn string, f func(g *gostgrator.Gostgrator, ctx context.Context)) {
+	db, err := open(conn)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error opening database: %v\n", err)
+		exit(ExitFailure)
+	}
+	defer db.Close()
+
+	g, err := gostgrator.NewGostgrator(cliConfig, db)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error initializing gostgrator: %v\n", err)
+		exit(ExitFailure)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	f(g, ctx)
+}
+
+// withoutDB runs f with a Gostgrator that has no database, for commands that
+// only read migration files, such as new, lint and export-undo, so they work
+// without a connection URL. Anything that would query the database fails
+// with gostgrator.ErrNoDatabase.
+func withoutDB(cliConfig gostgrator.Config, f func(g *gostgrator.Gostgrator)) {
+	g, err := gostgrator.NewGostgrator(cliConfig, nil)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error initializing gostgrator: %v\n", err)
+		exit(ExitFailure)
+	}
+	f(g)
+}
+
+// commandTimeout is set from -timeout: how long a command may run before its
+// context is canceled.
+var commandTimeout = 10 * time.Minute
+
+// mainConn returns the connection string to use, with secrets resolved, or
+// exits when there is none.
+func mainConn(cliConfig gostgrator.Config, flagConn string) string {
+	// Precedence: flag > env > config file
+	connStr := firstNonEmpty(
+		flagConn,
+		getenv(tool.ConnEnv),
+		cliConfig.Conn,
+	)
+
+	if connStr == "" {
+		via := "-conn flag"
+		if tool.ConnEnv != "" {
+			via += ", " + tool.ConnEnv + " env var,"
+		}
+		fmt.Fprintf(stderr, "Error: connection URL must be provided via %s or \"conn\" in config file\n", via)
+		usage()
+		exit(ExitUsage)
+	}
+
+	connStr, err := resolveConn(connStr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error resolving connection URL: %v\n", err)
+		exit(ExitFailure)
+	}
+	return connStr
+}
+
+// withReadDB is like withDB but connects with the read-only verification
+// connection when one is configured, so read-only commands never need write
+// credentials. That connection is opened with Tool.OpenReadOnly when the
+// binary has one. Precedence: flag > env > config file > main connection.
+func withReadDB(cliConfig gostgrator.Config, flagConn, flagVerifyConn string, f func(g *gostgrator.Gostgrator, ctx context.Context)) {
+	verifyConn := firstNonEmpty(
+		flagVerifyConn,
+		getenv(tool.VerifyConnEnv),
+		cliConfig.VerifyConn,
+	)
+	if verifyConn == "" {
+		withDB(cliConfig, flagConn, f)
+		return
+	}
+	open := tool.Open
+	if tool.OpenReadOnly != nil {
+		open = tool.OpenReadOnly
+	}
+	withOpenDB(cliConfig, open, mainConn(cliConfig, verifyConn), f)
+}
+
+// loadConfig loads a JSON configuration file into cfg, resolving its
+// relative paths from the file's directory; see gostgrator.LoadConfigFile.
+func loadConfig(path string, cfg *gostgrator.Config) error {
+	return gostgrator.LoadConfigFile(path, cfg)
+}
+
+// fleetConcurrency caps how many databases fleet-status queries at once.
+const fleetConcurrency = 8
+
+// fleetDatabase is the fleet-status result for a single database.
+type fleetDatabase struct {
+	conn    string
+	version int
+	err     error
+}
+
+// fleetStatus concurrently fetches the schema version of every database listed
+// in path and prints a matrix comparing each one to the highest available
+// migration version. It reports false if any database could not be queried.
+func fleetStatus(cliConfig gostgrator.Config, path string) (bool, error) {
+	conns, err := readConnList(path)
+	if err != nil {
+		return false, err
+	}
+	if len(conns) == 0 {
+		return false, fmt.Errorf("no connection URLs found in %s", path)
+	}
+
+	g, err := gostgrator.NewGostgrator(cliConfig, nil)
+	if err != nil {
+		return false, err
+	}
+	maxVersion, err := g.GetMaxVersion()
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	results := make([]fleetDatabase, len(conns))
+	sem := make(chan struct{}, fleetConcurrency)
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			version, err := fleetDatabaseVersion(ctx, cliConfig, conn)
+			results[i] = fleetDatabase{conn: conn, version: version, err: err}
+		})
+	}
+	wg.Wait()
+
+	ok := true
+	fmt.Fprintf(stdout, "Latest available migration version: %d\n", maxVersion)
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tVERSION\tSTATUS")
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			ok = false
+			fmt.Fprintf(w, "%s\t-\terror: %v\n", gostgrator.RedactCredentials(r.conn), r.err)
+		case r.version < maxVersion:
+			fmt.Fprintf(w, "%s\t%d\tbehind by %d <== lagging\n", gostgrator.RedactCredentials(r.conn), r.version, maxVersion-r.version)
+		case r.version > maxVersion:
+			fmt.Fprintf(w, "%s\t%d\tahead of migrations\n", gostgrator.RedactCredentials(r.conn), r.version)
+		default:
+			fmt.Fprintf(w, "%s\t%d\tup to date\n", gostgrator.RedactCredentials(r.conn), r.version)
+		}
+	}
+	return ok, w.Flush()
+}
+
+// fleetDatabaseVersion opens conn and returns its current schema version.
+func fleetDatabaseVersion(ctx context.Context, cliConfig gostgrator.Config, conn string) (int, error) {
+	conn, err := resolveConn(conn)
+	if err != nil {
+		return 0, err
+	}
+	db, err := tool.Open(conn)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	g, err := gostgrator.NewGostgrator(cliConfig, db)
+	if err != nil {
+		return 0, err
+	}
+	return g.GetDatabaseVersion(ctx)
+}
+
+// readConnList reads one connection string per line from path, skipping
+// blank lines and lines starting with '#'.
+func readConnList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var conns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		conns = append(conns, line)
+	}
+	return conns, nil
+}
+
+// commaList splits a comma-separated flag value, dropping empty entries.
+func commaList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// firstNonEmpty returns the first non-empty string in vals.
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,206 @@
+package clitool
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// Exit codes are stable so schedulers and scripts can act on them.
+const (
+	ExitOK      = 0 // the command succeeded
+	ExitFailure = 1 // the command ran but failed, e.g. a migration error
+	ExitUsage   = 2 // invalid flags, arguments or configuration
+	ExitLocked  = 3 // another process holds the migration lock
+	ExitFrozen  = 4 // migrations are frozen
+	ExitPending = 5 // migrate stopped at -max-apply with migrations still pending
+)
+
+// lineWriter buffers output until a full line is available, so lines from
+// stdout and stderr never interleave mid-line when both go to one file, and
+// tees complete lines to the log file when one is configured.
+type lineWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	if i := bytes.LastIndexByte(l.buf, '\n'); i >= 0 {
+		err := l.emit(l.buf[:i+1])
+		l.buf = append(l.buf[:0], l.buf[i+1:]...)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes out a trailing partial line, e.g. an interactive prompt.
+func (l *lineWriter) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buf) == 0 {
+		return nil
+	}
+	err := l.emit(l.buf)
+	l.buf = l.buf[:0]
+	return err
+}
+
+func (l *lineWriter) emit(p []byte) error {
+	if logFile != nil {
+		if err := logFile.writeLines(p); err != nil {
+			return err
+		}
+	}
+	_, err := l.w.Write(p)
+	return err
+}
+
+// redactWriter masks credentials in everything written through it.
+type redactWriter struct {
+	w io.Writer
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, gostgrator.RedactCredentials(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// stdout and stderr are used for all CLI output so that output is
+// line-buffered and connection strings and driver errors never print
+// credentials.
+var (
+	stdout = &lineWriter{w: redactWriter{os.Stdout}}
+	stderr = &lineWriter{w: redactWriter{os.Stderr}}
+)
+
+// logFile, when set by -log-file, receives a timestamped copy of every line
+// written to stdout and stderr.
+var logFile *rotatingFile
+
+// closeOutput flushes stdout and stderr and closes the log file.
+func closeOutput() {
+	stdout.Flush()
+	stderr.Flush()
+	if logFile != nil {
+		logFile.Close()
+		logFile = nil
+	}
+}
+
+// exit flushes all output before exiting with code, since os.Exit skips
+// deferred calls.
+func exit(code int) {
+	closeOutput()
+	os.Exit(code)
+}
+
+// rotatingFile is an append-only log file that is rotated once it would grow
+// past maxSize bytes, keeping up to maxFiles older copies as path.1, path.2
+// and so on, with path.1 the most recent.
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+// openRotatingFile opens path for appending, creating it if needed. A maxSize
+// of zero or less disables rotation.
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// writeLines writes each line of p prefixed with the current time, with
+// credentials masked.
+func (r *rotatingFile) writeLines(p []byte) error {
+	var out bytes.Buffer
+	stamp := time.Now().Format(time.RFC3339)
+	for line := range bytes.Lines(p) {
+		out.WriteString(stamp)
+		out.WriteByte(' ')
+		out.Write(line)
+	}
+	return r.write([]byte(gostgrator.RedactCredentials(out.String())))
+}
+
+func (r *rotatingFile) write(p []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return err
+}
+
+// rotate shifts path.N to path.N+1, dropping the oldest copy, moves the
+// current file to path.1 and starts a new one.
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+	if r.maxFiles > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxFiles))
+		for i := r.maxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	return r.open()
+}
+
+// Close closes the log file.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
@@ -0,0 +1,38 @@
+package clitool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRotatingFile verifies that the log file rotates once it would exceed its
+// size limit and keeps only the configured number of old copies.
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cli.log")
+	f, err := openRotatingFile(path, 16, 2)
+	if err != nil {
+		t.Fatalf("failed to open log file: %v", err)
+	}
+	for _, line := range []string{"first line\n", "second line\n", "third line\n", "fourth line\n"} {
+		if err := f.write([]byte(line)); err != nil {
+			t.Fatalf("failed to write log line: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close log file: %v", err)
+	}
+	for name, want := range map[string]string{
+		path:        "fourth line\n",
+		path + ".1": "third line\n",
+		path + ".2": "second line\n",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != want {
+			t.Errorf("expected %s to contain %q, got %q (%v)", name, want, data, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected no third rotated file, got %v", err)
+	}
+}
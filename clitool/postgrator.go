@@ -0,0 +1,259 @@
+package clitool
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// postgratorCommand is the first argument, or the name of the binary, that
+// makes the rest of the command line read as postgrator-cli's, so npm
+// scripts can switch binaries before they are rewritten.
+const postgratorCommand = "postgrator"
+
+// postgratorOptions maps postgrator-cli's options, long and short, to the
+// setting they stand for.
+var postgratorOptions = map[string]string{
+	"to": "to", "t": "to",
+	"driver": "driver", "r": "driver",
+	"host": "host", "h": "host",
+	"port": "port", "o": "port",
+	"database": "database", "d": "database",
+	"username": "username", "u": "username",
+	"password": "password", "p": "password",
+	"migration-pattern": "migrationPattern", "m": "migrationPattern",
+	"schema-table": "schemaTable", "s": "schemaTable",
+	"config": "config", "c": "config",
+	"ssl":       "ssl",
+	"no-config": "noConfig",
+	"version":   "version", "v": "version",
+	"help": "help", "?": "help",
+}
+
+// postgratorSwitches are the settings of postgratorOptions that take no
+// value.
+var postgratorSwitches = []string{"ssl", "noConfig", "version", "help"}
+
+// postgratorConfig is the JSON configuration file postgrator-cli reads with
+// --config.
+type postgratorConfig struct {
+	MigrationPattern string `json:"migrationPattern"`
+	Driver           string `json:"driver"`
+	Host             string `json:"host"`
+	Port             any    `json:"port"`
+	Database         string `json:"database"`
+	Username         string `json:"username"`
+	Password         string `json:"password"`
+	SchemaTable      string `json:"schemaTable"`
+	SSL              any    `json:"ssl"`
+}
+
+// postgratorArgs returns the arguments after the binary's name in args, and
+// whether they are in postgrator-cli's form: the binary is named postgrator,
+// e.g. through a symlink, or its first argument is "postgrator".
+func postgratorArgs(args []string) ([]string, bool) {
+	if strings.TrimSuffix(filepath.Base(args[0]), ".exe") == postgratorCommand {
+		return args[1:], true
+	}
+	if len(args) > 1 && args[1] == postgratorCommand {
+		return args[2:], true
+	}
+	return nil, false
+}
+
+// translatePostgratorArgs rewrites a postgrator-cli command line, such as
+// "--to 5 --database app -u deploy", into the flags and migrate command
+// that do the same, reading checksums as postgrator does. The connection
+// URL is built from the database options, or left to -conn's usual
+// fallbacks when there are none. Options of this binary may be mixed in,
+// with one or two dashes.
+func translatePostgratorArgs(args []string) ([]string, error) {
+	settings := make(map[string]string)
+	var passed []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			for _, target := range args[i+1:] {
+				if err := setPostgratorTarget(settings, target); err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if err := setPostgratorTarget(settings, arg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+		setting, ok := postgratorOptions[name]
+		if !ok {
+			f := flag.Lookup(name)
+			if f == nil {
+				return nil, fmt.Errorf("unknown postgrator-cli option %s", arg)
+			}
+			passed = append(passed, "-"+name)
+			if hasValue {
+				passed[len(passed)-1] += "=" + value
+			} else if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+				if i+1 == len(args) {
+					return nil, fmt.Errorf("option %s needs a value", arg)
+				}
+				i++
+				passed = append(passed, args[i])
+			}
+			continue
+		}
+		switch {
+		case slices.Contains(postgratorSwitches, setting):
+			value = "true"
+		case !hasValue:
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("option %s needs a value", arg)
+			}
+			i++
+			value = args[i]
+		}
+		if setting == "to" {
+			if err := setPostgratorTarget(settings, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		settings[setting] = value
+	}
+	if settings["help"] != "" {
+		return []string{"-help", postgratorCommand}, nil
+	}
+	if settings["version"] != "" {
+		return []string{"-version"}, nil
+	}
+	if path := settings["config"]; path != "" {
+		if err := readPostgratorConfig(path, settings); err != nil {
+			return nil, err
+		}
+	}
+	if driver := settings["driver"]; driver != "" && driver != tool.Driver {
+		return nil, fmt.Errorf("%s runs the %s driver, not %s", tool.Name, tool.Driver, driver)
+	}
+
+	flags := []string{"-checksum-compat", "postgrator"}
+	if pattern := settings["migrationPattern"]; pattern != "" {
+		flags = append(flags, "-migration-pattern", pattern)
+	}
+	if table := settings["schemaTable"]; table != "" {
+		flags = append(flags, "-schema-table", table)
+	}
+	conn, err := postgratorConn(settings)
+	if err != nil {
+		return nil, err
+	}
+	if conn != "" {
+		flags = append(flags, "-conn", conn)
+	}
+	command := []string{"migrate"}
+	if target := settings["to"]; target != "" {
+		command = append(command, target)
+	}
+	return append(append(flags, passed...), command...), nil
+}
+
+// setPostgratorTarget records the version to migrate to, from --to or the
+// positional argument postgrator-cli reads as --to.
+func setPostgratorTarget(settings map[string]string, target string) error {
+	if prev, ok := settings["to"]; ok && prev != target {
+		return fmt.Errorf("more than one version to migrate to: %s and %s", prev, target)
+	}
+	settings["to"] = target
+	return nil
+}
+
+// readPostgratorConfig fills the settings not given on the command line
+// from the postgrator-cli configuration file at path.
+func readPostgratorConfig(path string, settings map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read postgrator config: %w", err)
+	}
+	var cfg postgratorConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("invalid postgrator config %s: %w", path, err)
+	}
+	for setting, value := range map[string]string{
+		"migrationPattern": cfg.MigrationPattern,
+		"driver":           cfg.Driver,
+		"host":             cfg.Host,
+		"port":             postgratorString(cfg.Port),
+		"database":         cfg.Database,
+		"username":         cfg.Username,
+		"password":         cfg.Password,
+		"schemaTable":      cfg.SchemaTable,
+		"ssl":              postgratorString(cfg.SSL),
+	} {
+		if _, ok := settings[setting]; !ok && value != "" {
+			settings[setting] = value
+		}
+	}
+	return nil
+}
+
+// postgratorString formats a number, string or boolean of a postgrator-cli
+// configuration file, with false and null as empty.
+func postgratorString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		if !v {
+			return ""
+		}
+		return "true"
+	case float64:
+		return fmt.Sprint(int64(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// postgratorConn returns the connection URL the database options describe
+// for the Tool's driver, or "" when there are none.
+func postgratorConn(settings map[string]string) (string, error) {
+	if settings["host"] == "" && settings["port"] == "" && settings["database"] == "" && settings["username"] == "" && settings["password"] == "" {
+		return "", nil
+	}
+	switch tool.Driver {
+	case "pg":
+		u := url.URL{Scheme: "postgres", Host: settings["host"], Path: "/" + settings["database"]}
+		if u.Host == "" {
+			u.Host = "localhost"
+		}
+		if port := settings["port"]; port != "" {
+			u.Host = net.JoinHostPort(u.Host, port)
+		}
+		switch {
+		case settings["password"] != "":
+			u.User = url.UserPassword(settings["username"], settings["password"])
+		case settings["username"] != "":
+			u.User = url.User(settings["username"])
+		}
+		if settings["ssl"] != "" {
+			u.RawQuery = "sslmode=require"
+		}
+		return u.String(), nil
+	case "sqlite3":
+		if settings["database"] == "" {
+			return "", errors.New("--database must name the SQLite database file")
+		}
+		return settings["database"], nil
+	default:
+		return "", fmt.Errorf("postgrator-cli connection options are not supported by the %s driver; pass -conn", tool.Driver)
+	}
+}
@@ -0,0 +1,138 @@
+package clitool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// reconstructPlan is the proposal reconstruct -o writes and reconstruct
+// <plan> records after it was reviewed.
+type reconstructPlan struct {
+	Migrations []plannedRow `json:"migrations"`
+}
+
+// plannedRow is one schema table row of a reconstruct plan. Md5 guards
+// against recording a file that changed after the plan was written.
+type plannedRow struct {
+	Version  int    `json:"version"`
+	Name     string `json:"name"`
+	Filename string `json:"filename"`
+	Md5      string `json:"md5"`
+}
+
+// runReconstruct prints the evidence Reconstruct found for each migration
+// and the schema table rows it proposes. With path set the proposal is
+// written there for review; otherwise the rows are recorded after the user
+// confirms.
+func runReconstruct(g *gostgrator.Gostgrator, ctx context.Context, path string, yes, nonInteractive bool) error {
+	proposed, err := g.Reconstruct(ctx)
+	if err != nil {
+		fmt.Fprintf(stderr, "Reconstruct error: %v\n", err)
+		return err
+	}
+	var plan reconstructPlan
+	var applied []gostgrator.Migration
+	fmt.Fprintln(stdout, "Evidence in the database for each migration:")
+	for _, r := range proposed {
+		var evidence []string
+		if len(r.Found) > 0 {
+			evidence = append(evidence, "found "+strings.Join(r.Found, ", "))
+		}
+		if len(r.Missing) > 0 {
+			evidence = append(evidence, "missing "+strings.Join(r.Missing, ", "))
+		}
+		if len(evidence) == 0 {
+			evidence = append(evidence, "no objects to look for")
+		}
+		status := "not applied"
+		if r.Applied {
+			status = "applied"
+			applied = append(applied, r.Migration)
+			plan.Migrations = append(plan.Migrations, plannedRow{Version: r.Version, Name: r.Name, Filename: r.Filename, Md5: r.Md5})
+		}
+		fmt.Fprintf(stdout, "  - Version %d: %s (%s): %s\n", r.Version, r.Name, status, strings.Join(evidence, "; "))
+	}
+	if len(applied) == 0 {
+		fmt.Fprintln(stdout, "No migration left evidence in the database; nothing to record.")
+		return nil
+	}
+	fmt.Fprintf(stdout, "Proposed: record versions %d through %d (%d rows) as applied.\n", applied[0].Version, applied[len(applied)-1].Version, len(applied))
+
+	if path != "" {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err == nil {
+			err = os.WriteFile(path, append(data, '\n'), 0o644)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Error writing the plan: %v\n", err)
+			return err
+		}
+		fmt.Fprintf(stdout, "Wrote the plan to %s; review it, then run reconstruct %s to record it.\n", path, path)
+		return nil
+	}
+	confirm(fmt.Sprintf("reconstruct records %d migration(s) as applied without running them", len(applied)), yes, nonInteractive)
+	return recordReconstruction(g, ctx, applied)
+}
+
+// runReconstructPlan records the rows of a plan written by reconstruct -o,
+// failing if a migration is gone or changed since.
+func runReconstructPlan(g *gostgrator.Gostgrator, ctx context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error reading the plan: %v\n", err)
+		return err
+	}
+	var plan reconstructPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		fmt.Fprintf(stderr, "Error reading the plan: %v\n", err)
+		return err
+	}
+	migs, err := g.GetMigrations()
+	if err != nil {
+		fmt.Fprintf(stderr, "Error loading migrations: %v\n", err)
+		return err
+	}
+	var applied []gostgrator.Migration
+	for _, row := range plan.Migrations {
+		i := -1
+		for j, m := range migs {
+			if m.Action == "do" && m.Version == row.Version {
+				i = j
+			}
+		}
+		switch {
+		case i < 0:
+			err = fmt.Errorf("migration [%d] in the plan has no do file", row.Version)
+		case migs[i].Md5 != row.Md5:
+			err = fmt.Errorf("migration [%d] (%s) changed since the plan was written", row.Version, migs[i].Filename)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Reconstruct error: %v\n", err)
+			return err
+		}
+		applied = append(applied, migs[i])
+	}
+	return recordReconstruction(g, ctx, applied)
+}
+
+// recordReconstruction records migrations as applied under the migration
+// lock and reports the resulting version.
+func recordReconstruction(g *gostgrator.Gostgrator, ctx context.Context, migrations []gostgrator.Migration) error {
+	if err := WithLock(g, ctx, func() error { return g.RecordApplied(ctx, migrations) }); err != nil {
+		fmt.Fprintf(stderr, "Reconstruct error: %v\n", err)
+		return err
+	}
+	version, err := g.GetDatabaseVersion(ctx)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error fetching current database version: %v\n", err)
+		return err
+	}
+	fmt.Fprintf(stdout, "[%s] Recorded %d migration(s); the database is at version %d.\n", time.Now().Format(time.Kitchen), len(migrations), version)
+	return nil
+}
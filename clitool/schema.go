@@ -0,0 +1,54 @@
+package clitool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// emitSchemaPath is set from -emit-schema: where migrate, down and reset
+// write a summary of the database schema after they succeed.
+var emitSchemaPath string
+
+// emitSchema writes the schema of the database to emitSchemaPath, as JSON if
+// it ends in .json and as Markdown otherwise, creating its directory.
+func emitSchema(g *gostgrator.Gostgrator, ctx context.Context) error {
+	if emitSchemaPath == "" {
+		return nil
+	}
+	schema, err := g.DescribeSchema(ctx)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error describing the schema: %v\n", err)
+		return err
+	}
+	var data []byte
+	if strings.EqualFold(filepath.Ext(emitSchemaPath), ".json") {
+		if data, err = json.MarshalIndent(schema, "", "  "); err != nil {
+			fmt.Fprintf(stderr, "Error describing the schema: %v\n", err)
+			return err
+		}
+		data = append(data, '\n')
+	} else {
+		data = []byte(schema.Markdown())
+	}
+	if dir := filepath.Dir(emitSchemaPath); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			fmt.Fprintf(stderr, "Error writing the schema: %v\n", err)
+			return err
+		}
+	}
+	if err := os.WriteFile(emitSchemaPath, data, 0o644); err != nil {
+		fmt.Fprintf(stderr, "Error writing the schema: %v\n", err)
+		return err
+	}
+	if !jsonOutput {
+		fmt.Fprintf(stdout, "[%s] Wrote schema of %d tables to %s.\n", time.Now().Format(time.Kitchen), len(schema.Tables), emitSchemaPath)
+	}
+	return nil
+}
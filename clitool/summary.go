@@ -0,0 +1,157 @@
+package clitool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// jsonOutput is set from -json: migrate and down then print their summary as
+// a JSON object instead of text.
+var jsonOutput bool
+
+// runSummary is the roll-up printed at the end of migrate, down and reset.
+type runSummary struct {
+	Command      string             `json:"command"`
+	Count        int                `json:"count"`
+	DurationMs   int64              `json:"durationMs"`
+	Slowest      *summaryMigration  `json:"slowest,omitempty"`
+	FinalVersion *int               `json:"finalVersion,omitempty"`
+	Pending      int                `json:"pending,omitempty"`
+	Deferred     []int              `json:"deferred,omitempty"`
+	Migrations   []summaryMigration `json:"migrations"`
+	Error        string             `json:"error,omitempty"`
+
+	duration time.Duration
+}
+
+// summaryMigration is one migration run, as listed in a runSummary.
+type summaryMigration struct {
+	Version    int    `json:"version"`
+	Action     string `json:"action"`
+	Name       string `json:"name"`
+	Filename   string `json:"filename"`
+	DurationMs int64  `json:"durationMs"`
+	// Warnings are the errors tolerated in best-effort mode.
+	Warnings []gostgrator.Warning `json:"warnings,omitempty"`
+
+	duration time.Duration
+}
+
+// newRunSummary builds the summary of a migrate or down command that ran
+// applied in elapsed time and ended with err. On failure the migrations
+// applied before it are taken from the *PartialApplyError. The final version
+// is read back from the database and left out if that fails.
+func newRunSummary(g *gostgrator.Gostgrator, ctx context.Context, command string, applied []gostgrator.Migration, elapsed time.Duration, err error) runSummary {
+	var partial *gostgrator.PartialApplyError
+	if errors.As(err, &partial) {
+		applied = partial.Applied
+	}
+	summary := runSummary{
+		Command:    command,
+		Count:      len(applied),
+		DurationMs: elapsed.Milliseconds(),
+		Migrations: []summaryMigration{},
+		duration:   elapsed,
+	}
+	for _, m := range applied {
+		sm := summaryMigration{
+			Version:    m.Version,
+			Action:     m.Action,
+			Name:       m.Name,
+			Filename:   m.Filename,
+			DurationMs: m.Duration.Milliseconds(),
+			Warnings:   m.Warnings,
+			duration:   m.Duration,
+		}
+		summary.Migrations = append(summary.Migrations, sm)
+		if summary.Slowest == nil || sm.duration > summary.Slowest.duration {
+			summary.Slowest = &sm
+		}
+	}
+	if version, verr := g.GetDatabaseVersion(ctx); verr == nil {
+		summary.FinalVersion = &version
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	return summary
+}
+
+// print writes the summary as a JSON object with -json, or as a footer line.
+func (s runSummary) print() {
+	if jsonOutput {
+		if err := json.NewEncoder(stdout).Encode(s); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+		}
+		return
+	}
+	s.printWarnings()
+	footer := fmt.Sprintf("[%s] Summary: %d %s in %s", time.Now().Format(time.Kitchen), s.Count, s.verb(), roundDuration(s.duration))
+	if s.Slowest != nil {
+		footer += fmt.Sprintf("; slowest: version %d (%s) in %s", s.Slowest.Version, s.Slowest.Name, roundDuration(s.Slowest.duration))
+	}
+	if s.FinalVersion != nil {
+		footer += fmt.Sprintf("; final version: %d", *s.FinalVersion)
+	}
+	if len(s.Deferred) > 0 {
+		footer += fmt.Sprintf("; %d deferred", len(s.Deferred))
+	}
+	if s.Pending > 0 {
+		footer += fmt.Sprintf("; %d still pending", s.Pending)
+	}
+	fmt.Fprintln(stdout, footer)
+}
+
+// printWarnings lists the errors best-effort migrations tolerated, so drift
+// that was skipped over is not lost in the run's output.
+func (s runSummary) printWarnings() {
+	count := 0
+	for _, m := range s.Migrations {
+		count += len(m.Warnings)
+	}
+	if count == 0 {
+		return
+	}
+	fmt.Fprintf(stderr, "Warning: %d error(s) were tolerated in best-effort mode:\n", count)
+	for _, m := range s.Migrations {
+		for _, w := range m.Warnings {
+			fmt.Fprintf(stderr, "  - %s statement %d [%s]: %s\n", m.Filename, w.Statement, w.Code, w.Message)
+		}
+	}
+}
+
+// verb describes what happened to the migrations counted by the summary.
+func (s runSummary) verb() string {
+	switch s.Command {
+	case "down":
+		return "rolled back"
+	case "reset":
+		return "run"
+	}
+	return "applied"
+}
+
+// roundDuration rounds d to milliseconds, or to microseconds when shorter.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+// warnNotify reports a webhook that could not be notified of an otherwise
+// successful run as a warning, so the run still succeeds, and returns any
+// other error unchanged.
+func warnNotify(err error) error {
+	var notifyErr *gostgrator.NotifyError
+	if errors.As(err, &notifyErr) && err == error(notifyErr) {
+		fmt.Fprintf(stderr, "Warning: %v\n", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package clitool
+
+import (
+	"context"
+	"database/sql"
+	"io"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// Tool describes a migrator binary built on Main.
+type Tool struct {
+	// Name is the name of the binary, e.g. "gostgrator-pg", printed by
+	// -help and -version.
+	Name string
+	// Driver is the gostgrator.Config.Driver the binary runs with, e.g.
+	// "pg" or a driver added with gostgrator.RegisterClient.
+	Driver string
+	// Database names the database in help text, e.g. "PostgreSQL".
+	Database string
+	// ConnEnv is the environment variable holding the connection URL when
+	// -conn is not passed, e.g. "DATABASE_URL".
+	ConnEnv string
+	// VerifyConnEnv is the environment variable holding the read-only
+	// connection URL of list, explain-version, verify and drift-check, e.g.
+	// "DATABASE_VERIFY_URL". It is optional.
+	VerifyConnEnv string
+	// SecondaryConnEnv, when set, adds the -secondary-conn flag, read from
+	// this environment variable too, with which migrate applies each
+	// migration to a secondary database before the main one; see
+	// gostgrator.Gostgrator.MigrateLockstep.
+	SecondaryConnEnv string
+	// ConnFiles makes a "file:///path" connection URL read the URL from the
+	// file at path, as "env://NAME" reads it from an environment variable.
+	// Leave it off where file: URIs name the database itself, as in SQLite.
+	ConnFiles bool
+	// Open opens the database a connection URL names, after "env://NAME"
+	// and ConnFiles references are resolved. This is where a binary adds
+	// custom authentication, TLS or dialers.
+	Open func(conn string) (*sql.DB, error)
+	// OpenReadOnly, when set, opens the read-only verification connection
+	// of list, explain-version, verify and drift-check in a mode that
+	// refuses writes, so those commands cannot change the database even
+	// with write credentials. Open is used when it is nil.
+	OpenReadOnly func(conn string) (*sql.DB, error)
+	// Configure, when set, is called with the effective configuration once
+	// flags, environment variables, the -config file and defaults are
+	// merged, before any command runs, to apply the binary's own flags. An
+	// error is reported as a usage error.
+	Configure func(cfg *gostgrator.Config) error
+	// AfterDrop, when set, runs after down and drop-schema succeed, and after
+	// each down of a batch; gostgrator-sqlite uses it for -compact. An error
+	// fails the command.
+	AfterDrop func(g *gostgrator.Gostgrator, ctx context.Context) error
+	// ErrorPosition, when set, returns the 1-based character position in its
+	// query that a migration error points at, or 0 when unknown, so -format
+	// github can annotate the failing line.
+	ErrorPosition func(err error) int
+	// Commands are the binary's own commands, run after the built-in ones
+	// are ruled out.
+	Commands []Command
+}
+
+// Command is a command a Tool adds to the built-in ones.
+type Command struct {
+	// Name is the word that runs the command, e.g. "rehearse".
+	Name string
+	// Usage is the command and its arguments, e.g. "rehearse [target]".
+	Usage string
+	// Summary describes the command in one line of the command list of -help.
+	Summary string
+	// Details are further lines of the command's long help, printed by
+	// "help <command>" and "<command> -help" after Summary. They are optional.
+	Details []string
+	// Flags names the options that matter to the command, without "-", for
+	// its long help. They may be built-in options or the binary's own.
+	Flags []string
+	// Examples are example command lines for the long help, without the
+	// binary's name, e.g. "-proceed rehearse".
+	Examples []string
+	// Exits are the exit codes the command may exit with besides ExitOK,
+	// ExitFailure and ExitUsage, for the long help.
+	Exits []int
+	// Run runs the command with the effective configuration and the
+	// arguments after its name. It prints its own errors; Main exits with
+	// ExitCode(err) when it returns one.
+	Run func(cfg gostgrator.Config, args []string) error
+}
+
+// tool is the Tool Main runs.
+var tool Tool
+
+// connFlag is the connection URL from -conn or -conn-file.
+var connFlag string
+
+// Stdout returns the writer commands print their output to. It is line
+// buffered, masks credentials and copies lines to -log-file.
+func Stdout() io.Writer {
+	return stdout
+}
+
+// Stderr returns the writer commands print their errors to, with the same
+// handling as Stdout.
+func Stderr() io.Writer {
+	return stderr
+}
+
+// MainConn returns the connection URL of the main database from -conn,
+// -conn-file, the Tool's ConnEnv or "conn" in -config, with "env://NAME" and
+// ConnFiles references resolved. It exits with ExitUsage when none is set.
+func MainConn(cfg gostgrator.Config) string {
+	return mainConn(cfg, connFlag)
+}
+
+// WithDB opens the main database, as MainConn finds it, and runs f with a
+// Gostgrator for it and a context that times out after -timeout. It exits
+// with ExitFailure when the database cannot be opened.
+func WithDB(cfg gostgrator.Config, f func(g *gostgrator.Gostgrator, ctx context.Context) error) error {
+	var err error
+	withDB(cfg, connFlag, func(g *gostgrator.Gostgrator, ctx context.Context) {
+		err = f(g, ctx)
+	})
+	return err
+}
@@ -0,0 +1,552 @@
+package clitool
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bcomnes/gostgrator"
+	"github.com/gdamore/tcell/v2"
+)
+
+// uiLogLines is how many of the most recent steps are shown below the list.
+const uiLogLines = 3
+
+// runUI runs a full-screen terminal UI for browsing applied and pending
+// migrations, inspecting their SQL and stepping the database up or down while
+// watching each step run. Keys are read from the terminal even when stdin is
+// redirected, as with -conn -. The steps that ran are printed once the UI
+// exits, so they stay in the scrollback and the -log-file.
+func runUI(g *gostgrator.Gostgrator) error {
+	m, err := newUIModel(g)
+	if err != nil {
+		return err
+	}
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	if err := screen.Init(); err != nil {
+		return err
+	}
+	m.width, m.height = screen.Size()
+
+	events, quit := make(chan tcell.Event), make(chan struct{})
+	go screen.ChannelEvents(events, quit)
+	msgs := make(chan any)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for !m.done {
+		m.follow()
+		m.draw(screen)
+		var cmd uiCmd
+		select {
+		case ev := <-events:
+			switch ev := ev.(type) {
+			case *tcell.EventResize:
+				m.width, m.height = ev.Size()
+				screen.Sync()
+			case *tcell.EventKey:
+				cmd = m.key(uiKeyName(ev))
+			}
+		case msg := <-msgs:
+			cmd = m.update(msg)
+		case <-ticker.C:
+			// Redraw the elapsed time of a running step.
+		}
+		if cmd != nil {
+			go func() { msgs <- cmd() }()
+		}
+	}
+	close(quit)
+	screen.Fini()
+	for _, line := range m.log {
+		fmt.Fprintln(stdout, line)
+	}
+	return nil
+}
+
+// uiModel is the state of the terminal UI.
+type uiModel struct {
+	g       *gostgrator.Gostgrator
+	migs    []gostgrator.Migration
+	do      []gostgrator.Migration // the do migrations in ascending order
+	current int
+
+	// cursor is the selected migration and top the first one shown.
+	cursor, top int
+
+	// sql holds the lines of the files being inspected and offset the first
+	// one shown; sql is nil while the migration list is shown.
+	sql    []string
+	offset int
+
+	width, height int
+
+	// While running, step is the version being migrated to since started,
+	// stops the versions still to go and cancel stops the step.
+	running  bool
+	step     int
+	stops    []int
+	started  time.Time
+	cancel   context.CancelFunc
+	quitting bool
+	done     bool
+
+	log []string // finished steps and errors, oldest first
+}
+
+// uiCmd does slow work, such as running a migration, off the UI loop and
+// returns a message for uiModel.update.
+type uiCmd func() any
+
+// uiStepMsg reports that migrating to version finished.
+type uiStepMsg struct {
+	version int
+	took    time.Duration
+	err     error
+}
+
+// uiRefreshMsg carries reloaded migrations and the database version.
+type uiRefreshMsg struct {
+	migs    []gostgrator.Migration
+	current int
+	err     error
+}
+
+// uiLine is a line of the screen and the style it is drawn with.
+type uiLine struct {
+	text  string
+	style tcell.Style
+}
+
+// newUIModel loads the migrations and database version the UI starts with.
+func newUIModel(g *gostgrator.Gostgrator) (*uiModel, error) {
+	migs, err := g.GetMigrations()
+	if err != nil {
+		return nil, err
+	}
+	current, err := uiDatabaseVersion(g)
+	if err != nil {
+		return nil, err
+	}
+	m := &uiModel{g: g, current: current}
+	m.setMigrations(migs)
+	for i, mig := range m.do {
+		if mig.Version <= current {
+			m.cursor = i
+		}
+	}
+	return m, nil
+}
+
+// update applies the message returned by a uiCmd.
+func (m *uiModel) update(msg any) uiCmd {
+	switch msg := msg.(type) {
+	case uiStepMsg:
+		return m.stepDone(msg)
+	case uiRefreshMsg:
+		if msg.err != nil {
+			m.logf("Refresh failed: %v", msg.err)
+			return nil
+		}
+		if msg.migs != nil {
+			m.setMigrations(msg.migs)
+		}
+		m.current = msg.current
+	}
+	return nil
+}
+
+// uiKeyName names a key press the way uiModel.key expects.
+func uiKeyName(ev *tcell.EventKey) string {
+	switch ev.Key() {
+	case tcell.KeyRune:
+		return string(ev.Rune())
+	case tcell.KeyUp:
+		return "up"
+	case tcell.KeyDown:
+		return "down"
+	case tcell.KeyPgUp:
+		return "pgup"
+	case tcell.KeyPgDn:
+		return "pgdown"
+	case tcell.KeyHome:
+		return "home"
+	case tcell.KeyEnd:
+		return "end"
+	case tcell.KeyEnter:
+		return "enter"
+	case tcell.KeyEscape:
+		return "esc"
+	case tcell.KeyCtrlC:
+		return "ctrl+c"
+	}
+	return ""
+}
+
+// key handles a key press.
+func (m *uiModel) key(key string) uiCmd {
+	if key == "ctrl+c" {
+		m.quitting = true
+		if m.running {
+			// Quit once the canceled step has returned.
+			m.cancel()
+		} else {
+			m.done = true
+		}
+		return nil
+	}
+	if m.sql != nil {
+		switch key {
+		case "up", "k":
+			m.scroll(-1)
+		case "down", "j":
+			m.scroll(1)
+		case "pgup", "b":
+			m.scroll(-m.bodyHeight())
+		case "pgdown", "f", " ":
+			m.scroll(m.bodyHeight())
+		case "esc", "enter", "q":
+			m.sql = nil
+		}
+		return nil
+	}
+	switch key {
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		m.cursor = max(min(m.cursor+1, len(m.do)-1), 0)
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = max(len(m.do)-1, 0)
+	case "enter", "s":
+		m.showSQL()
+	case "q", "esc":
+		m.done = !m.running
+	}
+	if m.running {
+		return nil
+	}
+	versions := uiVersions(m.migs)
+	switch key {
+	case "u":
+		for _, v := range versions {
+			if v > m.current {
+				return m.migrateTo(v)
+			}
+		}
+		m.logf("Nothing to apply.")
+	case "d":
+		if m.current == 0 {
+			m.logf("Nothing to roll back.")
+			return nil
+		}
+		previous := 0
+		for _, v := range versions {
+			if v < m.current {
+				previous = v
+			}
+		}
+		return m.migrateTo(previous)
+	case "m":
+		if len(m.do) > 0 {
+			return m.migrateTo(m.do[m.cursor].Version)
+		}
+	case "r":
+		return m.refresh(true)
+	}
+	return nil
+}
+
+// migrateTo starts moving the database to target one migration at a time.
+func (m *uiModel) migrateTo(target int) uiCmd {
+	m.stops = uiStops(uiVersions(m.migs), m.current, target)
+	if len(m.stops) == 0 {
+		m.logf("Already at version %d.", target)
+		return nil
+	}
+	m.running = true
+	return m.nextStep()
+}
+
+// nextStep migrates to the first of the remaining stops.
+func (m *uiModel) nextStep() uiCmd {
+	m.step, m.stops = m.stops[0], m.stops[1:]
+	m.started = time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	m.cancel = cancel
+	g, version := m.g, m.step
+	return func() any {
+		start := time.Now()
+		_, err := g.Migrate(ctx, strconv.Itoa(version))
+		return uiStepMsg{version: version, took: time.Since(start), err: err}
+	}
+}
+
+// stepDone records a finished step and starts the next one, stopping at the
+// first failure.
+func (m *uiModel) stepDone(msg uiStepMsg) uiCmd {
+	m.cancel()
+	if msg.err != nil {
+		m.logf("Migrating to version %d failed: %v", msg.version, msg.err)
+		m.stops = nil
+	} else {
+		m.current = msg.version
+		m.logf("Migrated to version %d in %s.", msg.version, roundDuration(msg.took))
+	}
+	if m.quitting {
+		m.done = true
+		return nil
+	}
+	if len(m.stops) > 0 {
+		return m.nextStep()
+	}
+	m.running = false
+	// A failed step may have left the version anywhere between two stops.
+	return m.refresh(false)
+}
+
+// refresh reloads the database version, and the migration files too when
+// reload is set.
+func (m *uiModel) refresh(reload bool) uiCmd {
+	g := m.g
+	return func() any {
+		var msg uiRefreshMsg
+		if reload {
+			if msg.migs, msg.err = g.GetMigrations(); msg.err != nil {
+				return msg
+			}
+		}
+		msg.current, msg.err = uiDatabaseVersion(g)
+		return msg
+	}
+}
+
+// setMigrations replaces the migrations shown, keeping the cursor in range.
+func (m *uiModel) setMigrations(migs []gostgrator.Migration) {
+	m.migs = migs
+	m.do = m.do[:0]
+	for _, mig := range migs {
+		if mig.Action == "do" {
+			m.do = append(m.do, mig)
+		}
+	}
+	sort.Slice(m.do, func(i, j int) bool { return m.do[i].Version < m.do[j].Version })
+	m.cursor = max(min(m.cursor, len(m.do)-1), 0)
+}
+
+// showSQL switches to the do and undo files of the selected migration.
+func (m *uiModel) showSQL() {
+	if len(m.do) == 0 {
+		return
+	}
+	version := m.do[m.cursor].Version
+	var lines []string
+	for _, action := range []string{"do", "undo"} {
+		for _, mig := range m.migs {
+			if mig.Version != version || mig.Action != action {
+				continue
+			}
+			if len(lines) > 0 {
+				lines = append(lines, "")
+			}
+			lines = append(lines, fmt.Sprintf("--- %s (%s)", mig.Filename, mig.Action))
+			data, err := os.ReadFile(mig.Filename)
+			if err != nil {
+				lines = append(lines, fmt.Sprintf("Error reading %s: %v", mig.Filename, err))
+				continue
+			}
+			for _, line := range strings.Split(strings.TrimRight(string(data), "\r\n"), "\n") {
+				lines = append(lines, strings.ReplaceAll(strings.TrimSuffix(line, "\r"), "\t", "    "))
+			}
+		}
+	}
+	m.sql, m.offset = lines, 0
+}
+
+// scroll moves the SQL view by n lines.
+func (m *uiModel) scroll(n int) {
+	m.offset = max(min(m.offset+n, len(m.sql)-m.bodyHeight()), 0)
+}
+
+// follow scrolls the migration list so the cursor stays visible.
+func (m *uiModel) follow() {
+	body := m.bodyHeight()
+	if m.cursor < m.top {
+		m.top = m.cursor
+	}
+	if m.cursor >= m.top+body {
+		m.top = m.cursor - body + 1
+	}
+	m.top = max(min(m.top, len(m.do)-body), 0)
+}
+
+// bodyHeight is the number of lines left for the list or the SQL once the
+// header, the recent steps and the help line are drawn.
+func (m *uiModel) bodyHeight() int {
+	height := m.height
+	if height == 0 {
+		height = 24
+	}
+	used := 4 + min(len(m.log), uiLogLines)
+	if m.running {
+		used++
+	}
+	return max(height-used, 1)
+}
+
+// draw shows the current lines on screen. Each line is padded to the full
+// width instead of clearing the screen first, which would make tcell redraw
+// every cell.
+func (m *uiModel) draw(screen tcell.Screen) {
+	for y, line := range m.lines() {
+		pad := strings.Repeat(" ", max(m.width-utf8.RuneCountInString(line.text), 0))
+		screen.PutStrStyled(0, y, line.text+pad, line.style)
+	}
+	screen.Show()
+}
+
+// view returns the text of the screen, for tests.
+func (m *uiModel) view() string {
+	var b strings.Builder
+	for _, line := range m.lines() {
+		b.WriteString(line.text)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// lines lays out the screen: a header, the migration list or the SQL being
+// inspected, the most recent steps, the running step and the keys to press.
+func (m *uiModel) lines() []uiLine {
+	plain := tcell.StyleDefault
+	pending := 0
+	for _, mig := range m.do {
+		if mig.Version > m.current {
+			pending++
+		}
+	}
+	lines := []uiLine{
+		{fmt.Sprintf("gostgrator · database version %d · %d pending", m.current, pending), plain.Bold(true)},
+		{},
+	}
+
+	body := m.bodyHeight()
+	if m.sql != nil {
+		end := min(m.offset+body, len(m.sql))
+		for _, line := range m.sql[m.offset:end] {
+			lines = append(lines, uiLine{line, plain})
+		}
+		body -= end - m.offset
+	} else {
+		end := min(m.top+body, len(m.do))
+		for i := m.top; i < end; i++ {
+			lines = append(lines, uiLine{m.row(i), plain.Reverse(i == m.cursor)})
+		}
+		body -= end - m.top
+		if len(m.do) == 0 {
+			lines = append(lines, uiLine{"No migrations found.", plain})
+			body--
+		}
+	}
+	for ; body > 0; body-- {
+		lines = append(lines, uiLine{})
+	}
+
+	lines = append(lines, uiLine{})
+	for _, line := range m.log[max(len(m.log)-uiLogLines, 0):] {
+		lines = append(lines, uiLine{line, plain})
+	}
+	if m.running {
+		progress := fmt.Sprintf("Migrating to version %d... %s", m.step, time.Since(m.started).Round(100*time.Millisecond))
+		if len(m.stops) > 0 {
+			progress += fmt.Sprintf(" (%d more to go)", len(m.stops))
+		}
+		lines = append(lines, uiLine{progress, plain.Bold(true)})
+	}
+	return append(lines, uiLine{m.help(), plain.Dim(true)})
+}
+
+// row renders migration i of the list.
+func (m *uiModel) row(i int) string {
+	mig := m.do[i]
+	state := "pending"
+	if mig.Version <= m.current {
+		state = "applied"
+	}
+	if m.running && mig.Version == m.step {
+		state = "running"
+	}
+	annot := ""
+	if mig.Version == m.current {
+		annot = " <== current"
+	}
+	return fmt.Sprintf("  %-8s Version %d: %s (%s)%s", state, mig.Version, mig.Name, mig.Filename, annot)
+}
+
+// help lists the keys that work in the current view.
+func (m *uiModel) help() string {
+	switch {
+	case m.sql != nil:
+		return "↑/↓ scroll · pgup/pgdn page · esc back"
+	case m.running:
+		return "↑/↓ select · enter show SQL · ctrl+c cancel and quit"
+	default:
+		return "↑/↓ select · enter show SQL · u up · d down · m migrate to selected · r refresh · q quit"
+	}
+}
+
+// logf records a step, prefixed with the time like other CLI output.
+func (m *uiModel) logf(format string, args ...any) {
+	line := fmt.Sprintf("[%s] ", time.Now().Format(time.Kitchen)) + fmt.Sprintf(format, args...)
+	m.log = append(m.log, gostgrator.RedactCredentials(line))
+}
+
+// uiStops returns the versions to migrate through, in order, to move from
+// current to target one migration at a time.
+func uiStops(versions []int, current, target int) []int {
+	var stops []int
+	if target > current {
+		for _, v := range versions {
+			if v > current && v <= target {
+				stops = append(stops, v)
+			}
+		}
+		return stops
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i] < current && versions[i] > target {
+			stops = append(stops, versions[i])
+		}
+	}
+	if target < current {
+		stops = append(stops, target)
+	}
+	return stops
+}
+
+// uiDatabaseVersion fetches the current database version.
+func uiDatabaseVersion(g *gostgrator.Gostgrator) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	return g.GetDatabaseVersion(ctx)
+}
+
+// uiVersions returns the sorted versions that can be migrated up to.
+func uiVersions(migs []gostgrator.Migration) []int {
+	var versions []int
+	for _, m := range migs {
+		if m.Action == "do" {
+			versions = append(versions, m.Version)
+		}
+	}
+	sort.Ints(versions)
+	return versions
+}
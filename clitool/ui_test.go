@@ -0,0 +1,108 @@
+package clitool
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bcomnes/gostgrator"
+	"github.com/gdamore/tcell/v2"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// uiPress sends keys to m and runs the commands they start, so steps finish
+// before the next key like they would for a person watching them.
+func uiPress(m *uiModel, keys ...string) {
+	for _, key := range keys {
+		for cmd := m.key(key); cmd != nil; {
+			cmd = m.update(cmd())
+		}
+		m.follow()
+	}
+}
+
+// TestUI steps a SQLite database up and down through the terminal UI and
+// checks the list, the SQL view and the progress log.
+func TestUI(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"001.do.items.sql":    "CREATE TABLE items (id INTEGER);",
+		"001.undo.items.sql":  "DROP TABLE items;",
+		"002.do.more.sql":     "INSERT INTO items VALUES (1);",
+		"002.undo.more.sql":   "DELETE FROM items;",
+		"003.do.other.sql":    "CREATE TABLE other (id INTEGER);",
+		"003.undo.other.sql":  "DROP TABLE other;",
+		"004.do.broken.sql":   "CREATE TABLE items (id INTEGER);",
+		"004.undo.broken.sql": "SELECT 1;",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "ui.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{Driver: "sqlite3", MigrationPattern: filepath.Join(dir, "*.sql")}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := newUIModel(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.width, m.height = 200, 20
+
+	uiPress(m, "u", "u")
+	if m.current != 2 || m.running {
+		t.Fatalf("expected two steps up to leave version 2, got %d (running %v)", m.current, m.running)
+	}
+	view := m.view()
+	for _, want := range []string{"database version 2 · 2 pending", "applied  Version 2: more", "pending  Version 3: other", "Migrated to version 2 in"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("expected %q in the view, got:\n%s", want, view)
+		}
+	}
+
+	uiPress(m, "down", "enter")
+	if view := m.view(); !strings.Contains(view, "002.undo.more.sql (undo)") || !strings.Contains(view, "DELETE FROM items;") {
+		t.Errorf("expected the SQL of version 2, got:\n%s", view)
+	}
+	uiPress(m, "esc", "down", "down", "m")
+	if m.current != 3 {
+		t.Errorf("expected the failed migration to leave version 3, got %d", m.current)
+	}
+	if log := strings.Join(m.log, "\n"); !strings.Contains(log, "Migrated to version 3 in") || !strings.Contains(log, "Migrating to version 4 failed") {
+		t.Errorf("expected version 3 to apply and version 4 to fail, got:\n%s", log)
+	}
+
+	uiPress(m, "d", "d")
+	if m.current != 1 {
+		t.Errorf("expected two steps down to leave version 1, got %d", m.current)
+	}
+	uiPress(m, "q")
+	if !m.done {
+		t.Errorf("expected q to quit")
+	}
+}
+
+// TestUIKeyName checks the names terminal key presses are handled by.
+func TestUIKeyName(t *testing.T) {
+	for _, tt := range []struct {
+		ev   *tcell.EventKey
+		want string
+	}{
+		{tcell.NewEventKey(tcell.KeyRune, 'u', tcell.ModNone), "u"},
+		{tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone), "down"},
+		{tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), "enter"},
+		{tcell.NewEventKey(tcell.KeyCtrlC, 0, tcell.ModCtrl), "ctrl+c"},
+	} {
+		if got := uiKeyName(tt.ev); got != tt.want {
+			t.Errorf("expected %q for %s, got %q", tt.want, tt.ev.Name(), got)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package clitool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// workspaceFile is the name of the file listing the migration projects of a
+// monorepo, looked for in the working directory and its parents.
+const workspaceFile = "gostgrator.work.json"
+
+// workspace is a workspace file: the migration projects of a monorepo.
+type workspace struct {
+	Projects []workspaceProject `json:"projects"`
+}
+
+// workspaceProject is one migration project of a workspace file. Its
+// migration pattern is relative to the workspace file's directory.
+type workspaceProject struct {
+	// Name selects the project with -project.
+	Name string `json:"name"`
+	// MigrationPattern is the glob of the project's migration files.
+	MigrationPattern string `json:"migrationPattern"`
+	// SchemaTable is the project's schema table, e.g. "billing_schemaversion"
+	// when projects share a database (default "schemaversion").
+	SchemaTable string `json:"schemaTable,omitempty"`
+	// ConnEnv is the environment variable holding the project's connection
+	// URL, read instead of the Tool's ConnEnv.
+	ConnEnv string `json:"connEnv,omitempty"`
+}
+
+// project is the workspace project selected with -project, or nil.
+var project *workspaceProject
+
+// findWorkspace returns the path of the workspace file in the working
+// directory or the nearest parent that has one.
+func findWorkspace() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, workspaceFile)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no %s found in the working directory or its parents; pass -workspace", workspaceFile)
+		}
+		dir = parent
+	}
+}
+
+// loadWorkspace reads the workspace file at path, or finds one when path is
+// empty, and resolves each project's migration pattern from its directory.
+func loadWorkspace(path string) ([]workspaceProject, error) {
+	if path == "" {
+		var err error
+		if path, err = findWorkspace(); err != nil {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace file: %w", err)
+	}
+	var w workspace
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&w); err != nil {
+		return nil, fmt.Errorf("invalid workspace file %s: %w", path, err)
+	}
+	if len(w.Projects) == 0 {
+		return nil, fmt.Errorf("workspace file %s lists no projects", path)
+	}
+	var errs []error
+	seen := make(map[string]bool)
+	for i, p := range w.Projects {
+		switch {
+		case p.Name == "":
+			errs = append(errs, fmt.Errorf("project %d has no name", i+1))
+		case seen[p.Name]:
+			errs = append(errs, fmt.Errorf("project %q is listed more than once", p.Name))
+		case p.MigrationPattern == "":
+			errs = append(errs, fmt.Errorf("project %q has no migrationPattern", p.Name))
+		}
+		seen[p.Name] = true
+		if p.MigrationPattern != "" && !filepath.IsAbs(p.MigrationPattern) {
+			w.Projects[i].MigrationPattern = filepath.Join(filepath.Dir(path), p.MigrationPattern)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid workspace file %s: %w", path, err)
+	}
+	return w.Projects, nil
+}
+
+// selectProject returns the project called name.
+func selectProject(projects []workspaceProject, name string) (*workspaceProject, error) {
+	i := slices.IndexFunc(projects, func(p workspaceProject) bool { return p.Name == name })
+	if i < 0 {
+		names := make([]string, len(projects))
+		for j, p := range projects {
+			names[j] = p.Name
+		}
+		return nil, fmt.Errorf("unknown project %q; the workspace lists: %s", name, strings.Join(names, ", "))
+	}
+	return &projects[i], nil
+}
+
+// allProjectsFlag matches -all-projects on the command line, in any of the
+// forms the flag package accepts.
+var allProjectsFlag = regexp.MustCompile(`^--?all-projects(=.*)?$`)
+
+// runAllProjects runs the command line once for each project, as this binary
+// with -project in place of -all-projects, from dir, the directory the
+// command was started in. Each run prints its own output after a header.
+// It returns the exit code of the first project that failed, after running
+// them all.
+func runAllProjects(projects []workspaceProject, dir string) int {
+	executable, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return ExitFailure
+	}
+	var args []string
+	for _, arg := range os.Args[1:] {
+		if !allProjectsFlag.MatchString(arg) {
+			args = append(args, arg)
+		}
+	}
+	code := ExitOK
+	var failed []string
+	for _, p := range projects {
+		fmt.Fprintf(stdout, "[%s] Project %s:\n", time.Now().Format(time.Kitchen), p.Name)
+		cmd := exec.Command(executable, slices.Concat([]string{"-project", p.Name}, args)...)
+		cmd.Dir = dir
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			projectCode := ExitFailure
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				projectCode = exitErr.ExitCode()
+			} else {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+			}
+			if code == ExitOK {
+				code = projectCode
+			}
+			failed = append(failed, p.Name)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(stderr, "%d of %d projects failed: %s\n", len(failed), len(projects), strings.Join(failed, ", "))
+	} else {
+		fmt.Fprintf(stdout, "[%s] All %d projects succeeded.\n", time.Now().Format(time.Kitchen), len(projects))
+	}
+	return code
+}
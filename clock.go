@@ -0,0 +1,25 @@
+package gostgrator
+
+import "time"
+
+// Clock tells the time. Set Config.Clock to a fixed clock for deterministic
+// timestamp versions, run_at values and backup names in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to a Clock, e.g.
+//
+//	cfg.Clock = gostgrator.ClockFunc(func() time.Time { return fixed })
+type ClockFunc func() time.Time
+
+// Now returns f().
+func (f ClockFunc) Now() time.Time { return f() }
+
+// now reads Config.Clock, or the system clock when it is unset.
+func (cfg Config) now() time.Time {
+	if cfg.Clock != nil {
+		return cfg.Clock.Now()
+	}
+	return time.Now()
+}
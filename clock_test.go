@@ -0,0 +1,34 @@
+package gostgrator
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestClockRunAt verifies that the SQL recording runs, and its arguments,
+// stamp them with Config.Clock.
+func TestClockRunAt(t *testing.T) {
+	fixed := time.Date(2024, 6, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	cfg := Config{SchemaTable: "schemaversion", AuditHistory: true, Clock: ClockFunc(func() time.Time { return fixed })}
+	client := NewSqlite3Client(cfg, nil)
+	m := Migration{Version: 3, Action: "do", Name: "users", Md5: "abc"}
+	for name, query := range map[string]string{
+		"PersistActionSql":  client.PersistActionSql(m),
+		"PersistHistorySql": client.PersistHistorySql(m),
+	} {
+		if !strings.Contains(query, "'2024-06-01T10:00:00Z'") {
+			t.Errorf("expected %s to use the clock's time in UTC:\n%s", name, query)
+		}
+	}
+	ac := client.(ArgsClient)
+	for name, args := range map[string]func(Migration) (string, []any){
+		"PersistActionArgs":  ac.PersistActionArgs,
+		"PersistHistoryArgs": ac.PersistHistoryArgs,
+	} {
+		if _, got := args(m); !slices.Contains(got, any("2024-06-01T10:00:00Z")) {
+			t.Errorf("expected %s to pass the clock's time in UTC, got %v", name, got)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package gostgrator
+
+import (
+	"context"
+	"fmt"
+)
+
+// sqliteSizeSql returns the size in bytes of the main SQLite database file.
+const sqliteSizeSql = `SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size();`
+
+// CompactStats reports the database size before and after a compaction.
+type CompactStats struct {
+	// SizeBefore is the database size in bytes before compacting.
+	SizeBefore int64
+	// SizeAfter is the database size in bytes after compacting.
+	SizeAfter int64
+}
+
+// Compact rebuilds a SQLite database with VACUUM, returning the space left
+// behind by dropped tables and deleted rows to the file system. It is only
+// supported by the sqlite3 driver.
+func (g *Gostgrator) Compact(ctx context.Context) (CompactStats, error) {
+	var stats CompactStats
+	if _, ok := g.client.(*Sqlite3Client); !ok {
+		return stats, fmt.Errorf("compacting is only supported for sqlite3, not %s", g.cfg.Driver)
+	}
+	var err error
+	if stats.SizeBefore, err = g.sqliteSize(ctx); err != nil {
+		return stats, err
+	}
+	if _, err := g.client.ExecContext(ctx, "VACUUM;"); err != nil {
+		return stats, fmt.Errorf("failed to compact database: %w", err)
+	}
+	stats.SizeAfter, err = g.sqliteSize(ctx)
+	return stats, err
+}
+
+// autoCompact compacts the database after a rollback or drop when
+// Config.SQLiteAutoVacuum is set. Other drivers are left untouched.
+func (g *Gostgrator) autoCompact(ctx context.Context) error {
+	if _, ok := g.client.(*Sqlite3Client); !ok || !g.cfg.SQLiteAutoVacuum {
+		return nil
+	}
+	_, err := g.Compact(ctx)
+	return err
+}
+
+// sqliteSize returns the size of the SQLite database in bytes.
+func (g *Gostgrator) sqliteSize(ctx context.Context) (int64, error) {
+	rows, err := g.client.QueryContext(ctx, sqliteSizeSql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var size int64
+	if rows.Next() {
+		if err := rows.Scan(&size); err != nil {
+			return 0, err
+		}
+	}
+	return size, rows.Err()
+}
@@ -0,0 +1,217 @@
+package gostgrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// NewConfig returns a Config holding the defaults New fills in for unset
+// fields, as a starting point to override.
+func NewConfig() Config {
+	return DefaultConfig
+}
+
+// LoadConfigFile reads the JSON configuration file at path into cfg,
+// overriding the fields it sets. Relative MigrationPattern, ExcludePattern,
+// CacheFile, TrustedKeysFile and SQLiteBackupDir values in the file are
+// resolved from the file's directory, so "-config infra/gostgrator.json"
+// with "migrationPattern": "migrations/*.sql" finds infra/migrations. An
+// ExcludePattern without a slash, or starting with "**", is left as is since
+// it matches anywhere. Set PathsFromWorkingDir in the file to resolve its
+// paths from the working directory instead. With StrictConfig, set in cfg
+// beforehand or in the file, keys that match no field are an error.
+func LoadConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var set map[string]json.RawMessage
+	if err := json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return err
+	}
+	if cfg.StrictConfig != nil && *cfg.StrictConfig {
+		if err := checkConfigKeys(data, set); err != nil {
+			return err
+		}
+	}
+	dir := filepath.Dir(path)
+	if cfg.PathsFromWorkingDir || dir == "." {
+		return nil
+	}
+	resolve := func(key string, p *string) {
+		if _, ok := set[key]; ok && *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	resolve("migrationPattern", &cfg.MigrationPattern)
+	resolve("cacheFile", &cfg.CacheFile)
+	resolve("trustedKeysFile", &cfg.TrustedKeysFile)
+	resolve("sqliteBackupDir", &cfg.SQLiteBackupDir)
+	if strings.Contains(cfg.ExcludePattern, "/") && !strings.HasPrefix(cfg.ExcludePattern, "**") {
+		resolve("excludePattern", &cfg.ExcludePattern)
+	}
+	return nil
+}
+
+// checkConfigKeys decodes the config file data again, refusing unknown
+// fields, and reports the keys of set that match no field of Config, each
+// with the closest known key when one is near.
+func checkConfigKeys(data []byte, set map[string]json.RawMessage) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&Config{})
+	if err == nil {
+		return nil
+	}
+	known := configKeys()
+	var unknown []string
+	for key := range set {
+		// encoding/json matches keys to fields without regard to case.
+		if !slices.ContainsFunc(known, func(k string) bool { return strings.EqualFold(k, key) }) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return err
+	}
+	slices.Sort(unknown)
+	described := make([]string, len(unknown))
+	for i, key := range unknown {
+		described[i] = fmt.Sprintf("%q", key)
+		if suggestion := closestKey(key, known); suggestion != "" {
+			described[i] += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+	}
+	return fmt.Errorf("unknown config keys: %s; set \"strictConfig\": false to ignore them", strings.Join(described, ", "))
+}
+
+// configKeys returns the JSON keys of Config's fields.
+func configKeys() []string {
+	var keys []string
+	t := reflect.TypeFor[Config]()
+	for i := range t.NumField() {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if key != "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// closestKey returns the key of known with the smallest edit distance to
+// key, ignoring case, or "" when none is within a third of key's length.
+func closestKey(key string, known []string) string {
+	best, bestDistance := "", len(key)/3+1
+	for _, k := range known {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(k)); d < bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// Validate checks cfg without touching the database, so a CLI or service can
+// report a bad configuration before connecting: the driver must be built in
+// or registered, MigrationPattern must be set unless Sources supply the
+// migrations, enumerated settings such as Newline and Transaction must hold
+// known values, and options that contradict each other must not both be set.
+// Every problem found is reported, joined into one error.
+//
+// New runs the same checks, except that it allows an empty
+// MigrationPattern, for instances only used for locks or the schema table.
+func (cfg Config) Validate() error {
+	var errs []error
+	if cfg.MigrationPattern == "" && len(cfg.Sources) == 0 {
+		errs = append(errs, errors.New("MigrationPattern is required"))
+	}
+	return errors.Join(append(errs, cfg.validate()...)...)
+}
+
+// validate returns the problems Validate and New report.
+func (cfg Config) validate() []error {
+	var errs []error
+	if !slices.Contains(clientNames(), strings.ToLower(cfg.Driver)) {
+		errs = append(errs, fmt.Errorf("db driver '%s' not supported. Must be one of: %s", cfg.Driver, strings.Join(clientNames(), ", ")))
+	}
+	switch cfg.Newline {
+	case "", "LF", "CR", "CRLF":
+	default:
+		errs = append(errs, fmt.Errorf("unknown newline %q, must be one of: LF, CR or CRLF", cfg.Newline))
+	}
+	if !slices.Contains(transactionModes, strings.ToLower(cfg.Transaction)) {
+		errs = append(errs, fmt.Errorf("unknown transaction mode %q, must be one of: none, each or all", cfg.Transaction))
+	}
+	if _, err := newChecksumStyle(cfg.Newline, cfg.ChecksumCompat); err != nil {
+		errs = append(errs, err)
+	}
+	switch cfg.MigrationFormat {
+	case "", "gostgrator", "golang-migrate":
+	default:
+		errs = append(errs, fmt.Errorf("unknown migration format %q, must be one of: gostgrator or golang-migrate", cfg.MigrationFormat))
+	}
+	switch cfg.FilenameStyle {
+	case "", "do-undo", "up-down", "golang-migrate":
+	default:
+		errs = append(errs, fmt.Errorf("unknown filename style %q, must be one of: do-undo, up-down or golang-migrate", cfg.FilenameStyle))
+	}
+	switch cfg.NotifyOn {
+	case "", NotifyAlways, NotifyFailure:
+	default:
+		errs = append(errs, fmt.Errorf("unknown notify policy %q, must be one of: %s or %s", cfg.NotifyOn, NotifyAlways, NotifyFailure))
+	}
+	if err := checkQualified("SchemaTable", cfg.SchemaTable); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkQualified("GolangMigrateTable", cfg.GolangMigrateTable); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.MaxApplyPerRun < 0 {
+		errs = append(errs, fmt.Errorf("MaxApplyPerRun must be at least 0, got %d", cfg.MaxApplyPerRun))
+	}
+	if cfg.DataLossThreshold < 0 {
+		errs = append(errs, fmt.Errorf("DataLossThreshold must be at least 0, got %d", cfg.DataLossThreshold))
+	}
+	if cfg.VerifySignatures && cfg.TrustedKeysFile == "" {
+		errs = append(errs, errors.New("VerifySignatures requires a TrustedKeysFile"))
+	}
+	if cfg.RecordProgress && strings.EqualFold(cfg.Transaction, "all") {
+		errs = append(errs, errors.New("RecordProgress cannot be used with Transaction \"all\": the recorded progress would roll back with the failed run"))
+	}
+	for _, tag := range cfg.IncludeTags {
+		if slices.Contains(cfg.ExcludeTags, tag) {
+			errs = append(errs, fmt.Errorf("tag %q is in both IncludeTags and ExcludeTags", tag))
+		}
+	}
+	return errs
+}
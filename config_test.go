@@ -0,0 +1,114 @@
+package gostgrator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	cfg := NewConfig()
+	if cfg.SchemaTable != "schemaversion" || !cfg.ValidateChecksums {
+		t.Errorf("expected NewConfig to hold the defaults, got %+v", cfg)
+	}
+	cfg.Driver = "sqlite3"
+	cfg.MigrationPattern = "migrations/*.sql"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected a valid config, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"driver", func(c *Config) { c.Driver = "oracle" }, "db driver 'oracle' not supported"},
+		{"pattern", func(c *Config) { c.MigrationPattern = "" }, "MigrationPattern is required"},
+		{"newline", func(c *Config) { c.Newline = "lf" }, `unknown newline "lf"`},
+		{"checksum compat", func(c *Config) { c.ChecksumCompat = "flyway" }, `unknown checksum compatibility "flyway"`},
+		{"filename style", func(c *Config) { c.FilenameStyle = "flyway" }, `unknown filename style "flyway"`},
+		{"transaction", func(c *Config) { c.Transaction = "some" }, `unknown transaction mode "some"`},
+		{"progress in one transaction", func(c *Config) { c.RecordProgress, c.Transaction = true, "ALL" }, "RecordProgress cannot be used"},
+		{"tags", func(c *Config) { c.IncludeTags, c.ExcludeTags = []string{"slow"}, []string{"slow"} }, `tag "slow" is in both`},
+	} {
+		c := cfg
+		tc.modify(&c)
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	bad := Config{Driver: "oracle", Newline: "lf"}
+	err := bad.Validate()
+	if err == nil || strings.Count(err.Error(), "\n") != 2 {
+		t.Errorf("expected all three problems to be reported, got %v", err)
+	}
+	if _, err := NewGostgrator(Config{Driver: "sqlite3"}, nil); err != nil {
+		t.Errorf("expected New to allow an empty MigrationPattern, got %v", err)
+	}
+	if _, err := NewGostgrator(Config{Driver: "sqlite3", Newline: "lf"}, nil); err == nil {
+		t.Error("expected New to validate the config")
+	}
+}
+
+// TestLoadConfigFile verifies that relative paths in a config file resolve
+// from its directory unless it opts out.
+func TestLoadConfigFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "infra")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "gostgrator.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"migrationPattern": "migrations/*.sql", "excludePattern": "**/draft_*.sql", "cacheFile": "/var/cache/gostgrator.json"}`)
+	cfg := Config{Driver: "pg", TrustedKeysFile: "keys"}
+	if err := LoadConfigFile(path, &cfg); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if want := filepath.Join(dir, "migrations", "*.sql"); cfg.MigrationPattern != want {
+		t.Errorf("expected pattern %q, got %q", want, cfg.MigrationPattern)
+	}
+	if cfg.ExcludePattern != "**/draft_*.sql" || cfg.CacheFile != "/var/cache/gostgrator.json" || cfg.TrustedKeysFile != "keys" || cfg.Driver != "pg" {
+		t.Errorf("expected other values to be left as they are, got %+v", cfg)
+	}
+
+	write(`{"migrationPattern": "migrations/*.sql", "pathsFromWorkingDir": true}`)
+	cfg = Config{}
+	if err := LoadConfigFile(path, &cfg); err != nil || cfg.MigrationPattern != "migrations/*.sql" {
+		t.Errorf("expected pathsFromWorkingDir to keep the pattern, got %q (%v)", cfg.MigrationPattern, err)
+	}
+}
+
+func TestLoadConfigFileStrict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gostgrator.json")
+	if err := os.WriteFile(path, []byte(`{"schmaTable": "versions", "SchemaTable": "versions", "frobnicate": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{}
+	if err := LoadConfigFile(path, &cfg); err != nil {
+		t.Errorf("expected unknown keys to be ignored without StrictConfig, got %v", err)
+	}
+
+	strict := true
+	cfg = Config{StrictConfig: &strict}
+	err := LoadConfigFile(path, &cfg)
+	want := `unknown config keys: "frobnicate", "schmaTable" (did you mean "schemaTable"?)`
+	if err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("expected error starting with %q, got %v", want, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"schmaTable": "versions", "strictConfig": false}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg = Config{StrictConfig: &strict}
+	if err := LoadConfigFile(path, &cfg); err != nil {
+		t.Errorf("expected the file to opt out of StrictConfig, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrDataLoss is returned, wrapped with the tables and columns at stake, when
+// Config.CheckDataLoss finds that the undo migrations of a rollback would
+// destroy data and Config.AcknowledgeDataLoss is not set.
+var ErrDataLoss = errors.New("rolling back would destroy data")
+
+// DataLoss is data an undo migration would destroy by dropping a table or a
+// column that holds it.
+type DataLoss struct {
+	// Migration is the undo migration that drops the object.
+	Migration Migration
+	// Object is the dropped table or column, such as "table users" or
+	// "column users.email".
+	Object string
+	// Rows is the number of rows in the table, or of rows with a value in
+	// the column.
+	Rows int64
+}
+
+// String describes the loss, e.g. "version 3 drops column users.email
+// holding 1200 rows".
+func (l DataLoss) String() string {
+	return fmt.Sprintf("version %d drops %s holding %d rows", l.Migration.Version, l.Object, l.Rows)
+}
+
+// droppedTablePattern finds tables a statement drops.
+var droppedTablePattern = regexp.MustCompile(`(?i)\bDROP\s+TABLE(?:\s+IF\s+EXISTS)?\s+` + tableName)
+
+// droppedColumnPattern finds columns a statement drops and their tables.
+var droppedColumnPattern = regexp.MustCompile(`(?i)\bALTER\s+TABLE(?:\s+IF\s+EXISTS)?(?:\s+ONLY)?\s+` + tableName + `\s+DROP\s+(?:COLUMN\s+)?(?:IF\s+EXISTS\s+)?("[^"]+"|[\w$]+)`)
+
+// DataLoss reports the data that migrating down to target would destroy:
+// the rows of each table, and the values of each column, that the undo
+// migrations drop, where there are more than Config.DataLossThreshold. Drops
+// are found by simple pattern matching rather than a full SQL parser. It
+// does not change the database, and works whether or not
+// Config.CheckDataLoss is set, for reporting the data at stake before a
+// rollback; verify it with target "0" to cover every applied migration. It
+// is supported by the pg and sqlite3 drivers.
+func (g *Gostgrator) DataLoss(ctx context.Context, target string) ([]DataLoss, error) {
+	runnable, err := g.Plan(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return g.dataLoss(ctx, runnable)
+}
+
+// dataLoss returns the data the undo migrations among migrations would
+// destroy, above Config.DataLossThreshold.
+func (g *Gostgrator) dataLoss(ctx context.Context, migrations []Migration) ([]DataLoss, error) {
+	var losses []DataLoss
+	var schema *Schema
+	for _, m := range migrations {
+		if m.Action != "undo" {
+			continue
+		}
+		script, err := g.sql(m)
+		if err != nil {
+			return nil, err
+		}
+		dropped := droppedObjects(stripComments(script))
+		if len(dropped) == 0 {
+			continue
+		}
+		// Only describe the schema once a rollback drops something.
+		if schema == nil {
+			s, err := g.DescribeSchema(ctx)
+			if err != nil {
+				return nil, err
+			}
+			schema = &s
+		}
+		for _, object := range dropped {
+			rows, err := g.countRows(ctx, *schema, object)
+			if err != nil {
+				return nil, err
+			}
+			if rows > g.cfg.DataLossThreshold {
+				losses = append(losses, DataLoss{Migration: m, Object: object.String(), Rows: rows})
+			}
+		}
+	}
+	return losses, nil
+}
+
+// checkDataLoss returns an error wrapping ErrDataLoss if Config.CheckDataLoss
+// is set, Config.AcknowledgeDataLoss is not, and the undo migrations among
+// migrations would destroy data.
+func (g *Gostgrator) checkDataLoss(ctx context.Context, migrations []Migration) error {
+	if !g.cfg.CheckDataLoss || g.cfg.AcknowledgeDataLoss {
+		return nil
+	}
+	losses, err := g.dataLoss(ctx, migrations)
+	if err != nil {
+		return err
+	}
+	if len(losses) == 0 {
+		return nil
+	}
+	described := make([]string, len(losses))
+	for i, l := range losses {
+		described[i] = l.String()
+	}
+	return fmt.Errorf("%w: %s", ErrDataLoss, strings.Join(described, "; "))
+}
+
+// droppedObjects returns the tables and columns a script drops, in the order
+// they first appear.
+func droppedObjects(script string) []schemaObject {
+	type found struct {
+		at     int
+		object schemaObject
+	}
+	var objects []found
+	for _, loc := range droppedTablePattern.FindAllStringSubmatchIndex(script, -1) {
+		objects = append(objects, found{loc[0], schemaObject{kind: "table", table: normalizeTable(script[loc[2]:loc[3]])}})
+	}
+	for _, loc := range droppedColumnPattern.FindAllStringSubmatchIndex(script, -1) {
+		name := normalizeTable(script[loc[4]:loc[5]])
+		if !slices.Contains(notColumns, strings.ToLower(name)) {
+			objects = append(objects, found{loc[0], schemaObject{kind: "column", table: normalizeTable(script[loc[2]:loc[3]]), name: name}})
+		}
+	}
+	slices.SortStableFunc(objects, func(a, b found) int { return a.at - b.at })
+	var dropped []schemaObject
+	for _, o := range objects {
+		if !slices.Contains(dropped, o.object) {
+			dropped = append(dropped, o.object)
+		}
+	}
+	return dropped
+}
+
+// countRows returns the number of rows in a table, or of rows with a value
+// in a column, or 0 when the schema does not hold it.
+func (g *Gostgrator) countRows(ctx context.Context, schema Schema, object schemaObject) (int64, error) {
+	i := slices.IndexFunc(schema.Tables, func(t TableInfo) bool {
+		return sameTable(strings.ToLower(t.Name), strings.ToLower(object.table))
+	})
+	if i < 0 {
+		return 0, nil
+	}
+	table := schema.Tables[i]
+	query := "SELECT COUNT(*) FROM " + quoteQualified(table.Name)
+	if object.kind == "column" {
+		j := slices.IndexFunc(table.Columns, func(c ColumnInfo) bool { return strings.EqualFold(c.Name, object.name) })
+		if j < 0 {
+			return 0, nil
+		}
+		query += " WHERE " + quoteIdentifier(table.Columns[j].Name) + " IS NOT NULL"
+	}
+	var rows int64
+	err := g.queryRows(ctx, query+";", func(r *sql.Rows) error {
+		return r.Scan(&rows)
+	})
+	return rows, err
+}
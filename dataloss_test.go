@@ -0,0 +1,71 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCheckDataLoss verifies that rollbacks dropping tables or columns that
+// hold data are refused until acknowledged, and that PlanDown and DataLoss
+// report the rows at stake.
+func TestCheckDataLoss(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "dataloss.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	pattern := writeDriftedMigrations(t, map[string]string{
+		"001.do.users.sql":    "CREATE TABLE users (id INTEGER);",
+		"001.undo.users.sql":  "DROP TABLE IF EXISTS users;",
+		"002.do.email.sql":    "ALTER TABLE users ADD COLUMN email TEXT;",
+		"002.undo.email.sql":  "-- DROP TABLE users;\nALTER TABLE users DROP COLUMN email;",
+		"003.do.orders.sql":   "CREATE TABLE orders (id INTEGER);",
+		"003.undo.orders.sql": "DROP TABLE orders;",
+	})
+	g, err := NewGostgrator(Config{Driver: "sqlite3", MigrationPattern: pattern, CheckDataLoss: true}, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO users VALUES (1, 'a@example.com'), (2, NULL), (3, NULL);"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := g.Down(ctx, 1); err != nil {
+		t.Fatalf("expected rolling back the empty orders table to succeed, got %v", err)
+	}
+	impacts, err := g.PlanDown(ctx, 2)
+	if err != nil {
+		t.Fatalf("plan down failed: %v", err)
+	}
+	if len(impacts) != 2 || len(impacts[0].DataLoss) != 1 || impacts[0].DataLoss[0].Object != "column users.email" || impacts[0].DataLoss[0].Rows != 1 ||
+		len(impacts[1].DataLoss) != 1 || impacts[1].DataLoss[0].Rows != 3 {
+		t.Fatalf("expected 1 email and 3 users at stake, got %+v", impacts)
+	}
+	if _, err := g.Down(ctx, 1); !errors.Is(err, ErrDataLoss) || !strings.Contains(err.Error(), "version 2 drops column users.email holding 1 rows") {
+		t.Fatalf("expected the rollback to be refused, got %v", err)
+	}
+	if version, err := g.GetDatabaseVersion(ctx); err != nil || version != 2 {
+		t.Fatalf("expected the database to stay at version 2, got %d (%v)", version, err)
+	}
+
+	g.cfg.DataLossThreshold = 1
+	losses, err := g.DataLoss(ctx, "0")
+	if err != nil || len(losses) != 1 || losses[0].Object != "table users" {
+		t.Fatalf("expected only the users table above the threshold, got %+v (%v)", losses, err)
+	}
+	if _, err := g.Down(ctx, 1); err != nil {
+		t.Fatalf("expected a rollback within the threshold to succeed, got %v", err)
+	}
+	g.cfg.AcknowledgeDataLoss = true
+	if _, err := g.Down(ctx, 1); err != nil {
+		t.Fatalf("expected an acknowledged rollback to succeed, got %v", err)
+	}
+}
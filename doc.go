@@ -7,7 +7,8 @@
 //
 // A thin driver layer (currently PostgreSQL and SQLite) supplies SQL
 // dialect differences.  Companion CLI tools live under sub-packages
-// *pg* and *sqlite*; the core logic is here.
+// *pg* and *sqlite*, built on the *clitool* sub-package, which also builds
+// custom migrator binaries; the core logic is here.
 //
 // # Install
 //
@@ -41,8 +42,57 @@
 //   - Driver            — database driver name ("pg", "sqlite3")
 //   - SchemaTable       — table that stores migration state (default "schemaversion")
 //   - MigrationPattern  — glob for locating migration files
+//   - PathsFromWorkingDir — resolve a config file's relative paths from the working directory
+//   - StrictConfig      — make LoadConfigFile fail on unknown keys, suggesting the closest
+//   - ExcludePattern    — glob of files to ignore, e.g. "**/draft_*.sql"
 //   - Newline           — line-ending style when scaffolding new migrations
+//   - ChecksumCompat    — "postgrator" computes checksums as node-postgrator does
 //   - ValidateChecksums — compare MD5 hashes before running *up* migrations
+//   - BatchSeparator    — split files into batches on lines such as "GO"
+//   - AutoUpgradeSchemaTable — add missing columns to older schema tables (default true)
+//   - Transaction       — "none", "each" or "all": commit migrations and their version rows together
+//   - AuditHistory      — mark undone rows with undone_at and log every action to a history table
+//   - SnapshotSchema    — store the database structure after each run, for DetectDrift
+//   - CaptureEnv        — environment variables (e.g. GIT_SHA) recorded as JSON metadata on each row
+//   - WebhookURL        — post a JSON summary of each run, HMAC-signed with WebhookSecret
+//   - NotifyOn          — "always" (default) or "failure": when to post to WebhookURL
+//   - RecordProgress    — run statement by statement and resume failed migrations
+//   - FailAfterMigration — abort runs after N migrations to rehearse recovery (needs GOSTGRATOR_FAULT_INJECTION=1)
+//   - BestEffort        — tolerate "already exists"/"does not exist" errors as Migration.Warnings
+//   - BestEffortCodes   — SQLSTATE codes BestEffort tolerates (default DefaultBestEffortCodes)
+//   - KeepaliveInterval — query the database this often during runs so long migrations stay connected
+//   - LockWaitInterval  — report sessions blocking a migration's locks this often to OnLockWait (pg)
+//   - WarnAfter         — warn through the logger, OnSlowMigration and WebhookURL when a migration runs this long
+//   - StreamThreshold   — execute files larger than this while reading them (default 64 MiB)
+//   - CacheFile         — cache file checksums between runs (keyed by mtime+size)
+//   - Clock             — time source for timestamp versions, run_at values and durations (default system clock)
+//   - FS                — read migrations from an fs.FS such as embed.FS
+//   - Sources           — migrations supplied in memory as SourceMigration values
+//   - SQLiteAutoVacuum  — VACUUM SQLite databases after down and drop operations
+//   - SQLiteBackupDir   — back up SQLite databases before destructive operations
+//   - SQLiteBackupKeep  — number of SQLite backups to keep (default all)
+//   - CheckDataLoss     — refuse rollbacks that drop tables or columns holding data (ErrDataLoss)
+//   - DataLossThreshold — rows a dropped table or column may hold before CheckDataLoss reports it
+//   - AcknowledgeDataLoss — let a rollback run despite CheckDataLoss (not read from config files)
+//   - Environment       — environment matched against "environments" directives
+//   - SkipGatedMigrations — leave migrations gated to other environments unrecorded
+//   - IncludeTags       — only migrate files whose "tags" directive lists one of these
+//   - ExcludeTags       — leave out files whose "tags" directive lists one of these
+//   - AllowOutOfOrder   — apply migrations above pending ones and run pending ones below the version
+//   - MaxApplyPerRun    — cap how many migrations one Migrate applies, e.g. one per deploy
+//   - IgnoreWindows     — run migrations outside their maintenance window instead of deferring them
+//   - TranslateSQL      — best-effort rewrite of SERIAL, TIMESTAMPTZ and AUTOINCREMENT for the driver (default off)
+//   - ScanOnce          — load migration files once per Gostgrator instead of per call
+//   - StrictQueries     — make QueryContext fail for statements that return no rows
+//   - FilenamePolicy    — regexp or preset ("kebab-case", "ticket") filenames must match
+//   - VerifySignatures  — refuse migrations without a trusted SSH signature in <file>.sig
+//   - SignedEnvironments — environments where VerifySignatures is implied
+//   - TrustedKeysFile   — SSH public keys allowed to sign migrations
+//   - TrustedSigners    — allowed_signers principals whose keys may sign
+//   - ActionAliases     — extra action names for do, undo and test (up and down are built in)
+//   - FilenameStyle     — "do-undo", "up-down" or "golang-migrate" names for CreateMigration
+//   - MigrationFormat   — "golang-migrate" also reads 001_name.up.sql files
+//   - GolangMigrateTable — golang-migrate version table whose version counts as applied
 //
 // You can merge Config with your own JSON/YAML file or set it inline.
 //
@@ -53,18 +103,129 @@
 //	001.do.create_users.sql   // apply
 //	001.undo.create_users.sql // roll back
 //
+// 001.up.create_users.sql and 001.down.create_users.sql are read the same
+// way, as are other action names mapped in Config.ActionAliases. With
+// Config.MigrationFormat "golang-migrate", so are golang-migrate's
+// 001_create_users.up.sql and 001_create_users.down.sql.
+//
 // Versions may be plain integers (*001*, *002*, …) or timestamps if you
 // prefer.  The CLI’s *new* command scaffolds these files for you.
+// Versions are always compared as numbers, so after switching from integers
+// to timestamps a new 011.do.sql sorts below every timestamp already applied
+// and never runs; GetSkippedMigrations reports such files.
+//
+// A file named 001.test.sql, or 001.do.create_users.test.sql, holds tests
+// for version 1 that RunTests runs in a rolled-back transaction once the
+// version is applied; a row whose first column is false, 0, NULL or "not
+// ok..." fails the test.
+//
+// # Directives
+//
+// Leading comment lines of the form
+//
+//	-- gostgrator: key=value [key=value ...]
+//
+// configure how a single file is handled and are exposed as
+// Migration.Directives.  The "separator" directive overrides
+// Config.BatchSeparator for that file ("none" disables splitting), so
+// scripts exported from SQL Server tooling can keep their GO lines. The
+// "delimiter" directive (e.g. "delimiter=$$") also ends a batch at the end of
+// any line ending with it, and "DELIMITER x" lines switch it, as in scripts
+// for the MySQL client.
+// The "depends-on" directive lists versions (comma separated) that must be
+// applied before the file runs; Migrate fails before running anything if a
+// dependency is missing or would still be unapplied.
+// The "environments" directive (e.g. "environments=dev,staging") limits a
+// version to Config.Environment; elsewhere it is recorded without running so
+// versions stay aligned, or left out entirely with Config.SkipGatedMigrations.
+// The "best-effort" directive ("true" or "false") overrides Config.BestEffort
+// for the file.
+// The "tags" directive (e.g. "tags=reporting,slow") labels a file for
+// Config.IncludeTags and Config.ExcludeTags.
+// The "window" directive (e.g. "window=02:00-04:00 UTC", or an IANA zone
+// such as Europe/Berlin) defers the file, and the files above it, to a later
+// Migrate that runs inside that daily maintenance window; see Deferred and
+// Config.IgnoreWindows.
+//
+// Anywhere in a file, lines between "-- gostgrator:only driver=pg,sqlite3"
+// and "-- gostgrator:end" run only when the list names Config.Driver; for
+// other drivers they are blanked before the file runs. Checksums are taken
+// on the file as written.
 //
 // # Programmatic API
 //
+//	NewConfig()                   → Config  // DefaultConfig, to override
+//	LoadConfigFile(path, &cfg)    → error   // paths resolve from the file's directory; see StrictConfig
+//	(Config).Validate()           → error   // check a Config before connecting
 //	NewGostgrator(cfg, db)        → *Gostgrator
+//	New(db, opts...)              → *Gostgrator // WithConfig, WithLogger, WithFS, WithHooks, WithLock
+//	RegisterClient(name, newClient) // add a Client for Config.Driver name
 //	(*Gostgrator).Migrate(ctx, v) → []Migration, error
+//	(*Gostgrator).MigrateIfCurrent(ctx, expected, v) → []Migration, error  // ErrVersionChanged
+//	(*Gostgrator).MigrateLockstep(ctx, secondary, v) → []Migration, error  // secondary first
 //	(*Gostgrator).Down(ctx, n)    → []Migration, error
+//	(*Gostgrator).DownAll(ctx)    → []Migration, error
+//	(*Gostgrator).Reset(ctx)      → []Migration, error
 //	(*Gostgrator).GetMigrations() → []Migration, error
 //	(*Gostgrator).GetDatabaseVersion(ctx) → int, error
+//	(*Gostgrator).EnsureSchemaTable(ctx)  → error
+//	(*Gostgrator).UpgradeSchemaTable(ctx) → error
+//	(*Gostgrator).DropSchemaTable(ctx)    → error
+//	(*Gostgrator).QueryContext(ctx, q)    → *sql.Rows, error
+//	(*Gostgrator).ExecContext(ctx, q)     → sql.Result, error
+//	(*Gostgrator).Lock(ctx)               → error
+//	(*Gostgrator).Unlock(ctx)             → error
+//	(*Gostgrator).ForceUnlock(ctx)        → error
+//	(*Gostgrator).Freeze(ctx, reason)     → error
+//	(*Gostgrator).Unfreeze(ctx)           → error
+//	(*Gostgrator).FreezeStatus(ctx)       → string, time.Time, bool, error
+//	(*Gostgrator).Plan(ctx, v)            → []Migration, error
+//	(*Gostgrator).Deferred(ctx, v)        → []Migration, error
+//	(*Gostgrator).VersionAt(t)            → int, error
+//	(*Gostgrator).PlanDown(ctx, n)        → []RollbackImpact, error
+//	(*Gostgrator).DataLoss(ctx, v)        → []DataLoss, error  // rows undo migrations would drop
+//	(*Gostgrator).ExportUndo(w, from, to) → []Migration, error  // rollback script for a DBA
+//	(*Gostgrator).ExecFile(ctx, path)     → Migration, error  // ad-hoc script, not recorded
+//	(*Gostgrator).GetAppliedMigrations(ctx) → []AppliedMigration, error
+//	(*Gostgrator).GetSkippedMigrations(ctx) → []Migration, error
+//	(*Gostgrator).ExplainVersion(ctx, v)  → VersionDetails, error
+//	SortApplied(applied, order)           → error  // by OrderVersion or OrderRunAt
+//	(*Gostgrator).Compact(ctx)            → CompactStats, error
+//	(*Gostgrator).DescribeSchema(ctx)     → Schema, error  // tables, columns and indexes
+//	(*Gostgrator).SnapshotSchema(ctx)     → error
+//	(*Gostgrator).Reconstruct(ctx)        → []ReconstructedMigration, error  // rebuild a lost schema table
+//	(*Gostgrator).RecordApplied(ctx, migs) → error  // record without running
+//	(*Gostgrator).DetectDrift(ctx)        → Drift, error  // changes since the snapshot
+//	(*Gostgrator).Backup(ctx, dir)        → string, error
+//	(*Gostgrator).RunTests(ctx)           → []TestResult, error
+//	(*Gostgrator).CheckFilenames()        → error
+//	(*Gostgrator).CheckSignatures()       → error
+//	(*Gostgrator).MetricsHandler()        → http.Handler  // Prometheus text format
+//	(*Gostgrator).WriteMetrics(ctx, w)    → error
+//	CheckFilename(cfg, name)              → error
+//	Checksum(content, newline)            → string  // the md5 recorded for a migration
+//	ChecksumFile(path, newline)           → string, error
+//	ChecksumCompat(content, newline, compat) → string  // with Config.ChecksumCompat
+//	ChecksumFileCompat(path, newline, compat) → string, error
+//	RedactCredentials(s)                  → string
+//	GenerateManifest(fsys, pattern)       → string, error
+//	VerifyManifest(fsys, pattern, m)      → error
 //
 // All operations are context-aware; cancel the context to abort long runs.
+// Only Migrate and Down (through EnsureSchemaTable) and UpgradeSchemaTable
+// create or alter the schema table. The read methods treat a missing table as
+// version 0 and read tables created by older versions as they are, so they
+// work for users without DDL permissions and over read-only connections.
+// Database errors have any connection passwords masked before they are returned.
+// When a migration fails, Migrate and Down return the migrations applied so far
+// with a *PartialApplyError naming the failed migration; use errors.As to
+// inspect it.
+//
+// To open PostgreSQL connections with a custom *tls.Config or dialer, such as
+// for mTLS or an SSH tunnel, use the pgopen sub-package.
+//
+// The plan sub-package computes which migrations a target runs, and in what
+// order, without a database, for unit testing migration ordering.
 //
 // # CLI helpers
 //
@@ -72,6 +233,7 @@
 //
 //	go get -tool github.com/bcomnes/gostgrator/pg@latest      # PostgreSQL
 //	go get -tool github.com/bcomnes/gostgrator/sqlite@latest  # SQLite
+//	go get -tool github.com/bcomnes/gostgrator/gen@latest     # embed migrations
 //
 // See each sub-package’s doc for flags and usage.
 //
@@ -84,9 +246,16 @@
 //
 // A semantic version string is exposed as:
 //
-//	var Version = "vX.Y.Z"
+//	var Version = "X.Y.Z"
 //
+// It is read from the module version Go records in the binary, so binaries
+// built with go install, and programs depending on gostgrator, report the
+// version they were built with; release builds may set it with -ldflags
+// "-X github.com/bcomnes/gostgrator.Version=X.Y.Z", as make release does.
 // Embed it in your own commands to surface gostgrator’s build version.
+// VersionInfo adds the git commit (GitCommit, or the VCS revision Go
+// records), the Go version and the supported drivers, and is what the CLIs
+// print for -version -json.
 //
 // Generated documentation; update whenever public API or CLI flags change.
 package gostgrator
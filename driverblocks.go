@@ -0,0 +1,166 @@
+package gostgrator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Conditional blocks limit the lines between them to some drivers, so one
+// file can carry dialect-specific statements:
+//
+//	-- gostgrator:only driver=pg
+//	CREATE INDEX CONCURRENTLY users_email_idx ON users (email);
+//	-- gostgrator:end
+const (
+	blockOnlyPrefix = directivePrefix + "only"
+	blockEnd        = directivePrefix + "end"
+)
+
+// blockFilter blanks the lines of conditional blocks that do not list its
+// driver, one line at a time. Lines are blanked rather than removed so line
+// numbers in errors still match the file.
+type blockFilter struct {
+	driver   string
+	filename string
+	line     int
+	inBlock  bool
+	keep     bool
+}
+
+// filter returns line as it should run: unchanged, or blank inside a block
+// for another driver.
+func (f *blockFilter) filter(line string) (string, error) {
+	f.line++
+	trimmed := strings.TrimSpace(line)
+	if rest, ok := strings.CutPrefix(trimmed, blockOnlyPrefix); ok {
+		if f.inBlock {
+			return "", fmt.Errorf("%s:%d: conditional block opened inside another; close it with %q first", f.filename, f.line, blockEnd)
+		}
+		drivers, err := blockDrivers(rest)
+		if err != nil {
+			return "", fmt.Errorf("%s:%d: %v", f.filename, f.line, err)
+		}
+		f.inBlock, f.keep = true, slices.Contains(drivers, f.driver)
+		return line, nil
+	}
+	if trimmed == blockEnd {
+		if !f.inBlock {
+			return "", fmt.Errorf("%s:%d: %q without a conditional block", f.filename, f.line, blockEnd)
+		}
+		f.inBlock = false
+		return line, nil
+	}
+	if f.inBlock && !f.keep {
+		if strings.HasSuffix(line, "\n") {
+			return "\n", nil
+		}
+		return "", nil
+	}
+	return line, nil
+}
+
+// close reports a block left open at the end of the file.
+func (f *blockFilter) close() error {
+	if f.inBlock {
+		return fmt.Errorf("%s: conditional block is missing its %q", f.filename, blockEnd)
+	}
+	return nil
+}
+
+// blockDrivers parses the "driver=pg,sqlite3" argument of a block.
+func blockDrivers(args string) ([]string, error) {
+	key, value, ok := strings.Cut(strings.TrimSpace(args), "=")
+	if !ok || strings.TrimSpace(key) != "driver" {
+		return nil, fmt.Errorf("expected %q, got %q", blockOnlyPrefix+" driver=<name>[,<name>...]", blockOnlyPrefix+args)
+	}
+	var drivers []string
+	for _, d := range strings.Split(value, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			drivers = append(drivers, d)
+		}
+	}
+	if len(drivers) == 0 {
+		return nil, fmt.Errorf("conditional block lists no driver")
+	}
+	return drivers, nil
+}
+
+// sql returns the SQL of m that runs on Config.Driver, with the conditional
+// blocks for other drivers blanked and, with Config.TranslateSQL, column
+// types translated. Checksums are computed on the file as written, so they
+// do not depend on the driver.
+func (g *Gostgrator) sql(m Migration) (string, error) {
+	script, err := m.getSQL()
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(script, blockOnlyPrefix) {
+		if script, err = g.filterBlocks(script, m.Filename); err != nil {
+			return "", err
+		}
+	}
+	if g.cfg.TranslateSQL {
+		script = translateSQL(script, g.cfg.Driver)
+	}
+	return script, nil
+}
+
+// filterBlocks blanks the conditional blocks of script, read from filename,
+// that do not list Config.Driver.
+func (g *Gostgrator) filterBlocks(script, filename string) (string, error) {
+	f := &blockFilter{driver: g.cfg.Driver, filename: filename}
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(script, "\n") {
+		kept, err := f.filter(line)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(kept)
+	}
+	if err := f.close(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// blockReader applies a blockFilter to a migration file as it is read, for
+// files executed while streaming.
+type blockReader struct {
+	r      *bufio.Reader
+	filter *blockFilter
+	buf    string
+	err    error
+}
+
+// sqlReader wraps the file of m, read from r, so it yields the SQL that runs
+// on Config.Driver.
+func (g *Gostgrator) sqlReader(r io.Reader, m Migration) io.Reader {
+	return &blockReader{r: bufio.NewReader(r), filter: &blockFilter{driver: g.cfg.Driver, filename: m.Filename}}
+}
+
+func (b *blockReader) Read(p []byte) (int, error) {
+	for b.buf == "" {
+		if b.err != nil {
+			return 0, b.err
+		}
+		line, err := b.r.ReadString('\n')
+		if line != "" {
+			if b.buf, b.err = b.filter.filter(line); b.err != nil {
+				continue
+			}
+		}
+		if err == io.EOF {
+			err = b.filter.close()
+			if err == nil {
+				err = io.EOF
+			}
+		}
+		b.err = err
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
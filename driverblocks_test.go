@@ -0,0 +1,96 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDriverBlocks verifies that only the blocks for the configured driver
+// run, and that the checksum does not depend on the driver.
+func TestDriverBlocks(t *testing.T) {
+	script := "CREATE TABLE a (id INTEGER);\n" +
+		"-- gostgrator:only driver=pg\n" +
+		"CREATE TABLE pg_only (id SERIAL);\n" +
+		"-- gostgrator:end\n" +
+		"-- gostgrator:only driver=pg,sqlite3\n" +
+		"CREATE TABLE shared (id INTEGER);\n" +
+		"-- gostgrator:end\n"
+	pattern := writeDriftedMigrations(t, map[string]string{"001.do.a.sql": script})
+	for _, threshold := range []int64{-1, 1} {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "blocks.db"))
+		if err != nil {
+			t.Fatalf("failed to open sqlite3 db: %v", err)
+		}
+		defer db.Close()
+		g, err := NewGostgrator(Config{Driver: "sqlite3", MigrationPattern: pattern, StreamThreshold: threshold}, db)
+		if err != nil {
+			t.Fatalf("failed to create gostgrator: %v", err)
+		}
+		if _, err := g.Migrate(context.Background(), "max"); err != nil {
+			t.Fatalf("migrate failed (stream threshold %d): %v", threshold, err)
+		}
+		if !tableExists(t, db, "a") || !tableExists(t, db, "shared") || tableExists(t, db, "pg_only") {
+			t.Errorf("expected only the sqlite3 blocks to run (stream threshold %d)", threshold)
+		}
+		migs, err := g.GetMigrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := checksum(script, ""); migs[0].Md5 != want {
+			t.Errorf("expected the checksum of the raw file %s, got %s", want, migs[0].Md5)
+		}
+		if len(migs[0].Directives) != 0 {
+			t.Errorf("expected block markers not to be directives, got %v", migs[0].Directives)
+		}
+	}
+}
+
+func TestBlockFilter(t *testing.T) {
+	g := &Gostgrator{cfg: Config{Driver: "sqlite3"}}
+	m := Migration{Filename: "001.do.sql"}
+	for _, tc := range []struct {
+		script, want, err string
+	}{
+		{script: "A;\n-- gostgrator:only driver=pg\nB;\n-- gostgrator:end\nC;", want: "A;\n-- gostgrator:only driver=pg\n\n-- gostgrator:end\nC;"},
+		{script: "-- gostgrator:only driver=sqlite3\nB;\n-- gostgrator:end", want: "-- gostgrator:only driver=sqlite3\nB;\n-- gostgrator:end"},
+		{script: "-- gostgrator:only driver=pg\n-- gostgrator:only driver=sqlite3\n", err: "001.do.sql:2: conditional block opened inside another"},
+		{script: "A;\n-- gostgrator:end\n", err: "001.do.sql:2:"},
+		{script: "-- gostgrator:only driver=pg\nB;\n", err: "missing its"},
+		{script: "-- gostgrator:only pg\n", err: "expected"},
+		{script: "-- gostgrator:only driver=\n", err: "lists no driver"},
+	} {
+		filter := &blockFilter{driver: g.cfg.Driver, filename: m.Filename}
+		var b strings.Builder
+		var err error
+		for _, line := range strings.SplitAfter(tc.script, "\n") {
+			var kept string
+			if kept, err = filter.filter(line); err != nil {
+				break
+			}
+			b.WriteString(kept)
+		}
+		if err == nil {
+			err = filter.close()
+		}
+		streamed, serr := io.ReadAll(g.sqlReader(strings.NewReader(tc.script), m))
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected an error containing %q, got %v", tc.script, tc.err, err)
+			}
+			if serr == nil || !strings.Contains(serr.Error(), tc.err) {
+				t.Errorf("%q: expected the reader to fail with %q, got %v", tc.script, tc.err, serr)
+			}
+			continue
+		}
+		if err != nil || b.String() != tc.want {
+			t.Errorf("%q: expected %q, got %q (%v)", tc.script, tc.want, b.String(), err)
+		}
+		if serr != nil || string(streamed) != tc.want {
+			t.Errorf("%q: expected the reader to yield %q, got %q (%v)", tc.script, tc.want, streamed, serr)
+		}
+	}
+}
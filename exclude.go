@@ -0,0 +1,74 @@
+package gostgrator
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// excludePattern compiles cfg.ExcludePattern, returning nil if none is set.
+func excludePattern(cfg Config) (*regexp.Regexp, error) {
+	if cfg.ExcludePattern == "" {
+		return nil, nil
+	}
+	re, err := globRegexp(path.Clean(filepath.ToSlash(cfg.ExcludePattern)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern %q: %v", cfg.ExcludePattern, err)
+	}
+	return re, nil
+}
+
+// excluded reports whether file matches the compiled exclude pattern re. A
+// pattern without a slash is matched against the base name, like a
+// .gitignore entry; otherwise against the whole path.
+func excluded(re *regexp.Regexp, pattern, file string) bool {
+	if re == nil {
+		return false
+	}
+	file = path.Clean(filepath.ToSlash(file))
+	if !strings.Contains(filepath.ToSlash(pattern), "/") {
+		file = path.Base(file)
+	}
+	return re.MatchString(file)
+}
+
+// globRegexp translates a glob in path.Match syntax, extended with "**" for
+// any number of directories, into an anchored regular expression.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
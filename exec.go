@@ -0,0 +1,62 @@
+package gostgrator
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+)
+
+// ExecFile runs the SQL file at path, read from the local disk, through the
+// same machinery as a migration without recording a version, for operational
+// scripts that should follow the same safety rails: it holds the migration
+// lock, runs in a transaction when Config.Transaction is "each" or "all"
+// (unless the file has a "transaction=none" directive), honors the
+// separator, best-effort and "-- gostgrator:only" blocks, streams large
+// files, and is logged and reported to Config.WebhookURL as the "exec"
+// command. Progress is never recorded, so a failed script starts over.
+// The script is returned as a Migration with Action "exec" and version 0,
+// with its duration.
+func (g *Gostgrator) ExecFile(ctx context.Context, path string) (Migration, error) {
+	md5sum, directives, err := parseMigrationFile(nil, path, g.cfg.checksumStyle())
+	if err != nil {
+		return Migration{}, err
+	}
+	m := Migration{
+		Action:     "exec",
+		Filename:   path,
+		Name:       strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Md5:        md5sum,
+		Directives: directives,
+	}
+	_, err = g.report(ctx, "exec", func() ([]Migration, error) {
+		err := g.withLock(ctx, func() error {
+			start := g.cfg.now()
+			err := g.execScript(ctx, &m)
+			m.Duration = g.cfg.now().Sub(start)
+			return err
+		})
+		attrs := []any{"file", m.Filename, "duration", m.Duration}
+		if err != nil {
+			g.logger.ErrorContext(ctx, "script failed", append(attrs, "error", err)...)
+			return nil, err
+		}
+		g.logger.InfoContext(ctx, "script executed", attrs...)
+		return []Migration{m}, nil
+	})
+	return m, err
+}
+
+// execScript runs m, in a transaction when the transaction mode and the file
+// allow it.
+func (g *Gostgrator) execScript(ctx context.Context, m *Migration) error {
+	transactional, err := m.transactional()
+	if err != nil {
+		return err
+	}
+	if g.cfg.Transaction == "none" || g.cfg.Transaction == "" || !transactional {
+		return g.execute(ctx, m, false)
+	}
+	return g.inTransaction(ctx, func(tg *Gostgrator) error {
+		return tg.execute(ctx, m, false)
+	})
+}
@@ -0,0 +1,59 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExecFile verifies that a script runs without being recorded, and that
+// in a transaction mode a failing script leaves nothing behind.
+func TestExecFile(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "exec.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	g, err := NewGostgrator(Config{Driver: "sqlite3", Transaction: "each"}, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	m, err := g.ExecFile(ctx, write("backfill.sql", "CREATE TABLE a (id INTEGER);\nINSERT INTO a VALUES (1);\n"))
+	if err != nil {
+		t.Fatalf("ExecFile failed: %v", err)
+	}
+	if m.Action != "exec" || m.Name != "backfill" || m.Version != 0 {
+		t.Errorf("unexpected script %+v", m)
+	}
+	if !tableExists(t, db, "a") {
+		t.Error("expected the script to run")
+	}
+	if version, err := g.GetDatabaseVersion(ctx); err != nil || version != 0 {
+		t.Errorf("expected no version to be recorded, got %d (%v)", version, err)
+	}
+
+	_, err = g.ExecFile(ctx, write("broken.sql", "CREATE TABLE b (id INTEGER);\nINSERT INTO missing VALUES (1);\n"))
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("expected the broken script to fail, got %v", err)
+	}
+	if tableExists(t, db, "b") {
+		t.Error("expected the failed script to roll back")
+	}
+	if _, err := g.ExecFile(ctx, filepath.Join(dir, "absent.sql")); err == nil {
+		t.Error("expected a missing file to fail")
+	}
+}
@@ -0,0 +1,64 @@
+package gostgrator
+
+import (
+	"context"
+	"fmt"
+)
+
+// VersionDetails gathers what is known about one migration version, as
+// returned by ExplainVersion, for triaging a single migration.
+type VersionDetails struct {
+	// Version is the migration version explained.
+	Version int
+	// DatabaseVersion is the current version of the database.
+	DatabaseVersion int
+	// Migrations are the version's files: do, undo and test, in that order.
+	Migrations []Migration
+	// SQL holds the content of each file in Migrations, by Filename.
+	SQL map[string]string
+	// Applied is the version's row in the schema table, or nil if the
+	// version is not recorded as applied.
+	Applied *AppliedMigration
+}
+
+// ExplainVersion returns the files of version with their checksums,
+// directives and SQL, along with its row in the schema table if it was
+// applied. It only reads the database, and fails if the version has neither
+// files nor a row.
+func (g *Gostgrator) ExplainVersion(ctx context.Context, version int) (VersionDetails, error) {
+	details := VersionDetails{Version: version, SQL: make(map[string]string)}
+	migs, err := g.GetMigrations()
+	if err != nil {
+		return details, err
+	}
+	for _, action := range []string{"do", "undo", "test"} {
+		for _, m := range migs {
+			if m.Version != version || m.Action != action {
+				continue
+			}
+			script, err := m.getSQL()
+			if err != nil {
+				return details, err
+			}
+			details.Migrations = append(details.Migrations, m)
+			details.SQL[m.Filename] = script
+		}
+	}
+	if details.DatabaseVersion, err = g.GetDatabaseVersion(ctx); err != nil {
+		return details, err
+	}
+	applied, err := g.GetAppliedMigrations(ctx)
+	if err != nil {
+		return details, err
+	}
+	for _, a := range applied {
+		if a.Version == version {
+			details.Applied = &a
+			break
+		}
+	}
+	if len(details.Migrations) == 0 && details.Applied == nil {
+		return details, fmt.Errorf("no migration found for version %d", version)
+	}
+	return details, nil
+}
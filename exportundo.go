@@ -0,0 +1,109 @@
+package gostgrator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportUndo writes a SQL script to w that rolls the schema back from version
+// from to version to, for teams whose production rollbacks are run by hand
+// rather than by gostgrator. It holds the undo migrations Down would run,
+// newest first, each followed by the schema table change that records it and
+// wrapped in BEGIN and COMMIT, so running the script leaves the database as
+// Down would. Files with a "transaction=none" directive are left unwrapped,
+// and migrations gated to other environments only update the schema table.
+// With Config.AuditHistory the undone_at and history times are those of the
+// export.
+//
+// The database is not read, so the script can be prepared and reviewed ahead
+// of time. It fails if a version being rolled back has no undo file, and if
+// an undo file lacks a trusted signature when signatures are required; see
+// Config.VerifySignatures. The undo migrations in the script are returned.
+func (g *Gostgrator) ExportUndo(w io.Writer, from, to int) ([]Migration, error) {
+	if to < 0 || from <= to {
+		return nil, fmt.Errorf("cannot export a rollback from version %d to %d: from must be above to, and to at least 0", from, to)
+	}
+	migs, err := g.GetMigrations()
+	if err != nil {
+		return nil, err
+	}
+	undos, err := g.GetRunnableMigrations(from, to)
+	if err != nil {
+		return nil, err
+	}
+	hasUndo := make(map[int]bool, len(undos))
+	for _, m := range undos {
+		hasUndo[m.Version] = true
+	}
+	for _, m := range migs {
+		if m.Action == "do" && m.Version <= from && m.Version > to && !hasUndo[m.Version] {
+			return nil, fmt.Errorf("migration [%d] (%s) has no undo file", m.Version, m.Filename)
+		}
+	}
+	if g.signaturesRequired() {
+		if err := g.checkSignatures(undos); err != nil {
+			return nil, err
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- Rollback from version %d to %d, exported by gostgrator %s.\n", from, to, Version)
+	fmt.Fprintf(&b, "-- Each undo migration runs in its own transaction and the %s change that records it.\n", g.cfg.SchemaTable)
+	b.WriteString("-- Review it, then run it in full; stop at the first error.\n")
+	var exported []Migration
+	for _, m := range undos {
+		enabled, err := g.environmentEnabled(m)
+		if err != nil {
+			return nil, err
+		}
+		if !enabled && g.cfg.SkipGatedMigrations {
+			continue
+		}
+		transactional, err := m.transactional()
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "\n-- Version %d: %s (%s, md5 %s)\n", m.Version, m.Name, m.Filename, m.Md5)
+		if !transactional {
+			b.WriteString("-- Runs outside a transaction, as its transaction=none directive requires.\n")
+		} else {
+			b.WriteString("BEGIN;\n")
+		}
+		if enabled {
+			sqlScript, err := g.sql(m)
+			if err != nil {
+				return nil, err
+			}
+			for _, batch := range splitBatches(sqlScript, g.batchSplitter(m)) {
+				b.WriteString(strings.TrimSpace(batch) + "\n")
+			}
+		} else {
+			fmt.Fprintf(&b, "-- Not run in environment %q; only its version is recorded.\n", g.cfg.Environment)
+		}
+		b.WriteString(scriptSql(g.client.PersistActionSql(m)))
+		if g.cfg.AuditHistory {
+			b.WriteString(scriptSql(g.client.PersistHistorySql(m)))
+		}
+		if transactional {
+			b.WriteString("COMMIT;\n")
+		}
+		exported = append(exported, m)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return nil, err
+	}
+	return exported, nil
+}
+
+// scriptSql strips the indentation of SQL generated by a Client so it reads
+// naturally in an exported script.
+func scriptSql(query string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(query, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExportUndo verifies that running an exported rollback script leaves
+// the database as Down would.
+func TestExportUndo(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "export.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	pattern := writeTransactionMigrations(t)
+	g, err := NewGostgrator(Config{Driver: "sqlite3", MigrationPattern: pattern}, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+
+	var script strings.Builder
+	exported, err := g.ExportUndo(&script, 2, 0)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if len(exported) != 2 || exported[0].Version != 2 || exported[1].Version != 1 {
+		t.Fatalf("expected undo migrations 2 and 1, got %v", exported)
+	}
+	got := script.String()
+	if i, j := strings.Index(got, "DROP TABLE b;"), strings.Index(got, "DROP TABLE a;"); i < 0 || j < i {
+		t.Errorf("expected undo 2 before undo 1:\n%s", got)
+	}
+	if strings.Count(got, "BEGIN;") != 2 || strings.Count(got, "COMMIT;") != 2 || !strings.Contains(got, "DELETE FROM \"schemaversion\"\nWHERE version = 2;") {
+		t.Errorf("expected each undo in a transaction with its schema table delete:\n%s", got)
+	}
+
+	if _, err := db.Exec(got); err != nil {
+		t.Fatalf("failed to run the exported script: %v\n%s", err, got)
+	}
+	if tableExists(t, db, "a") || tableExists(t, db, "b") {
+		t.Error("expected the script to drop both tables")
+	}
+	if version, err := g.GetDatabaseVersion(ctx); err != nil || version != 0 {
+		t.Errorf("expected version 0 after the script, got %d (%v)", version, err)
+	}
+
+	if _, err := g.ExportUndo(&script, 1, 1); err == nil {
+		t.Error("expected from at or below to to fail")
+	}
+	if err := os.Remove(filepath.Join(filepath.Dir(pattern), "001.undo.a.sql")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.ExportUndo(&script, 2, 0); err == nil || !strings.Contains(err.Error(), "no undo file") {
+		t.Errorf("expected a missing undo file to fail, got %v", err)
+	}
+}
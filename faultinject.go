@@ -0,0 +1,23 @@
+package gostgrator
+
+import (
+	"errors"
+	"os"
+)
+
+// FaultInjectionEnv is the environment variable that must be "1" for
+// Config.FailAfterMigration to take effect.
+const FaultInjectionEnv = "GOSTGRATOR_FAULT_INJECTION"
+
+// ErrInjectedFailure is the error a run aborted by Config.FailAfterMigration
+// fails with, wrapped in a *PartialApplyError.
+var ErrInjectedFailure = errors.New("run aborted by FailAfterMigration")
+
+// injectedFailure returns ErrInjectedFailure if Config.FailAfterMigration
+// asks for a run to abort before the migration at index i, counted from zero.
+func (g *Gostgrator) injectedFailure(i int) error {
+	if g.cfg.FailAfterMigration > 0 && i == g.cfg.FailAfterMigration && os.Getenv(FaultInjectionEnv) == "1" {
+		return ErrInjectedFailure
+	}
+	return nil
+}
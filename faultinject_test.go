@@ -0,0 +1,62 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestFailAfterMigration verifies that FailAfterMigration aborts a run only
+// while fault injection is enabled, leaving what transaction "none" and "all"
+// promise, and that the lock is released for the next run.
+func TestFailAfterMigration(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		transaction string
+		applied     int
+	}{
+		{"none", 1},
+		{"all", 0},
+	} {
+		t.Run(tt.transaction, func(t *testing.T) {
+			db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "fault.db"))
+			if err != nil {
+				t.Fatalf("failed to open sqlite3 db: %v", err)
+			}
+			defer db.Close()
+			cfg := Config{
+				Driver:             "sqlite3",
+				MigrationPattern:   writeTransactionMigrations(t),
+				Transaction:        tt.transaction,
+				FailAfterMigration: 1,
+			}
+			g, err := NewGostgrator(cfg, db)
+			if err != nil {
+				t.Fatalf("failed to create gostgrator: %v", err)
+			}
+
+			t.Setenv(FaultInjectionEnv, "1")
+			_, err = g.Migrate(ctx, "max")
+			var partial *PartialApplyError
+			if !errors.Is(err, ErrInjectedFailure) || !errors.As(err, &partial) || partial.Failed.Version != 2 {
+				t.Fatalf("expected the run to abort before version 2, got %v", err)
+			}
+			if version, err := g.GetDatabaseVersion(ctx); err != nil || version != tt.applied {
+				t.Fatalf("expected version %d after the abort, got %d (%v)", tt.applied, version, err)
+			}
+			if tableExists(t, db, "b") {
+				t.Error("expected version 2 not to run")
+			}
+
+			t.Setenv(FaultInjectionEnv, "")
+			if _, err := g.Migrate(ctx, "max"); err != nil {
+				t.Fatalf("expected the run to recover without fault injection, got %v", err)
+			}
+			if version, err := g.GetDatabaseVersion(ctx); err != nil || version != 2 {
+				t.Errorf("expected version 2 after recovering, got %d (%v)", version, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrFrozen is returned, wrapped with the reason, by Migrate, Down, DownAll
+// and Reset while migrations are frozen with Freeze.
+var ErrFrozen = errors.New("migrations are frozen")
+
+// Freeze stops Migrate, Down, DownAll and Reset from changing the schema
+// until Unfreeze is called, for example during an incident or while a
+// long-running job depends on the current schema. The freeze and its reason
+// are kept in the frozen_at and frozen_reason columns of the schema table's
+// version 0 row, which Freeze adds if they are missing, so every process
+// migrating the database sees it. Freezing again replaces the reason.
+func (g *Gostgrator) Freeze(ctx context.Context, reason string) error {
+	f, err := g.freezer()
+	if err != nil {
+		return err
+	}
+	if err := f.EnsureFreezeColumns(ctx); err != nil {
+		return err
+	}
+	_, err = execArgs(ctx, g.client, func(c ArgsClient) (string, []any) {
+		return c.FreezeArgs(reason)
+	}, func() string {
+		return f.FreezeSql(reason)
+	})
+	return err
+}
+
+// Unfreeze lifts a freeze set with Freeze. It succeeds if migrations are not
+// frozen.
+func (g *Gostgrator) Unfreeze(ctx context.Context) error {
+	f, err := g.freezer()
+	if err != nil {
+		return err
+	}
+	columns, err := g.client.SchemaColumns(ctx)
+	if err != nil || !columns["frozen_at"] {
+		return err
+	}
+	_, err = g.client.ExecContext(ctx, f.UnfreezeSql())
+	return err
+}
+
+// FreezeStatus reports whether migrations are frozen, with the reason given
+// to Freeze and when it was called. It only reads the schema table. A Client
+// that is not a Freezer is never frozen.
+func (g *Gostgrator) FreezeStatus(ctx context.Context) (string, time.Time, bool, error) {
+	f, ok := g.client.(Freezer)
+	if !ok {
+		return "", time.Time{}, false, nil
+	}
+	columns, err := g.client.SchemaColumns(ctx)
+	if err != nil || !columns["frozen_at"] {
+		return "", time.Time{}, false, err
+	}
+	rows, err := g.client.QueryContext(ctx, f.GetFreezeSql())
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return "", time.Time{}, false, rows.Err()
+	}
+	var reason sql.NullString
+	var frozenAt any
+	if err := rows.Scan(&reason, &frozenAt); err != nil {
+		return "", time.Time{}, false, err
+	}
+	since, err := parseRunAt(frozenAt)
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+	return reason.String, since, true, nil
+}
+
+// checkFrozen returns an error wrapping ErrFrozen if migrations are frozen.
+func (g *Gostgrator) checkFrozen(ctx context.Context) error {
+	reason, since, frozen, err := g.FreezeStatus(ctx)
+	if err != nil || !frozen {
+		return err
+	}
+	if reason == "" {
+		return fmt.Errorf("%w since %s", ErrFrozen, since.Format(time.RFC3339))
+	}
+	return fmt.Errorf("%w since %s: %s", ErrFrozen, since.Format(time.RFC3339), reason)
+}
+
+// freezer returns the client as a Freezer, or an error wrapping
+// errors.ErrUnsupported if it cannot keep a freeze.
+func (g *Gostgrator) freezer() (Freezer, error) {
+	f, ok := g.client.(Freezer)
+	if !ok {
+		return nil, fmt.Errorf("freezing migrations is not supported by the %s client: %w", g.cfg.Driver, errors.ErrUnsupported)
+	}
+	return f, nil
+}
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: MIT
+
+// Package main provides gostgrator‑gen, which embeds a migrations directory
+// into a Go package so migrations ship inside the application binary.
+//
+// # Install
+//
+//	go get -tool github.com/bcomnes/gostgrator/gen
+//
+// # Synopsis
+//
+//	gostgrator-gen [options]
+//
+// The generated file (migrations_gen.go by default) declares:
+//
+//	FS        embed.FS holding the files matched by -pattern
+//	Pattern   the glob to use as gostgrator.Config.MigrationPattern
+//	Manifest  the MD5 of every embedded file when the file was generated
+//
+// Its init function calls gostgrator.VerifyManifest, so any program or test
+// importing the package panics if migrations were added, removed or edited
+// without regenerating. Run with -check in CI to fail before anything is
+// built.
+//
+// # Flags
+//
+//	-dir string       Migrations directory the generated file is written to (default ".").
+//	-pattern string   Glob, relative to -dir, of the files to embed (default "*.sql").
+//	-out string       Name of the generated file, relative to -dir (default "migrations_gen.go").
+//	-package string   Package name; defaults to the package already in -dir, or the
+//	                  directory name.
+//	-check            Exit with an error instead of writing when the file is stale.
+//	-help             Show built‑in help.
+//	-version          Print gostgrator‑gen version.
+//	-json             With -version, print it as a JSON object.
+//
+// # Example
+//
+// In migrations/doc.go:
+//
+//	//go:generate go tool github.com/bcomnes/gostgrator/gen
+//	package migrations
+//
+// Then, in the application:
+//
+//	g, err := gostgrator.NewGostgrator(gostgrator.Config{
+//	    Driver:           "pg",
+//	    FS:               migrations.FS,
+//	    MigrationPattern: migrations.Pattern,
+//	}, db)
+package main
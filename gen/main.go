@@ -0,0 +1,210 @@
+// Package main implements gostgrator-gen, which embeds a migrations directory
+// into a Go package together with a checksum manifest of its files.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+var versionString = gostgrator.Version
+
+// usage prints the help text.
+func usage() {
+	header := `Usage:
+  gostgrator-gen [options]
+
+Writes a Go file into the migrations directory that embeds the migration files
+with go:embed and records their checksums. Loading the generated package fails
+if migrations were added, removed or edited without regenerating it.
+
+Options:`
+	fmt.Fprintln(os.Stderr, header)
+	flag.PrintDefaults()
+}
+
+func main() {
+	dir := flag.String("dir", ".", "Migrations directory the generated file is written to")
+	pattern := flag.String("pattern", "*.sql", "Glob, relative to -dir, of the migration files to embed")
+	out := flag.String("out", "migrations_gen.go", "Name of the generated file, relative to -dir")
+	pkg := flag.String("package", "", "Package name of the generated file (default: the package already in -dir, or the directory name)")
+	check := flag.Bool("check", false, "Exit with an error instead of writing when the generated file is missing or out of date")
+	helpFlag := flag.Bool("help", false, "Show help message")
+	versionFlag := flag.Bool("version", false, "Show version")
+	jsonFlag := flag.Bool("json", false, "With -version, print the version, git commit, Go version and supported drivers as JSON")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if *helpFlag {
+		usage()
+		os.Exit(0)
+	}
+	if *versionFlag {
+		if *jsonFlag {
+			if err := json.NewEncoder(os.Stdout).Encode(gostgrator.VersionInfo()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+		fmt.Println("gostgrator-gen version:", versionString)
+		os.Exit(0)
+	}
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected arguments: %s\n", strings.Join(flag.Args(), " "))
+		usage()
+		os.Exit(1)
+	}
+
+	outPath := filepath.Join(*dir, *out)
+	if *pkg == "" {
+		name, err := packageName(*dir, *out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error determining package name: %v\n", err)
+			os.Exit(1)
+		}
+		*pkg = name
+	}
+	src, err := generate(*dir, *pattern, *pkg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating %s: %v\n", outPath, err)
+		os.Exit(1)
+	}
+
+	if *check {
+		current, err := os.ReadFile(outPath)
+		if err != nil || !bytes.Equal(current, src) {
+			fmt.Fprintf(os.Stderr, "Error: %s is out of date; run gostgrator-gen (or go generate) and commit the result.\n", outPath)
+			os.Exit(1)
+		}
+		fmt.Printf("%s is up to date.\n", outPath)
+		return
+	}
+	if err := os.WriteFile(outPath, src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", outPath, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s.\n", outPath)
+}
+
+// generatedTemplate is the source of the generated file.
+var generatedTemplate = template.Must(template.New("gen").Parse(`// Code generated by gostgrator-gen; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"embed"
+
+	"github.com/bcomnes/gostgrator"
+)
+
+// FS holds the embedded migration files. Use it as gostgrator.Config.FS
+// with Pattern as the MigrationPattern.
+//
+//go:embed {{.Pattern}}
+var FS embed.FS
+
+// Pattern matches the embedded migration files within FS.
+const Pattern = {{printf "%q" .Pattern}}
+
+// Manifest is the checksum of every migration file when this file was generated.
+const Manifest = {{.Manifest}}
+
+// init fails fast when the embedded migrations no longer match Manifest
+// because files were added, removed or edited without regenerating this file.
+func init() {
+	if err := gostgrator.VerifyManifest(FS, Pattern, Manifest); err != nil {
+		panic(err)
+	}
+}
+`))
+
+// generate returns the formatted source of the generated file.
+func generate(dir, pattern, pkg string) ([]byte, error) {
+	if !fsValidPattern(pattern) {
+		return nil, fmt.Errorf("invalid pattern %q: it must be a slash-separated glob inside the directory", pattern)
+	}
+	manifest, err := gostgrator.GenerateManifest(os.DirFS(dir), pattern)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == "" {
+		return nil, fmt.Errorf("no files in %s match %s", dir, pattern)
+	}
+	var buf bytes.Buffer
+	err = generatedTemplate.Execute(&buf, struct {
+		Package, Pattern, Manifest string
+	}{pkg, pattern, stringLiteral(manifest)})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// fsValidPattern reports whether pattern can be used with go:embed and fs.Glob.
+func fsValidPattern(pattern string) bool {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return false
+	}
+	return fs.ValidPath(pattern) && pattern != "." && !strings.ContainsAny(pattern, " \"`")
+}
+
+// stringLiteral quotes s as a raw string literal when possible so multi-line
+// values stay readable in the generated file.
+func stringLiteral(s string) string {
+	if strings.Contains(s, "`") || strings.Contains(s, "\r") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+// packageName returns the package declared by the Go files already in dir,
+// ignoring tests and the generated file itself, or a name derived from the
+// directory when there are none.
+func packageName(dir, generated string) (string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") || filepath.Base(file) == generated {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly)
+		if err != nil {
+			return "", err
+		}
+		return f.Name.Name, nil
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, filepath.Base(abs))
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "migrations"
+	}
+	return name, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain triggers our helper process mode. When the environment
+// variable GO_HELPER_PROCESS is set, main() is called (simulating our CLI).
+func TestMain(m *testing.M) {
+	if os.Getenv("GO_HELPER_PROCESS") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs the current test binary as a helper process running the CLI.
+func runCLI(args ...string) (string, error) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "GO_HELPER_PROCESS=1")
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// writeMigrations creates a migrations directory with a single pair.
+func writeMigrations(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "db-migrations")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	for name, content := range map[string]string{
+		"001.do.sql":   "CREATE TABLE a (id INT);\n",
+		"001.undo.sql": "DROP TABLE a;\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write migration: %v", err)
+		}
+	}
+	return dir
+}
+
+// TestCLIHelp checks that -help prints the usage info.
+func TestCLIHelp(t *testing.T) {
+	out, _ := runCLI("-help")
+	if !strings.Contains(out, "Usage:") {
+		t.Errorf("expected help usage info, got:\n%s", out)
+	}
+}
+
+// TestGenerateAndCheck checks that the generated file embeds the migrations
+// with a manifest and that -check detects stale output.
+func TestGenerateAndCheck(t *testing.T) {
+	dir := writeMigrations(t)
+	out, err := runCLI("-dir", dir)
+	if err != nil {
+		t.Fatalf("gen failed: %v; output: %s", err, out)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "migrations_gen.go"))
+	if err != nil {
+		t.Fatalf("failed to read generated file: %v", err)
+	}
+	src := string(data)
+	for _, want := range []string{
+		"// Code generated by gostgrator-gen; DO NOT EDIT.",
+		"package dbmigrations",
+		"//go:embed *.sql",
+		"  001.do.sql\n",
+		"  001.undo.sql\n",
+		"gostgrator.VerifyManifest(FS, Pattern, Manifest)",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("expected generated file to contain %q, got:\n%s", want, src)
+		}
+	}
+
+	if out, err := runCLI("-dir", dir, "-check"); err != nil {
+		t.Errorf("expected -check to pass right after generating, got %v; output: %s", err, out)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "002.do.sql"), []byte("SELECT 1;\n"), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	out, err = runCLI("-dir", dir, "-check")
+	if err == nil || !strings.Contains(out, "out of date") {
+		t.Errorf("expected -check to fail after adding a migration, got:\n%s", out)
+	}
+}
+
+// TestPackageNameFromExistingFiles checks that the package clause of existing
+// files wins over the directory name.
+func TestPackageNameFromExistingFiles(t *testing.T) {
+	dir := writeMigrations(t)
+	if err := os.WriteFile(filepath.Join(dir, "doc.go"), []byte("// Package schema holds migrations.\npackage schema\n"), 0644); err != nil {
+		t.Fatalf("failed to write doc.go: %v", err)
+	}
+	name, err := packageName(dir, "migrations_gen.go")
+	if err != nil {
+		t.Fatalf("packageName failed: %v", err)
+	}
+	if name != "schema" {
+		t.Errorf("expected package schema, got %s", name)
+	}
+}
+
+// TestGenerateRejectsBadPatterns checks patterns go:embed cannot use.
+func TestGenerateRejectsBadPatterns(t *testing.T) {
+	dir := writeMigrations(t)
+	for _, pattern := range []string{"../*.sql", "/abs/*.sql", "[", "nothing-*.sql"} {
+		if _, err := generate(dir, pattern, "migrations"); err == nil {
+			t.Errorf("expected pattern %q to be rejected", pattern)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package gostgrator
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// golangMigrateName matches golang-migrate's "001_name.up" and
+// "001_name.down" base names, without the ".sql" extension.
+var golangMigrateName = regexp.MustCompile(`^(\d+)_(.*)\.(up|down)$`)
+
+// parseGolangMigrateName parses a base name without extension in
+// golang-migrate's layout into its version, action and name.
+func parseGolangMigrateName(baseNoExt string) (int, string, string, bool) {
+	match := golangMigrateName.FindStringSubmatch(baseNoExt)
+	if match == nil {
+		return 0, "", "", false
+	}
+	version, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, "", "", false
+	}
+	return version, defaultActionAliases[match[3]], match[2], true
+}
+
+// golangMigrateVersion returns the version recorded in
+// Config.GolangMigrateTable, or 0 if it is unset or the table does not
+// exist. A version golang-migrate left dirty after a failure is an error.
+func (g *Gostgrator) golangMigrateVersion(ctx context.Context) (int, error) {
+	if g.cfg.GolangMigrateTable == "" {
+		return 0, nil
+	}
+	version, dirty, err := g.client.GolangMigrateVersion(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read golang-migrate table %s: %w", g.cfg.GolangMigrateTable, err)
+	}
+	if dirty {
+		return 0, fmt.Errorf("golang-migrate table %s is dirty at version %d; fix the database and run golang-migrate force first", g.cfg.GolangMigrateTable, version)
+	}
+	return version, nil
+}
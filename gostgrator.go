@@ -3,31 +3,307 @@ package gostgrator
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/bcomnes/gostgrator/plan"
 )
 
 // Config holds settings for migrations.
 type Config struct {
 	// Driver is the database driver, e.g., "pg" or "sqlite3".
 	Driver string `json:"driver,omitempty"`
-	// SchemaTable is the name of the migration table.
+	// SchemaTable is the name of the migration table. On PostgreSQL it may be
+	// schema-qualified, e.g. "app.schemaversion", but has at most two parts;
+	// otherwise it lives in current_schema(), the first existing schema on
+	// the search_path.
 	SchemaTable string `json:"schemaTable,omitempty"`
 	// MigrationPattern is the glob pattern for migration files (e.g. "./migrations/*.sql").
 	MigrationPattern string `json:"migrationPattern,omitempty"`
+	// PathsFromWorkingDir, set in a config file, makes LoadConfigFile leave
+	// the file's relative paths to resolve from the working directory
+	// instead of the file's directory.
+	PathsFromWorkingDir bool `json:"pathsFromWorkingDir,omitempty"`
+	// StrictConfig makes LoadConfigFile fail on keys of the file that match
+	// no field, such as a misspelled "schmaTable", naming each with the
+	// closest known key. Nil means false for the library; the CLIs default
+	// it to true, and a config file can set it to false.
+	StrictConfig *bool `json:"strictConfig,omitempty"`
+	// FS, when set, is searched for MigrationPattern instead of the local disk,
+	// so migrations can be embedded in the binary with embed.FS. Patterns use
+	// fs.Glob syntax relative to the root of FS, and CacheFile is ignored.
+	FS fs.FS `json:"-"`
+	// Clock is read wherever the time is needed, such as for timestamp
+	// versions, run_at values and run durations. It defaults to the system
+	// clock.
+	Clock Clock `json:"-"`
+	// Sources are migrations supplied in memory rather than read from files,
+	// for systems that generate their schema at runtime. They are loaded
+	// alongside any files matching MigrationPattern, which may be left empty.
+	Sources []SourceMigration `json:"-"`
+	// ExcludePattern is a glob of files matching MigrationPattern to ignore,
+	// such as drafts or editor backups (e.g. "**/draft_*.sql"), where "**"
+	// matches any number of directories. A pattern without a slash is
+	// matched against the base name only.
+	ExcludePattern string `json:"excludePattern,omitempty"`
+	// ActionAliases maps other action names used in filenames to "do",
+	// "undo" or "test", on top of the built-in "up" and "down", so files
+	// named for other tools, like "001.up.name.sql", load without renaming.
+	ActionAliases map[string]string `json:"actionAliases,omitempty"`
+	// FilenameStyle is the action naming CreateMigration uses: "do-undo"
+	// (the default), "up-down", or "golang-migrate" for
+	// "001_name.up.sql" and "001_name.down.sql".
+	FilenameStyle string `json:"filenameStyle,omitempty"`
+	// MigrationFormat is "gostgrator" (the default) or "golang-migrate",
+	// which also reads golang-migrate's "001_name.up.sql" and
+	// "001_name.down.sql" layout, so both tools can share a directory.
+	MigrationFormat string `json:"migrationFormat,omitempty"`
+	// GolangMigrateTable names golang-migrate's version table, usually
+	// "schema_migrations". When set, the version it records counts as
+	// applied: the database version is the higher of the two tables, a
+	// dirty golang-migrate version is an error, and rolling back below it is
+	// refused, as only golang-migrate can rewind its table.
+	GolangMigrateTable string `json:"golangMigrateTable,omitempty"`
 	// Newline is the desired newline style ("LF", "CR", or "CRLF").
 	Newline string `json:"newline,omitempty"`
+	// ChecksumCompat is "gostgrator" (the default) or "postgrator", which
+	// computes migration checksums exactly as node-postgrator does, so the
+	// md5 values it recorded validate without a repair step: Newline converts
+	// each "\r\n" and "\n" but leaves a lone "\r", and bytes that are not
+	// UTF-8 are hashed as U+FFFD replacement characters instead of being an
+	// error. Set Newline to match postgrator's newline option.
+	ChecksumCompat string `json:"checksumCompat,omitempty"`
+	// CacheFile is an optional path where parsed migration checksums are cached
+	// between runs, keyed by file modification time and size.
+	CacheFile string `json:"cacheFile,omitempty"`
+	// BatchSeparator splits migration files into separately executed batches on
+	// lines consisting solely of this token (e.g. "GO"). Empty runs each file as
+	// a single batch. A file can override it with "-- gostgrator: separator=...",
+	// or disable it with "separator=none".
+	BatchSeparator string `json:"batchSeparator,omitempty"`
+	// RecordProgress executes migrations one statement at a time and records each
+	// completed statement in "<SchemaTable>_progress", so re-running a migration
+	// that failed halfway resumes after its last successful statement.
+	RecordProgress bool `json:"recordProgress,omitempty"`
+	// FailAfterMigration aborts every run once that many migrations have been
+	// applied, failing the next one with ErrInjectedFailure, so recovery,
+	// transactions and resuming can be rehearsed. It only takes effect while
+	// the GOSTGRATOR_FAULT_INJECTION environment variable is "1", so a config
+	// copied to production cannot abort a real deploy. Zero disables it.
+	FailAfterMigration int `json:"failAfterMigration,omitempty"`
+	// KeepaliveInterval, when positive, runs a lightweight query this often
+	// while migrations run, through the connection pool, so idle-in-transaction
+	// killers and load balancers do not drop hour-long data migrations. Pair
+	// it with TCP keepalives on the connections, e.g. pgopen.Options.KeepAlive.
+	KeepaliveInterval time.Duration `json:"-"`
+	// LockWaitInterval, when positive, checks this often on a second
+	// connection whether the running migration waits for a lock, and reports
+	// the sessions blocking it, how long they have been running and their
+	// queries to OnLockWait and the logger. It is supported by the pg driver.
+	LockWaitInterval time.Duration `json:"-"`
+	// OnLockWait, when set, is called with each lock wait LockWaitInterval
+	// finds, from another goroutine.
+	OnLockWait func(LockWait) `json:"-"`
+	// WarnAfter, when positive, warns once a migration has run this long
+	// without stopping it: it is logged, passed to OnSlowMigration and posted
+	// to WebhookURL with the status "slow", whatever NotifyOn says. It suits
+	// alerting on long backfills that must not be aborted; the context passed
+	// to Migrate is what limits how long they may run.
+	WarnAfter time.Duration `json:"-"`
+	// OnSlowMigration, when set, is called with a migration that has run for
+	// WarnAfter, from another goroutine, while it carries on.
+	OnSlowMigration func(Migration) `json:"-"`
+	// BestEffort runs migrations statement by statement and treats errors
+	// whose SQLSTATE is in BestEffortCodes, such as "already exists", as
+	// warnings: the migration carries on, is recorded as applied and lists
+	// them in Migration.Warnings. It is meant for rebuilding drifted
+	// environments. A file can opt in or out with
+	// "-- gostgrator: best-effort=true" or "best-effort=false".
+	BestEffort bool `json:"bestEffort,omitempty"`
+	// BestEffortCodes are the SQLSTATE codes best-effort migrations tolerate.
+	// Empty uses DefaultBestEffortCodes. SQLite errors about objects that
+	// already exist or do not exist are matched to the codes PostgreSQL uses.
+	BestEffortCodes []string `json:"bestEffortCodes,omitempty"`
+	// Transaction controls how migrations are wrapped in transactions:
+	// "none" (the default) runs them as they are, "each" runs every
+	// migration together with its schema table row in its own transaction,
+	// and "all" runs the whole Migrate or Down call in one transaction. In
+	// "each" and "all" a migration and its recorded version commit or roll
+	// back together, even if the run is canceled between them. In "all"
+	// other connections keep seeing the starting version until the run
+	// commits, never one in between. A file can opt out of "each" with
+	// "-- gostgrator: transaction=none".
+	Transaction string `json:"transaction,omitempty"`
+	// StreamThreshold is the size in bytes above which a migration file is
+	// read and executed one statement (or batch) at a time instead of being
+	// loaded whole, keeping memory flat for very large data migrations.
+	// Streamed files do not run in the single execution Postgres treats as a
+	// transaction. Zero uses DefaultConfig.StreamThreshold; a negative value
+	// never streams.
+	StreamThreshold int64 `json:"streamThreshold,omitempty"`
+	// FilenamePolicy is a regular expression every migration's base filename
+	// must match, or the name of a preset: "kebab-case" (lowercase words
+	// joined by hyphens) or "ticket" (the name starts with an issue key such
+	// as ABC-123). CreateMigration refuses names that break it and
+	// CheckFilenames reports existing files that do.
+	FilenamePolicy string `json:"filenamePolicy,omitempty"`
+	// ScanOnce loads migration files the first time they are needed and reuses
+	// them for every later call instead of rescanning, for long-lived instances
+	// that run several operations, like the CLIs' batch command. Files added
+	// or edited afterwards are not seen.
+	ScanOnce bool `json:"scanOnce,omitempty"`
+	// StrictQueries makes QueryContext fail with ErrNotAQuery for statements
+	// that return no rows, catching DDL run through it instead of
+	// ExecContext.
+	StrictQueries bool `json:"strictQueries,omitempty"`
+	// Environment names the environment migrations run in (e.g. "dev"). Files
+	// with an "-- gostgrator: environments=..." directive only run their SQL
+	// when it is listed.
+	Environment string `json:"environment,omitempty"`
+	// SkipGatedMigrations leaves migrations gated to other environments out of
+	// the schema table. By default they are recorded without running their SQL
+	// so versions stay aligned across environments.
+	SkipGatedMigrations bool `json:"skipGatedMigrations,omitempty"`
+	// IncludeTags limits Migrate to do migrations with one of these tags in
+	// their "-- gostgrator: tags=..." directive, e.g. for a maintenance window.
+	IncludeTags []string `json:"includeTags,omitempty"`
+	// ExcludeTags leaves do migrations with any of these tags out of Migrate.
+	ExcludeTags []string `json:"excludeTags,omitempty"`
+	// AllowOutOfOrder lets Migrate apply a migration while one numbered below
+	// it is left pending, by the tag filters or because it was added after
+	// higher versions ran. Migrate then also runs pending migrations below the
+	// database version, and rollbacks skip versions that were never applied.
+	AllowOutOfOrder bool `json:"allowOutOfOrder,omitempty"`
+	// MaxApplyPerRun caps how many do migrations one Migrate call applies,
+	// oldest first, so a deploy can ship one schema change at a time. Zero
+	// means no limit. Rollbacks are not capped, and Plan lists everything
+	// still pending.
+	MaxApplyPerRun int `json:"maxApplyPerRun,omitempty"`
+	// IgnoreWindows runs migrations whose "window" directive's maintenance
+	// window is closed instead of deferring them, for emergencies.
+	IgnoreWindows bool `json:"ignoreWindows,omitempty"`
+	// TranslateSQL rewrites a few column types written for the other
+	// bundled driver before running a migration, so simple schemas developed
+	// on SQLite can run on PostgreSQL and back: SERIAL and BIGSERIAL become
+	// INTEGER (INTEGER PRIMARY KEY AUTOINCREMENT as a primary key) and
+	// TIMESTAMPTZ becomes TEXT on SQLite, and INTEGER PRIMARY KEY
+	// AUTOINCREMENT becomes SERIAL PRIMARY KEY on PostgreSQL. It is best
+	// effort, not a dialect converter; use "-- gostgrator:only" blocks for
+	// anything else. Checksums are taken on the file as written.
+	TranslateSQL bool `json:"translateSql,omitempty"`
+	// VerifySignatures refuses to run migrations that are not accompanied by
+	// a "<file>.sig" SSH signature, made with "ssh-keygen -Y sign -n
+	// gostgrator", from a key in TrustedKeysFile, or that changed since they
+	// were signed. Migrate, Down, DownAll and Reset check every migration
+	// they are about to run before running any.
+	VerifySignatures bool `json:"verifySignatures,omitempty"`
+	// SignedEnvironments lists environments, such as "production", in which
+	// VerifySignatures is implied, so one config can require signed
+	// migrations in production without getting in the way of development.
+	SignedEnvironments []string `json:"signedEnvironments,omitempty"`
+	// TrustedKeysFile is the path of a file of SSH public keys allowed to
+	// sign migrations, in authorized_keys or allowed_signers format.
+	// ssh-ed25519, ecdsa-sha2-nistp256/384/521 and ssh-rsa keys are supported.
+	// The namespaces, valid-after and valid-before options of allowed_signers
+	// lines are enforced.
+	TrustedKeysFile string `json:"trustedKeysFile,omitempty"`
+	// TrustedSigners, when set, restricts the keys in TrustedKeysFile to
+	// allowed_signers lines whose principals match one of these identities,
+	// such as "release@example.com", as "ssh-keygen -Y verify -I" does.
+	TrustedSigners []string `json:"trustedSigners,omitempty"`
+	// SQLiteAutoVacuum runs VACUUM after migrating down and after dropping the
+	// schema table, so large rollbacks do not leave the SQLite file bloated.
+	// It is ignored by other drivers.
+	SQLiteAutoVacuum bool `json:"sqliteAutoVacuum,omitempty"`
+	// SQLiteBackupDir, when set, is where a SQLite database is backed up
+	// before migrating down, dropping the schema table, or running a
+	// migration that drops, truncates or deletes. It is ignored by other
+	// drivers.
+	SQLiteBackupDir string `json:"sqliteBackupDir,omitempty"`
+	// SQLiteBackupKeep is how many backups of the database to keep in
+	// SQLiteBackupDir, removing the oldest first. Zero keeps them all.
+	SQLiteBackupKeep int `json:"sqliteBackupKeep,omitempty"`
+	// CheckDataLoss counts the rows held by the tables and columns the undo
+	// migrations of a rollback drop. Migrate, Down, DownAll and Reset then
+	// refuse, with an error wrapping ErrDataLoss, to run undo migrations that
+	// would destroy more than DataLossThreshold rows, unless
+	// AcknowledgeDataLoss is set, and PlanDown reports the rows at stake. It
+	// is supported by the pg and sqlite3 drivers.
+	CheckDataLoss bool `json:"checkDataLoss,omitempty"`
+	// DataLossThreshold is the number of rows a dropped table or column may
+	// hold before CheckDataLoss reports it. Zero reports any row.
+	DataLossThreshold int64 `json:"dataLossThreshold,omitempty"`
+	// AcknowledgeDataLoss lets a rollback run undo migrations that
+	// CheckDataLoss found would destroy data. It is meant to be set for one
+	// run, so it is not read from config files.
+	AcknowledgeDataLoss bool `json:"-"`
+	// AutoUpgradeSchemaTable controls whether Migrate and Down add the name,
+	// md5 and run_at columns to a schema table created by an older version.
+	// Nil means true. When false, such a table is an error until it is
+	// upgraded explicitly with UpgradeSchemaTable, so DBAs can gate the change.
+	AutoUpgradeSchemaTable *bool `json:"autoUpgradeSchemaTable,omitempty"`
+	// AuditHistory keeps a record of every migration that ran. Undo sets the
+	// undone_at column of the version's row instead of deleting it, and each
+	// do and undo is appended to "<SchemaTable>_history". Rows marked undone
+	// do not count towards the database version or the applied migrations.
+	AuditHistory bool `json:"auditHistory,omitempty"`
+	// SnapshotSchema stores the structure of the database in
+	// "<SchemaTable>_snapshot" after every run that applied or undid a
+	// migration, so DetectDrift can report changes made outside of
+	// migrations. It is supported by the pg and sqlite3 drivers.
+	SnapshotSchema bool `json:"snapshotSchema,omitempty"`
+	// CaptureEnv names environment variables, such as GIT_SHA or
+	// CI_PIPELINE_ID, recorded with each applied migration. When set, the
+	// schema table gains a metadata column holding a JSON object of the
+	// listed variables that are set, plus the "hostname" the migration ran
+	// on, so every row links back to the deploy that applied it.
+	CaptureEnv []string `json:"captureEnv,omitempty"`
+	// WebhookURL, when set, receives a JSON WebhookPayload describing each
+	// Migrate, Down, DownAll and Reset: the migrations that ran, the final
+	// version and any failure. Its "text" field makes it readable by Slack
+	// and compatible incoming webhooks. A failed delivery is retried and then
+	// returned as a *NotifyError.
+	WebhookURL string `json:"webhookURL,omitempty"`
+	// WebhookSecret signs each webhook body with HMAC-SHA256, sent in the
+	// X-Gostgrator-Signature header as "sha256=<hex>".
+	WebhookSecret string `json:"webhookSecret,omitempty"`
+	// NotifyOn is when to post to WebhookURL: "always" (the default) or
+	// "failure".
+	NotifyOn string `json:"notifyOn,omitempty"`
 	// ValidateChecksums indicates if the tool should validate migration checksums.
 	ValidateChecksums bool `json:"validateChecksums,omitempty"`
 	// The connection strig to use
 	Conn string `json:"conn,omitempty"`
+	// VerifyConn is an optional read-only connection string used by commands
+	// that only inspect the database (e.g. list). Falls back to Conn when empty.
+	VerifyConn string `json:"verifyConn,omitempty"`
+	// SecondaryConn is an optional connection string of a database
+	// gostgrator-pg migrate keeps in lockstep with Conn; see MigrateLockstep.
+	SecondaryConn string `json:"secondaryConn,omitempty"`
+	// SQLiteDriver selects the driver gostgrator-sqlite opens databases with:
+	// "mattn" for github.com/mattn/go-sqlite3, which needs cgo, or "modernc"
+	// for the pure Go modernc.org/sqlite. The library itself runs on whichever
+	// *sql.DB it is given, with Driver "sqlite3" for either.
+	SQLiteDriver string `json:"sqliteDriver,omitempty"`
+	// Aliases maps names the CLIs accept as commands to the command, arguments
+	// and flags they stand for, e.g. "deploy": ["-json", "migrate", "max"].
+	// Flags given on the command line override the alias's flags, and further
+	// arguments are appended to its own. The library ignores it.
+	Aliases map[string][]string `json:"aliases,omitempty"`
 }
 
 // DefaultConfig provides default values for configuration.
 var DefaultConfig = Config{
 	SchemaTable:       "schemaversion",
 	ValidateChecksums: true,
+	StreamThreshold:   64 << 20,
 }
 
 // Gostgrator is the main orchestrator for running database migrations.
@@ -37,11 +313,49 @@ var DefaultConfig = Config{
 type Gostgrator struct {
 	cfg        Config
 	migrations []Migration
-	client     Client
+	// byVersion indexes migrations by version; loaded reports that
+	// migrations has been read, even if no files were found.
+	byVersion map[int][]Migration
+	loaded    bool
+	client    Client
+	// locked reports that the migration lock is held through Lock.
+	locked bool
+	// reporting is the command running whose outcome is posted to
+	// Config.WebhookURL, or empty.
+	reporting string
+	// inTx reports that client runs every query in a transaction.
+	inTx bool
+	// metrics counts the runs reported by MetricsHandler.
+	metrics *runMetrics
+	// logger, hooks and locker are set with WithLogger, WithHooks and
+	// WithLock.
+	logger *slog.Logger
+	hooks  Hooks
+	locker Locker
 }
 
 // NewGostgrator creates a new Gostgrator instance with the provided configuration and database connection.
+// It is New(db, WithConfig(cfg)).
+//
+// db may be nil for work that only reads migration files, such as
+// GetMigrations, CreateMigration and ExportUndo; methods that query the
+// database then fail with an error wrapping ErrNoDatabase.
 func NewGostgrator(cfg Config, db *sql.DB) (*Gostgrator, error) {
+	return New(db, WithConfig(cfg))
+}
+
+// New creates a new Gostgrator for db, configured by opts. Without
+// WithConfig it uses the defaults of an empty Config. The configuration is
+// checked as by Config.Validate, except that MigrationPattern may be empty.
+func New(db *sql.DB, opts ...Option) (*Gostgrator, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	cfg := o.cfg
+	if o.fs != nil {
+		cfg.FS = o.fs
+	}
 	// Merge defaults.
 	if cfg.SchemaTable == "" {
 		cfg.SchemaTable = DefaultConfig.SchemaTable
@@ -49,42 +363,156 @@ func NewGostgrator(cfg Config, db *sql.DB) (*Gostgrator, error) {
 	if !cfg.ValidateChecksums {
 		cfg.ValidateChecksums = DefaultConfig.ValidateChecksums
 	}
+	if cfg.StreamThreshold == 0 {
+		cfg.StreamThreshold = DefaultConfig.StreamThreshold
+	}
+	if err := errors.Join(cfg.validate()...); err != nil {
+		return nil, err
+	}
+	cfg.Transaction = strings.ToLower(cfg.Transaction)
 	client, err := NewClient(cfg, db)
 	if err != nil {
 		return nil, err
 	}
+	logger := o.logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
 	return &Gostgrator{
-		cfg:    cfg,
-		client: client,
+		cfg:     cfg,
+		client:  client,
+		metrics: newRunMetrics(),
+		logger:  logger,
+		hooks:   o.hooks,
+		locker:  o.locker,
 	}, nil
 }
 
+// GetMigrations scans for migration files and returns them, unless
+// Config.ScanOnce is set and they have already been loaded.
 func (g *Gostgrator) GetMigrations() ([]Migration, error) {
-    migs, err := getMigrations(g.cfg)
-    if err != nil {
-        return nil, err
-    }
-    g.migrations = migs
-    return migs, nil
+	if g.cfg.ScanOnce && g.loaded {
+		return slices.Clone(g.migrations), nil
+	}
+	migs, err := getMigrations(g.cfg)
+	if err != nil {
+		return nil, err
+	}
+	g.migrations = migs
+	g.byVersion = make(map[int][]Migration, len(migs))
+	for _, m := range migs {
+		g.byVersion[m.Version] = append(g.byVersion[m.Version], m)
+	}
+	g.loaded = true
+	return migs, nil
 }
 
-// QueryContext is a helper to execute a query using the underlying client.
+// ErrNotAQuery is returned by QueryContext with Config.StrictQueries for a
+// statement that returns no rows, such as DROP TABLE; run those with
+// ExecContext instead.
+var ErrNotAQuery = errors.New("statement returns no rows; use ExecContext")
+
+// QueryContext runs a query that returns rows on the database, or in the
+// transaction of the current run. The caller must close the returned rows.
+// With Config.StrictQueries, a statement that returns no columns fails with
+// ErrNotAQuery, though it has already run by then.
 func (g *Gostgrator) QueryContext(ctx context.Context, query string) (*sql.Rows, error) {
-	return g.client.QueryContext(ctx, query)
+	rows, err := g.client.QueryContext(ctx, query)
+	if err != nil || !g.cfg.StrictQueries {
+		return rows, err
+	}
+	columns, err := rows.Columns()
+	if err == nil && len(columns) == 0 {
+		err = ErrNotAQuery
+	}
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ExecContext runs a statement that returns no rows, such as DDL, on the
+// database, or in the transaction of the current run.
+func (g *Gostgrator) ExecContext(ctx context.Context, query string) (sql.Result, error) {
+	return g.client.ExecContext(ctx, query)
+}
+
+// EnsureSchemaTable creates the migration table if it does not exist and adds
+// any columns missing from tables created by older versions, unless
+// Config.AutoUpgradeSchemaTable is false.
+func (g *Gostgrator) EnsureSchemaTable(ctx context.Context) error {
+	return g.client.EnsureTable(ctx)
+}
+
+// UpgradeSchemaTable creates the migration table if it does not exist and adds
+// any missing columns, even when Config.AutoUpgradeSchemaTable is false.
+func (g *Gostgrator) UpgradeSchemaTable(ctx context.Context) error {
+	return g.client.UpgradeTable(ctx)
+}
+
+// companionTables are the suffixes of the tables gostgrator keeps next to
+// the schema table.
+var companionTables = []string{"_lock", "_history", "_progress", "_snapshot"}
+
+// DropSchemaTable drops the migration table and the lock, history, progress
+// and snapshot tables next to it, discarding all recorded migration state.
+func (g *Gostgrator) DropSchemaTable(ctx context.Context) error {
+	return g.DropSchemaTableWithOptions(ctx, DropOptions{})
+}
+
+// DropSchemaTableWithOptions drops the migration table and its companions
+// using opts, e.g. to succeed when the table is already gone, to drop
+// dependent objects too or to keep the companions. Companions that do not
+// exist are skipped.
+func (g *Gostgrator) DropSchemaTableWithOptions(ctx context.Context, opts DropOptions) error {
+	if err := g.autoBackup(ctx, "drop-schema"); err != nil {
+		return err
+	}
+	if _, err := g.client.ExecContext(ctx, g.client.DropTableSql(opts)); err != nil {
+		return err
+	}
+	if !opts.OnlyCore {
+		for _, suffix := range companionTables {
+			drop := "DROP TABLE IF EXISTS " + quoteQualified(g.cfg.SchemaTable+suffix)
+			if opts.Cascade && strings.ToLower(g.cfg.Driver) == "pg" {
+				drop += " CASCADE"
+			}
+			if _, err := g.client.ExecContext(ctx, drop+";"); err != nil {
+				return err
+			}
+		}
+	}
+	return g.autoCompact(ctx)
 }
 
-// GetDatabaseVersion returns the current database version.
-// If the migration table is not initialized, it returns 0.
+// GetDatabaseVersion returns the current database version, the highest
+// version recorded in the schema table, or in Config.GolangMigrateTable if
+// that is higher. If the migration table is not initialized or holds no
+// applied migrations, it returns 0.
 func (g *Gostgrator) GetDatabaseVersion(ctx context.Context) (int, error) {
-	versionSql := g.client.GetDatabaseVersionSql()
-	initialized, err := g.client.HasVersionTable(ctx)
+	version, err := g.schemaTableVersion(ctx)
+	if err != nil {
+		return 0, err
+	}
+	gmVersion, err := g.golangMigrateVersion(ctx)
 	if err != nil {
 		return 0, err
 	}
-	if !initialized {
+	return max(version, gmVersion), nil
+}
+
+// schemaTableVersion returns the highest version recorded in the schema
+// table, or 0 if there is none.
+func (g *Gostgrator) schemaTableVersion(ctx context.Context) (int, error) {
+	columns, err := g.client.SchemaColumns(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(columns) == 0 {
 		return 0, nil
 	}
-	rows, err := g.client.QueryContext(ctx, versionSql)
+	rows, err := g.client.QueryContext(ctx, g.client.GetDatabaseVersionColumnsSql(columns))
 	if err != nil {
 		return 0, err
 	}
@@ -95,12 +523,12 @@ func (g *Gostgrator) GetDatabaseVersion(ctx context.Context) (int, error) {
 			return 0, err
 		}
 	}
-	return version, nil
+	return version, rows.Err()
 }
 
 // GetMaxVersion returns the highest migration version available.
 func (g *Gostgrator) GetMaxVersion() (int, error) {
-	if len(g.migrations) == 0 {
+	if !g.loaded {
 		_, err := g.GetMigrations()
 		if err != nil {
 			return 0, err
@@ -117,39 +545,89 @@ func (g *Gostgrator) GetMaxVersion() (int, error) {
 
 // Down rolls back the migrations by the given number of steps.
 // It computes the target version as the current version minus steps (not going below zero),
-// and then calls Migrate to perform the undo operations.
+// and then calls Migrate to perform the undo operations, holding the
+// migration lock throughout.
 func (g *Gostgrator) Down(ctx context.Context, steps int) ([]Migration, error) {
-	currentVersion, err := g.GetDatabaseVersion(ctx)
-	if err != nil {
-		return nil, err
-	}
-	targetVersion := max(currentVersion - steps, 0)
-	// Convert target version to string for Migrate.
-	return g.Migrate(ctx, strconv.Itoa(targetVersion))
+	return g.report(ctx, "down", func() ([]Migration, error) {
+		var applied []Migration
+		err := g.withLock(ctx, func() error {
+			currentVersion, err := g.GetDatabaseVersion(ctx)
+			if err != nil {
+				return err
+			}
+			targetVersion := max(currentVersion-steps, 0)
+			// Convert target version to string for Migrate.
+			applied, err = g.Migrate(ctx, strconv.Itoa(targetVersion))
+			return err
+		})
+		return applied, err
+	})
+}
+
+// DownAll rolls back every applied migration, leaving the database at
+// version 0.
+func (g *Gostgrator) DownAll(ctx context.Context) ([]Migration, error) {
+	return g.report(ctx, "down", func() ([]Migration, error) {
+		return g.Migrate(ctx, "0")
+	})
+}
+
+// Reset rolls back every applied migration and then migrates to the highest
+// available version, holding the migration lock throughout, to rebuild a
+// development database from scratch. It returns the undo migrations followed
+// by the do migrations that ran. If the rollback fails, nothing is migrated.
+func (g *Gostgrator) Reset(ctx context.Context) ([]Migration, error) {
+	return g.report(ctx, "reset", func() ([]Migration, error) {
+		var ran []Migration
+		err := g.withLock(ctx, func() error {
+			undone, err := g.DownAll(ctx)
+			ran = append(ran, undone...)
+			if err != nil {
+				return err
+			}
+			applied, err := g.Migrate(ctx, "max")
+			ran = append(ran, applied...)
+			if err != nil {
+				var partial *PartialApplyError
+				if errors.As(err, &partial) {
+					partial.Applied = slices.Concat(undone, partial.Applied)
+				}
+			}
+			return err
+		})
+		return ran, err
+	})
 }
 
-// ValidateMigrations verifies that applied migrations have not changed by comparing MD5 checksums.
+// ValidateMigrations verifies that applied migrations have not changed by
+// comparing MD5 checksums. The recorded checksums are read in a single query
+// and compared locally, so the cost does not grow with round trips per
+// applied migration.
 func (g *Gostgrator) ValidateMigrations(ctx context.Context, databaseVersion int) error {
 	_, err := g.GetMigrations()
 	if err != nil {
 		return err
 	}
+	return g.validateMigrations(ctx, databaseVersion)
+}
+
+// validateMigrations checks the loaded migrations against the checksums
+// recorded in the schema table, reading them all in a single query.
+func (g *Gostgrator) validateMigrations(ctx context.Context, databaseVersion int) error {
+	applied, err := g.GetAppliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	recorded := make(map[int]string, len(applied))
+	for _, a := range applied {
+		if _, ok := recorded[a.Version]; !ok {
+			recorded[a.Version] = a.Md5
+		}
+	}
 	for _, m := range g.migrations {
 		if m.Action == "do" && m.Version > 0 && m.Version <= databaseVersion {
-			query := g.client.GetMd5Sql(m)
-			rows, err := g.client.QueryContext(ctx, query)
-			if err != nil {
-				return err
-			}
-			var dbMd5 sql.NullString
-			if rows.Next() {
-				if err := rows.Scan(&dbMd5); err != nil {
-					rows.Close()
-					return err
-				}
-			}
-			rows.Close()
-			if dbMd5.Valid && m.Md5 != "" && dbMd5.String != m.Md5 {
+			dbMd5 := recorded[m.Version]
+			if dbMd5 != "" && m.Md5 != "" && dbMd5 != m.Md5 {
 				return fmt.Errorf("MD5 checksum failed for migration [%d]", m.Version)
 			}
 		}
@@ -157,93 +635,520 @@ func (g *Gostgrator) ValidateMigrations(ctx context.Context, databaseVersion int
 	return nil
 }
 
+// PartialApplyError is returned by RunMigrations, and so by Migrate and Down,
+// when a migration fails after the run started. Migrations in Applied were
+// run and recorded before Failed; none after Failed were attempted.
+type PartialApplyError struct {
+	// Applied lists the migrations completed before the failure, in run order.
+	Applied []Migration
+	// Failed is the migration that could not be applied.
+	Failed Migration
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *PartialApplyError) Error() string {
+	return fmt.Sprintf("migration %s failed after %d applied: %v", e.Failed.Filename, len(e.Applied), e.Err)
+}
+
+func (e *PartialApplyError) Unwrap() error { return e.Err }
+
 // RunMigrations applies the provided migrations in sequence.
+// When Config.RecordProgress is set, each statement is recorded as it
+// completes so a failed migration resumes after its last successful statement.
+// If a migration fails, the migrations applied so far are returned along with
+// a *PartialApplyError describing the failure. If it failed because its
+// connection dropped, the schema table is read again on a new connection: a
+// migration recorded before the drop counts as applied and the run carries
+// on, and otherwise the error wraps ErrConnectionLost. With
+// Config.SnapshotSchema a schema snapshot is taken once any migration was
+// applied, even if a later one failed.
 func (g *Gostgrator) RunMigrations(ctx context.Context, migrations []Migration) ([]Migration, error) {
+	applied, err := g.runMigrations(ctx, migrations)
+	if g.cfg.SnapshotSchema && len(applied) > 0 {
+		if serr := g.SnapshotSchema(ctx); serr != nil && err == nil {
+			err = fmt.Errorf("taking a schema snapshot: %w", serr)
+		}
+	}
+	return applied, err
+}
+
+// runMigrations is RunMigrations without the schema snapshot.
+func (g *Gostgrator) runMigrations(ctx context.Context, migrations []Migration) ([]Migration, error) {
 	var applied []Migration
-	for _, m := range migrations {
-		sqlScript, err := m.getSQL()
-		if err != nil {
+	if g.cfg.RecordProgress && len(migrations) > 0 {
+		if err := g.client.EnsureProgressTable(ctx); err != nil {
 			return applied, err
 		}
-		if _, err := g.client.ExecContext(ctx, sqlScript); err != nil {
+	}
+	if g.cfg.AuditHistory && len(migrations) > 0 {
+		if err := g.client.EnsureHistoryTable(ctx); err != nil {
 			return applied, err
 		}
-		persistSQL := g.client.PersistActionSql(m)
-		if _, err := g.client.ExecContext(ctx, persistSQL); err != nil {
-			return applied, err
+	}
+	defer g.startKeepalive(ctx)()
+	if g.cfg.Transaction == "all" && len(migrations) > 0 {
+		return g.runAllInTransaction(ctx, migrations)
+	}
+	for i, m := range migrations {
+		if err := g.injectedFailure(i); err != nil {
+			return applied, &PartialApplyError{Applied: applied, Failed: m, Err: err}
+		}
+		recorded, err := g.observe(ctx, &m, func() (bool, error) {
+			start := g.cfg.now()
+			recorded, err := g.runMigrationInTransaction(ctx, &m)
+			m.Duration = g.cfg.now().Sub(start)
+			if err != nil && connectionLost(err) {
+				recorded, err = true, g.recoverLostConnection(ctx, m, err)
+			}
+			return recorded, err
+		})
+		if err != nil {
+			return applied, &PartialApplyError{Applied: applied, Failed: m, Err: err}
+		}
+		if recorded {
+			applied = append(applied, m)
 		}
-		applied = append(applied, m)
 	}
 	return applied, nil
 }
 
-func (g *Gostgrator) GetRunnableMigrations(databaseVersion, targetVersion int) ([]Migration, error) {
-	if targetVersion > databaseVersion {
-		var runnable []Migration
-		for _, m := range g.migrations {
-			if m.Action == "do" && m.Version > databaseVersion && m.Version <= targetVersion {
-				runnable = append(runnable, m)
+// runMigration runs a single migration and records it in the schema table.
+// It reports false if the migration was skipped without being recorded.
+// Errors tolerated in best-effort mode are added to m.Warnings.
+func (g *Gostgrator) runMigration(ctx context.Context, m *Migration) (bool, error) {
+	enabled, err := g.environmentEnabled(*m)
+	if err != nil {
+		return false, err
+	}
+	if !enabled {
+		if g.cfg.SkipGatedMigrations {
+			return false, nil
+		}
+		// Record the version without running it to keep versions aligned.
+		if err := g.persistAction(ctx, *m); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err := g.execute(ctx, m, g.cfg.RecordProgress); err != nil {
+		return false, err
+	}
+	if afterMigrationSQL != nil {
+		afterMigrationSQL(*m)
+	}
+	if err := g.persistAction(ctx, *m); err != nil {
+		return false, err
+	}
+	if g.cfg.RecordProgress {
+		if _, err := g.client.ExecContext(ctx, g.client.ClearProgressSql(*m)); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// execute runs the SQL of m: while reading it if it is large enough to
+// stream, statement by statement when recording progress or in best-effort
+// mode, and in batches otherwise.
+func (g *Gostgrator) execute(ctx context.Context, m *Migration, recordProgress bool) error {
+	bestEffort, err := g.bestEffort(*m)
+	if err != nil {
+		return err
+	}
+	stream, err := g.streams(*m)
+	if err != nil {
+		return err
+	}
+	if stream {
+		return g.runStreamed(ctx, m, bestEffort, recordProgress)
+	}
+	sqlScript, err := g.sql(*m)
+	if err != nil {
+		return err
+	}
+	switch {
+	case recordProgress:
+		return g.runWithProgress(ctx, m, bestEffort, sliceStatements(g.statements(*m, sqlScript)))
+	case bestEffort:
+		return g.runStatements(ctx, m, bestEffort, sliceStatements(g.statements(*m, sqlScript)))
+	default:
+		return g.runBatches(ctx, *m, sqlScript)
+	}
+}
+
+// persistAction records m in the schema table and, with Config.AuditHistory,
+// in the history table.
+func (g *Gostgrator) persistAction(ctx context.Context, m Migration) error {
+	if _, err := execArgs(ctx, g.client, func(c ArgsClient) (string, []any) {
+		return c.PersistActionArgs(m)
+	}, func() string {
+		return g.client.PersistActionSql(m)
+	}); err != nil {
+		return err
+	}
+	if g.cfg.AuditHistory {
+		if _, err := execArgs(ctx, g.client, func(c ArgsClient) (string, []any) {
+			return c.PersistHistoryArgs(m)
+		}, func() string {
+			return g.client.PersistHistorySql(m)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// environmentEnabled reports whether m may run in the configured environment.
+// A version is gated by the "environments" directive of its do or undo file, so
+// an undo only runs where its do migration ran.
+func (g *Gostgrator) environmentEnabled(m Migration) (bool, error) {
+	for _, other := range g.byVersion[m.Version] {
+		environments, err := other.environments()
+		if err != nil {
+			return false, err
+		}
+		if environments != nil && !slices.Contains(environments, g.cfg.Environment) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// runBatches executes each batch of a migration script.
+func (g *Gostgrator) runBatches(ctx context.Context, m Migration, sqlScript string) error {
+	for _, batch := range splitBatches(sqlScript, g.batchSplitter(m)) {
+		if _, err := g.client.ExecContext(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streams reports whether m is large enough to be executed as it is read.
+func (g *Gostgrator) streams(m Migration) (bool, error) {
+	if g.cfg.StreamThreshold < 0 {
+		return false, nil
+	}
+	size, err := m.size()
+	if err != nil {
+		return false, err
+	}
+	return size > g.cfg.StreamThreshold, nil
+}
+
+// runStreamed executes a migration one statement or batch at a time while
+// reading it, so only the statement being run is held in memory.
+func (g *Gostgrator) runStreamed(ctx context.Context, m *Migration, bestEffort, recordProgress bool) error {
+	f, err := openMigrationFile(m.fsys, m.Filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	statements := newStatementReader(g.sqlReader(f, *m), m.Filename, g.batchSplitter(*m))
+	next := statements.Next
+	if g.cfg.TranslateSQL {
+		next = func() (string, error) {
+			stmt, err := statements.Next()
+			return translateSQL(stmt, g.cfg.Driver), err
+		}
+	}
+	if recordProgress {
+		return g.runWithProgress(ctx, m, bestEffort, next)
+	}
+	return g.runStatements(ctx, m, bestEffort, next)
+}
+
+// runStatements executes the statements next yields, in order, until it
+// returns io.EOF.
+func (g *Gostgrator) runStatements(ctx context.Context, m *Migration, bestEffort bool, next func() (string, error)) error {
+	for i := 0; ; i++ {
+		stmt, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := g.execStatement(ctx, m, bestEffort, i, stmt); err != nil {
+			return err
+		}
+	}
+}
+
+// statements splits a migration script into the units runWithProgress
+// records: batches when the file has a batch separator or delimiter,
+// statements otherwise.
+func (g *Gostgrator) statements(m Migration, sqlScript string) []string {
+	if b := g.batchSplitter(m); b.splits() {
+		return splitBatches(sqlScript, b)
+	}
+	return splitStatements(sqlScript)
+}
+
+// sliceStatements returns a function yielding each of statements in turn and
+// then io.EOF, matching statementReader.Next.
+func sliceStatements(statements []string) func() (string, error) {
+	return func() (string, error) {
+		if len(statements) == 0 {
+			return "", io.EOF
+		}
+		stmt := statements[0]
+		statements = statements[1:]
+		return stmt, nil
+	}
+}
+
+// runWithProgress executes a migration one statement at a time, recording each
+// completed statement and skipping the ones a previous run already recorded.
+// Files with a batch separator are executed and recorded batch by batch instead.
+// next yields the statements in order and io.EOF after the last one.
+func (g *Gostgrator) runWithProgress(ctx context.Context, m *Migration, bestEffort bool, next func() (string, error)) error {
+	done, err := g.statementProgress(ctx, *m)
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		stmt, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		sum, err := checksum(stmt, "")
+		if err != nil {
+			return err
+		}
+		if prev, ok := done[i]; ok {
+			if prev != sum {
+				return fmt.Errorf("statement %d of migration [%d] changed since it was partially applied", i+1, m.Version)
 			}
+			continue
+		}
+		if err := g.execStatement(ctx, m, bestEffort, i, stmt); err != nil {
+			return err
+		}
+		if _, err := execArgs(ctx, g.client, func(c ArgsClient) (string, []any) {
+			return c.PersistProgressArgs(*m, i, sum)
+		}, func() string {
+			return g.client.PersistProgressSql(*m, i, sum)
+		}); err != nil {
+			return err
 		}
-		sortMigrationsAsc(runnable)
-		return runnable, nil
 	}
+}
 
-	if targetVersion < databaseVersion {
-		var runnable []Migration
-		for _, m := range g.migrations {
-			if m.Action == "undo" && m.Version <= databaseVersion && m.Version > targetVersion {
-				runnable = append(runnable, m)
+// statementProgress returns the checksums of the statements of m that have
+// already run, keyed by statement index.
+func (g *Gostgrator) statementProgress(ctx context.Context, m Migration) (map[int]string, error) {
+	rows, err := g.client.QueryContext(ctx, g.client.GetProgressSql(m))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	done := make(map[int]string)
+	for rows.Next() {
+		var statement int
+		var md5 sql.NullString
+		if err := rows.Scan(&statement, &md5); err != nil {
+			return nil, err
+		}
+		done[statement] = md5.String
+	}
+	return done, rows.Err()
+}
+
+// batchSplitter returns how m is split into batches: on the file's separator
+// directive, or Config.BatchSeparator without one, and on its delimiter
+// directive.
+func (g *Gostgrator) batchSplitter(m Migration) batchSplitter {
+	b := batchSplitter{separator: g.cfg.BatchSeparator, delimiter: m.Directives["delimiter"]}
+	if sep, ok := m.Directives["separator"]; ok {
+		b.separator = sep
+		if strings.EqualFold(sep, "none") {
+			b.separator = ""
+		}
+	}
+	return b
+}
+
+// planFiles describes migrations to the planner. A do migration whose
+// depends-on directive cannot be parsed is planned without dependencies and
+// its error returned in invalid, as it only matters if the migration runs.
+func planFiles(migrations []Migration) (files []plan.File, invalid map[int]error) {
+	invalid = make(map[int]error)
+	for _, m := range migrations {
+		f := plan.File{Version: m.Version, Action: m.Action, Name: m.Name}
+		if m.Action == "do" {
+			deps, err := m.dependencies()
+			if err != nil {
+				invalid[m.Version] = err
 			}
+			f.DependsOn = deps
 		}
-		sortMigrationsDesc(runnable)
-		return runnable, nil
+		files = append(files, f)
 	}
+	return files, invalid
+}
 
-	// targetVersion == databaseVersion
-	return nil, nil
+// GetRunnableMigrations returns the migrations that move the database from
+// databaseVersion to targetVersion: do migrations numbered above
+// databaseVersion up to targetVersion in ascending order, or undo migrations
+// numbered at or below databaseVersion and above targetVersion in descending
+// order. Versions are compared as plain integers whatever their numbering
+// mode, so a timestamp version always sorts after an int version, and a do
+// migration numbered at or below databaseVersion is never run even if it was
+// not applied; GetSkippedMigrations reports such files. The order is
+// computed by plan.Runnable.
+func (g *Gostgrator) GetRunnableMigrations(databaseVersion, targetVersion int) ([]Migration, error) {
+	files, invalid := planFiles(g.migrations)
+	steps, err := plan.Runnable(files, databaseVersion, targetVersion)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]Migration, len(g.migrations))
+	for _, m := range g.migrations {
+		byKey[fmt.Sprintf("%d:%s", m.Version, m.Action)] = m
+	}
+	var runnable []Migration
+	for _, step := range steps {
+		if err := invalid[step.Version]; err != nil && step.Action == "do" {
+			return nil, err
+		}
+		runnable = append(runnable, byKey[fmt.Sprintf("%d:%s", step.Version, step.Action)])
+	}
+	return runnable, nil
+}
+
+// resolveTarget converts a Migrate target into a version number.
+// "max" or an empty target resolves to the highest available version.
+func (g *Gostgrator) resolveTarget(target string) (int, error) {
+	if !g.loaded {
+		if _, err := g.GetMigrations(); err != nil {
+			return 0, err
+		}
+	}
+	files, _ := planFiles(g.migrations)
+	return plan.ResolveTarget(files, target)
 }
 
 // Migrate moves the schema to the target version.
 // If target is "max" or empty, it migrates to the highest available version.
+// Errors raised while running migrations are *PartialApplyError values; use
+// errors.As to tell which migrations were applied before the failure.
+// Migrate holds the migration lock while it runs and fails with an error
+// wrapping ErrLocked if another process holds it; see Lock. With
+// Config.WebhookURL, the outcome is posted there afterwards, and a failed
+// delivery after a successful run is returned as a *NotifyError.
 func (g *Gostgrator) Migrate(ctx context.Context, target string) ([]Migration, error) {
-	if err := g.client.EnsureTable(ctx); err != nil {
+	return g.report(ctx, "migrate", func() ([]Migration, error) {
+		var applied []Migration
+		err := g.withLock(ctx, func() error {
+			var err error
+			applied, err = g.migrate(ctx, target)
+			return err
+		})
+		return applied, err
+	})
+}
+
+// ErrVersionChanged is wrapped by the error MigrateIfCurrent returns when
+// the database is not at the version the caller expected.
+var ErrVersionChanged = errors.New("the database version changed")
+
+// MigrateIfCurrent is Migrate, but only if the database is still at
+// expectedVersion once the migration lock is held. Otherwise it changes
+// nothing and fails with an error wrapping ErrVersionChanged, so an operator
+// can confirm a plan, such as one from Plan, against a specific version and
+// be sure exactly that plan runs, even if another deploy migrated in the
+// meantime.
+func (g *Gostgrator) MigrateIfCurrent(ctx context.Context, expectedVersion int, target string) ([]Migration, error) {
+	return g.report(ctx, "migrate", func() ([]Migration, error) {
+		var applied []Migration
+		err := g.withLock(ctx, func() error {
+			version, err := g.GetDatabaseVersion(ctx)
+			if err != nil {
+				return err
+			}
+			if version != expectedVersion {
+				return fmt.Errorf("%w: expected version %d, but the database is at version %d", ErrVersionChanged, expectedVersion, version)
+			}
+			applied, err = g.migrate(ctx, target)
+			return err
+		})
+		return applied, err
+	})
+}
+
+// migrate is Migrate with the migration lock held.
+func (g *Gostgrator) migrate(ctx context.Context, target string) ([]Migration, error) {
+	if err := g.EnsureSchemaTable(ctx); err != nil {
+		return nil, err
+	}
+	if err := g.checkFrozen(ctx); err != nil {
 		return nil, err
 	}
 	_, migErr := g.GetMigrations()
 	if migErr != nil {
 		return nil, migErr
 	}
-	var targetVersion int
-	var err error
-	cleaned := strings.ToLower(strings.TrimSpace(target))
-	if cleaned == "max" || cleaned == "" {
-		targetVersion, err = g.GetMaxVersion()
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		targetVersion, err = strconv.Atoi(cleaned)
-		if err != nil {
-			return nil, fmt.Errorf("invalid target version: %v", err)
-		}
+	targetVersion, err := g.resolveTarget(target)
+	if err != nil {
+		return nil, err
 	}
 	dbVersion, err := g.GetDatabaseVersion(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if gmVersion, err := g.golangMigrateVersion(ctx); err != nil {
+		return nil, err
+	} else if targetVersion < gmVersion {
+		return nil, fmt.Errorf("cannot roll back below version %d recorded in golang-migrate table %s; use golang-migrate to go further", gmVersion, g.cfg.GolangMigrateTable)
+	}
 	if g.cfg.ValidateChecksums && targetVersion >= dbVersion {
-		if err := g.ValidateMigrations(ctx, dbVersion); err != nil {
+		if err := g.validateMigrations(ctx, dbVersion); err != nil {
 			return nil, err
 		}
 	}
-	runnable, err := g.GetRunnableMigrations(dbVersion, targetVersion)
+	runnable, _, err := g.selectRunnable(ctx, dbVersion, targetVersion)
 	if err != nil {
 		return nil, err
 	}
+	if n := g.cfg.MaxApplyPerRun; n > 0 && len(runnable) > n && runnable[0].Action == "do" {
+		runnable = runnable[:n]
+	}
+	if g.signaturesRequired() {
+		if err := g.checkSignatures(runnable); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.checkDataLoss(ctx, runnable); err != nil {
+		return nil, err
+	}
+	if g.cfg.SQLiteBackupDir != "" {
+		destructive, err := g.destructive(runnable)
+		if err != nil {
+			return nil, err
+		}
+		if destructive {
+			reason := "migrate"
+			if targetVersion < dbVersion {
+				reason = "down"
+			}
+			if err := g.autoBackup(ctx, reason); err != nil {
+				return nil, err
+			}
+		}
+	}
 	applied, err := g.RunMigrations(ctx, runnable)
 	if err != nil {
 		return applied, err
 	}
+	if targetVersion < dbVersion && len(applied) > 0 {
+		if err := g.autoCompact(ctx); err != nil {
+			return applied, err
+		}
+	}
 	return applied, nil
 }
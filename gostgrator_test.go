@@ -4,23 +4,38 @@ package gostgrator_test
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/bcomnes/gostgrator"
+	"github.com/bcomnes/gostgrator/gostgratortest"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var pgTestConfig gostgrator.Config
 
+// pgTestConn is the connection URL of the Postgres test database.
+var pgTestConn string
+
 // TestMain sets up a temporary Postgres test database and drops it after tests.
 func TestMain(m *testing.M) {
+	pg, err := gostgratortest.StartPostgres(context.Background())
+	if err != nil {
+		log.Fatalf("failed to start postgres: %v", err)
+	}
+	pgTestConn = pg.URL("gostgrator_test") + "&search_path=gostgrator_schema"
+
 	// Connect to default "postgres" database.
-	connStr := "host=localhost port=5432 user=postgres dbname=postgres sslmode=disable"
+	connStr := pg.URL("postgres")
 	db, err := sql.Open("pgx", connStr)
 	if err != nil {
 		log.Fatalf("failed to connect to postgres: %v", err)
@@ -42,7 +57,7 @@ func TestMain(m *testing.M) {
 	time.Sleep(1 * time.Second)
 
 	// Connect to the newly created test database.
-	testConnStr := "host=localhost port=5432 user=postgres dbname=gostgrator_test sslmode=disable"
+	testConnStr := pg.URL("gostgrator_test")
 	testDB, err := sql.Open("pgx", testConnStr)
 	if err != nil {
 		log.Fatalf("failed to connect to test database: %v", err)
@@ -80,6 +95,9 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		log.Printf("failed to drop test database: %v", err)
 	}
+	if err := pg.Close(); err != nil {
+		log.Printf("failed to stop postgres: %v", err)
+	}
 
 	os.Exit(code)
 }
@@ -87,8 +105,7 @@ func TestMain(m *testing.M) {
 func TestPostgresMigrations(t *testing.T) {
 	ctx := context.Background()
 	// Open a connection to the test database.
-	connStr := "host=localhost port=5432 user=postgres dbname=gostgrator_test sslmode=disable search_path=gostgrator_schema"
-	db, err := sql.Open("pgx", connStr)
+	db, err := sql.Open("pgx", pgTestConn)
 	if err != nil {
 		t.Fatalf("failed to connect to test database: %v", err)
 	}
@@ -127,7 +144,7 @@ func TestPostgresMigrations(t *testing.T) {
 		}
 	})
 
-	t.Run("Get Migrations", func (t *testing.T) {
+	t.Run("Get Migrations", func(t *testing.T) {
 		migs, err := g.GetMigrations()
 		if err != nil {
 			t.Fatalf("GetMigrations failed: %v", err)
@@ -137,16 +154,16 @@ func TestPostgresMigrations(t *testing.T) {
 		}
 		mig := migs[0]
 
-		if (mig.Version != 1) {
+		if mig.Version != 1 {
 			t.Fatalf("expected migration version 1, got %d", mig.Version)
 		}
 
-		if (mig.Action != "do") {
+		if mig.Action != "do" {
 			t.Fatalf("expected migration action 'up', got %s", mig.Action)
 		}
 
 		// filanem endswith
-		if (strings.HasSuffix(mig.Filename, "001_do.sql")) {
+		if strings.HasSuffix(mig.Filename, "001_do.sql") {
 			t.Fatalf("expected migration filename '001_do.sql', got %s", mig.Filename)
 		}
 
@@ -193,8 +210,7 @@ func TestMigrationFail(t *testing.T) {
 	t.Run("Migration Failure Handling", func(t *testing.T) {
 		ctx := context.Background()
 
-		connStr := "host=localhost port=5432 user=postgres dbname=gostgrator_test sslmode=disable search_path=gostgrator_schema"
-		db, err := sql.Open("pgx", connStr)
+		db, err := sql.Open("pgx", pgTestConn)
 		if err != nil {
 			t.Fatalf("failed to connect to test database: %v", err)
 		}
@@ -245,10 +261,9 @@ func TestMigrationDupe(t *testing.T) {
 	t.Run("Duplicate Migrations Error", func(t *testing.T) {
 		ctx := context.Background()
 
-		connStr := "host=localhost port=5432 user=postgres dbname=gostgrator_test sslmode=disable search_path=gostgrator_schema"
 		dupCfg := pgTestConfig
 		dupCfg.MigrationPattern = "testdata/duplicateMigrations/*"
-		dupDB, err := sql.Open("pgx", connStr)
+		dupDB, err := sql.Open("pgx", pgTestConn)
 		if err != nil {
 			t.Fatalf("failed to connect for duplicate test: %v", err)
 		}
@@ -277,9 +292,9 @@ func TestSqliteMigrations(t *testing.T) {
 	defer db.Close()
 
 	cfg := gostgrator.Config{
-		Driver:           "sqlite3",
-		MigrationPattern: "testdata/migrations/*",
-		SchemaTable:      "versions",
+		Driver:            "sqlite3",
+		MigrationPattern:  "testdata/migrations/*",
+		SchemaTable:       "versions",
 		ValidateChecksums: true,
 	}
 
@@ -288,7 +303,7 @@ func TestSqliteMigrations(t *testing.T) {
 		t.Fatalf("failed to create sqlite gostgrator: %v", err)
 	}
 	defer func() {
-		_, _ = g.QueryContext(ctx, "DROP TABLE IF EXISTS versions")
+		_, _ = g.ExecContext(ctx, "DROP TABLE IF EXISTS versions")
 		db.Close()
 	}()
 
@@ -300,6 +315,11 @@ func TestSqliteMigrations(t *testing.T) {
 		if len(migs) != 3 {
 			t.Fatalf("expected 3 migrations, got %d", len(migs))
 		}
+		for _, m := range migs {
+			if m.Duration <= 0 {
+				t.Errorf("expected version %d to report how long it ran, got %s", m.Version, m.Duration)
+			}
+		}
 	})
 
 	t.Run("Database Version", func(t *testing.T) {
@@ -326,3 +346,1794 @@ func TestSqliteMigrations(t *testing.T) {
 		}
 	})
 }
+
+func TestSqliteBatchSeparator(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "batch.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+
+	cfg := gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: "testdata/batchMigrations/*",
+		SchemaTable:      "versions",
+	}
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("sqlite migrate with GO separators failed: %v", err)
+	}
+	var name string
+	if err := db.QueryRowContext(ctx, "SELECT name FROM batch_widgets").Scan(&name); err != nil {
+		t.Fatalf("failed to query batch_widgets: %v", err)
+	}
+	if name != "sprocket" {
+		t.Fatalf("expected sprocket, got %s", name)
+	}
+
+	if _, err := g.Migrate(ctx, "0"); err != nil {
+		t.Fatalf("sqlite migrate down with GO separators failed: %v", err)
+	}
+}
+
+func TestSqliteStreamThreshold(t *testing.T) {
+	ctx := context.Background()
+	for _, pattern := range []string{"testdata/migrations/*", "testdata/batchMigrations/*"} {
+		for _, recordProgress := range []bool{false, true} {
+			db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "stream.db"))
+			if err != nil {
+				t.Fatalf("failed to open sqlite3 db: %v", err)
+			}
+			defer db.Close()
+
+			cfg := gostgrator.Config{
+				Driver:           "sqlite3",
+				MigrationPattern: pattern,
+				SchemaTable:      "versions",
+				StreamThreshold:  1,
+				RecordProgress:   recordProgress,
+			}
+			g, err := gostgrator.NewGostgrator(cfg, db)
+			if err != nil {
+				t.Fatalf("failed to create sqlite gostgrator: %v", err)
+			}
+			if _, err := g.Migrate(ctx, "max"); err != nil {
+				t.Fatalf("streamed migrate of %s failed: %v", pattern, err)
+			}
+			max, err := g.GetMaxVersion()
+			if err != nil {
+				t.Fatalf("failed to get max version: %v", err)
+			}
+			if version, err := g.GetDatabaseVersion(ctx); err != nil || version != max {
+				t.Fatalf("expected version %d, got %d (%v)", max, version, err)
+			}
+			if _, err := g.Migrate(ctx, "0"); err != nil {
+				t.Fatalf("streamed migrate down of %s failed: %v", pattern, err)
+			}
+		}
+	}
+}
+
+func TestSqliteScanOnce(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(name string) {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("SELECT 1;"), 0644); err != nil {
+			t.Fatalf("failed to write migration: %v", err)
+		}
+	}
+	write("001.do.sql")
+
+	cfg := gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: filepath.Join(tmpDir, "*.sql"),
+		ScanOnce:         true,
+	}
+	g, err := gostgrator.NewGostgrator(cfg, nil)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if migs, err := g.GetMigrations(); err != nil || len(migs) != 1 {
+		t.Fatalf("expected 1 migration, got %d (%v)", len(migs), err)
+	}
+	write("002.do.sql")
+	if migs, err := g.GetMigrations(); err != nil || len(migs) != 1 {
+		t.Fatalf("expected the first scan to be reused, got %d migrations (%v)", len(migs), err)
+	}
+}
+
+func TestSqliteRecordProgress(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(tmpDir, "progress.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+
+	doFile := filepath.Join(tmpDir, "001.do.sql")
+	broken := "CREATE TABLE first (id INTEGER);\nCREATE TABLE second (id INTEGER);\nINSERT INTO missing VALUES (1);\n"
+	if err := os.WriteFile(doFile, []byte(broken), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+
+	cfg := gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: filepath.Join(tmpDir, "*.sql"),
+		SchemaTable:      "versions",
+		RecordProgress:   true,
+	}
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+
+	if _, err := g.Migrate(ctx, "max"); err == nil || !strings.Contains(err.Error(), "statement 3") {
+		t.Fatalf("expected statement 3 to fail, got %v", err)
+	}
+	var recorded int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM versions_progress").Scan(&recorded); err != nil {
+		t.Fatalf("failed to query progress: %v", err)
+	}
+	if recorded != 2 {
+		t.Fatalf("expected 2 recorded statements, got %d", recorded)
+	}
+
+	fixed := "CREATE TABLE first (id INTEGER);\nCREATE TABLE second (id INTEGER);\nINSERT INTO first VALUES (1);\n"
+	if err := os.WriteFile(doFile, []byte(fixed), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	applied, err := g.Migrate(ctx, "max")
+	if err != nil {
+		t.Fatalf("expected resumed migration to succeed, got %v", err)
+	}
+	if len(applied) != 1 {
+		t.Fatalf("expected 1 applied migration, got %d", len(applied))
+	}
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM versions_progress").Scan(&recorded); err != nil {
+		t.Fatalf("failed to query progress: %v", err)
+	}
+	if recorded != 0 {
+		t.Fatalf("expected progress to be cleared, got %d rows", recorded)
+	}
+}
+
+func TestSqliteDependencies(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(tmpDir, "deps.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+
+	files := map[string]string{
+		"001.do.sql": "CREATE TABLE users (id INTEGER);\n",
+		"002.do.sql": "-- gostgrator: depends-on=001\nCREATE TABLE orders (user_id INTEGER);\n",
+		"003.do.sql": "-- gostgrator: depends-on=004\nCREATE TABLE carts (id INTEGER);\n",
+		"004.do.sql": "CREATE TABLE items (id INTEGER);\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write migration: %v", err)
+		}
+	}
+
+	cfg := gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: filepath.Join(tmpDir, "*.sql"),
+		SchemaTable:      "versions",
+	}
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+
+	t.Run("Satisfied Dependency", func(t *testing.T) {
+		if _, err := g.Migrate(ctx, "2"); err != nil {
+			t.Fatalf("expected migrate to 2 to succeed, got %v", err)
+		}
+	})
+
+	t.Run("Unapplied Dependency", func(t *testing.T) {
+		_, err := g.Migrate(ctx, "3")
+		if err == nil || !strings.Contains(err.Error(), "depends on unapplied migration [4]") {
+			t.Fatalf("expected unapplied dependency error, got %v", err)
+		}
+	})
+
+	t.Run("Missing Dependency", func(t *testing.T) {
+		content := "-- gostgrator: depends-on=001, 009\nCREATE TABLE carts (id INTEGER);\n"
+		if err := os.WriteFile(filepath.Join(tmpDir, "003.do.sql"), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write migration: %v", err)
+		}
+		_, err := g.Migrate(ctx, "max")
+		if err == nil || !strings.Contains(err.Error(), "depends on missing migration [9]") {
+			t.Fatalf("expected missing dependency error, got %v", err)
+		}
+		ver, err := g.GetDatabaseVersion(ctx)
+		if err != nil {
+			t.Fatalf("GetDatabaseVersion failed: %v", err)
+		}
+		if ver != 2 {
+			t.Fatalf("expected nothing to run after a dependency error, got version %d", ver)
+		}
+	})
+}
+
+func TestSqliteSchemaTableLifecycle(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "lifecycle.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+
+	cfg := gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: "testdata/migrations/*",
+		SchemaTable:      "versions",
+	}
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+
+	tableCount := func(names ...string) int {
+		if len(names) == 0 {
+			names = []string{"versions"}
+		}
+		var cnt int
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name IN ('"+strings.Join(names, "', '")+"')").Scan(&cnt); err != nil {
+			t.Fatalf("failed to query sqlite_master: %v", err)
+		}
+		return cnt
+	}
+
+	if err := g.EnsureSchemaTable(ctx); err != nil {
+		t.Fatalf("EnsureSchemaTable failed: %v", err)
+	}
+	if err := g.EnsureSchemaTable(ctx); err != nil {
+		t.Fatalf("EnsureSchemaTable should be idempotent, got: %v", err)
+	}
+	if tableCount() != 1 {
+		t.Fatal("expected versions table to exist after EnsureSchemaTable")
+	}
+
+	if err := g.DropSchemaTable(ctx); err != nil {
+		t.Fatalf("DropSchemaTable failed: %v", err)
+	}
+	if tableCount() != 0 {
+		t.Fatal("expected versions table to be dropped")
+	}
+
+	if err := g.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if err := g.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if err := g.EnsureSchemaTable(ctx); err != nil {
+		t.Fatalf("EnsureSchemaTable failed: %v", err)
+	}
+	if err := g.DropSchemaTableWithOptions(ctx, gostgrator.DropOptions{OnlyCore: true}); err != nil {
+		t.Fatalf("DropSchemaTableWithOptions failed: %v", err)
+	}
+	if tableCount() != 0 || tableCount("versions_lock") != 1 {
+		t.Fatal("expected OnlyCore to keep the lock table")
+	}
+	if err := g.DropSchemaTableWithOptions(ctx, gostgrator.DropOptions{IfExists: true}); err != nil {
+		t.Fatalf("DropSchemaTableWithOptions failed: %v", err)
+	}
+	if tableCount("versions_lock") != 0 {
+		t.Fatal("expected the lock table to be dropped with the schema table")
+	}
+	ver, err := g.GetDatabaseVersion(ctx)
+	if err != nil {
+		t.Fatalf("GetDatabaseVersion failed: %v", err)
+	}
+	if ver != 0 {
+		t.Fatalf("expected version 0 after drop, got %d", ver)
+	}
+}
+
+// TestSqliteDatabaseVersionSparse checks that the database version is the
+// highest recorded version when rows were deleted by hand or applied out of
+// order, and 0 when the table is empty.
+func TestSqliteDatabaseVersionSparse(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "sparse.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+
+	cfg := gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: "testdata/migrations/*",
+		SchemaTable:      "versions",
+	}
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if err := g.EnsureSchemaTable(ctx); err != nil {
+		t.Fatalf("EnsureSchemaTable failed: %v", err)
+	}
+
+	cases := []struct {
+		sql  string
+		want int
+	}{
+		{"DELETE FROM versions;", 0},
+		{"INSERT INTO versions (version) VALUES (3), (1);", 3},
+		{"DELETE FROM versions WHERE version = 3;", 1},
+		{"INSERT INTO versions (version) VALUES (0);", 1},
+		{"DELETE FROM versions WHERE version > 0;", 0},
+	}
+	for _, c := range cases {
+		if _, err := db.ExecContext(ctx, c.sql); err != nil {
+			t.Fatalf("%s: %v", c.sql, err)
+		}
+		version, err := g.GetDatabaseVersion(ctx)
+		if err != nil {
+			t.Fatalf("%s: GetDatabaseVersion failed: %v", c.sql, err)
+		}
+		if version != c.want {
+			t.Errorf("after %s expected version %d, got %d", c.sql, c.want, version)
+		}
+	}
+}
+
+// TestSqliteAuditHistory checks that in audit mode undo marks rows undone
+// instead of deleting them, that the version ignores them, and that every do
+// and undo is appended to the history table.
+func TestSqliteAuditHistory(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+
+	cfg := gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: "testdata/migrations/*",
+		SchemaTable:      "versions",
+		AuditHistory:     true,
+	}
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+
+	if _, err := g.Migrate(ctx, "003"); err != nil {
+		t.Fatalf("migrate to 003 failed: %v", err)
+	}
+	if _, err := g.Down(ctx, 2); err != nil {
+		t.Fatalf("down failed: %v", err)
+	}
+	version, err := g.GetDatabaseVersion(ctx)
+	if err != nil || version != 1 {
+		t.Fatalf("expected version 1 after down, got %d (%v)", version, err)
+	}
+	applied, err := g.GetAppliedMigrations(ctx)
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("expected 1 applied migration, got %d (%v)", len(applied), err)
+	}
+	var undone int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM versions WHERE undone_at IS NOT NULL").Scan(&undone); err != nil {
+		t.Fatalf("failed to count undone rows: %v", err)
+	}
+	if undone != 2 {
+		t.Errorf("expected 2 rows marked undone, got %d", undone)
+	}
+
+	// Reapplying an undone version replaces its row.
+	if _, err := g.Migrate(ctx, "002"); err != nil {
+		t.Fatalf("migrate to 002 failed: %v", err)
+	}
+	if version, err := g.GetDatabaseVersion(ctx); err != nil || version != 2 {
+		t.Fatalf("expected version 2 after reapplying, got %d (%v)", version, err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version, action FROM versions_history ORDER BY id")
+	if err != nil {
+		t.Fatalf("failed to read history: %v", err)
+	}
+	defer rows.Close()
+	var events []string
+	for rows.Next() {
+		var v int
+		var action string
+		if err := rows.Scan(&v, &action); err != nil {
+			t.Fatalf("failed to scan history: %v", err)
+		}
+		events = append(events, fmt.Sprintf("%d.%s", v, action))
+	}
+	want := "1.do 2.do 3.do 3.undo 2.undo 2.do"
+	if got := strings.Join(events, " "); got != want {
+		t.Errorf("expected history %q, got %q", want, got)
+	}
+}
+
+// TestSqliteMigrationLock checks that a second instance cannot migrate while
+// the lock is held, and that Migrate releases the lock it took even when it
+// fails.
+func TestSqliteMigrationLock(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "lock.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+
+	cfg := gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: "testdata/migrations/*",
+		SchemaTable:      "versions",
+	}
+	first, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	second, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+
+	if err := first.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if _, err := second.Migrate(ctx, "max"); !errors.Is(err, gostgrator.ErrLocked) {
+		t.Fatalf("expected ErrLocked while the lock is held, got %v", err)
+	}
+	if _, err := first.Migrate(ctx, "002"); err != nil {
+		t.Fatalf("migrate while holding the lock failed: %v", err)
+	}
+	if err := first.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+
+	if _, err := second.Migrate(ctx, "bogus"); err == nil {
+		t.Fatal("expected an invalid target to fail")
+	}
+	if _, err := first.Down(ctx, 1); err != nil {
+		t.Fatalf("down after a failed migrate failed: %v", err)
+	}
+
+	if err := first.Lock(ctx); err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	if err := second.ForceUnlock(ctx); err != nil {
+		t.Fatalf("ForceUnlock failed: %v", err)
+	}
+	if _, err := second.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate after ForceUnlock failed: %v", err)
+	}
+}
+
+// TestSqliteBackup checks that destructive operations back up the database
+// first, that additive migrations do not, and that old backups are pruned.
+func TestSqliteBackup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "app.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+
+	backupDir := filepath.Join(dir, "backups")
+	cfg := gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: "testdata/migrations/*",
+		SchemaTable:      "versions",
+		SQLiteBackupDir:  backupDir,
+		SQLiteBackupKeep: 2,
+	}
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	backups := func() []string {
+		t.Helper()
+		matches, err := filepath.Glob(filepath.Join(backupDir, "app-*.bak"))
+		if err != nil {
+			t.Fatalf("failed to list backups: %v", err)
+		}
+		return matches
+	}
+
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if n := len(backups()); n != 0 {
+		t.Fatalf("expected no backup before additive migrations, got %d", n)
+	}
+
+	if _, err := g.Down(ctx, 1); err != nil {
+		t.Fatalf("down failed: %v", err)
+	}
+	first := backups()
+	if len(first) != 1 || !strings.HasSuffix(first[0], "-down.bak") {
+		t.Fatalf("expected one down backup, got %v", first)
+	}
+	backup, err := sql.Open("sqlite3", first[0])
+	if err != nil {
+		t.Fatalf("failed to open backup: %v", err)
+	}
+	defer backup.Close()
+	var version int
+	if err := backup.QueryRowContext(ctx, "SELECT MAX(version) FROM versions").Scan(&version); err != nil || version != 6 {
+		t.Errorf("expected the backup to be at version 6, got %d (%v)", version, err)
+	}
+
+	for range 2 {
+		time.Sleep(2 * time.Millisecond)
+		if _, err := g.Down(ctx, 1); err != nil {
+			t.Fatalf("down failed: %v", err)
+		}
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := g.DropSchemaTable(ctx); err != nil {
+		t.Fatalf("DropSchemaTable failed: %v", err)
+	}
+	kept := backups()
+	if len(kept) != 2 || !strings.HasSuffix(kept[1], "-drop-schema.bak") {
+		t.Errorf("expected the 2 newest backups to be kept, got %v", kept)
+	}
+}
+
+// TestSqliteRunTests checks that test migrations of applied versions run in
+// a rolled-back transaction and report failed assertions per file.
+func TestSqliteRunTests(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	files := map[string]string{
+		"001.do.items.sql":     "CREATE TABLE items (id INTEGER); INSERT INTO items VALUES (1), (2);",
+		"001.test.sql":         "INSERT INTO items VALUES (3);\nSELECT count(*) = 4 FROM items;",
+		"002.do.more.sql":      "INSERT INTO items VALUES (4);",
+		"002.do.more.test.sql": "SELECT 'ok 1 - has rows';\nSELECT count(*) = 5 FROM items;",
+		"003.do.pending.sql":   "INSERT INTO items VALUES (5);",
+		"003.test.pending.sql": "SELECT 0;",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "tests.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: filepath.Join(dir, "*.sql"),
+	}, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "2"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+
+	results, err := g.RunTests(ctx)
+	if err != nil {
+		t.Fatalf("RunTests failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected tests for the 2 applied versions, got %d", len(results))
+	}
+	if results[0].Err != nil {
+		t.Errorf("expected %s to pass, got %v", results[0].Migration.Filename, results[0].Err)
+	}
+	if err := results[1].Err; err == nil || !strings.Contains(err.Error(), "returned 0") {
+		t.Errorf("expected %s to fail its assertion, got %v", results[1].Migration.Filename, err)
+	}
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM items").Scan(&n); err != nil || n != 3 {
+		t.Errorf("expected the test writes to be rolled back leaving 3 rows, got %d (%v)", n, err)
+	}
+}
+
+// TestSqliteResetAndDownAll checks that Reset rolls everything back before
+// migrating to the latest version and that DownAll leaves version 0.
+func TestSqliteResetAndDownAll(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "reset.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: "testdata/migrations/*",
+	}, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "003"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+
+	ran, err := g.Reset(ctx)
+	if err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	var actions []string
+	for _, m := range ran {
+		actions = append(actions, fmt.Sprintf("%d.%s", m.Version, m.Action))
+	}
+	want := "3.undo 2.undo 1.undo 1.do 2.do 3.do 4.do 5.do 6.do"
+	if got := strings.Join(actions, " "); got != want {
+		t.Errorf("expected Reset to run %q, got %q", want, got)
+	}
+	if version, err := g.GetDatabaseVersion(ctx); err != nil || version != 6 {
+		t.Errorf("expected version 6 after Reset, got %d (%v)", version, err)
+	}
+
+	undone, err := g.DownAll(ctx)
+	if err != nil || len(undone) != 6 {
+		t.Fatalf("expected DownAll to roll back 6 migrations, got %d (%v)", len(undone), err)
+	}
+	if version, err := g.GetDatabaseVersion(ctx); err != nil || version != 0 {
+		t.Errorf("expected version 0 after DownAll, got %d (%v)", version, err)
+	}
+}
+
+// TestSqliteGolangMigrateInterop verifies that golang-migrate's file layout
+// is read next to gostgrator's, that the version in its schema_migrations
+// table counts as applied, and that it is never rolled back or run dirty.
+func TestSqliteGolangMigrateInterop(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"1_users.up.sql":   "CREATE TABLE users (id INTEGER);",
+		"1_users.down.sql": "DROP TABLE users;",
+		"2_posts.up.sql":   "CREATE TABLE posts (id INTEGER);",
+		"2_posts.down.sql": "DROP TABLE posts;",
+		"003.do.tags.sql":  "CREATE TABLE tags (id INTEGER);",
+		"003.undo.sql":     "DROP TABLE tags;",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "interop.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	// The state golang-migrate leaves after applying versions 1 and 2.
+	if _, err := db.Exec(`CREATE TABLE users (id INTEGER); CREATE TABLE posts (id INTEGER);
+		CREATE TABLE schema_migrations (version uint64, dirty bool); INSERT INTO schema_migrations VALUES (2, 0);`); err != nil {
+		t.Fatalf("failed to set up golang-migrate state: %v", err)
+	}
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{
+		Driver:             "sqlite3",
+		MigrationPattern:   filepath.Join(dir, "*.sql"),
+		MigrationFormat:    "golang-migrate",
+		GolangMigrateTable: "schema_migrations",
+	}, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	migs, err := g.GetMigrations()
+	if err != nil || len(migs) != 6 {
+		t.Fatalf("expected 6 migrations, got %d (%v)", len(migs), err)
+	}
+
+	applied, err := g.Migrate(ctx, "max")
+	if err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if len(applied) != 1 || applied[0].Version != 3 {
+		t.Fatalf("expected only version 3 to run, got %+v", applied)
+	}
+	if _, err := g.Down(ctx, 2); err == nil || !strings.Contains(err.Error(), "cannot roll back below version 2") {
+		t.Errorf("expected rolling back below golang-migrate's version to be refused, got %v", err)
+	}
+	if _, err := g.Down(ctx, 1); err != nil {
+		t.Fatalf("down failed: %v", err)
+	}
+	if version, err := g.GetDatabaseVersion(ctx); err != nil || version != 2 {
+		t.Errorf("expected version 2 from golang-migrate's table, got %d (%v)", version, err)
+	}
+
+	if _, err := db.Exec("UPDATE schema_migrations SET dirty = 1;"); err != nil {
+		t.Fatalf("failed to mark dirty: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err == nil || !strings.Contains(err.Error(), "is dirty at version 2") {
+		t.Errorf("expected a dirty golang-migrate table to be refused, got %v", err)
+	}
+}
+
+// TestRegisterClient verifies that a registered Client is used for its
+// driver name and that names cannot be registered twice.
+func TestRegisterClient(t *testing.T) {
+	// Registrations are global, so each run of the test uses a new name.
+	name := fmt.Sprintf("wrapped-sqlite3-%d", time.Now().UnixNano())
+	var built bool
+	gostgrator.RegisterClient(name, func(cfg gostgrator.Config, db *sql.DB) gostgrator.Client {
+		built = true
+		cfg.Driver = "sqlite3"
+		return gostgrator.NewSqlite3Client(cfg, db)
+	})
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "registered.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{
+		Driver:           name,
+		MigrationPattern: "testdata/migrations/*",
+	}, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(context.Background(), "max"); err != nil || !built {
+		t.Fatalf("expected the registered client to migrate, built %v: %v", built, err)
+	}
+
+	if _, err := gostgrator.NewClient(gostgrator.Config{Driver: "mysql"}, db); err == nil || !strings.Contains(err.Error(), "pg, sqlite3, ") || !strings.Contains(err.Error(), name) {
+		t.Errorf("expected an error listing the drivers, got %v", err)
+	}
+	for _, taken := range []string{name, "pg"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected registering %s again to panic", taken)
+				}
+			}()
+			gostgrator.RegisterClient(taken, gostgrator.NewSqlite3Client)
+		}()
+	}
+}
+
+// TestNoDatabase verifies that a Gostgrator created without a database
+// reads migration files, and that methods needing the database fail with
+// ErrNoDatabase instead of panicking, for every built-in driver.
+func TestNoDatabase(t *testing.T) {
+	ctx := context.Background()
+	for _, driver := range []string{"pg", "sqlite3"} {
+		g, err := gostgrator.NewGostgrator(gostgrator.Config{
+			Driver:           driver,
+			MigrationPattern: "testdata/migrations/*",
+		}, nil)
+		if err != nil {
+			t.Fatalf("%s: failed to create gostgrator: %v", driver, err)
+		}
+		if migs, err := g.GetMigrations(); err != nil || len(migs) == 0 {
+			t.Errorf("%s: expected migrations to load without a database, got %d: %v", driver, len(migs), err)
+		}
+		if _, err := g.GetDatabaseVersion(ctx); !errors.Is(err, gostgrator.ErrNoDatabase) {
+			t.Errorf("%s: expected GetDatabaseVersion to fail with ErrNoDatabase, got %v", driver, err)
+		}
+		if _, err := g.Migrate(ctx, "max"); !errors.Is(err, gostgrator.ErrNoDatabase) {
+			t.Errorf("%s: expected Migrate to fail with ErrNoDatabase, got %v", driver, err)
+		}
+		g, err = gostgrator.NewGostgrator(gostgrator.Config{
+			Driver:           driver,
+			MigrationPattern: "testdata/migrations/*",
+			Transaction:      "all",
+		}, nil)
+		if err != nil {
+			t.Fatalf("%s: failed to create gostgrator: %v", driver, err)
+		}
+		if _, err := g.Migrate(ctx, "max"); !errors.Is(err, gostgrator.ErrNoDatabase) {
+			t.Errorf("%s: expected Migrate in a transaction to fail with ErrNoDatabase, got %v", driver, err)
+		}
+	}
+}
+
+// TestSqliteSkippedMigrations verifies that a migration numbered below the
+// current version after a switch to timestamps is reported as skipped, and
+// that SortApplied orders applied migrations by when they ran.
+func TestSqliteSkippedMigrations(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	write("001.do.users.sql", "CREATE TABLE users (id INTEGER);")
+	write("001.undo.users.sql", "DROP TABLE users;")
+	write("20240101000000.do.posts.sql", "CREATE TABLE posts (id INTEGER);")
+	write("20240101000000.undo.posts.sql", "DROP TABLE posts;")
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "skipped.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: filepath.Join(dir, "*.sql"),
+	}, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if skipped, err := g.GetSkippedMigrations(ctx); err != nil || len(skipped) != 0 {
+		t.Fatalf("expected no skipped migrations, got %+v (%v)", skipped, err)
+	}
+
+	write("002.do.tags.sql", "CREATE TABLE tags (id INTEGER);")
+	write("002.undo.tags.sql", "DROP TABLE tags;")
+	skipped, err := g.GetSkippedMigrations(ctx)
+	if err != nil {
+		t.Fatalf("GetSkippedMigrations failed: %v", err)
+	}
+	if len(skipped) != 1 || skipped[0].Version != 2 || skipped[0].Action != "do" {
+		t.Fatalf("expected version 2 to be reported as skipped, got %+v", skipped)
+	}
+	if applied, err := g.Migrate(ctx, "max"); err != nil || len(applied) != 0 {
+		t.Errorf("expected migrate to run nothing, got %+v (%v)", applied, err)
+	}
+
+	// Make version 1 look like it ran after the timestamp version.
+	if _, err := db.Exec("UPDATE schemaversion SET run_at = '2030-01-01 00:00:00' WHERE version = 1;"); err != nil {
+		t.Fatalf("failed to update run_at: %v", err)
+	}
+	applied, err := g.GetAppliedMigrations(ctx)
+	if err != nil {
+		t.Fatalf("GetAppliedMigrations failed: %v", err)
+	}
+	if err := gostgrator.SortApplied(applied, gostgrator.OrderRunAt); err != nil {
+		t.Fatalf("SortApplied failed: %v", err)
+	}
+	if len(applied) != 2 || applied[0].Version != 20240101000000 || applied[1].Version != 1 {
+		t.Errorf("expected run_at order [20240101000000 1], got %+v", applied)
+	}
+	if err := gostgrator.SortApplied(applied, gostgrator.OrderVersion); err != nil || applied[0].Version != 1 {
+		t.Errorf("expected version order to put version 1 first, got %+v (%v)", applied, err)
+	}
+	if err := gostgrator.SortApplied(applied, "name"); err == nil {
+		t.Error("expected an unknown order to be rejected")
+	}
+}
+
+// TestSqliteCaptureEnv verifies that Config.CaptureEnv adds a metadata column
+// to an existing schema table and records the listed variables with each
+// applied migration.
+func TestSqliteCaptureEnv(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"001.do.users.sql": "CREATE TABLE users (id INTEGER);",
+		"002.do.posts.sql": "CREATE TABLE posts (id INTEGER);",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "capture.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	cfg := gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: filepath.Join(dir, "*.sql"),
+	}
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "1"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+
+	t.Setenv("GOSTGRATOR_TEST_SHA", "abc123")
+	cfg.CaptureEnv = []string{"GOSTGRATOR_TEST_SHA", "GOSTGRATOR_TEST_UNSET"}
+	g, err = gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	applied, err := g.GetAppliedMigrations(ctx)
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("expected 2 applied migrations, got %+v (%v)", applied, err)
+	}
+	if applied[0].Metadata != nil {
+		t.Errorf("expected no metadata for a migration applied before capturing, got %v", applied[0].Metadata)
+	}
+	metadata := applied[1].Metadata
+	if metadata["GOSTGRATOR_TEST_SHA"] != "abc123" || metadata["hostname"] == "" {
+		t.Errorf("expected the variable and hostname to be recorded, got %v", metadata)
+	}
+	if _, ok := metadata["GOSTGRATOR_TEST_UNSET"]; ok {
+		t.Errorf("expected an unset variable to be left out, got %v", metadata)
+	}
+}
+
+// TestSqliteFreeze verifies that Migrate, Down and Reset fail with ErrFrozen
+// while migrations are frozen and run again after Unfreeze.
+func TestSqliteFreeze(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"001.do.users.sql":   "CREATE TABLE users (id INTEGER);",
+		"001.undo.users.sql": "DROP TABLE users;",
+		"002.do.posts.sql":   "CREATE TABLE posts (id INTEGER);",
+		"002.undo.posts.sql": "DROP TABLE posts;",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "freeze.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: filepath.Join(dir, "*.sql"),
+	}, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, _, frozen, err := g.FreezeStatus(ctx); err != nil || frozen {
+		t.Fatalf("expected a new database not to be frozen, got %v (%v)", frozen, err)
+	}
+	if _, err := g.Migrate(ctx, "1"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if err := g.Freeze(ctx, "incident 42"); err != nil {
+		t.Fatalf("Freeze failed: %v", err)
+	}
+	if reason, _, frozen, err := g.FreezeStatus(ctx); err != nil || !frozen || reason != "incident 42" {
+		t.Fatalf("expected a freeze for incident 42, got %q %v (%v)", reason, frozen, err)
+	}
+	if _, err := g.Migrate(ctx, "max"); !errors.Is(err, gostgrator.ErrFrozen) || !strings.Contains(err.Error(), "incident 42") {
+		t.Errorf("expected migrate to fail with ErrFrozen and the reason, got %v", err)
+	}
+	if _, err := g.Down(ctx, 1); !errors.Is(err, gostgrator.ErrFrozen) {
+		t.Errorf("expected down to fail with ErrFrozen, got %v", err)
+	}
+	if _, err := g.Reset(ctx); !errors.Is(err, gostgrator.ErrFrozen) {
+		t.Errorf("expected reset to fail with ErrFrozen, got %v", err)
+	}
+	if version, err := g.GetDatabaseVersion(ctx); err != nil || version != 1 {
+		t.Errorf("expected the frozen database to stay at version 1, got %d (%v)", version, err)
+	}
+
+	if err := g.Unfreeze(ctx); err != nil {
+		t.Fatalf("Unfreeze failed: %v", err)
+	}
+	if applied, err := g.Migrate(ctx, "max"); err != nil || len(applied) != 1 {
+		t.Errorf("expected migrate to run after unfreezing, got %+v (%v)", applied, err)
+	}
+}
+
+// TestSqliteDescribeSchema verifies that DescribeSchema lists tables with
+// their columns and indexes, leaving out gostgrator's own tables.
+func TestSqliteDescribeSchema(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	script := `CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL, status TEXT DEFAULT 'new');
+CREATE UNIQUE INDEX users_email ON users (email);
+CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users (id));
+CREATE INDEX posts_user ON posts (user_id, id);`
+	if err := os.WriteFile(filepath.Join(dir, "001.do.sql"), []byte(script), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "describe.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: filepath.Join(dir, "*.sql"),
+	}, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	schema, err := g.DescribeSchema(ctx)
+	if err != nil {
+		t.Fatalf("DescribeSchema failed: %v", err)
+	}
+	if len(schema.Tables) != 2 || schema.Tables[0].Name != "posts" || schema.Tables[1].Name != "users" {
+		t.Fatalf("expected tables posts and users, got %+v", schema.Tables)
+	}
+	users := schema.Tables[1]
+	want := []gostgrator.ColumnInfo{
+		{Name: "id", Type: "INTEGER"},
+		{Name: "email", Type: "TEXT"},
+		{Name: "status", Type: "TEXT", Nullable: true, Default: "'new'"},
+	}
+	if !reflect.DeepEqual(users.Columns, want) {
+		t.Errorf("expected users columns %+v, got %+v", want, users.Columns)
+	}
+	wantIndexes := []gostgrator.IndexInfo{{Name: "users_email", Columns: []string{"email"}, Unique: true}}
+	if !reflect.DeepEqual(users.Indexes, wantIndexes) {
+		t.Errorf("expected users indexes %+v, got %+v", wantIndexes, users.Indexes)
+	}
+	if got := schema.Tables[0].Indexes; len(got) != 1 || strings.Join(got[0].Columns, ",") != "user_id,id" {
+		t.Errorf("expected the posts_user index on user_id, id, got %+v", got)
+	}
+	markdown := schema.Markdown()
+	for _, want := range []string{"## users", "| `status` | `TEXT` | yes | `'new'` |", "- `users_email` (email) unique"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("expected the Markdown to contain %q, got:\n%s", want, markdown)
+		}
+	}
+}
+
+// TestSqliteExplainVersion verifies that ExplainVersion returns a version's
+// files, SQL and schema table row.
+func TestSqliteExplainVersion(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"001.do.users.sql":   "-- gostgrator: separator=none\nCREATE TABLE users (id INTEGER);",
+		"001.undo.users.sql": "DROP TABLE users;",
+		"001.test.sql":       "SELECT count(*) = 0 FROM users;",
+		"002.do.posts.sql":   "CREATE TABLE posts (id INTEGER);",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "explain.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: filepath.Join(dir, "*.sql"),
+	}, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "1"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+
+	details, err := g.ExplainVersion(ctx, 1)
+	if err != nil {
+		t.Fatalf("ExplainVersion failed: %v", err)
+	}
+	var actions []string
+	for _, m := range details.Migrations {
+		actions = append(actions, m.Action)
+	}
+	if strings.Join(actions, ",") != "do,undo,test" || details.DatabaseVersion != 1 {
+		t.Fatalf("expected do, undo and test files at database version 1, got %v at %d", actions, details.DatabaseVersion)
+	}
+	do := details.Migrations[0]
+	if details.Applied == nil || details.Applied.Md5 != do.Md5 || details.Applied.RunAt.IsZero() {
+		t.Errorf("expected the applied row with the do file's checksum, got %+v", details.Applied)
+	}
+	if !strings.Contains(details.SQL[do.Filename], "CREATE TABLE users") || do.Directives["separator"] != "none" {
+		t.Errorf("expected the do file's SQL and directives, got %q %v", details.SQL[do.Filename], do.Directives)
+	}
+
+	if details, err := g.ExplainVersion(ctx, 2); err != nil || details.Applied != nil || len(details.Migrations) != 1 {
+		t.Errorf("expected pending version 2 with one file, got %+v (%v)", details, err)
+	}
+	if _, err := g.ExplainVersion(ctx, 3); err == nil {
+		t.Error("expected an unknown version to be an error")
+	}
+}
+
+// TestSqliteSourceMigrations verifies that migrations supplied in memory run
+// and are checksummed like migration files.
+func TestSqliteSourceMigrations(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "sources.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	cfg := gostgrator.Config{
+		Driver: "sqlite3",
+		Sources: []gostgrator.SourceMigration{
+			{Version: 1, Name: "accounts", UpSQL: "CREATE TABLE accounts (id INTEGER);", DownSQL: "DROP TABLE accounts;"},
+			{Version: 2, UpSQL: "-- gostgrator: transaction=none\nCREATE TABLE notes (id INTEGER);"},
+		},
+	}
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	ran, err := g.Migrate(ctx, "max")
+	if err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if len(ran) != 2 || ran[0].Filename != "1.do.accounts.sql" || ran[1].Filename != "2.do.sql" || ran[1].Directives["transaction"] != "none" {
+		t.Fatalf("unexpected migrations ran: %+v", ran)
+	}
+	if err := g.ValidateMigrations(ctx, 2); err != nil {
+		t.Fatalf("expected inline migrations to validate: %v", err)
+	}
+
+	cfg.Sources[0].UpSQL = "CREATE TABLE accounts (id INTEGER, name TEXT);"
+	if g, err = gostgrator.NewGostgrator(cfg, db); err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if err := g.ValidateMigrations(ctx, 2); err == nil {
+		t.Error("expected an edited inline migration to fail checksum validation")
+	}
+
+	cfg.Sources = append(cfg.Sources, gostgrator.SourceMigration{Version: 1, UpSQL: "SELECT 1;"})
+	if g, err = gostgrator.NewGostgrator(cfg, db); err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, err := g.GetMigrations(); err == nil || !strings.Contains(err.Error(), "duplicate migration") {
+		t.Errorf("expected a duplicate version to be rejected, got %v", err)
+	}
+	cfg.Sources = []gostgrator.SourceMigration{{Version: 3}}
+	if g, err = gostgrator.NewGostgrator(cfg, db); err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, err := g.GetMigrations(); err == nil {
+		t.Error("expected a source migration without UpSQL to be rejected")
+	}
+}
+
+// TestSqliteRunAtUTC verifies that run_at is stored as ISO-8601 text in UTC
+// and read back as the time the migration ran.
+func TestSqliteRunAtUTC(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "runat.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: "testdata/migrations/*",
+	}, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	start := time.Now().Truncate(time.Second)
+	if _, err := g.Migrate(ctx, "1"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	var stored string
+	if err := db.QueryRowContext(ctx, "SELECT CAST(run_at AS TEXT) FROM schemaversion WHERE version = 1;").Scan(&stored); err != nil {
+		t.Fatalf("failed to read run_at: %v", err)
+	}
+	if !regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ$`).MatchString(stored) {
+		t.Errorf("expected run_at as ISO-8601 UTC, got %q", stored)
+	}
+	applied, err := g.GetAppliedMigrations(ctx)
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("expected one applied migration, got %+v (%v)", applied, err)
+	}
+	if runAt := applied[0].RunAt; runAt.Before(start) || runAt.After(time.Now()) {
+		t.Errorf("expected run_at between %v and now, got %v", start, runAt)
+	}
+}
+
+// TestPostgresZonelessRunAt verifies that upgrading a schema table whose
+// run_at lacks a time zone converts it, keeping existing values as UTC.
+func TestPostgresZonelessRunAt(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("pgx", pgTestConn)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	defer func() {
+		_, _ = db.ExecContext(ctx, "DROP TABLE IF EXISTS zoneless_versions")
+		_ = db.Close()
+	}()
+	if _, err := db.ExecContext(ctx, `
+      CREATE TABLE zoneless_versions (version BIGINT PRIMARY KEY, name TEXT, md5 TEXT, run_at TIMESTAMP);
+      INSERT INTO zoneless_versions (version, run_at) VALUES (0, '2024-01-02 03:04:05');
+    `); err != nil {
+		t.Fatalf("failed to create zoneless schema table: %v", err)
+	}
+	cfg := pgTestConfig
+	cfg.SchemaTable = "zoneless_versions"
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if err := g.UpgradeSchemaTable(ctx); err != nil {
+		t.Fatalf("UpgradeSchemaTable failed: %v", err)
+	}
+	var dataType string
+	var runAt time.Time
+	if err := db.QueryRowContext(ctx, `
+      SELECT data_type FROM INFORMATION_SCHEMA.COLUMNS
+      WHERE table_name = 'zoneless_versions' AND column_name = 'run_at';
+    `).Scan(&dataType); err != nil {
+		t.Fatalf("failed to read the run_at type: %v", err)
+	}
+	if dataType != "timestamp with time zone" {
+		t.Errorf("expected run_at to be converted, got %s", dataType)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT run_at FROM zoneless_versions WHERE version = 0;").Scan(&runAt); err != nil {
+		t.Fatalf("failed to read run_at: %v", err)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !runAt.Equal(want) {
+		t.Errorf("expected the existing run_at to be kept as UTC %v, got %v", want, runAt)
+	}
+}
+
+// TestPostgresSearchPath verifies that an unqualified schema table is looked
+// up in the first schema on the search_path, so a table of the same name in
+// another schema is neither reused nor duplicated.
+func TestPostgresSearchPath(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("pgx", pgTestConn)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	defer func() {
+		_, _ = db.ExecContext(ctx, "DROP TABLE IF EXISTS search_path_versions; DROP TABLE IF EXISTS public.search_path_versions")
+		_ = db.Close()
+	}()
+	if _, err := db.ExecContext(ctx, "CREATE TABLE public.search_path_versions (id INTEGER);"); err != nil {
+		t.Fatalf("failed to create the decoy table: %v", err)
+	}
+	cfg := pgTestConfig
+	cfg.SchemaTable = "search_path_versions"
+	if ok, err := gostgrator.NewPostgresClient(cfg, db).HasVersionTable(ctx); err != nil || ok {
+		t.Fatalf("expected no version table on the search_path, got %v (%v)", ok, err)
+	}
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	var schemas []string
+	rows, err := db.QueryContext(ctx, "SELECT table_schema FROM INFORMATION_SCHEMA.TABLES WHERE table_name = 'search_path_versions' ORDER BY table_schema;")
+	if err != nil {
+		t.Fatalf("failed to list version tables: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			t.Fatal(err)
+		}
+		schemas = append(schemas, schema)
+	}
+	if want := []string{"gostgrator_schema", "public"}; !reflect.DeepEqual(schemas, want) {
+		t.Errorf("expected version tables in %v, got %v", want, schemas)
+	}
+	var columns int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE table_schema = 'public' AND table_name = 'search_path_versions';").Scan(&columns); err != nil {
+		t.Fatal(err)
+	}
+	if columns != 1 {
+		t.Errorf("expected the decoy table to be left alone, got %d columns", columns)
+	}
+	if _, err := g.Migrate(ctx, "0"); err != nil {
+		t.Errorf("migrate down failed: %v", err)
+	}
+}
+
+// TestPostgresLockWait verifies that a migration blocked by another session's
+// lock reports that session and its query until the lock is released.
+func TestPostgresLockWait(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("pgx", pgTestConn)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	defer func() {
+		_, _ = db.ExecContext(ctx, "DROP TABLE IF EXISTS lock_wait_target; DROP TABLE IF EXISTS lock_wait_versions; DROP TABLE IF EXISTS lock_wait_versions_lock")
+		_ = db.Close()
+	}()
+	if _, err := db.ExecContext(ctx, "CREATE TABLE lock_wait_target (id INTEGER);"); err != nil {
+		t.Fatalf("failed to create the locked table: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "001.do.note.sql"), []byte("ALTER TABLE lock_wait_target ADD COLUMN note TEXT;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	blocker, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blocker.Rollback()
+	if _, err := blocker.ExecContext(ctx, "LOCK TABLE lock_wait_target IN ACCESS SHARE MODE;"); err != nil {
+		t.Fatalf("failed to lock the table: %v", err)
+	}
+
+	waits := make(chan gostgrator.LockWait, 10)
+	cfg := pgTestConfig
+	cfg.SchemaTable = "lock_wait_versions"
+	cfg.MigrationPattern = filepath.Join(dir, "*.sql")
+	cfg.LockWaitInterval = 50 * time.Millisecond
+	cfg.OnLockWait = func(w gostgrator.LockWait) {
+		select {
+		case waits <- w:
+		default:
+		}
+	}
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.Migrate(ctx, "max")
+		done <- err
+	}()
+	select {
+	case w := <-waits:
+		if w.Migration.Version != 1 || len(w.Blockers) != 1 || w.Blockers[0].State != "idle in transaction" ||
+			!strings.Contains(w.Blockers[0].Query, "LOCK TABLE lock_wait_target") || !strings.Contains(w.String(), "version 1 (note) has waited") {
+			t.Errorf("unexpected lock wait: %+v", w)
+		}
+	case err := <-done:
+		t.Fatalf("expected the migration to wait for the lock, it returned %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected a lock wait to be reported")
+	}
+	if err := blocker.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected the migration to finish once the lock was released, got %v", err)
+	}
+}
+
+// TestSqliteReadOnlyCommands verifies that the read paths work over a
+// read-only connection, both without a schema table and with one created by an
+// older version that lacks the name, md5 and run_at columns.
+func TestSqliteReadOnlyCommands(t *testing.T) {
+	ctx := context.Background()
+	dbFile := filepath.Join(t.TempDir(), "readonly.db")
+	setup, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer setup.Close()
+	if _, err := setup.ExecContext(ctx, "CREATE TABLE unrelated (id INTEGER);"); err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+
+	check := func(wantVersion int) {
+		t.Helper()
+		db, err := sql.Open("sqlite3", "file:"+dbFile+"?mode=ro")
+		if err != nil {
+			t.Fatalf("failed to open read-only db: %v", err)
+		}
+		defer db.Close()
+		cfg := gostgrator.Config{
+			Driver:           "sqlite3",
+			MigrationPattern: "testdata/migrations/*",
+			SchemaTable:      "versions",
+		}
+		g, err := gostgrator.NewGostgrator(cfg, db)
+		if err != nil {
+			t.Fatalf("failed to create sqlite gostgrator: %v", err)
+		}
+		version, err := g.GetDatabaseVersion(ctx)
+		if err != nil || version != wantVersion {
+			t.Fatalf("expected version %d, got %d (%v)", wantVersion, version, err)
+		}
+		if err := g.ValidateMigrations(ctx, version); err != nil {
+			t.Errorf("ValidateMigrations failed: %v", err)
+		}
+		applied, err := g.GetAppliedMigrations(ctx)
+		if err != nil || len(applied) != wantVersion {
+			t.Errorf("expected %d applied migrations, got %d (%v)", wantVersion, len(applied), err)
+		}
+		if _, err := g.Plan(ctx, "max"); err != nil {
+			t.Errorf("Plan failed: %v", err)
+		}
+		if _, err := g.PlanDown(ctx, 1); err != nil {
+			t.Errorf("PlanDown failed: %v", err)
+		}
+	}
+
+	check(0)
+
+	// A schema table from before the name, md5 and run_at columns existed.
+	if _, err := setup.ExecContext(ctx, "CREATE TABLE versions (version INTEGER PRIMARY KEY); INSERT INTO versions VALUES (0), (1), (2);"); err != nil {
+		t.Fatalf("failed to create legacy schema table: %v", err)
+	}
+	check(2)
+}
+
+// TestSqliteAutoUpgradeSchemaTable verifies that disabling automatic upgrades
+// leaves an older schema table alone until UpgradeSchemaTable is called.
+func TestSqliteAutoUpgradeSchemaTable(t *testing.T) {
+	ctx := context.Background()
+	for _, auto := range []bool{true, false} {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "upgrade.db"))
+		if err != nil {
+			t.Fatalf("failed to open sqlite3 db: %v", err)
+		}
+		defer db.Close()
+		if _, err := db.ExecContext(ctx, "CREATE TABLE versions (version INTEGER PRIMARY KEY); INSERT INTO versions VALUES (0);"); err != nil {
+			t.Fatalf("failed to create legacy schema table: %v", err)
+		}
+		columnCount := func() int {
+			var n int
+			if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info('versions')").Scan(&n); err != nil {
+				t.Fatalf("failed to count columns: %v", err)
+			}
+			return n
+		}
+		indexed := func() bool {
+			var n int
+			if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_index_list('versions') WHERE name = 'versions_run_at_idx'").Scan(&n); err != nil {
+				t.Fatalf("failed to list indexes: %v", err)
+			}
+			return n == 1
+		}
+
+		cfg := gostgrator.Config{
+			Driver:                 "sqlite3",
+			MigrationPattern:       "testdata/migrations/*",
+			SchemaTable:            "versions",
+			AutoUpgradeSchemaTable: &auto,
+		}
+		g, err := gostgrator.NewGostgrator(cfg, db)
+		if err != nil {
+			t.Fatalf("failed to create sqlite gostgrator: %v", err)
+		}
+		_, err = g.Migrate(ctx, "max")
+		if auto {
+			if err != nil || columnCount() != 4 || !indexed() {
+				t.Fatalf("expected migrate to upgrade the table and index run_at, got %d columns (%v)", columnCount(), err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "missing columns name, md5, run_at") {
+			t.Fatalf("expected migrate to refuse the old table, got %v", err)
+		}
+		if columnCount() != 1 || indexed() {
+			t.Fatalf("expected the table to be left alone, got %d columns", columnCount())
+		}
+		if err := g.UpgradeSchemaTable(ctx); err != nil {
+			t.Fatalf("UpgradeSchemaTable failed: %v", err)
+		}
+		if columnCount() != 4 || !indexed() {
+			t.Fatalf("expected 4 columns and the run_at index after the upgrade, got %d columns", columnCount())
+		}
+		if _, err := g.Migrate(ctx, "max"); err != nil {
+			t.Fatalf("migrate after the upgrade failed: %v", err)
+		}
+	}
+}
+
+// TestSqlitePlanDown verifies that PlanDown reports undo files, touched tables
+// and later-applied dependents without changing the database.
+func TestSqlitePlanDown(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "plan.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+
+	cfg := gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: "testdata/migrations/*",
+	}
+	g, err := gostgrator.NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+
+	applied, err := g.GetAppliedMigrations(ctx)
+	if err != nil {
+		t.Fatalf("GetAppliedMigrations failed: %v", err)
+	}
+	if len(applied) != 6 {
+		t.Fatalf("Expected 6 applied migrations, got %d", len(applied))
+	}
+	for _, a := range applied {
+		if a.RunAt.IsZero() || a.Md5 == "" {
+			t.Errorf("Expected run_at and md5 to be recorded for version %d, got %+v", a.Version, a)
+		}
+	}
+
+	impacts, err := g.PlanDown(ctx, 2)
+	if err != nil {
+		t.Fatalf("PlanDown failed: %v", err)
+	}
+	if len(impacts) != 2 {
+		t.Fatalf("Expected 2 undo migrations, got %d", len(impacts))
+	}
+	if impacts[0].Migration.Version != 6 || impacts[1].Migration.Version != 5 {
+		t.Errorf("Expected undo of versions 6 then 5, got %d then %d", impacts[0].Migration.Version, impacts[1].Migration.Version)
+	}
+	for _, impact := range impacts {
+		if len(impact.Tables) != 1 || impact.Tables[0] != "person" {
+			t.Errorf("Expected version %d to touch [person], got %v", impact.Migration.Version, impact.Tables)
+		}
+	}
+	if len(impacts[0].Dependents) != 0 {
+		t.Errorf("Expected no dependents for version 6, got %v", impacts[0].Dependents)
+	}
+	if len(impacts[1].Dependents) != 1 || impacts[1].Dependents[0].Version != 6 {
+		t.Errorf("Expected version 6 as the only dependent of version 5, got %v", impacts[1].Dependents)
+	}
+
+	ver, err := g.GetDatabaseVersion(ctx)
+	if err != nil {
+		t.Fatalf("GetDatabaseVersion failed: %v", err)
+	}
+	if ver != 6 {
+		t.Errorf("Expected PlanDown to leave version 6, got %d", ver)
+	}
+}
+
+// TestSqliteEnvironmentGating verifies that migrations gated to other
+// environments are recorded without running, or skipped when configured.
+func TestSqliteEnvironmentGating(t *testing.T) {
+	ctx := context.Background()
+
+	run := func(t *testing.T, cfg gostgrator.Config) (*sql.DB, *gostgrator.Gostgrator) {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "env.db"))
+		if err != nil {
+			t.Fatalf("failed to open sqlite3 db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		cfg.Driver = "sqlite3"
+		cfg.MigrationPattern = "testdata/envMigrations/*.sql"
+		g, err := gostgrator.NewGostgrator(cfg, db)
+		if err != nil {
+			t.Fatalf("failed to create sqlite gostgrator: %v", err)
+		}
+		if _, err := g.Migrate(ctx, "max"); err != nil {
+			t.Fatalf("migration failed: %v", err)
+		}
+		return db, g
+	}
+	seedCount := func(t *testing.T, db *sql.DB) int {
+		var cnt int
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM seeds").Scan(&cnt); err != nil {
+			t.Fatalf("failed to count seeds: %v", err)
+		}
+		return cnt
+	}
+	appliedVersions := func(t *testing.T, g *gostgrator.Gostgrator) []int {
+		applied, err := g.GetAppliedMigrations(ctx)
+		if err != nil {
+			t.Fatalf("GetAppliedMigrations failed: %v", err)
+		}
+		var versions []int
+		for _, a := range applied {
+			versions = append(versions, a.Version)
+		}
+		return versions
+	}
+
+	t.Run("Listed Environment", func(t *testing.T) {
+		db, _ := run(t, gostgrator.Config{Environment: "staging"})
+		if seedCount(t, db) != 1 {
+			t.Error("expected the gated migration to run in staging")
+		}
+	})
+
+	t.Run("Other Environment Records Noop", func(t *testing.T) {
+		db, g := run(t, gostgrator.Config{Environment: "production"})
+		if seedCount(t, db) != 0 {
+			t.Error("expected the gated migration not to run in production")
+		}
+		if got := appliedVersions(t, g); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+			t.Errorf("expected versions [1 2 3] to be recorded, got %v", got)
+		}
+		if _, err := g.Migrate(ctx, "1"); err != nil {
+			t.Fatalf("rollback failed: %v", err)
+		}
+		if got := appliedVersions(t, g); !reflect.DeepEqual(got, []int{1}) {
+			t.Errorf("expected only version 1 after rollback, got %v", got)
+		}
+	})
+
+	t.Run("Other Environment Skipped", func(t *testing.T) {
+		db, g := run(t, gostgrator.Config{SkipGatedMigrations: true})
+		if seedCount(t, db) != 0 {
+			t.Error("expected the gated migration not to run without an environment")
+		}
+		if got := appliedVersions(t, g); !reflect.DeepEqual(got, []int{1, 3}) {
+			t.Errorf("expected versions [1 3] to be recorded, got %v", got)
+		}
+	})
+}
+
+// TestSqlitePartialApplyError verifies that a failed run reports the
+// migrations applied before the failure and the one that failed.
+func TestSqlitePartialApplyError(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(tmpDir, "partial.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+
+	files := map[string]string{
+		"001.do.sql": "CREATE TABLE users (id INTEGER);\n",
+		"002.do.sql": "CREATE TABLE orders (id INTEGER);\n",
+		"003.do.sql": "INSERT INTO missing_table VALUES (1);\n",
+		"004.do.sql": "CREATE TABLE carts (id INTEGER);\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write migration: %v", err)
+		}
+	}
+
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: filepath.Join(tmpDir, "*.sql"),
+	}, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+
+	applied, err := g.Migrate(ctx, "max")
+	var partial *gostgrator.PartialApplyError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected a *PartialApplyError, got %T: %v", err, err)
+	}
+	if len(applied) != 2 || len(partial.Applied) != 2 || partial.Applied[1].Version != 2 {
+		t.Errorf("expected versions 1 and 2 to be reported as applied, got %v and %v", applied, partial.Applied)
+	}
+	if partial.Failed.Version != 3 {
+		t.Errorf("expected version 3 to be reported as failed, got %d", partial.Failed.Version)
+	}
+	if partial.Unwrap() == nil || !strings.Contains(err.Error(), "missing_table") || !strings.Contains(err.Error(), "003.do.sql") {
+		t.Errorf("expected the error to name the file and wrap the cause, got %v", err)
+	}
+
+	ver, err := g.GetDatabaseVersion(ctx)
+	if err != nil {
+		t.Fatalf("GetDatabaseVersion failed: %v", err)
+	}
+	if ver != 2 {
+		t.Errorf("expected database version 2 after the failure, got %d", ver)
+	}
+}
+
+// TestSqliteAutoVacuum verifies that rolling back with SQLiteAutoVacuum set
+// shrinks the database file, and that Compact rejects other drivers.
+func TestSqliteAutoVacuum(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "vacuum.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+
+	files := map[string]string{
+		"001.do.sql": `CREATE TABLE blobs (data BLOB);
+WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 2000)
+INSERT INTO blobs SELECT randomblob(1024) FROM n;
+`,
+		"001.undo.sql": "DROP TABLE blobs;\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write migration: %v", err)
+		}
+	}
+
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{
+		Driver:           "sqlite3",
+		MigrationPattern: filepath.Join(tmpDir, "*.sql"),
+		SQLiteAutoVacuum: true,
+	}, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	fileSize := func() int64 {
+		info, err := os.Stat(dbPath)
+		if err != nil {
+			t.Fatalf("failed to stat database: %v", err)
+		}
+		return info.Size()
+	}
+	before := fileSize()
+	if _, err := g.Down(ctx, 1); err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+	if after := fileSize(); after*4 > before {
+		t.Errorf("expected the database to shrink after rollback, went from %d to %d bytes", before, after)
+	}
+
+	stats, err := g.Compact(ctx)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if stats.SizeBefore <= 0 || stats.SizeAfter > stats.SizeBefore {
+		t.Errorf("unexpected compact stats: %+v", stats)
+	}
+
+	pg, err := gostgrator.NewGostgrator(gostgrator.Config{Driver: "pg"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create pg gostgrator: %v", err)
+	}
+	if _, err := pg.Compact(ctx); err == nil {
+		t.Error("expected Compact to fail for pg")
+	}
+}
+
+func TestSqliteStrictQueries(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "strict.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{Driver: "sqlite3", StrictQueries: true}, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if _, err := g.ExecContext(ctx, "CREATE TABLE widgets (id INTEGER)"); err != nil {
+		t.Fatalf("ExecContext failed: %v", err)
+	}
+	if _, err := g.QueryContext(ctx, "DROP TABLE widgets"); !errors.Is(err, gostgrator.ErrNotAQuery) {
+		t.Errorf("expected DDL through QueryContext to fail with ErrNotAQuery, got %v", err)
+	}
+	rows, err := g.QueryContext(ctx, "SELECT 1")
+	if err != nil {
+		t.Fatalf("expected a SELECT to pass, got %v", err)
+	}
+	rows.Close()
+}
+
+func TestMigrateIfCurrent(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"001.do.a.sql": "CREATE TABLE a (id INTEGER);",
+		"002.do.b.sql": "CREATE TABLE b (id INTEGER);",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "cas.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := gostgrator.NewGostgrator(gostgrator.Config{Driver: "sqlite3", MigrationPattern: filepath.Join(dir, "*.sql")}, db)
+	if err != nil {
+		t.Fatalf("failed to create sqlite gostgrator: %v", err)
+	}
+	if applied, err := g.MigrateIfCurrent(ctx, 0, "1"); err != nil || len(applied) != 1 {
+		t.Fatalf("expected 1 to be applied at version 0, got %v (%v)", applied, err)
+	}
+	applied, err := g.MigrateIfCurrent(ctx, 0, "max")
+	if !errors.Is(err, gostgrator.ErrVersionChanged) || len(applied) != 0 || !strings.Contains(err.Error(), "expected version 0, but the database is at version 1") {
+		t.Fatalf("expected a stale version to fail with ErrVersionChanged, got %v (%v)", applied, err)
+	}
+	if version, err := g.GetDatabaseVersion(ctx); err != nil || version != 1 {
+		t.Errorf("expected the database to stay at version 1, got %d (%v)", version, err)
+	}
+	if applied, err := g.MigrateIfCurrent(ctx, 1, "max"); err != nil || len(applied) != 1 || applied[0].Version != 2 {
+		t.Errorf("expected 2 to be applied at version 1, got %v (%v)", applied, err)
+	}
+}
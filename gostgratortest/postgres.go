@@ -0,0 +1,174 @@
+// Package gostgratortest provides a PostgreSQL harness for testing gostgrator
+// and new Client implementations against a real database, such as with the
+// clienttest conformance suite.
+package gostgratortest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+)
+
+// DefaultPostgresImage is the image StartPostgres runs unless
+// GOSTGRATOR_TEST_PG_IMAGE names another.
+const DefaultPostgresImage = "postgres:17-alpine"
+
+// containerLifetime is how long docker keeps a container StartPostgres
+// started before removing it, in case the test binary dies before Close.
+const containerLifetime = 10 * 60
+
+// Postgres is a PostgreSQL server for tests.
+type Postgres struct {
+	// base is the server's connection URL without a database name.
+	base *url.URL
+	// pool and container are set when StartPostgres started a container.
+	pool      *dockertest.Pool
+	container *dockertest.Resource
+}
+
+// StartPostgres returns a PostgreSQL server for tests, waiting until it
+// accepts connections. It uses the connection URL in GOSTGRATOR_TEST_PG
+// (e.g. "postgres://postgres@db:5432/?sslmode=disable") when set, and
+// otherwise starts a throwaway container through the docker API named by
+// DOCKER_HOST, or the local docker socket. It fails when neither is
+// available, so callers can skip. Close stops the container.
+func StartPostgres(ctx context.Context) (*Postgres, error) {
+	p := &Postgres{}
+	if conn := os.Getenv("GOSTGRATOR_TEST_PG"); conn != "" {
+		base, err := url.Parse(conn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GOSTGRATOR_TEST_PG: %w", err)
+		}
+		p.base = base
+	} else if err := p.startContainer(); err != nil {
+		return nil, fmt.Errorf("set GOSTGRATOR_TEST_PG or make docker available: %w", err)
+	}
+	if err := p.wait(ctx); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// startContainer runs postgres in docker on a random local port.
+func (p *Postgres) startContainer() error {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return fmt.Errorf("failed to connect to docker: %w", err)
+	}
+	if err := pool.Client.Ping(); err != nil {
+		return fmt.Errorf("failed to connect to docker: %w", err)
+	}
+	image := os.Getenv("GOSTGRATOR_TEST_PG_IMAGE")
+	if image == "" {
+		image = DefaultPostgresImage
+	}
+	repository, tag, ok := strings.Cut(image, ":")
+	if !ok {
+		tag = "latest"
+	}
+	container, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: repository,
+		Tag:        tag,
+		Env:        []string{"POSTGRES_HOST_AUTH_METHOD=trust"},
+		PortBindings: map[docker.Port][]docker.PortBinding{
+			"5432/tcp": {{HostIP: "127.0.0.1"}},
+		},
+	}, func(cfg *docker.HostConfig) {
+		cfg.AutoRemove = true
+		cfg.RestartPolicy = docker.RestartPolicy{Name: "no"}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", image, err)
+	}
+	p.pool, p.container = pool, container
+	if err := container.Expire(containerLifetime); err != nil {
+		p.Close()
+		return fmt.Errorf("failed to set the lifetime of %s: %w", image, err)
+	}
+	p.base = &url.URL{Scheme: "postgres", User: url.User("postgres"), Host: container.GetHostPort("5432/tcp"), RawQuery: "sslmode=disable"}
+	return nil
+}
+
+// wait pings the server until it accepts connections. A container gets a
+// minute to start; any other server must be up already.
+func (p *Postgres) wait(ctx context.Context) error {
+	db, err := sql.Open("pgx", p.URL("postgres"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if p.container == nil {
+		return db.PingContext(ctx)
+	}
+	p.pool.MaxWait = time.Minute
+	if err := p.pool.Retry(func() error { return db.PingContext(ctx) }); err != nil {
+		return fmt.Errorf("postgres did not accept connections: %w", err)
+	}
+	return nil
+}
+
+// URL returns the connection URL of dbname on the server. It always has a
+// query string, so parameters can be appended with "&".
+func (p *Postgres) URL(dbname string) string {
+	u := *p.base
+	u.Path = "/" + dbname
+	if u.RawQuery == "" {
+		u.RawQuery = "sslmode=disable"
+	}
+	return u.String()
+}
+
+// Close stops the container started by StartPostgres, if any.
+func (p *Postgres) Close() error {
+	if p.container == nil {
+		return nil
+	}
+	err := p.pool.Purge(p.container)
+	p.container = nil
+	return err
+}
+
+// databaseSeq numbers the databases created by NewDatabase.
+var databaseSeq atomic.Int64
+
+// NewDatabase creates an empty database on the server, returns a connection
+// to it and drops it when tb finishes.
+func (p *Postgres) NewDatabase(tb testing.TB) *sql.DB {
+	tb.Helper()
+	admin, err := sql.Open("pgx", p.URL("postgres"))
+	if err != nil {
+		tb.Fatalf("failed to connect to postgres: %v", err)
+	}
+	name := fmt.Sprintf("gostgratortest_%d_%d", os.Getpid(), databaseSeq.Add(1))
+	if _, err := admin.Exec("CREATE DATABASE " + name); err != nil {
+		admin.Close()
+		tb.Fatalf("failed to create database %s: %v", name, err)
+	}
+	db, err := sql.Open("pgx", p.URL(name))
+	if err != nil {
+		if _, err := admin.Exec("DROP DATABASE IF EXISTS " + name); err != nil {
+			tb.Logf("failed to drop database %s: %v", name, err)
+		}
+		admin.Close()
+		tb.Fatalf("failed to connect to database %s: %v", name, err)
+	}
+	tb.Cleanup(func() {
+		db.Close()
+		if _, err := admin.Exec("DROP DATABASE IF EXISTS " + name + " WITH (FORCE)"); err != nil {
+			tb.Logf("failed to drop database %s: %v", name, err)
+		}
+		admin.Close()
+	})
+	return db
+}
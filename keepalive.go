@@ -0,0 +1,98 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrConnectionLost is wrapped by the error of a migration whose database
+// connection dropped while it ran and was not recorded as applied.
+var ErrConnectionLost = errors.New("database connection lost")
+
+// startKeepalive runs a lightweight query every Config.KeepaliveInterval
+// until the returned function is called, so idle-in-transaction killers,
+// load balancers and NAT gateways see traffic during long migrations. The
+// queries run through the connection pool, on a second connection while the
+// migration's own is busy. Their errors are ignored: a dropped connection is
+// reported by the migration using it.
+func (g *Gostgrator) startKeepalive(ctx context.Context) (stop func()) {
+	if g.cfg.KeepaliveInterval <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(g.cfg.KeepaliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				g.client.ExecContext(ctx, "SELECT 1;")
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// connectionLost reports whether err means the connection a migration ran
+// on was dropped, rather than that its SQL failed or the run was canceled.
+func connectionLost(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		code := state.SQLState()
+		// Connection exceptions, server shutdowns and the
+		// idle_in_transaction_session_timeout.
+		return strings.HasPrefix(code, "08") || code == "57P01" || code == "57P02" || code == "57P03" || code == "25P03"
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &netErr)
+}
+
+// recoverLostConnection is called when m failed because its connection
+// dropped. It reconnects through the pool and reads the schema table to find
+// out whether m was recorded before the connection went. If it was, m is
+// applied and nil is returned so the run can carry on. Otherwise the error
+// wraps ErrConnectionLost and says whether m can safely be run again.
+func (g *Gostgrator) recoverLostConnection(ctx context.Context, m Migration, err error) error {
+	applied, verr := g.GetAppliedMigrations(ctx)
+	if verr != nil {
+		return fmt.Errorf("%w while running %s, and reconnecting to check the schema table failed: %v (original error: %v)", ErrConnectionLost, m.Filename, verr, err)
+	}
+	// Check the version's own row rather than the database version, which
+	// says nothing about migrations run out of order.
+	recorded := slices.ContainsFunc(applied, func(a AppliedMigration) bool { return a.Version == m.Version })
+	if (m.Action == "do" && recorded) || (m.Action == "undo" && !recorded) {
+		return nil
+	}
+	transactional, terr := m.transactional()
+	switch {
+	case terr == nil && transactional && g.cfg.Transaction == "each":
+		return fmt.Errorf("%w while running %s; reconnected and verified it was rolled back, so it is safe to run again: %v", ErrConnectionLost, m.Filename, err)
+	case g.cfg.RecordProgress:
+		return fmt.Errorf("%w while running %s; reconnected and verified it was not recorded, and running it again resumes after its last recorded statement: %v", ErrConnectionLost, m.Filename, err)
+	default:
+		return fmt.Errorf("%w while running %s; reconnected and verified it was not recorded, but it ran outside a transaction and may be partially applied, so check the schema before running it again: %v", ErrConnectionLost, m.Filename, err)
+	}
+}
@@ -0,0 +1,116 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// sqlStateError mimics a driver error carrying an SQLSTATE, such as
+// *pgconn.PgError.
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "ERROR: " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestConnectionLost(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{driver.ErrBadConn, true},
+		{fmt.Errorf("reading: %w", io.ErrUnexpectedEOF), true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, true},
+		{syscall.EPIPE, true},
+		{sqlStateError("25P03"), true},
+		{sqlStateError("57P01"), true},
+		{sqlStateError("08006"), true},
+		{sqlStateError("42P01"), false},
+		{errors.New("syntax error"), false},
+		{context.Canceled, false},
+		{fmt.Errorf("timeout: %w", context.DeadlineExceeded), false},
+	} {
+		if got := connectionLost(tt.err); got != tt.want {
+			t.Errorf("connectionLost(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// TestRecoverLostConnection verifies that a migration recorded before its
+// connection dropped counts as applied, and that one that was not is
+// reported with whether it can be run again.
+func TestRecoverLostConnection(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		transaction string
+		want        string
+	}{
+		{"each", "safe to run again"},
+		{"none", "may be partially applied"},
+	} {
+		t.Run(tt.transaction, func(t *testing.T) {
+			db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "recover.db"))
+			if err != nil {
+				t.Fatalf("failed to open sqlite3 db: %v", err)
+			}
+			defer db.Close()
+			cfg := Config{Driver: "sqlite3", MigrationPattern: writeTransactionMigrations(t), Transaction: tt.transaction}
+			g, err := NewGostgrator(cfg, db)
+			if err != nil {
+				t.Fatalf("failed to create gostgrator: %v", err)
+			}
+			if _, err := g.Migrate(ctx, "1"); err != nil {
+				t.Fatalf("migrate failed: %v", err)
+			}
+			migs, err := g.GetMigrations()
+			if err != nil {
+				t.Fatalf("failed to load migrations: %v", err)
+			}
+			byKey := make(map[string]Migration)
+			for _, m := range migs {
+				byKey[fmt.Sprintf("%d.%s", m.Version, m.Action)] = m
+			}
+
+			if err := g.recoverLostConnection(ctx, byKey["1.do"], driver.ErrBadConn); err != nil {
+				t.Errorf("expected a recorded migration to count as applied, got %v", err)
+			}
+			err = g.recoverLostConnection(ctx, byKey["2.do"], driver.ErrBadConn)
+			if !errors.Is(err, ErrConnectionLost) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an unrecorded migration to be reported as %q, got %v", tt.want, err)
+			}
+			if err := g.recoverLostConnection(ctx, byKey["1.undo"], driver.ErrBadConn); !errors.Is(err, ErrConnectionLost) {
+				t.Errorf("expected an undo that left its version in place to fail, got %v", err)
+			}
+		})
+	}
+}
+
+// TestKeepalive verifies that migrations run alongside keepalive queries and
+// that the keepalive stops with the run.
+func TestKeepalive(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "keepalive.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	cfg := Config{Driver: "sqlite3", MigrationPattern: writeTransactionMigrations(t), KeepaliveInterval: time.Millisecond}
+	g, err := NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	stop := g.startKeepalive(context.Background())
+	time.Sleep(10 * time.Millisecond)
+	stop()
+	if applied, err := g.Migrate(context.Background(), "max"); err != nil || len(applied) != 2 {
+		t.Fatalf("expected 2 migrations to run with keepalives, got %d (%v)", len(applied), err)
+	}
+}
@@ -0,0 +1,143 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrLocked is returned, wrapped with the holder, when another process holds
+// the migration lock.
+var ErrLocked = errors.New("migration lock is held by another process")
+
+// lockHolder identifies this process in the lock table as host:pid.
+var lockHolder = func() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + ":" + strconv.Itoa(os.Getpid())
+}()
+
+// Lock takes the migration lock, a row in "<SchemaTable>_lock", so no other
+// process migrates the same database at the same time. It fails with an error
+// wrapping ErrLocked, naming the holder, if the lock is already taken. Migrate
+// and Down take the lock themselves unless it is already held through Lock.
+// A lock left behind by a killed process can be cleared with ForceUnlock.
+// With WithLock, the Locker is taken instead of the row.
+func (g *Gostgrator) Lock(ctx context.Context) error {
+	if g.locked {
+		return nil
+	}
+	if g.locker != nil {
+		if err := g.locker.Lock(ctx); err != nil {
+			return err
+		}
+		g.locked = true
+		return nil
+	}
+	if err := g.client.EnsureLockTable(ctx); err != nil {
+		return err
+	}
+	// A failed attempt is retried when the lock turns out to be free, as
+	// its holder may have released it in between.
+	var err error
+	for range lockAttempts {
+		if _, err = execArgs(ctx, g.client, func(c ArgsClient) (string, []any) {
+			return c.AcquireLockArgs(lockHolder)
+		}, func() string {
+			return g.client.AcquireLockSql(lockHolder)
+		}); err == nil {
+			g.locked = true
+			return nil
+		}
+		holder, since, held, lerr := g.lockStatus(ctx)
+		if lerr != nil {
+			return err
+		}
+		if held {
+			return fmt.Errorf("%w: held by %s since %s", ErrLocked, holder, since.Format(time.RFC3339))
+		}
+	}
+	return err
+}
+
+// lockAttempts is how many times Lock tries to take a lock that is released
+// while it tries.
+const lockAttempts = 3
+
+// Unlock releases the migration lock taken with Lock.
+func (g *Gostgrator) Unlock(ctx context.Context) error {
+	if !g.locked {
+		return nil
+	}
+	if g.locker != nil {
+		if err := g.locker.Unlock(ctx); err != nil {
+			return err
+		}
+		g.locked = false
+		return nil
+	}
+	if _, err := g.client.ExecContext(ctx, g.client.ReleaseLockSql(lockHolder)); err != nil {
+		return err
+	}
+	g.locked = false
+	return nil
+}
+
+// ForceUnlock releases the migration lock whoever holds it, for clearing a
+// lock left by a process that was killed mid-run. It succeeds if the lock is
+// not held. It cannot release a Locker set with WithLock.
+func (g *Gostgrator) ForceUnlock(ctx context.Context) error {
+	if g.locker != nil {
+		return errors.New("ForceUnlock cannot release a Locker set with WithLock")
+	}
+	if err := g.client.EnsureLockTable(ctx); err != nil {
+		return err
+	}
+	_, err := g.client.ExecContext(ctx, g.client.ReleaseLockSql(""))
+	g.locked = false
+	return err
+}
+
+// withLock runs f holding the migration lock, taking it first unless it is
+// already held, and releasing it afterwards even if ctx has been canceled.
+func (g *Gostgrator) withLock(ctx context.Context, f func() error) error {
+	if g.locked {
+		return f()
+	}
+	if err := g.Lock(ctx); err != nil {
+		return err
+	}
+	err := f()
+	if uerr := g.Unlock(context.WithoutCancel(ctx)); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// lockStatus reads the current lock holder and when it took the lock.
+func (g *Gostgrator) lockStatus(ctx context.Context) (string, time.Time, bool, error) {
+	rows, err := g.client.QueryContext(ctx, g.client.GetLockSql())
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return "", time.Time{}, false, rows.Err()
+	}
+	var holder sql.NullString
+	var lockedAt any
+	if err := rows.Scan(&holder, &lockedAt); err != nil {
+		return "", time.Time{}, false, err
+	}
+	since, err := parseRunAt(lockedAt)
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+	return holder.String, since, true, nil
+}
@@ -0,0 +1,107 @@
+package gostgrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// MigrateLockstep migrates the database of g and that of secondary to target
+// one migration at a time, for blue/green cutovers where a logical replica
+// must keep the schema of the primary. Each migration is applied to
+// secondary first and to g only once it succeeded there, so a migration
+// that fails stops the run before the primary changes. Both databases must
+// be at the same version to start, and both locks are held for the whole
+// run.
+//
+// The migrations are those Plan returns for g, capped by
+// Config.MaxApplyPerRun, and pending migrations below the database version
+// are refused, since the two could not be kept in step. The run is reported
+// to g's webhook and metrics as a migrate; secondary's are not used. The
+// returned migrations are those applied to both databases. A failure is
+// returned as a *PartialApplyError whose message says which database the
+// migration failed on; if it succeeded on secondary but failed on g,
+// secondary is one migration ahead until the primary is fixed and migrated.
+func (g *Gostgrator) MigrateLockstep(ctx context.Context, secondary *Gostgrator, target string) ([]Migration, error) {
+	return g.report(ctx, "migrate", func() ([]Migration, error) {
+		var applied []Migration
+		err := g.withLock(ctx, func() error {
+			return secondary.withLock(ctx, func() error {
+				var err error
+				applied, err = g.migrateLockstep(ctx, secondary, target)
+				return err
+			})
+		})
+		return applied, err
+	})
+}
+
+// migrateLockstep is MigrateLockstep with both locks held.
+func (g *Gostgrator) migrateLockstep(ctx context.Context, secondary *Gostgrator, target string) ([]Migration, error) {
+	for _, x := range []*Gostgrator{secondary, g} {
+		if err := x.EnsureSchemaTable(ctx); err != nil {
+			return nil, err
+		}
+		if err := x.checkFrozen(ctx); err != nil {
+			return nil, err
+		}
+	}
+	version, err := g.GetDatabaseVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	secondaryVersion, err := secondary.GetDatabaseVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("secondary: %w", err)
+	}
+	if secondaryVersion != version {
+		return nil, fmt.Errorf("secondary is at version %d but primary is at %d; bring them to the same version before migrating in lockstep", secondaryVersion, version)
+	}
+	targetVersion, err := g.resolveTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	runnable, _, err := g.plan(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if n := g.cfg.MaxApplyPerRun; n > 0 && len(runnable) > n && runnable[0].Action == "do" {
+		runnable = runnable[:n]
+	}
+
+	var applied []Migration
+	for i, m := range runnable {
+		// Step to the version each migration leaves the database at, so
+		// migrate runs exactly that one.
+		step := m.Version
+		if m.Action == "undo" {
+			step = targetVersion
+			if i+1 < len(runnable) {
+				step = runnable[i+1].Version
+			}
+		} else if m.Version < version {
+			return applied, fmt.Errorf("migration [%d] is pending below version %d and cannot be applied in lockstep", m.Version, version)
+		}
+		if _, err := secondary.migrate(ctx, strconv.Itoa(step)); err != nil {
+			return applied, &PartialApplyError{Applied: applied, Failed: m, Err: fmt.Errorf("on the secondary, so the primary was not changed: %w", unwrapPartial(err))}
+		}
+		done, err := g.migrate(ctx, strconv.Itoa(step))
+		if err != nil {
+			return applied, &PartialApplyError{Applied: applied, Failed: m, Err: fmt.Errorf("on the primary after it was applied to the secondary: %w", unwrapPartial(err))}
+		}
+		applied = append(applied, done...)
+		version = step
+	}
+	return applied, nil
+}
+
+// unwrapPartial returns the underlying error of a *PartialApplyError from a
+// single step, whose Failed the lockstep error already names.
+func unwrapPartial(err error) error {
+	var partial *PartialApplyError
+	if errors.As(err, &partial) {
+		return partial.Err
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMigrateLockstep verifies that a migration failing on the secondary
+// leaves the primary unchanged, and that both databases move together.
+func TestMigrateLockstep(t *testing.T) {
+	ctx := context.Background()
+	pattern := writeTransactionMigrations(t)
+	open := func(name string) (*Gostgrator, *sql.DB) {
+		t.Helper()
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), name))
+		if err != nil {
+			t.Fatalf("failed to open sqlite3 db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		g, err := NewGostgrator(Config{Driver: "sqlite3", MigrationPattern: pattern}, db)
+		if err != nil {
+			t.Fatalf("failed to create gostgrator: %v", err)
+		}
+		return g, db
+	}
+	primary, primaryDB := open("primary.db")
+	secondary, secondaryDB := open("secondary.db")
+
+	if _, err := secondaryDB.Exec("CREATE TABLE b (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := primary.MigrateLockstep(ctx, secondary, "max")
+	var partial *PartialApplyError
+	if !errors.As(err, &partial) || partial.Failed.Version != 2 || !strings.Contains(err.Error(), "on the secondary") {
+		t.Fatalf("expected migration 2 to fail on the secondary, got %v", err)
+	}
+	if len(applied) != 1 || applied[0].Version != 1 {
+		t.Errorf("expected only 1 to be applied to both, got %v", applied)
+	}
+	if tableExists(t, primaryDB, "b") {
+		t.Error("expected the primary to be left at version 1")
+	}
+
+	if _, err := secondaryDB.Exec("DROP TABLE b"); err != nil {
+		t.Fatal(err)
+	}
+	if applied, err := primary.MigrateLockstep(ctx, secondary, "max"); err != nil || len(applied) != 1 || applied[0].Version != 2 {
+		t.Fatalf("expected 2 to be applied to both, got %v (%v)", applied, err)
+	}
+	if undone, err := primary.MigrateLockstep(ctx, secondary, "0"); err != nil || len(undone) != 2 {
+		t.Fatalf("expected both to be rolled back, got %v (%v)", undone, err)
+	}
+	for _, db := range []*sql.DB{primaryDB, secondaryDB} {
+		if tableExists(t, db, "a") || tableExists(t, db, "b") {
+			t.Error("expected both databases to be rolled back")
+		}
+	}
+
+	if _, err := secondary.Migrate(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primary.MigrateLockstep(ctx, secondary, "max"); err == nil || !strings.Contains(err.Error(), "same version") {
+		t.Errorf("expected databases at different versions to fail, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LockWait describes a migration blocked waiting for a lock another session
+// holds, as reported to Config.OnLockWait.
+type LockWait struct {
+	// Migration is the migration that is waiting.
+	Migration Migration
+	// PID is the process ID of the waiting session.
+	PID int
+	// Waited is how long the blocked statement has been running.
+	Waited time.Duration
+	// Blockers are the sessions holding, or queued ahead for, the lock.
+	Blockers []LockBlocker
+}
+
+// LockBlocker is a session a migration is waiting on.
+type LockBlocker struct {
+	// PID is the process ID of the blocking session.
+	PID int
+	// User and Application are the role and application_name it connected
+	// with.
+	User, Application string
+	// State is the session's state, such as "active" or
+	// "idle in transaction".
+	State string
+	// Running is how long its transaction, or its query outside of one, has
+	// been running.
+	Running time.Duration
+	// Query is its current or most recent query.
+	Query string
+}
+
+// String describes the wait in one line, e.g. "version 12 (add-index) has
+// waited 45s for a lock held by pid 4242 (user app, application api, idle in
+// transaction for 12m3s): UPDATE orders SET ...".
+func (w LockWait) String() string {
+	blockers := make([]string, len(w.Blockers))
+	for i, b := range w.Blockers {
+		blockers[i] = fmt.Sprintf("pid %d (user %s, application %s, %s for %s): %s", b.PID, b.User, b.Application, b.State, b.Running.Round(time.Second), b.Query)
+	}
+	return fmt.Sprintf("version %d (%s) has waited %s for a lock held by %s", w.Migration.Version, w.Migration.Name, w.Waited.Round(time.Second), strings.Join(blockers, "; "))
+}
+
+// maxBlockerQuery is how much of a blocking query a LockWait keeps.
+const maxBlockerQuery = 200
+
+// pgLockWaitSql finds sessions of the same role, database and
+// application_name as the one running it that wait for a lock, with the
+// sessions blocking them. The migration runs on another connection of the
+// same pool, so it is among them.
+const pgLockWaitSql = `
+      SELECT w.pid,
+             EXTRACT(EPOCH FROM clock_timestamp() - w.query_start)::float8,
+             b.pid,
+             COALESCE(b.usename, ''),
+             COALESCE(b.application_name, ''),
+             COALESCE(b.state, ''),
+             COALESCE(EXTRACT(EPOCH FROM clock_timestamp() - COALESCE(b.xact_start, b.query_start))::float8, 0),
+             COALESCE(b.query, '')
+      FROM pg_stat_activity w
+      CROSS JOIN LATERAL unnest(pg_blocking_pids(w.pid)) AS blocker(pid)
+      JOIN pg_stat_activity b ON b.pid = blocker.pid
+      WHERE w.wait_event_type = 'Lock'
+        AND w.pid <> pg_backend_pid()
+        AND w.datname = current_database()
+        AND w.usename = current_user
+        AND w.application_name = current_setting('application_name')
+      ORDER BY w.pid, b.pid;`
+
+// startLockWaitMonitor checks every Config.LockWaitInterval whether m is
+// blocked waiting for a lock, until the returned function is called, and
+// reports who blocks it to Config.OnLockWait and the logger. The checks run
+// on a second connection of the pool, since the migration's own is busy.
+// It is supported by the pg driver; errors are ignored, as the migration
+// reports its own.
+func (g *Gostgrator) startLockWaitMonitor(ctx context.Context, m Migration) (stop func()) {
+	pg, ok := g.client.(*PostgresClient)
+	if g.cfg.LockWaitInterval <= 0 || !ok || pg.db == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(g.cfg.LockWaitInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				waits, err := queryLockWaits(ctx, pg.db, m)
+				if err != nil {
+					continue
+				}
+				for _, w := range waits {
+					g.logger.WarnContext(ctx, "migration waiting for a lock", "version", m.Version, "name", m.Name, "pid", w.PID, "waited", w.Waited, "blockers", w.Blockers)
+					if g.cfg.OnLockWait != nil {
+						g.cfg.OnLockWait(w)
+					}
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// queryLockWaits returns the waits pgLockWaitSql finds, one per waiting
+// session, attributed to m.
+func queryLockWaits(ctx context.Context, db *sql.DB, m Migration) ([]LockWait, error) {
+	rows, err := db.QueryContext(ctx, pgLockWaitSql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var waits []LockWait
+	for rows.Next() {
+		var pid int
+		var waited, running float64
+		var b LockBlocker
+		if err := rows.Scan(&pid, &waited, &b.PID, &b.User, &b.Application, &b.State, &running, &b.Query); err != nil {
+			return nil, err
+		}
+		b.Running = time.Duration(running * float64(time.Second))
+		b.Query = strings.Join(strings.Fields(b.Query), " ")
+		if len(b.Query) > maxBlockerQuery {
+			b.Query = strings.ToValidUTF8(b.Query[:maxBlockerQuery], "") + "..."
+		}
+		if len(waits) == 0 || waits[len(waits)-1].PID != pid {
+			waits = append(waits, LockWait{Migration: m, PID: pid, Waited: time.Duration(waited * float64(time.Second))})
+		}
+		waits[len(waits)-1].Blockers = append(waits[len(waits)-1].Blockers, b)
+	}
+	return waits, rows.Err()
+}
@@ -0,0 +1,46 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLockWaitString verifies the one-line description of a lock wait.
+func TestLockWaitString(t *testing.T) {
+	w := LockWait{
+		Migration: Migration{Version: 12, Name: "add-index"},
+		PID:       100,
+		Waited:    45*time.Second + 300*time.Millisecond,
+		Blockers: []LockBlocker{
+			{PID: 4242, User: "app", Application: "api", State: "idle in transaction", Running: 12*time.Minute + 3*time.Second, Query: "UPDATE orders SET status = 'paid'"},
+			{PID: 4243, User: "app", Application: "worker", State: "active", Running: 2 * time.Second, Query: "SELECT 1"},
+		},
+	}
+	want := "version 12 (add-index) has waited 45s for a lock held by pid 4242 (user app, application api, idle in transaction for 12m3s): UPDATE orders SET status = 'paid'; pid 4243 (user app, application worker, active for 2s): SELECT 1"
+	if got := w.String(); got != want {
+		t.Errorf("unexpected description:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+// TestLockWaitMonitorUnsupported verifies that lock waits are not monitored
+// on drivers other than pg.
+func TestLockWaitMonitorUnsupported(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "lockwait.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	cfg := Config{Driver: "sqlite3", MigrationPattern: writeTransactionMigrations(t), LockWaitInterval: time.Millisecond, OnLockWait: func(LockWait) {
+		t.Error("expected no lock waits on sqlite3")
+	}}
+	g, err := NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(context.Background(), "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+}
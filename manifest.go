@@ -0,0 +1,89 @@
+package gostgrator
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// GenerateManifest returns a checksum manifest of the files in fsys matching
+// pattern: one "<md5>  <path>" line per file, sorted by path. The checksum
+// covers the raw file bytes so any edit, including whitespace, changes it.
+func GenerateManifest(fsys fs.FS, pattern string) (string, error) {
+	sums, err := manifestChecksums(fsys, pattern)
+	if err != nil {
+		return "", err
+	}
+	files := make([]string, 0, len(sums))
+	for file := range sums {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	var b strings.Builder
+	for _, file := range files {
+		fmt.Fprintf(&b, "%s  %s\n", sums[file], file)
+	}
+	return b.String(), nil
+}
+
+// VerifyManifest checks that the files in fsys matching pattern are exactly
+// the ones recorded in manifest, as produced by GenerateManifest, with the
+// same content. The error lists every added, removed and changed file.
+func VerifyManifest(fsys fs.FS, pattern, manifest string) error {
+	sums, err := manifestChecksums(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	expected := make(map[string]string)
+	for _, line := range strings.Split(manifest, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		sum, file, ok := strings.Cut(line, "  ")
+		if !ok {
+			return fmt.Errorf("invalid manifest line: %q", line)
+		}
+		expected[file] = sum
+	}
+
+	var problems []string
+	for file, sum := range sums {
+		switch want, ok := expected[file]; {
+		case !ok:
+			problems = append(problems, "added "+file)
+		case want != sum:
+			problems = append(problems, "changed "+file)
+		}
+	}
+	for file := range expected {
+		if _, ok := sums[file]; !ok {
+			problems = append(problems, "removed "+file)
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("migrations do not match the manifest (regenerate it): %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// manifestChecksums returns the MD5 of every file in fsys matching pattern.
+func manifestChecksums(fsys fs.FS, pattern string) (map[string]string, error) {
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string, len(files))
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		sum := md5.Sum(data)
+		sums[file] = hex.EncodeToString(sum[:])
+	}
+	return sums, nil
+}
@@ -0,0 +1,44 @@
+package gostgrator
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// TestManifestRoundTrip verifies that a generated manifest verifies against
+// the same files and reports added, removed and changed files otherwise.
+func TestManifestRoundTrip(t *testing.T) {
+	fsys := fstest.MapFS{
+		"001.do.sql":   {Data: []byte("CREATE TABLE a (id INT);\n")},
+		"001.undo.sql": {Data: []byte("DROP TABLE a;\n")},
+		"notes.txt":    {Data: []byte("not a migration")},
+	}
+	manifest, err := GenerateManifest(fsys, "*.sql")
+	if err != nil {
+		t.Fatalf("GenerateManifest failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(manifest), "\n"); len(lines) != 2 || !strings.HasSuffix(lines[0], "  001.do.sql") || !strings.HasSuffix(lines[1], "  001.undo.sql") {
+		t.Fatalf("Unexpected manifest:\n%s", manifest)
+	}
+	if err := VerifyManifest(fsys, "*.sql", manifest); err != nil {
+		t.Errorf("Expected manifest to verify, got %v", err)
+	}
+
+	fsys["001.do.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE a (id BIGINT);\n")}
+	fsys["002.do.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;\n")}
+	delete(fsys, "001.undo.sql")
+	err = VerifyManifest(fsys, "*.sql", manifest)
+	if err == nil {
+		t.Fatal("Expected verification to fail after editing migrations")
+	}
+	for _, want := range []string{"added 002.do.sql", "changed 001.do.sql", "removed 001.undo.sql"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got %v", want, err)
+		}
+	}
+
+	if err := VerifyManifest(fsys, "*.sql", "garbage"); err == nil || !strings.Contains(err.Error(), "invalid manifest line") {
+		t.Errorf("Expected an invalid manifest error, got %v", err)
+	}
+}
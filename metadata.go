@@ -0,0 +1,23 @@
+package gostgrator
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// captureMetadata returns the JSON object recorded in the metadata column
+// with Config.CaptureEnv: each variable in names that is set, and the
+// hostname of this machine.
+func captureMetadata(names []string) string {
+	metadata := make(map[string]string, len(names)+1)
+	if host, err := os.Hostname(); err == nil {
+		metadata["hostname"] = host
+	}
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			metadata[name] = value
+		}
+	}
+	data, _ := json.Marshal(metadata)
+	return string(data)
+}
@@ -0,0 +1,159 @@
+package gostgrator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsCommands are the commands whose runs are counted, in the order
+// their series are written.
+var metricsCommands = []string{"migrate", "down", "reset"}
+
+// runMetrics accumulates the outcome of every Migrate, Down, DownAll and
+// Reset of a Gostgrator. It is shared by the copies of a Gostgrator made for
+// transactions.
+type runMetrics struct {
+	mu       sync.Mutex
+	runs     map[string]int
+	failures map[string]int
+	lastEnd  map[string]time.Time
+	lastTook map[string]time.Duration
+}
+
+func newRunMetrics() *runMetrics {
+	return &runMetrics{
+		runs:     make(map[string]int),
+		failures: make(map[string]int),
+		lastEnd:  make(map[string]time.Time),
+		lastTook: make(map[string]time.Duration),
+	}
+}
+
+// record counts a run of command that ended at end after elapsed, failing
+// if err is set.
+func (r *runMetrics) record(command string, end time.Time, elapsed time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs[command]++
+	if err != nil {
+		r.failures[command]++
+	}
+	r.lastEnd[command] = end
+	r.lastTook[command] = elapsed
+}
+
+// MetricsHandler returns an http.Handler serving metrics about g in the
+// Prometheus text exposition format, for services that keep a Gostgrator
+// around and want to alert on schema drift:
+//
+//	http.Handle("/metrics", g.MetricsHandler())
+//
+// Every scrape reads the database version and counts the migration files
+// above it, so the gauges follow deploys by other processes too:
+//
+//	gostgrator_up                                 1 if the database could be read, else 0
+//	gostgrator_schema_version                     version recorded in the schema table
+//	gostgrator_pending_migrations                 do migrations above that version
+//	gostgrator_runs_total{command}                Migrate, Down and Reset calls of g
+//	gostgrator_run_failures_total{command}        those that failed
+//	gostgrator_last_run_timestamp_seconds{command} when the last one ended
+//	gostgrator_last_run_duration_seconds{command} how long it took
+//
+// DownAll counts as "down", and the run series only cover calls made
+// through g. The handler may be scraped while g is migrating. It needs no
+// Prometheus client library; services that already run one can serve it on
+// its own path.
+func (g *Gostgrator) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		g.WriteMetrics(r.Context(), w)
+	})
+}
+
+// WriteMetrics writes the metrics served by MetricsHandler to w. A database
+// that cannot be read is reported through gostgrator_up rather than as an
+// error, so run counters are still exported; only write errors are returned.
+func (g *Gostgrator) WriteMetrics(ctx context.Context, w io.Writer) error {
+	var b strings.Builder
+	version, pending, err := g.schemaGauges(ctx)
+	up := 1
+	if err != nil {
+		up = 0
+	}
+	writeMetric(&b, "gostgrator_up", "gauge", "Whether the schema table could be read on the last scrape.", up)
+	if err == nil {
+		writeMetric(&b, "gostgrator_schema_version", "gauge", "Migration version recorded in the schema table.", version)
+		writeMetric(&b, "gostgrator_pending_migrations", "gauge", "Do migrations numbered above the schema version.", pending)
+	}
+
+	m := g.metrics
+	if m == nil {
+		m = newRunMetrics()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writeHeader(&b, "gostgrator_runs_total", "counter", "Migrate, Down and Reset calls, by command.")
+	for _, c := range metricsCommands {
+		fmt.Fprintf(&b, "gostgrator_runs_total{command=%q} %d\n", c, m.runs[c])
+	}
+	writeHeader(&b, "gostgrator_run_failures_total", "counter", "Migrate, Down and Reset calls that failed, by command.")
+	for _, c := range metricsCommands {
+		fmt.Fprintf(&b, "gostgrator_run_failures_total{command=%q} %d\n", c, m.failures[c])
+	}
+	if len(m.lastEnd) > 0 {
+		writeHeader(&b, "gostgrator_last_run_timestamp_seconds", "gauge", "Unix time the last run of each command ended.")
+		for _, c := range metricsCommands {
+			if end, ok := m.lastEnd[c]; ok {
+				fmt.Fprintf(&b, "gostgrator_last_run_timestamp_seconds{command=%q} %.3f\n", c, float64(end.UnixMilli())/1000)
+			}
+		}
+		writeHeader(&b, "gostgrator_last_run_duration_seconds", "gauge", "Duration of the last run of each command.")
+		for _, c := range metricsCommands {
+			if took, ok := m.lastTook[c]; ok {
+				fmt.Fprintf(&b, "gostgrator_last_run_duration_seconds{command=%q} %g\n", c, took.Seconds())
+			}
+		}
+	}
+	_, werr := io.WriteString(w, b.String())
+	return werr
+}
+
+// schemaGauges returns the database version and the number of do
+// migrations above it. The files are scanned without touching g's loaded
+// migrations, so a scrape is safe while g is migrating.
+func (g *Gostgrator) schemaGauges(ctx context.Context) (int, int, error) {
+	migs, err := getMigrations(g.cfg)
+	if err != nil {
+		return 0, 0, err
+	}
+	version, err := g.GetDatabaseVersion(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	pending := 0
+	for _, m := range migs {
+		if m.Action == "do" && m.Version > version {
+			pending++
+		}
+	}
+	return version, pending, nil
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeMetric writes a metric with a single unlabeled sample.
+func writeMetric(b *strings.Builder, name, kind, help string, value int) {
+	writeHeader(b, name, kind, help)
+	fmt.Fprintf(b, "%s %d\n", name, value)
+}
@@ -0,0 +1,88 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMetricsHandler verifies the gauges follow the database and that runs
+// and failures are counted by command.
+func TestMetricsHandler(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "metrics.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := NewGostgrator(Config{Driver: "sqlite3", MigrationPattern: writeTransactionMigrations(t)}, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	scrape := func() string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		g.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		body, _ := io.ReadAll(rec.Body)
+		return string(body)
+	}
+	expect := func(body string, lines ...string) {
+		t.Helper()
+		for _, line := range lines {
+			if !strings.Contains(body, "\n"+line+"\n") {
+				t.Errorf("expected %q in metrics:\n%s", line, body)
+			}
+		}
+	}
+
+	body := scrape()
+	expect(body,
+		"gostgrator_up 1",
+		"gostgrator_schema_version 0",
+		"gostgrator_pending_migrations 2",
+		`gostgrator_runs_total{command="migrate"} 0`,
+		`gostgrator_run_failures_total{command="down"} 0`,
+	)
+	if strings.Contains(body, "gostgrator_last_run") {
+		t.Errorf("expected no last run before any run:\n%s", body)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.WriteMetrics(ctx, io.Discard)
+	}()
+	if _, err := g.Migrate(ctx, "1"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	<-done
+	if _, err := g.Migrate(ctx, "latest"); err == nil {
+		t.Fatal("expected an invalid target to fail")
+	}
+	body = scrape()
+	expect(body,
+		"gostgrator_schema_version 1",
+		"gostgrator_pending_migrations 1",
+		`gostgrator_runs_total{command="migrate"} 2`,
+		`gostgrator_run_failures_total{command="migrate"} 1`,
+		`gostgrator_runs_total{command="reset"} 0`,
+	)
+	for _, prefix := range []string{`gostgrator_last_run_timestamp_seconds{command="migrate"} `, `gostgrator_last_run_duration_seconds{command="migrate"} `} {
+		if !strings.Contains(body, prefix) {
+			t.Errorf("expected %s in metrics:\n%s", prefix, body)
+		}
+	}
+	if strings.Contains(body, `last_run_timestamp_seconds{command="down"}`) {
+		t.Errorf("expected no last run for down:\n%s", body)
+	}
+
+	db.Close()
+	expect(scrape(), "gostgrator_up 0", `gostgrator_runs_total{command="migrate"} 2`)
+}
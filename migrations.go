@@ -1,15 +1,19 @@
 package gostgrator
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // Migration represents a single migration file.
@@ -17,7 +21,9 @@ type Migration struct {
 	// Version of the migration.
 	Version int
 
-	// Action, e.g., "do" or "undo".
+	// Action, e.g., "do" or "undo", or "test" for a test migration run by
+	// RunTests. Aliases such as "up" and "down" are resolved, so Filename
+	// may name a different action.
 	Action string
 
 	// Filename is the path to the migration file.
@@ -28,17 +34,152 @@ type Migration struct {
 
 	// Md5 is the MD5 checksum of the migration file.
 	Md5 string
+
+	// Directives holds the key/value settings declared in the file's
+	// "-- gostgrator:" header comments, e.g. "-- gostgrator: separator=GO".
+	Directives map[string]string
+
+	// Duration is how long the migration took to run. It is only set on the
+	// migrations returned by Migrate, Down and RunMigrations.
+	Duration time.Duration
+
+	// Warnings lists the errors tolerated while running the migration in
+	// best-effort mode. Like Duration, it is only set on migrations that ran.
+	Warnings []Warning
+
+	// fsys is the file system Filename is read from, or nil for the local disk.
+	fsys fs.FS
 }
 
+// directivePrefix marks a header comment that carries gostgrator directives.
+const directivePrefix = "-- gostgrator:"
+
 // getSQL reads the migration file's content.
 func (m *Migration) getSQL() (string, error) {
-	data, err := os.ReadFile(m.Filename)
+	data, err := readMigrationFile(m.fsys, m.Filename)
 	if err != nil {
 		return "", err
 	}
+	return decodeMigration(m.Filename, data)
+}
+
+// size returns the size of the migration file in bytes.
+func (m *Migration) size() (int64, error) {
+	var info fs.FileInfo
+	var err error
+	if m.fsys == nil {
+		info, err = os.Stat(m.Filename)
+	} else {
+		info, err = fs.Stat(m.fsys, m.Filename)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// byteOrderMarks maps the byte order marks of unsupported encodings to their names.
+// UTF-32LE must come before UTF-16LE because it shares the same prefix.
+var byteOrderMarks = []struct {
+	bom      []byte
+	encoding string
+}{
+	{[]byte{0xFF, 0xFE, 0x00, 0x00}, "UTF-32LE"},
+	{[]byte{0x00, 0x00, 0xFE, 0xFF}, "UTF-32BE"},
+	{[]byte{0xFF, 0xFE}, "UTF-16LE"},
+	{[]byte{0xFE, 0xFF}, "UTF-16BE"},
+}
+
+// decodeMigration returns the content of a migration file as a string. A UTF-8
+// byte order mark is stripped from the SQL that runs, though checksums still
+// include it; files in any other encoding are rejected with an error naming
+// the file, since they would otherwise fail with confusing SQL errors.
+func decodeMigration(filename string, data []byte) (string, error) {
+	if content, ok := bytes.CutPrefix(data, []byte{0xEF, 0xBB, 0xBF}); ok {
+		data = content
+	}
+	for _, b := range byteOrderMarks {
+		if bytes.HasPrefix(data, b.bom) {
+			return "", fmt.Errorf("migration file %s is encoded as %s; only UTF-8 is supported", filename, b.encoding)
+		}
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", fmt.Errorf("migration file %s contains NUL bytes; it may be UTF-16 encoded, only UTF-8 is supported", filename)
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("migration file %s is not valid UTF-8", filename)
+	}
 	return string(data), nil
 }
 
+// dependencies returns the versions listed in the migration's "depends-on"
+// directive, e.g. "-- gostgrator: depends-on=012,015".
+func (m *Migration) dependencies() ([]int, error) {
+	value, ok := m.Directives["depends-on"]
+	if !ok {
+		return nil, nil
+	}
+	var deps []int
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		dep, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid depends-on directive in %s: %v", m.Filename, err)
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// environments returns the environments listed in the migration's
+// "environments" directive, e.g. "-- gostgrator: environments=dev,staging",
+// or nil if the migration is not gated.
+func (m *Migration) environments() ([]string, error) {
+	value, ok := m.Directives["environments"]
+	if !ok {
+		return nil, nil
+	}
+	environments := []string{}
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			environments = append(environments, part)
+		}
+	}
+	if len(environments) == 0 {
+		return nil, fmt.Errorf("empty environments directive in %s", m.Filename)
+	}
+	return environments, nil
+}
+
+// tags returns the tags listed in the migration's "tags" directive, e.g.
+// "-- gostgrator: tags=reporting,slow".
+func (m *Migration) tags() []string {
+	var tags []string
+	for _, part := range strings.Split(m.Directives["tags"], ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			tags = append(tags, part)
+		}
+	}
+	return tags
+}
+
+// transactional reports whether the migration may run inside a transaction.
+// Files opt out with "-- gostgrator: transaction=none", e.g. for statements
+// such as CREATE INDEX CONCURRENTLY that Postgres refuses to run in one.
+func (m *Migration) transactional() (bool, error) {
+	value, ok := m.Directives["transaction"]
+	if !ok {
+		return true, nil
+	}
+	if !strings.EqualFold(value, "none") {
+		return false, fmt.Errorf("invalid transaction directive in %s: %q, expected none", m.Filename, value)
+	}
+	return false, nil
+}
+
 // sortMigrationsAsc sorts migrations in ascending order based on version.
 func sortMigrationsAsc(migs []Migration) {
 	sort.Slice(migs, func(i, j int) bool {
@@ -46,13 +187,6 @@ func sortMigrationsAsc(migs []Migration) {
 	})
 }
 
-// sortMigrationsDesc sorts migrations in descending order based on version.
-func sortMigrationsDesc(migs []Migration) {
-	sort.Slice(migs, func(i, j int) bool {
-		return migs[i].Version > migs[j].Version
-	})
-}
-
 // convertLineEnding converts all newline variations in content to the target style.
 func convertLineEnding(content, lineEnding string) (string, error) {
 	var target string
@@ -66,10 +200,12 @@ func convertLineEnding(content, lineEnding string) (string, error) {
 	default:
 		return "", fmt.Errorf("newline must be one of: LF, CR, CRLF")
 	}
-	re := regexp.MustCompile(`\r\n|\r|\n`)
-	return re.ReplaceAllString(content, target), nil
+	return newlinePattern.ReplaceAllString(content, target), nil
 }
 
+// newlinePattern matches every newline style convertLineEnding normalizes.
+var newlinePattern = regexp.MustCompile(`\r\n|\r|\n`)
+
 // checksum computes the MD5 checksum of the content after converting line endings if set.
 func checksum(content, lineEnding string) (string, error) {
 	if lineEnding != "" {
@@ -83,61 +219,258 @@ func checksum(content, lineEnding string) (string, error) {
 	return hex.EncodeToString(sum[:]), nil
 }
 
-// fileChecksum reads a file and returns its MD5 checksum.
-func fileChecksum(filename, lineEnding string) (string, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return "", err
+// parseDirectives collects "-- gostgrator: key=value ..." settings from the
+// leading comment block of a migration. Parsing stops at the first line that is
+// neither blank nor a "--" comment. Words without an "=" are appended to the
+// previous value so values may contain spaces.
+func parseDirectives(content string) map[string]string {
+	directives := make(map[string]string)
+	for remaining := content; remaining != ""; {
+		var line string
+		line, remaining, _ = strings.Cut(remaining, "\n")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		rest, ok := strings.CutPrefix(line, directivePrefix)
+		if !ok || strings.HasPrefix(line, blockOnlyPrefix) || line == blockEnd {
+			continue
+		}
+		var lastKey string
+		for _, field := range strings.Fields(rest) {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				if lastKey != "" {
+					directives[lastKey] += " " + field
+				}
+				continue
+			}
+			lastKey = strings.ToLower(key)
+			directives[lastKey] = value
+		}
+	}
+	return directives
+}
+
+// batchSplitter describes where a script is split into separately executed
+// batches.
+type batchSplitter struct {
+	// separator ends a batch on a line of its own, compared
+	// case-insensitively, like SQL Server's "GO".
+	separator string
+	// delimiter ends a batch at the end of any line ending with it, like the
+	// MySQL client's, so procedural blocks can end with e.g. "END$$". A
+	// "DELIMITER x" line switches it to x.
+	delimiter string
+}
+
+// splits reports whether b splits scripts at all.
+func (b batchSplitter) splits() bool {
+	return b.separator != "" || b.delimiter != ""
+}
+
+// line returns the part of line that belongs to the current batch and
+// whether line ends the batch, switching the delimiter on DELIMITER lines.
+func (b *batchSplitter) line(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if b.delimiter != "" {
+		if keyword, delimiter, ok := strings.Cut(trimmed, " "); ok && strings.EqualFold(keyword, "DELIMITER") {
+			if delimiter = strings.TrimSpace(delimiter); delimiter != "" {
+				b.delimiter = delimiter
+				return "", true
+			}
+		}
+		if strings.HasSuffix(trimmed, b.delimiter) {
+			i := strings.LastIndex(line, b.delimiter)
+			return line[:i] + line[i+len(b.delimiter):], true
+		}
 	}
-	return checksum(string(data), lineEnding)
+	if b.separator != "" && strings.EqualFold(trimmed, b.separator) {
+		return "", true
+	}
+	return line, false
 }
 
-// getMigrations scans for migration files matching the pattern and loads them.
+// splitBatches splits a script into batches as b describes. A splitter that
+// does not split returns the whole script as a single batch. Blank batches
+// are dropped.
+func splitBatches(script string, b batchSplitter) []string {
+	if !b.splits() {
+		return []string{script}
+	}
+	var batches []string
+	var current strings.Builder
+	flush := func() {
+		if strings.TrimSpace(current.String()) != "" {
+			batches = append(batches, current.String())
+		}
+		current.Reset()
+	}
+	for _, line := range strings.SplitAfter(script, "\n") {
+		text, end := b.line(line)
+		current.WriteString(text)
+		if end {
+			flush()
+		}
+	}
+	flush()
+	return batches
+}
+
+// defaultActionAliases are the action names accepted in place of do and undo
+// without configuration.
+var defaultActionAliases = map[string]string{"up": "do", "down": "undo"}
+
+// canonicalAction resolves action, as written in a filename, through
+// cfg.ActionAliases and the default aliases.
+func canonicalAction(cfg Config, action string) (string, error) {
+	alias, ok := cfg.ActionAliases[action]
+	if !ok {
+		alias, ok = defaultActionAliases[action]
+	}
+	if !ok {
+		return action, nil
+	}
+	switch alias {
+	case "do", "undo", "test":
+		return alias, nil
+	}
+	return "", fmt.Errorf("action alias %q must map to do, undo or test, not %q", action, alias)
+}
+
+// getMigrations scans for migration files matching the pattern and loads them,
+// followed by the migrations of cfg.Sources.
 func getMigrations(cfg Config) ([]Migration, error) {
-	files, err := filepath.Glob(cfg.MigrationPattern)
+	var files []string
+	var err error
+	if cfg.FS != nil {
+		files, err = fs.Glob(cfg.FS, cfg.MigrationPattern)
+	} else {
+		files, err = filepath.Glob(cfg.MigrationPattern)
+	}
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := excludePattern(cfg)
 	if err != nil {
 		return nil, err
 	}
+	var cache *migrationCache
+	// Files in an fs.FS such as embed.FS have no modification time to key the
+	// cache on, so the cache only applies to the local disk.
+	if cfg.CacheFile != "" && cfg.FS == nil {
+		cache = loadMigrationCache(cfg.CacheFile, cfg.checksumStyle())
+	}
 	var migrations []Migration
 	migrationKeys := make(map[string]struct{})
+	add := func(mig Migration) error {
+		key := fmt.Sprintf("%d:%s", mig.Version, mig.Action)
+		if _, exists := migrationKeys[key]; exists {
+			return fmt.Errorf("duplicate migration for version %d and action %s", mig.Version, mig.Action)
+		}
+		migrationKeys[key] = struct{}{}
+		migrations = append(migrations, mig)
+		return nil
+	}
 	for _, file := range files {
-		if filepath.Ext(file) != ".sql" {
+		if filepath.Ext(file) != ".sql" || excluded(exclude, cfg.ExcludePattern, file) {
 			continue
 		}
 		base := filepath.Base(file)
 		ext := filepath.Ext(base)
 		baseNoExt := strings.TrimSuffix(base, ext)
-		parts := strings.Split(baseNoExt, ".")
-		if len(parts) < 2 {
-			// Skip files that do not match version.action[.name]
-			continue
+		version, action, name, ok := 0, "", "", false
+		if cfg.MigrationFormat == "golang-migrate" {
+			version, action, name, ok = parseGolangMigrateName(baseNoExt)
 		}
-		version, err := strconv.Atoi(parts[0])
-		if err != nil {
-			continue
+		if !ok {
+			parts := strings.Split(baseNoExt, ".")
+			if len(parts) < 2 {
+				// Skip files that do not match version.action[.name]
+				continue
+			}
+			version, err = strconv.Atoi(parts[0])
+			if err != nil {
+				continue
+			}
+			action, err = canonicalAction(cfg, parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			// "001.do.name.test.sql" is the test companion of "001.do.name.sql",
+			// like "001.test.name.sql".
+			if len(parts) > 3 && parts[len(parts)-1] == "test" {
+				action = "test"
+				parts = parts[:len(parts)-1]
+			}
+			if len(parts) > 2 {
+				name = strings.Join(parts[2:], ".")
+			}
 		}
-		action := parts[1]
-		name := ""
-		if len(parts) > 2 {
-			name = strings.Join(parts[2:], ".")
+		var md5sum string
+		var directives map[string]string
+		if cfg.FS != nil {
+			md5sum, directives, err = parseMigrationFile(cfg.FS, file, cfg.checksumStyle())
+		} else {
+			md5sum, directives, err = cache.parse(file, cfg.checksumStyle())
 		}
-		md5sum, err := fileChecksum(file, cfg.Newline)
 		if err != nil {
 			return nil, err
 		}
 		mig := Migration{
-			Version:  version,
-			Action:   action,
-			Filename: file,
-			Name:     name,
-			Md5:      md5sum,
+			Version:    version,
+			Action:     action,
+			Filename:   file,
+			Name:       name,
+			Md5:        md5sum,
+			Directives: directives,
+			fsys:       cfg.FS,
 		}
-		key := fmt.Sprintf("%d:%s", mig.Version, mig.Action)
-		if _, exists := migrationKeys[key]; exists {
-			return nil, fmt.Errorf("duplicate migration for version %d and action %s", mig.Version, mig.Action)
+		if err := add(mig); err != nil {
+			return nil, err
+		}
+	}
+	if err := cache.save(cfg.CacheFile); err != nil {
+		return nil, err
+	}
+	sources, err := sourceMigrations(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, mig := range sources {
+		if err := add(mig); err != nil {
+			return nil, err
 		}
-		migrationKeys[key] = struct{}{}
-		migrations = append(migrations, mig)
 	}
 	return migrations, nil
 }
+
+// readMigrationFile reads file from fsys, or from the local disk if fsys is nil.
+func readMigrationFile(fsys fs.FS, file string) ([]byte, error) {
+	if fsys == nil {
+		return os.ReadFile(file)
+	}
+	return fs.ReadFile(fsys, file)
+}
+
+// openMigrationFile opens file in fsys, or on the local disk if fsys is nil.
+func openMigrationFile(fsys fs.FS, file string) (fs.File, error) {
+	if fsys == nil {
+		return os.Open(file)
+	}
+	return fsys.Open(file)
+}
+
+// parseMigrationFile streams a migration file and returns its checksum and
+// directives, so large files are never held in memory while loading.
+func parseMigrationFile(fsys fs.FS, file string, style checksumStyle) (string, map[string]string, error) {
+	f, err := openMigrationFile(fsys, file)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	return scanMigration(f, file, style)
+}
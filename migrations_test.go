@@ -1,7 +1,14 @@
 package gostgrator
 
 import (
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 // TestConvertLineEnding_LF verifies that converting to LF produces the expected result.
@@ -56,3 +63,258 @@ func TestConvertLineEnding_Invalid(t *testing.T) {
 		t.Errorf("Expected an error for invalid newline type, got nil")
 	}
 }
+
+// TestParseDirectives verifies that header directives are collected until the first SQL line.
+func TestParseDirectives(t *testing.T) {
+	content := "-- a plain comment\n-- gostgrator: separator=GO\n\n-- gostgrator: delimiter=$$\nSELECT 1;\n-- gostgrator: ignored=true\n"
+
+	got := parseDirectives(content)
+	expected := map[string]string{
+		"separator": "GO",
+		"delimiter": "$$",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d directives, got %d: %v", len(expected), len(got), got)
+	}
+	for k, v := range expected {
+		if got[k] != v {
+			t.Errorf("Expected directive %s=%q, got %q", k, v, got[k])
+		}
+	}
+}
+
+// TestSplitBatches verifies that scripts are split on separator lines and blank batches are dropped.
+func TestSplitBatches(t *testing.T) {
+	script := "CREATE TABLE a (id INT);\nGO\nINSERT INTO a VALUES (1);\r\n  go  \r\n\nGO\n"
+
+	got := splitBatches(script, batchSplitter{separator: "GO"})
+	expected := []string{"CREATE TABLE a (id INT);\n", "INSERT INTO a VALUES (1);\r\n"}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d batches, got %d: %q", len(expected), len(got), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected batch %d to be %q, got %q", i, expected[i], got[i])
+		}
+	}
+
+	if whole := splitBatches(script, batchSplitter{}); len(whole) != 1 || whole[0] != script {
+		t.Errorf("Expected an empty separator to return the whole script, got %q", whole)
+	}
+}
+
+// TestSplitBatchesDelimiter verifies that a delimiter ends batches at the end
+// of any line and that DELIMITER lines switch it.
+func TestSplitBatchesDelimiter(t *testing.T) {
+	script := "CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  DELETE FROM b;\nEND$$\n\nDELIMITER ;\nINSERT INTO a VALUES (1);\nINSERT INTO a VALUES (2); \r\nGO\n"
+
+	got := splitBatches(script, batchSplitter{separator: "GO", delimiter: "$$"})
+	expected := []string{
+		"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  DELETE FROM b;\nEND\n",
+		"INSERT INTO a VALUES (1)\n",
+		"INSERT INTO a VALUES (2) \r\n",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d batches, got %d: %q", len(expected), len(got), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected batch %d to be %q, got %q", i, expected[i], got[i])
+		}
+	}
+}
+
+// TestDecodeMigration verifies UTF-8 BOM stripping and rejection of other encodings.
+func TestDecodeMigration(t *testing.T) {
+	got, err := decodeMigration("bom.sql", []byte("\xEF\xBB\xBFSELECT 1;"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != "SELECT 1;" {
+		t.Errorf("Expected BOM to be stripped, got %q", got)
+	}
+
+	cases := map[string]struct {
+		data     []byte
+		expected string
+	}{
+		"UTF-16LE BOM":  {[]byte("\xFF\xFES\x00E\x00"), "encoded as UTF-16LE"},
+		"UTF-16BE BOM":  {[]byte("\xFE\xFF\x00S\x00E"), "encoded as UTF-16BE"},
+		"UTF-32LE BOM":  {[]byte("\xFF\xFE\x00\x00S\x00\x00\x00"), "encoded as UTF-32LE"},
+		"UTF-16 no BOM": {[]byte("S\x00E\x00L\x00"), "contains NUL bytes"},
+		"Invalid UTF-8": {[]byte("SELECT '\xE9';"), "is not valid UTF-8"},
+	}
+	for name, c := range cases {
+		_, err := decodeMigration("bad.sql", c.data)
+		if err == nil || !strings.Contains(err.Error(), c.expected) || !strings.Contains(err.Error(), "bad.sql") {
+			t.Errorf("%s: expected error containing %q and the file name, got %v", name, c.expected, err)
+		}
+	}
+}
+
+// TestGetMigrationsRejectsUTF16 verifies that getMigrations fails early on UTF-16 files.
+func TestGetMigrationsRejectsUTF16(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "001.do.sql")
+	if err := os.WriteFile(file, []byte("\xFF\xFEC\x00R\x00"), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	_, err := getMigrations(Config{MigrationPattern: filepath.Join(tmpDir, "*.sql")})
+	if err == nil || !strings.Contains(err.Error(), file) {
+		t.Errorf("Expected an error naming %s, got %v", file, err)
+	}
+}
+
+// TestGetMigrationsFromFS verifies that migrations are loaded from Config.FS.
+func TestGetMigrationsFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/001.do.create.sql": {Data: []byte("-- gostgrator: separator=GO\nCREATE TABLE a (id INT);\n")},
+		"sql/001.undo.sql":      {Data: []byte("DROP TABLE a;\n")},
+	}
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+	migs, err := getMigrations(Config{FS: fsys, MigrationPattern: "sql/*.sql", CacheFile: cacheFile})
+	if err != nil {
+		t.Fatalf("getMigrations failed: %v", err)
+	}
+	if _, err := os.Stat(cacheFile); !os.IsNotExist(err) {
+		t.Errorf("Expected no cache file for migrations in an fs.FS, got %v", err)
+	}
+	if len(migs) != 2 {
+		t.Fatalf("Expected 2 migrations, got %d", len(migs))
+	}
+	sortMigrationsAsc(migs)
+	do := migs[0]
+	if do.Action != "do" {
+		do = migs[1]
+	}
+	if do.Name != "create" || do.Directives["separator"] != "GO" {
+		t.Errorf("Unexpected migration parsed from FS: %+v", do)
+	}
+	sqlScript, err := do.getSQL()
+	if err != nil || !strings.Contains(sqlScript, "CREATE TABLE a") {
+		t.Errorf("Expected SQL to be read from FS, got %q, %v", sqlScript, err)
+	}
+}
+
+// TestMigrationEnvironments verifies parsing of the environments directive.
+func TestMigrationEnvironments(t *testing.T) {
+	m := Migration{Filename: "002.do.sql", Directives: map[string]string{"environments": "dev, staging,"}}
+	got, err := m.environments()
+	if err != nil {
+		t.Fatalf("environments failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"dev", "staging"}) {
+		t.Errorf("Expected [dev staging], got %v", got)
+	}
+
+	if got, err := (&Migration{}).environments(); err != nil || got != nil {
+		t.Errorf("Expected no environments for an ungated migration, got %v, %v", got, err)
+	}
+	empty := Migration{Filename: "003.do.sql", Directives: map[string]string{"environments": ""}}
+	if _, err := empty.environments(); err == nil {
+		t.Error("Expected an error for an empty environments directive")
+	}
+}
+
+// TestGetMigrationsExcludePattern verifies that files matching
+// Config.ExcludePattern are skipped before the duplicate check.
+func TestGetMigrationsExcludePattern(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/001.do.sql":            {Data: []byte("CREATE TABLE a (id INT);\n")},
+		"sql/002.do.sql":            {Data: []byte("CREATE TABLE b (id INT);\n")},
+		"sql/002.do.wip.sql":        {Data: []byte("CREATE TABLE c (id INT);\n")},
+		"sql/drafts/003.do.wip.sql": {Data: []byte("CREATE TABLE d (id INT);\n")},
+	}
+	tests := []struct {
+		pattern string
+		glob    string
+		want    int
+	}{
+		{pattern: "**/*.wip.sql", glob: "sql/*.sql", want: 2},
+		{pattern: "*.wip.sql", glob: "sql/*.sql", want: 2},
+		{pattern: "sql/**/*.wip.sql", glob: "sql/drafts/*.sql", want: 0},
+		{pattern: "**/drafts/**", glob: "sql/drafts/*.sql", want: 0},
+		{pattern: "sql/00[!1]*.sql", glob: "sql/*.sql", want: 1},
+	}
+	for _, tt := range tests {
+		migs, err := getMigrations(Config{FS: fsys, MigrationPattern: tt.glob, ExcludePattern: tt.pattern})
+		if err != nil {
+			t.Errorf("%s: getMigrations failed: %v", tt.pattern, err)
+			continue
+		}
+		if len(migs) != tt.want {
+			t.Errorf("%s: expected %d migrations, got %d", tt.pattern, tt.want, len(migs))
+		}
+	}
+
+	if _, err := getMigrations(Config{FS: fsys, MigrationPattern: "sql/*.sql"}); err == nil {
+		t.Error("Expected a duplicate migration error without an exclude pattern")
+	}
+	if _, err := getMigrations(Config{FS: fsys, MigrationPattern: "sql/*.sql", ExcludePattern: "[wip"}); err == nil || !strings.Contains(err.Error(), "invalid exclude pattern") {
+		t.Errorf("Expected an invalid exclude pattern error, got %v", err)
+	}
+}
+
+// TestGetMigrationsActionAliases verifies that Config.ActionAliases maps
+// action names in filenames to do, undo and test.
+func TestGetMigrationsActionAliases(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/001.apply.users.sql":  {Data: []byte("CREATE TABLE users (id INT);\n")},
+		"sql/001.revert.users.sql": {Data: []byte("DROP TABLE users;\n")},
+		"sql/001.check.users.sql":  {Data: []byte("SELECT 1;\n")},
+		"sql/002.up.posts.sql":     {Data: []byte("CREATE TABLE posts (id INT);\n")},
+	}
+	aliases := map[string]string{"apply": "do", "revert": "undo", "check": "test"}
+	migs, err := getMigrations(Config{FS: fsys, MigrationPattern: "sql/*.sql", ActionAliases: aliases})
+	if err != nil {
+		t.Fatalf("getMigrations failed: %v", err)
+	}
+	got := map[string]string{}
+	for _, m := range migs {
+		got[path.Base(m.Filename)] = m.Action
+	}
+	expected := map[string]string{
+		"001.apply.users.sql":  "do",
+		"001.revert.users.sql": "undo",
+		"001.check.users.sql":  "test",
+		"002.up.posts.sql":     "do",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected actions %v, got %v", expected, got)
+	}
+
+	aliases["apply"] = "run"
+	if _, err := getMigrations(Config{FS: fsys, MigrationPattern: "sql/*.sql", ActionAliases: aliases}); err == nil || !strings.Contains(err.Error(), "must map to do, undo or test") {
+		t.Errorf("Expected an invalid alias error, got %v", err)
+	}
+}
+
+// TestVersionAt verifies that dates resolve to the latest version stamped at
+// or before them, for Unix and YYYYMMDDHHMMSS versions alike.
+func TestVersionAt(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/1717200000.do.a.sql":       {Data: []byte("SELECT 1;")}, // 2024-06-01T00:00:00Z
+		"sql/1717286400.do.b.sql":       {Data: []byte("SELECT 1;")}, // 2024-06-02T00:00:00Z
+		"sql/20240603120000.do.c.sql":   {Data: []byte("SELECT 1;")},
+		"sql/20240603120000.undo.c.sql": {Data: []byte("SELECT 1;")},
+	}
+	g, err := NewGostgrator(Config{Driver: "sqlite3", FS: fsys, MigrationPattern: "sql/*.sql"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	cases := []struct {
+		at       string
+		expected int
+	}{
+		{"2024-05-31T23:59:59Z", 0},
+		{"2024-06-01T00:00:00Z", 1717200000},
+		{"2024-06-03T11:59:59Z", 1717286400},
+		{"2024-06-03T14:00:00+02:00", 20240603120000},
+	}
+	for _, c := range cases {
+		at, _ := time.Parse(time.RFC3339, c.at)
+		if got, err := g.VersionAt(at); err != nil || got != c.expected {
+			t.Errorf("VersionAt(%s) = %d (%v), expected %d", c.at, got, err, c.expected)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package gostgrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TestResult is the outcome of running one test migration.
+type TestResult struct {
+	// Migration is the test file that ran.
+	Migration Migration
+	// Duration is how long the test took.
+	Duration time.Duration
+	// Err describes the first failed statement or assertion, or is nil if
+	// the test passed.
+	Err error
+}
+
+// RunTests runs the test migrations, files named "001.test.sql" or
+// "001.do.name.test.sql", of every applied version in ascending order. Each
+// runs in its own transaction that is always rolled back, so tests can write
+// fixtures without leaving anything behind.
+//
+// A test fails if a statement errors or returns a row whose first column is
+// false, zero, NULL or a string starting with "not ok", so plain assertions
+// such as "SELECT count(*) = 3 FROM users;" and pgTAP output both work. The
+// returned error is only set if the tests could not be run at all.
+func (g *Gostgrator) RunTests(ctx context.Context) ([]TestResult, error) {
+	migs, err := g.GetMigrations()
+	if err != nil {
+		return nil, err
+	}
+	dbVersion, err := g.GetDatabaseVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sortMigrationsAsc(migs)
+	var results []TestResult
+	for _, m := range migs {
+		if m.Action != "test" || m.Version > dbVersion {
+			continue
+		}
+		start := g.cfg.now()
+		err := g.runTest(ctx, m)
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		results = append(results, TestResult{Migration: m, Duration: g.cfg.now().Sub(start), Err: err})
+	}
+	return results, nil
+}
+
+// errRollbackTest ends every test transaction after the test has passed.
+var errRollbackTest = errors.New("rolling back test")
+
+// runTest runs the statements of test migration m in a transaction that is
+// rolled back afterwards.
+func (g *Gostgrator) runTest(ctx context.Context, m Migration) error {
+	script, err := g.sql(m)
+	if err != nil {
+		return err
+	}
+	err = g.inTransaction(ctx, func(tg *Gostgrator) error {
+		for _, stmt := range g.statements(m, script) {
+			if err := tg.assertStatement(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return errRollbackTest
+	})
+	if errors.Is(err, errRollbackTest) {
+		return nil
+	}
+	return err
+}
+
+// assertStatement runs stmt and checks the first column of every row it
+// returns.
+func (g *Gostgrator) assertStatement(ctx context.Context, stmt string) error {
+	rows, err := g.client.QueryContext(ctx, stmt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", summarizeStatement(stmt), err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		// SQLite drivers only run a statement as its rows are read, so a
+		// fixture INSERT must still be stepped through.
+		for rows.Next() {
+		}
+		return redactError(rows.Err())
+	}
+	values := make([]any, len(columns))
+	for i := range values {
+		values[i] = new(any)
+	}
+	for rows.Next() {
+		if err := rows.Scan(values...); err != nil {
+			return err
+		}
+		if err := checkAssertion(*values[0].(*any)); err != nil {
+			return fmt.Errorf("%s: %w", summarizeStatement(stmt), err)
+		}
+	}
+	return redactError(rows.Err())
+}
+
+// checkAssertion reports an error if v, the first column of a row returned
+// by a test, signals a failure.
+func checkAssertion(v any) error {
+	switch t := v.(type) {
+	case nil:
+		return errors.New("assertion returned NULL")
+	case bool:
+		if !t {
+			return errors.New("assertion returned false")
+		}
+	case int64:
+		if t == 0 {
+			return errors.New("assertion returned 0")
+		}
+	case float64:
+		if t == 0 {
+			return errors.New("assertion returned 0")
+		}
+	case []byte:
+		return checkAssertion(string(t))
+	case string:
+		if strings.HasPrefix(strings.TrimSpace(t), "not ok") {
+			return errors.New(strings.TrimSpace(t))
+		}
+	}
+	return nil
+}
+
+// summarizeStatement shortens stmt to its first line for error messages.
+func summarizeStatement(stmt string) string {
+	stmt = strings.TrimSpace(stripComments(stmt))
+	line, _, cut := strings.Cut(stmt, "\n")
+	if cut || len(line) > 60 {
+		line = strings.TrimSpace(line)
+		if len(line) > 60 {
+			line = line[:60]
+		}
+		line += "..."
+	}
+	return line
+}
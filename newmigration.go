@@ -7,13 +7,25 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"time"
 )
 
-// CreateMigration creates a new pair of migration files (do/undo).
+// CreateMigration creates a new pair of migration files (do/undo, or up/down
+// as set by cfg.FilenameStyle).
 // description: a human-readable description that will be kebab-cased for the filename.
 // mode: "int" for integer increment (default) or "timestamp" to use the Unix timestamp.
 func CreateMigration(cfg Config, description string, mode string) error {
+	// Filenames are version, action and description joined as in layout.
+	layout, doAction, undoAction := "%s.%s.%s.sql", "do", "undo"
+	switch cfg.FilenameStyle {
+	case "", "do-undo":
+	case "up-down":
+		doAction, undoAction = "up", "down"
+	case "golang-migrate":
+		layout, doAction, undoAction = "%[1]s_%[3]s.%[2]s.sql", "up", "down"
+	default:
+		return fmt.Errorf("unknown filename style %q: use \"do-undo\", \"up-down\" or \"golang-migrate\"", cfg.FilenameStyle)
+	}
+
 	// Determine the migration folder from the migration pattern.
 	migFolder := filepath.Dir(cfg.MigrationPattern)
 
@@ -24,7 +36,7 @@ func CreateMigration(cfg Config, description string, mode string) error {
 		return fmt.Errorf("failed to scan migration files: %w", err)
 	}
 	if strings.ToLower(mode) == "timestamp" {
-		nextNumber = strconv.FormatInt(time.Now().Unix(), 10)
+		nextNumber = strconv.FormatInt(cfg.now().Unix(), 10)
 	} else {
 		// Default: integer mode with triple zero-padding.
 		max := 0
@@ -34,8 +46,9 @@ func CreateMigration(cfg Config, description string, mode string) error {
 			if len(parts) < 2 {
 				continue
 			}
-			// Parse without padding.
-			num, err := strconv.Atoi(parts[0])
+			// Parse without padding, or the "_name" of golang-migrate files.
+			digits, _, _ := strings.Cut(parts[0], "_")
+			num, err := strconv.Atoi(digits)
 			if err != nil {
 				continue
 			}
@@ -51,8 +64,14 @@ func CreateMigration(cfg Config, description string, mode string) error {
 	kebabDesc := kebabCase(description)
 
 	// Build file names.
-	doFilename := fmt.Sprintf("%s.do.%s.sql", nextNumber, kebabDesc)
-	undoFilename := fmt.Sprintf("%s.undo.%s.sql", nextNumber, kebabDesc)
+	doFilename := fmt.Sprintf(layout, nextNumber, doAction, kebabDesc)
+	undoFilename := fmt.Sprintf(layout, nextNumber, undoAction, kebabDesc)
+
+	for _, name := range []string{doFilename, undoFilename} {
+		if err := CheckFilename(cfg, name); err != nil {
+			return err
+		}
+	}
 
 	// Build full file paths.
 	doFilePath := filepath.Join(migFolder, doFilename)
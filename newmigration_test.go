@@ -72,9 +72,12 @@ func TestCreateMigrationTimestampMode(t *testing.T) {
 	}
 	defer os.RemoveAll(tmpDir)
 
-	// Create a configuration with the migration pattern pointing to our temp dir.
+	// Create a configuration with the migration pattern pointing to our temp
+	// dir and a fixed clock.
+	fixed := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
 	cfg := Config{
 		MigrationPattern: filepath.Join(tmpDir, "*.sql"),
+		Clock:            ClockFunc(func() time.Time { return fixed }),
 	}
 
 	description := "Fix bug"
@@ -118,9 +121,9 @@ func TestCreateMigrationTimestampMode(t *testing.T) {
 	if err != nil {
 		t.Errorf("expected timestamp number, got %s", timestampStr)
 	}
-	// Ensure the timestamp is within a reasonable range (e.g. within the last minute).
-	if time.Since(time.Unix(timestamp, 0)) > time.Minute {
-		t.Errorf("timestamp %d seems too old", timestamp)
+	// Ensure the timestamp comes from the configured clock.
+	if timestamp != fixed.Unix() {
+		t.Errorf("expected timestamp %d from the clock, got %d", fixed.Unix(), timestamp)
 	}
 
 	// Check file contents.
@@ -140,3 +143,47 @@ func TestCreateMigrationTimestampMode(t *testing.T) {
 		t.Errorf("undo file content not as expected: %s", string(undoContent))
 	}
 }
+
+// TestCreateMigrationUpDownStyle verifies that FilenameStyle "up-down" names
+// the pair up and down, that the files load as do and undo, and that unknown
+// styles are rejected.
+func TestCreateMigrationUpDownStyle(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		MigrationPattern: filepath.Join(tmpDir, "*.sql"),
+		FilenameStyle:    "up-down",
+		FilenamePolicy:   "kebab-case",
+	}
+	if err := CreateMigration(cfg, "Add users", "int"); err != nil {
+		t.Fatalf("CreateMigration failed: %v", err)
+	}
+	for _, name := range []string{"001.up.add-users.sql", "001.down.add-users.sql"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		}
+	}
+	migs, err := getMigrations(cfg)
+	if err != nil {
+		t.Fatalf("getMigrations failed: %v", err)
+	}
+	actions := map[string]string{}
+	for _, m := range migs {
+		actions[filepath.Base(m.Filename)] = m.Action
+	}
+	if actions["001.up.add-users.sql"] != "do" || actions["001.down.add-users.sql"] != "undo" {
+		t.Errorf("expected up and down to load as do and undo, got %v", actions)
+	}
+
+	cfg.FilenameStyle, cfg.FilenamePolicy = "golang-migrate", ""
+	if err := CreateMigration(cfg, "Add posts", "int"); err != nil {
+		t.Fatalf("CreateMigration failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "002_add-posts.up.sql")); err != nil {
+		t.Errorf("expected a golang-migrate up file: %v", err)
+	}
+
+	cfg.FilenameStyle = "forward-back"
+	if err := CreateMigration(cfg, "Other", "int"); err == nil || !strings.Contains(err.Error(), "unknown filename style") {
+		t.Errorf("expected an unknown filename style error, got %v", err)
+	}
+}
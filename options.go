@@ -0,0 +1,93 @@
+package gostgrator
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+)
+
+// Option configures a Gostgrator created with New.
+type Option func(*options)
+
+// options collects the settings applied by Options.
+type options struct {
+	cfg    Config
+	fs     fs.FS
+	logger *slog.Logger
+	hooks  Hooks
+	locker Locker
+}
+
+// WithConfig sets the Config, as passed to NewGostgrator.
+func WithConfig(cfg Config) Option {
+	return func(o *options) { o.cfg = cfg }
+}
+
+// WithLogger logs each migration that runs, and each that fails, to logger.
+// Without it nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// WithFS reads migrations from fsys, overriding Config.FS whichever order
+// the options are given in.
+func WithFS(fsys fs.FS) Option {
+	return func(o *options) { o.fs = fsys }
+}
+
+// WithHooks calls hooks around every migration that runs.
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) { o.hooks = hooks }
+}
+
+// WithLock replaces the row in <schemaTable>_lock that Migrate, Down and
+// Lock take by default with locker, e.g. an external lock service shared by
+// several databases.
+func WithLock(locker Locker) Option {
+	return func(o *options) { o.locker = locker }
+}
+
+// Hooks are called around each migration Migrate, Down, Reset or
+// RunMigrations runs. With Config.Transaction "each" or "all" they run inside
+// its transaction. Either may be nil.
+type Hooks struct {
+	// BeforeMigration is called before m runs. An error stops the run
+	// before m, as a failing migration would.
+	BeforeMigration func(ctx context.Context, m Migration) error
+	// AfterMigration is called after m ran, with its run time in m.Duration
+	// and the error it failed with, if any.
+	AfterMigration func(ctx context.Context, m Migration, err error)
+}
+
+// Locker is a migration lock that keeps two processes from migrating the
+// same database at once. Lock should fail with an error wrapping ErrLocked
+// when another process holds it.
+type Locker interface {
+	Lock(ctx context.Context) error
+	Unlock(ctx context.Context) error
+}
+
+// observe runs m with run, calling the hooks around it and logging the
+// outcome.
+func (g *Gostgrator) observe(ctx context.Context, m *Migration, run func() (bool, error)) (bool, error) {
+	if g.hooks.BeforeMigration != nil {
+		if err := g.hooks.BeforeMigration(ctx, *m); err != nil {
+			return false, err
+		}
+	}
+	stopMonitor := g.startLockWaitMonitor(ctx, *m)
+	stopWarning := g.startSlowWarning(ctx, *m)
+	recorded, err := run()
+	stopWarning()
+	stopMonitor()
+	if g.hooks.AfterMigration != nil {
+		g.hooks.AfterMigration(ctx, *m, err)
+	}
+	attrs := []any{"version", m.Version, "action", m.Action, "name", m.Name, "duration", m.Duration}
+	if err != nil {
+		g.logger.ErrorContext(ctx, "migration failed", append(attrs, "error", err)...)
+	} else if recorded {
+		g.logger.InfoContext(ctx, "migration applied", attrs...)
+	}
+	return recorded, err
+}
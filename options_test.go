@@ -0,0 +1,96 @@
+package gostgrator
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// countingLocker records how often it is taken and released.
+type countingLocker struct {
+	locks, unlocks int
+	err            error
+}
+
+func (l *countingLocker) Lock(ctx context.Context) error {
+	if l.err != nil {
+		return l.err
+	}
+	l.locks++
+	return nil
+}
+
+func (l *countingLocker) Unlock(ctx context.Context) error {
+	l.unlocks++
+	return nil
+}
+
+// TestNewOptions verifies that the options of New reach Migrate: migrations
+// come from the FS, hooks and the logger see each one and the Locker
+// replaces the lock table.
+func TestNewOptions(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "options.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	var logs bytes.Buffer
+	var before, after []int
+	locker := &countingLocker{}
+	g, err := New(db,
+		WithFS(os.DirFS(filepath.Dir(writeTransactionMigrations(t)))),
+		WithConfig(Config{Driver: "sqlite3", MigrationPattern: "*.sql"}),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+		WithHooks(Hooks{
+			BeforeMigration: func(ctx context.Context, m Migration) error {
+				before = append(before, m.Version)
+				return nil
+			},
+			AfterMigration: func(ctx context.Context, m Migration, err error) {
+				after = append(after, m.Version)
+			},
+		}),
+		WithLock(locker),
+	)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if len(before) != 2 || len(after) != 2 || after[1] != 2 {
+		t.Errorf("expected hooks around both migrations, got before %v and after %v", before, after)
+	}
+	if strings.Count(logs.String(), "migration applied") != 2 {
+		t.Errorf("expected both migrations to be logged:\n%s", logs.String())
+	}
+	if locker.locks != 1 || locker.unlocks != 1 {
+		t.Errorf("expected the Locker to be taken once, got %d locks and %d unlocks", locker.locks, locker.unlocks)
+	}
+	if tableExists(t, db, "schemaversion_lock") {
+		t.Error("expected no lock table with a Locker")
+	}
+
+	stop := errors.New("not now")
+	g, err = New(db, WithConfig(Config{Driver: "sqlite3", MigrationPattern: "*.sql"}), WithFS(g.cfg.FS), WithHooks(Hooks{
+		BeforeMigration: func(ctx context.Context, m Migration) error { return stop },
+	}))
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "0"); !errors.Is(err, stop) {
+		t.Errorf("expected BeforeMigration to stop the run, got %v", err)
+	}
+	locker.err = ErrLocked
+	g, _ = New(db, WithConfig(Config{Driver: "sqlite3", MigrationPattern: "*.sql"}), WithFS(g.cfg.FS), WithLock(locker))
+	if _, err := g.Migrate(ctx, "0"); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected the Locker's error, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bcomnes/gostgrator/pgopen"
+	"github.com/jackc/pgx/v5"
+)
+
+// sslFiles holds the client certificate flags applied to every connection.
+type sslFiles struct {
+	cert     string
+	key      string
+	rootCert string
+}
+
+// connSSL is set from the -sslcert, -sslkey and -sslrootcert flags.
+var connSSL sslFiles
+
+// connAuth is set from -aws-iam-auth or -gcp-iam-auth to supply a fresh
+// token as the password of every new connection.
+var connAuth func(context.Context, *pgx.ConnConfig) error
+
+// connKeepalive is set from -keepalive as the TCP keepalive interval of
+// every connection.
+var connKeepalive time.Duration
+
+// connOptions returns the pgopen options for the -ssh, -keepalive and IAM
+// auth flags.
+func connOptions() pgopen.Options {
+	opts := connSSH.options()
+	opts.BeforeConnect = connAuth
+	opts.KeepAlive = connKeepalive
+	return opts
+}
+
+// buildConn applies the SSL certificate flags to conn. A bare absolute path is
+// treated as the directory holding the server's Unix socket, e.g.
+// "/var/run/postgresql". Both URL ("postgres://…") and keyword/value
+// ("host=/var/run/postgresql dbname=app") connection strings are accepted.
+func buildConn(conn string, ssl sslFiles) (string, error) {
+	if strings.HasPrefix(conn, "/") {
+		conn = "host=" + quoteConnValue(conn)
+	}
+	params := [][2]string{
+		{"sslcert", ssl.cert},
+		{"sslkey", ssl.key},
+		{"sslrootcert", ssl.rootCert},
+	}
+
+	if strings.HasPrefix(conn, "postgres://") || strings.HasPrefix(conn, "postgresql://") {
+		u, err := url.Parse(conn)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		for _, p := range params {
+			if p[1] != "" {
+				q.Set(p[0], p[1])
+			}
+		}
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+
+	for _, p := range params {
+		if p[1] != "" {
+			conn += " " + p[0] + "=" + quoteConnValue(p[1])
+		}
+	}
+	return strings.TrimSpace(conn), nil
+}
+
+// quoteConnValue quotes a keyword/value connection string value, escaping
+// backslashes and single quotes.
+func quoteConnValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
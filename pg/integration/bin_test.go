@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bcomnes/gostgrator/gostgratortest"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
@@ -18,19 +20,25 @@ var cliBinary string
 
 // Global variables for test database and migration files.
 var (
-	testDBName  = "gostgrator_cli_test"
-	testSchema  = "gostgrator_schema"
-	// Base connection string for DSN-based connections used in TestMain.
-	baseConnStr = "host=localhost port=5432 user=postgres sslmode=disable"
+	testDBName = "gostgrator_cli_test"
+	testSchema = "gostgrator_schema"
+	// pgServer is the Postgres server the tests run against.
+	pgServer *gostgratortest.Postgres
 	// testMigrationsPath: relative path from the integration test package to the test migration files.
 	testMigrationsPath = "../../testdata/migrations/*.sql"
 )
 
-// TestMain sets up the test database (using DSN style) and builds the CLI binary before running tests,
+// TestMain sets up the test database and builds the CLI binary before running tests,
 // then cleans up afterward.
 func TestMain(m *testing.M) {
 	// === Set up Test Database ===
-	defaultConn := baseConnStr + " dbname=postgres"
+	var err error
+	pgServer, err = gostgratortest.StartPostgres(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start postgres: %v\n", err)
+		os.Exit(1)
+	}
+	defaultConn := pgServer.URL("postgres")
 	db, err := sql.Open("pgx", defaultConn)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to connect to postgres: %v\n", err)
@@ -54,7 +62,7 @@ func TestMain(m *testing.M) {
 	time.Sleep(1 * time.Second)
 
 	// Connect to the newly created test database.
-	testDBConnStr := baseConnStr + " dbname=" + testDBName
+	testDBConnStr := pgServer.URL(testDBName)
 	testDB, err := sql.Open("pgx", testDBConnStr)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to connect to test database: %v\n", err)
@@ -101,6 +109,9 @@ func TestMain(m *testing.M) {
 	}
 
 	os.Remove(cliBinary)
+	if err := pgServer.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to stop postgres: %v\n", err)
+	}
 	os.Exit(code)
 }
 
@@ -113,10 +124,10 @@ func helperRun(args []string, extraEnv ...string) (string, error) {
 }
 
 // makeTestConnURL constructs a URL-style DSN, for example:
-//   postgres://postgres@localhost:5432/gostgrator_cli_test?sslmode=disable&search_path=gostgrator_schema
+//
+//	postgres://postgres@localhost:5432/gostgrator_cli_test?sslmode=disable&search_path=gostgrator_schema
 func makeTestConnURL() string {
-	testConnURL := fmt.Sprintf("postgres://postgres@localhost:5432/%s?sslmode=disable", testDBName)
-	return testConnURL + "&search_path=" + testSchema
+	return pgServer.URL(testDBName) + "&search_path=" + testSchema
 }
 
 // tableExists returns true if the given table name exists in the current search_path.
@@ -230,6 +241,25 @@ func TestCLIDropSchema(t *testing.T) {
 	}
 }
 
+// TestCLIDropSchemaIfExists checks that -if-exists makes drop-schema succeed
+// after TestCLIDropSchema already removed the table.
+func TestCLIDropSchemaIfExists(t *testing.T) {
+	connArg := makeTestConnURL()
+	env := fmt.Sprintf("DATABASE_URL=%s", connArg)
+	args := []string{
+		"-conn", connArg,
+		"-if-exists", "-cascade",
+		"drop-schema",
+	}
+	out, err := helperRun(args, env)
+	if err != nil {
+		t.Fatalf("CLI drop-schema -if-exists command failed: %v; output: %s", err, out)
+	}
+	if !strings.Contains(out, "Schema table dropped.") {
+		t.Errorf("expected schema table dropped message, got:\n%s", out)
+	}
+}
+
 // TestCLINew tests the "new" command which creates migration files.
 // For "new", we use a dummy connection since a live DB is not needed.
 func TestCLINew(t *testing.T) {
@@ -240,9 +270,9 @@ func TestCLINew(t *testing.T) {
 	defer os.RemoveAll(tmpDir)
 
 	cfg := map[string]interface{}{
-		"MigrationPattern": filepath.Join(tmpDir, "*.sql"),
-		"Driver":           "pg",
-		"SchemaTable":      "schemaversion",
+		"MigrationPattern":  filepath.Join(tmpDir, "*.sql"),
+		"Driver":            "pg",
+		"SchemaTable":       "schemaversion",
 		"ValidateChecksums": true,
 	}
 	cfgPath := filepath.Join(tmpDir, "config.json")
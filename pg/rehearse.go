@@ -0,0 +1,117 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+	"github.com/bcomnes/gostgrator/clitool"
+	"github.com/bcomnes/gostgrator/pgopen"
+	"github.com/jackc/pgx/v5"
+)
+
+// rehearsalAdminDB is the maintenance database rehearse connects to while it
+// creates and drops the copy, since Postgres cannot copy a database with
+// open connections.
+const rehearsalAdminDB = "postgres"
+
+// runRehearse copies the database connStr points at, or template when set,
+// to a temporary database, migrates the copy to target and drops it,
+// reporting the migrations and their run times as migrate does. The real
+// database is not changed; it returns an error when the rehearsal fails.
+func runRehearse(cliConfig gostgrator.Config, connStr, template, target string) error {
+	timeout := flag.Lookup("timeout").Value.(flag.Getter).Get().(time.Duration)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	parsed, err := pgx.ParseConfig(connStr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error parsing connection URL: %v\n", err)
+		return err
+	}
+	source := cmp.Or(template, parsed.Database)
+	rehearsal := fmt.Sprintf("%s_rehearse_%d", parsed.Database, time.Now().Unix())
+
+	adminConn, err := withDatabase(connStr, rehearsalAdminDB)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error parsing connection URL: %v\n", err)
+		return err
+	}
+	admin, err := pgopen.Open(adminConn, connOptions())
+	if err != nil {
+		fmt.Fprintf(stderr, "Error opening database: %v\n", err)
+		return err
+	}
+	defer admin.Close()
+
+	fmt.Fprintf(stdout, "[%s] Copying %s to %s for a rehearsal...\n", time.Now().Format(time.Kitchen), source, rehearsal)
+	create := fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", pgx.Identifier{rehearsal}.Sanitize(), pgx.Identifier{source}.Sanitize())
+	if _, err := admin.ExecContext(ctx, create); err != nil {
+		fmt.Fprintf(stderr, "Error copying %s: %v\n", source, err)
+		fmt.Fprintln(stderr, "A database can only be copied while nothing else is connected to it; pass -template with a snapshot of it instead.")
+		return err
+	}
+	defer func() {
+		drop := "DROP DATABASE IF EXISTS " + pgx.Identifier{rehearsal}.Sanitize()
+		if _, err := admin.ExecContext(context.WithoutCancel(ctx), drop); err != nil {
+			fmt.Fprintf(stderr, "Error dropping rehearsal database %s: %v\n", rehearsal, err)
+			return
+		}
+		fmt.Fprintf(stdout, "[%s] Dropped %s.\n", time.Now().Format(time.Kitchen), rehearsal)
+	}()
+
+	rehearsalConn, err := withDatabase(connStr, rehearsal)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error parsing connection URL: %v\n", err)
+		return err
+	}
+	db, err := pgopen.Open(rehearsalConn, connOptions())
+	if err != nil {
+		fmt.Fprintf(stderr, "Error opening database: %v\n", err)
+		return err
+	}
+	defer db.Close()
+
+	// The rehearsal should not notify anyone or overwrite schema docs.
+	cliConfig.WebhookURL = ""
+	emitSchema := flag.Lookup("emit-schema").Value
+	savedSchemaPath := emitSchema.String()
+	emitSchema.Set("")
+	defer emitSchema.Set(savedSchemaPath)
+
+	g, err := gostgrator.NewGostgrator(cliConfig, db)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error initializing gostgrator: %v\n", err)
+		return err
+	}
+	if err := clitool.Migrate(g, ctx, target); err != nil && !errors.Is(err, clitool.ErrMorePending) {
+		fmt.Fprintf(stderr, "Rehearsal failed; %s was not changed.\n", parsed.Database)
+		return err
+	}
+	fmt.Fprintf(stdout, "[%s] Rehearsal succeeded.\n", time.Now().Format(time.Kitchen))
+	return nil
+}
+
+// withDatabase returns conn with its database replaced by name.
+func withDatabase(conn, name string) (string, error) {
+	if strings.HasPrefix(conn, "postgres://") || strings.HasPrefix(conn, "postgresql://") {
+		u, err := url.Parse(conn)
+		if err != nil {
+			return "", err
+		}
+		u.Path = "/" + name
+		q := u.Query()
+		if q.Has("dbname") {
+			q.Set("dbname", name)
+			u.RawQuery = q.Encode()
+		}
+		return u.String(), nil
+	}
+	return strings.TrimSpace(conn + " dbname=" + quoteConnValue(name)), nil
+}
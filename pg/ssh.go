@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bcomnes/gostgrator/pgopen"
+	"github.com/jackc/pgx/v5"
+)
+
+// sshTunnel holds the -ssh and -ssh-key flags applied to every connection.
+type sshTunnel struct {
+	dest  string // user@host[:port] of the jump host
+	key   string
+	batch bool // never prompt for passwords or host key confirmation
+}
+
+// connSSH is set from the -ssh, -ssh-key and -non-interactive flags.
+var connSSH sshTunnel
+
+// sshCommand is the ssh client started for each tunneled connection.
+var sshCommand = "ssh"
+
+// options returns the pgopen options that route connections through the
+// tunnel, or no options when no jump host is configured.
+func (t sshTunnel) options() pgopen.Options {
+	if t.dest == "" {
+		return pgopen.Options{}
+	}
+	return pgopen.Options{
+		DialFunc: t.dial,
+		// Leave host names for the jump host to resolve, since private
+		// database hosts are often not in local DNS.
+		Configure: func(cfg *pgx.ConnConfig) error {
+			cfg.LookupFunc = func(_ context.Context, host string) ([]string, error) {
+				return []string{host}, nil
+			}
+			return nil
+		},
+	}
+}
+
+// args returns the ssh arguments that forward stdin and stdout to addr, the
+// database address as seen from the jump host.
+func (t sshTunnel) args(addr string) ([]string, error) {
+	user, hostPort, ok := strings.Cut(t.dest, "@")
+	if !ok {
+		user, hostPort = "", t.dest
+	}
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host, port = hostPort, ""
+	}
+	if host == "" || strings.HasPrefix(host, "-") || ok && user == "" {
+		return nil, fmt.Errorf("invalid -ssh destination %q, expected user@host[:port]", t.dest)
+	}
+
+	args := []string{"-W", addr, "-o", "ExitOnForwardFailure=yes"}
+	if t.batch {
+		args = append(args, "-o", "BatchMode=yes")
+	}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	if t.key != "" {
+		args = append(args, "-i", t.key, "-o", "IdentitiesOnly=yes")
+	}
+	if user != "" {
+		host = user + "@" + host
+	}
+	return append(args, "--", host), nil
+}
+
+// dial starts an ssh client that forwards its stdin and stdout to addr and
+// returns a connection over those pipes. Each connection gets its own ssh
+// process; ssh reports authentication failures on stderr.
+func (t sshTunnel) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" {
+		return nil, fmt.Errorf("ssh tunnels only support TCP connections, not %s", network)
+	}
+	args, err := t.args(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, err
+	}
+	cmd := exec.Command(sshCommand, args...)
+	cmd.Stdin = inR
+	cmd.Stdout = outW
+	cmd.Stderr = stderr
+	err = cmd.Start()
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		return nil, fmt.Errorf("starting ssh tunnel: %w", err)
+	}
+	return &sshConn{cmd: cmd, r: outR, w: inW, local: sshAddr(t.dest), remote: sshAddr(addr)}, nil
+}
+
+// sshConn is a net.Conn over the stdin and stdout of an ssh -W process.
+type sshConn struct {
+	cmd    *exec.Cmd
+	r      *os.File
+	w      *os.File
+	local  sshAddr
+	remote sshAddr
+}
+
+func (c *sshConn) Read(p []byte) (int, error)  { return c.r.Read(p) }
+func (c *sshConn) Write(p []byte) (int, error) { return c.w.Write(p) }
+func (c *sshConn) LocalAddr() net.Addr         { return c.local }
+func (c *sshConn) RemoteAddr() net.Addr        { return c.remote }
+
+func (c *sshConn) SetDeadline(t time.Time) error {
+	return errors.Join(c.r.SetReadDeadline(t), c.w.SetWriteDeadline(t))
+}
+
+func (c *sshConn) SetReadDeadline(t time.Time) error  { return c.r.SetReadDeadline(t) }
+func (c *sshConn) SetWriteDeadline(t time.Time) error { return c.w.SetWriteDeadline(t) }
+
+// Close closes the pipes and stops the ssh process.
+func (c *sshConn) Close() error {
+	err := errors.Join(c.w.Close(), c.r.Close())
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	return err
+}
+
+// sshAddr is a tunnel endpoint as passed to ssh.
+type sshAddr string
+
+func (a sshAddr) Network() string { return "ssh" }
+func (a sshAddr) String() string  { return string(a) }
@@ -0,0 +1,225 @@
+package pgopen
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AWSCredentials are the keys used to sign RDS IAM authentication tokens.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// AWSCredentialsFromEnv reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN. Other credential sources, such as profiles or instance
+// roles, can be exported first with "aws configure export-credentials".
+func AWSCredentialsFromEnv() (AWSCredentials, error) {
+	creds := AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return AWSCredentials{}, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set for IAM authentication")
+	}
+	return creds, nil
+}
+
+// rdsTokenExpiry is how long an RDS IAM authentication token is valid.
+const rdsTokenExpiry = 15 * time.Minute
+
+// RDSIAMAuth returns a BeforeConnect hook that replaces the password with an
+// RDS IAM authentication token for the connection's host, port and user,
+// signed with credentials from the environment. An empty region is taken
+// from AWS_REGION, AWS_DEFAULT_REGION or the RDS endpoint name. A fresh token
+// is generated for every connection, so none outlives its 15 minutes.
+func RDSIAMAuth(region string) func(context.Context, *pgx.ConnConfig) error {
+	return func(_ context.Context, cfg *pgx.ConnConfig) error {
+		creds, err := AWSCredentialsFromEnv()
+		if err != nil {
+			return err
+		}
+		region := cmp.Or(region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), rdsRegion(cfg.Host))
+		if region == "" {
+			return fmt.Errorf("cannot determine the AWS region of %s; set AWS_REGION", cfg.Host)
+		}
+		endpoint := net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port)))
+		cfg.Password, err = RDSAuthToken(endpoint, region, cfg.User, creds, time.Now())
+		return err
+	}
+}
+
+// RDSAuthToken returns an RDS IAM authentication token, a SigV4 presigned
+// connect request for user on endpoint (host:port), valid for 15 minutes
+// from now.
+func RDSAuthToken(endpoint, region, user string, creds AWSCredentials, now time.Time) (string, error) {
+	if endpoint == "" || region == "" || user == "" {
+		return "", errors.New("endpoint, region and user are required for an RDS auth token")
+	}
+	now = now.UTC()
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	scope := date + "/" + region + "/rds-db/aws4_request"
+
+	params := map[string]string{
+		"Action":              "connect",
+		"DBUser":              user,
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    creds.AccessKeyID + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       strconv.Itoa(int(rdsTokenExpiry / time.Second)),
+		"X-Amz-SignedHeaders": "host",
+	}
+	if creds.SessionToken != "" {
+		params["X-Amz-Security-Token"] = creds.SessionToken
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	query := make([]string, len(keys))
+	for i, k := range keys {
+		query[i] = sigv4Escape(k) + "=" + sigv4Escape(params[k])
+	}
+	canonicalQuery := strings.Join(query, "&")
+
+	emptyHash := sha256.Sum256(nil)
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		"/",
+		canonicalQuery,
+		"host:" + endpoint + "\n",
+		"host",
+		hex.EncodeToString(emptyHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := sigv4SigningKey(creds.SecretAccessKey, date, region, "rds-db")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	return endpoint + "/?" + canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+// rdsRegion returns the region in an RDS endpoint such as
+// "app.abc123.us-east-1.rds.amazonaws.com", or "" for other hosts.
+func rdsRegion(host string) string {
+	parts := strings.Split(host, ".")
+	if len(parts) >= 6 && parts[3] == "rds" {
+		return parts[2]
+	}
+	return ""
+}
+
+// sigv4Escape percent-encodes everything but RFC 3986 unreserved characters.
+func sigv4Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// sigv4SigningKey derives the SigV4 key for a date, region and service.
+func sigv4SigningKey(secret, date, region, service string) []byte {
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return key
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// CloudSQLIAMAuth returns a BeforeConnect hook that replaces the password with
+// a Google OAuth2 access token for Cloud SQL IAM database authentication. The
+// token is read from CLOUDSDK_AUTH_ACCESS_TOKEN when set, for example from
+// "gcloud auth print-access-token", and otherwise fetched from the metadata
+// server of the GCE, GKE or Cloud Run service account. Fetched tokens are
+// reused until shortly before they expire.
+//
+// The user must be the IAM principal's database user, such as the service
+// account email without ".gserviceaccount.com", and the connection must use
+// TLS, e.g. through the Cloud SQL Auth Proxy or with sslmode=require.
+func CloudSQLIAMAuth() func(context.Context, *pgx.ConnConfig) error {
+	var (
+		mu      sync.Mutex
+		token   string
+		expires time.Time
+	)
+	return func(ctx context.Context, cfg *pgx.ConnConfig) error {
+		if t := os.Getenv("CLOUDSDK_AUTH_ACCESS_TOKEN"); t != "" {
+			cfg.Password = t
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if token == "" || time.Until(expires) < time.Minute {
+			var ttl time.Duration
+			var err error
+			if token, ttl, err = metadataAccessToken(ctx); err != nil {
+				return err
+			}
+			expires = time.Now().Add(ttl)
+		}
+		cfg.Password = token
+		return nil
+	}
+}
+
+// metadataAccessToken fetches the default service account's access token
+// from the metadata server, honoring GCE_METADATA_HOST.
+func metadataAccessToken(ctx context.Context) (string, time.Duration, error) {
+	host := cmp.Or(os.Getenv("GCE_METADATA_HOST"), "metadata.google.internal")
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("fetching a Cloud SQL access token from the metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("fetching a Cloud SQL access token from the metadata server: %s", resp.Status)
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", 0, fmt.Errorf("decoding metadata server token: %w", err)
+	}
+	if body.AccessToken == "" {
+		return "", 0, errors.New("metadata server returned an empty access token")
+	}
+	return body.AccessToken, time.Duration(body.ExpiresIn) * time.Second, nil
+}
@@ -0,0 +1,136 @@
+package pgopen
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TestSigV4SigningKey checks key derivation against the example in the AWS
+// Signature Version 4 documentation.
+func TestSigV4SigningKey(t *testing.T) {
+	key := sigv4SigningKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	expected := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if got := hex.EncodeToString(key); got != expected {
+		t.Errorf("signing key = %s, expected %s", got, expected)
+	}
+}
+
+// TestRDSAuthToken checks the token is a presigned connect request for the
+// endpoint and user.
+func TestRDSAuthToken(t *testing.T) {
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "session/token+="}
+	now := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	token, err := RDSAuthToken("app.abc123.us-east-1.rds.amazonaws.com:5432", "us-east-1", "migrator", creds, now)
+	if err != nil {
+		t.Fatalf("RDSAuthToken: %v", err)
+	}
+	endpoint, rawQuery, ok := strings.Cut(token, "/?")
+	if !ok || endpoint != "app.abc123.us-east-1.rds.amazonaws.com:5432" {
+		t.Fatalf("unexpected token %q", token)
+	}
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		t.Fatalf("token query: %v", err)
+	}
+	for k, v := range map[string]string{
+		"Action":               "connect",
+		"DBUser":               "migrator",
+		"X-Amz-Algorithm":      "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":     "AKIDEXAMPLE/20240301/us-east-1/rds-db/aws4_request",
+		"X-Amz-Date":           "20240301T123000Z",
+		"X-Amz-Expires":        "900",
+		"X-Amz-Security-Token": "session/token+=",
+		"X-Amz-SignedHeaders":  "host",
+	} {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, expected %q", k, q.Get(k), v)
+		}
+	}
+	if len(q.Get("X-Amz-Signature")) != 64 {
+		t.Errorf("expected a hex SHA-256 signature, got %q", q.Get("X-Amz-Signature"))
+	}
+	if strings.Contains(rawQuery, "session/token") {
+		t.Error("expected the session token to be percent-encoded")
+	}
+
+	again, _ := RDSAuthToken("app.abc123.us-east-1.rds.amazonaws.com:5432", "us-east-1", "migrator", creds, now)
+	if again != token {
+		t.Error("expected the same inputs to produce the same token")
+	}
+}
+
+// TestRDSIAMAuth checks the hook sets the password and finds the region in
+// the endpoint name.
+func TestRDSIAMAuth(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+
+	cfg := &pgx.ConnConfig{}
+	cfg.Host, cfg.Port, cfg.User = "app.abc123.eu-west-2.rds.amazonaws.com", 5432, "migrator"
+	if err := RDSIAMAuth("")(context.Background(), cfg); err != nil {
+		t.Fatalf("RDSIAMAuth: %v", err)
+	}
+	if !strings.Contains(cfg.Password, "%2Feu-west-2%2Frds-db%2F") {
+		t.Errorf("expected a token for eu-west-2, got %q", cfg.Password)
+	}
+
+	cfg.Host = "db.internal"
+	if err := RDSIAMAuth("")(context.Background(), cfg); err == nil {
+		t.Error("expected an error when the region is unknown")
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	if err := RDSIAMAuth("us-east-1")(context.Background(), cfg); err == nil {
+		t.Error("expected an error without credentials")
+	}
+}
+
+// TestCloudSQLIAMAuth checks tokens come from the metadata server and are
+// reused until they expire.
+func TestCloudSQLIAMAuth(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing Metadata-Flavor", http.StatusForbidden)
+			return
+		}
+		n := requests.Add(1)
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":3599,"token_type":"Bearer"}`, n)
+	}))
+	defer srv.Close()
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+	t.Setenv("CLOUDSDK_AUTH_ACCESS_TOKEN", "")
+
+	auth := CloudSQLIAMAuth()
+	for range 2 {
+		cfg := &pgx.ConnConfig{}
+		if err := auth(context.Background(), cfg); err != nil {
+			t.Fatalf("CloudSQLIAMAuth: %v", err)
+		}
+		if cfg.Password != "token-1" {
+			t.Errorf("password = %q, expected token-1", cfg.Password)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected the token to be fetched once, got %d requests", n)
+	}
+
+	t.Setenv("CLOUDSDK_AUTH_ACCESS_TOKEN", "from-gcloud")
+	cfg := &pgx.ConnConfig{}
+	if err := auth(context.Background(), cfg); err != nil || cfg.Password != "from-gcloud" {
+		t.Errorf("expected CLOUDSDK_AUTH_ACCESS_TOKEN to win, got %q (%v)", cfg.Password, err)
+	}
+}
@@ -0,0 +1,84 @@
+// Package pgopen opens PostgreSQL databases for gostgrator with pgx, letting
+// callers inject a prebuilt TLS configuration, a custom dialer or any other
+// pgx setting instead of encoding everything in the connection string or
+// PG* environment variables. Use it for corporate mTLS setups or to reach a
+// database through a bastion or SSH tunnel:
+//
+//	db, err := pgopen.Open(conn, pgopen.Options{
+//	    TLSConfig: tlsConfig,
+//	    DialFunc:  tunnel.DialContext,
+//	})
+//	g, err := gostgrator.NewGostgrator(gostgrator.Config{Driver: "pg"}, db)
+//
+// RDSIAMAuth and CloudSQLIAMAuth supply short-lived IAM tokens as passwords
+// through Options.BeforeConnect. Callers that already have a
+// *pgx.ConnConfig can pass it to stdlib.OpenDB directly.
+package pgopen
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Options customizes how Open connects.
+type Options struct {
+	// TLSConfig replaces the TLS settings derived from the connection string.
+	// Fallback configurations, such as the plaintext retry of
+	// sslmode=prefer, are dropped so connections always use it.
+	TLSConfig *tls.Config
+
+	// DialFunc replaces the network dialer, e.g. to connect through an SSH
+	// tunnel or bastion host.
+	DialFunc pgconn.DialFunc
+
+	// KeepAlive, when positive, is the interval of the TCP keepalive probes
+	// sent on idle connections, in place of pgx's default of five minutes,
+	// so load balancers and NAT gateways with shorter idle timeouts keep
+	// long-running migrations connected. It is ignored when DialFunc is set.
+	KeepAlive time.Duration
+
+	// Configure, when set, is called with the parsed configuration after
+	// TLSConfig and DialFunc are applied, for any other adjustment.
+	Configure func(*pgx.ConnConfig) error
+
+	// BeforeConnect, when set, is called before every new connection with a
+	// copy of the configuration, e.g. to set a short-lived password with
+	// RDSIAMAuth or CloudSQLIAMAuth.
+	BeforeConnect func(context.Context, *pgx.ConnConfig) error
+}
+
+// Open parses conn as a pgx connection string, applies opts and returns a
+// *sql.DB for gostgrator.NewGostgrator. pgx masks passwords in parse errors.
+func Open(conn string, opts Options) (*sql.DB, error) {
+	cfg, err := pgx.ParseConfig(conn)
+	if err != nil {
+		return nil, err
+	}
+	if opts.TLSConfig != nil {
+		cfg.TLSConfig = opts.TLSConfig
+		cfg.Fallbacks = nil
+	}
+	if opts.DialFunc != nil {
+		cfg.DialFunc = opts.DialFunc
+	} else if opts.KeepAlive > 0 {
+		dialer := &net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: opts.KeepAlive}
+		cfg.DialFunc = dialer.DialContext
+	}
+	if opts.Configure != nil {
+		if err := opts.Configure(cfg); err != nil {
+			return nil, err
+		}
+	}
+	var dbOpts []stdlib.OptionOpenDB
+	if opts.BeforeConnect != nil {
+		dbOpts = append(dbOpts, stdlib.OptionBeforeConnect(opts.BeforeConnect))
+	}
+	return stdlib.OpenDB(*cfg, dbOpts...), nil
+}
@@ -0,0 +1,220 @@
+package gostgrator
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// RollbackImpact describes an undo migration a rollback would run and what it may affect.
+type RollbackImpact struct {
+	// Migration is the undo migration that would run.
+	Migration Migration
+
+	// Tables lists the tables the undo SQL creates, alters, drops or writes to.
+	Tables []string
+
+	// Dependents lists applied migrations that were applied after the
+	// migration being rolled back and reference one of Tables.
+	Dependents []Migration
+
+	// DataLoss lists the data the undo SQL would destroy, with
+	// Config.CheckDataLoss set.
+	DataLoss []DataLoss
+}
+
+// Plan returns the migrations Migrate would run for target, including the
+// effect of the tag filters, maintenance windows and Config.AllowOutOfOrder,
+// without running them or modifying the database. It ignores
+// Config.MaxApplyPerRun, so after a capped Migrate it lists the migrations
+// still pending.
+func (g *Gostgrator) Plan(ctx context.Context, target string) ([]Migration, error) {
+	runnable, _, err := g.plan(ctx, target)
+	return runnable, err
+}
+
+// VersionAt returns the highest do migration version stamped at or before t,
+// for migrating a database to the schema of a past day. Versions are read as
+// "-mode timestamp" Unix seconds, or as YYYYMMDDHHMMSS when they have 14
+// digits. It returns 0 if no version is that old.
+func (g *Gostgrator) VersionAt(t time.Time) (int, error) {
+	migs, err := g.GetMigrations()
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for _, m := range migs {
+		if m.Action == "do" && m.Version > version && !versionTime(m.Version).After(t) {
+			version = m.Version
+		}
+	}
+	return version, nil
+}
+
+// versionTime returns the time a timestamp version stands for.
+func versionTime(version int) time.Time {
+	if digits := strconv.Itoa(version); len(digits) == 14 {
+		if t, err := time.Parse("20060102150405", digits); err == nil {
+			return t
+		}
+	}
+	return time.Unix(int64(version), 0).UTC()
+}
+
+// Deferred returns the migrations Migrate would leave for a later run for
+// target because the maintenance window of their "window" directive is
+// closed, along with the migrations waiting on them. They are not failures;
+// they run once a Migrate call falls inside the window, or at once with
+// Config.IgnoreWindows.
+func (g *Gostgrator) Deferred(ctx context.Context, target string) ([]Migration, error) {
+	_, deferred, err := g.plan(ctx, target)
+	return deferred, err
+}
+
+// plan returns the migrations Migrate would run for target and those it
+// would defer.
+func (g *Gostgrator) plan(ctx context.Context, target string) ([]Migration, []Migration, error) {
+	if _, err := g.GetMigrations(); err != nil {
+		return nil, nil, err
+	}
+	targetVersion, err := g.resolveTarget(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbVersion, err := g.GetDatabaseVersion(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return g.selectRunnable(ctx, dbVersion, targetVersion)
+}
+
+// GetSkippedMigrations returns the do migrations numbered at or below the
+// database version that were never recorded in the schema table, in
+// ascending version order. Migrate never runs them, because versions are
+// compared as integers: after switching from int to timestamp versions, a new
+// file numbered like 011 sorts below every timestamp already applied.
+// Migrations left unrecorded on purpose, gated to other environments with
+// Config.SkipGatedMigrations or at or below Config.GolangMigrateTable's
+// version, are not reported.
+func (g *Gostgrator) GetSkippedMigrations(ctx context.Context) ([]Migration, error) {
+	migs, err := g.GetMigrations()
+	if err != nil {
+		return nil, err
+	}
+	dbVersion, err := g.GetDatabaseVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gmVersion, err := g.golangMigrateVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := g.GetAppliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recorded := make(map[int]bool, len(applied))
+	for _, a := range applied {
+		recorded[a.Version] = true
+	}
+	var skipped []Migration
+	for _, m := range migs {
+		if m.Action != "do" || m.Version > dbVersion || m.Version <= gmVersion || recorded[m.Version] {
+			continue
+		}
+		enabled, err := g.environmentEnabled(m)
+		if err != nil {
+			return nil, err
+		}
+		if !enabled && g.cfg.SkipGatedMigrations {
+			continue
+		}
+		skipped = append(skipped, m)
+	}
+	sortMigrationsAsc(skipped)
+	return skipped, nil
+}
+
+// PlanDown reports what Down(ctx, steps) would run without running it: each
+// undo migration, the tables it touches (found by basic SQL pattern matching)
+// and any migration applied after it that references those tables and may
+// break once it is rolled back. With Config.CheckDataLoss it also reports the
+// rows each undo migration would destroy.
+func (g *Gostgrator) PlanDown(ctx context.Context, steps int) ([]RollbackImpact, error) {
+	currentVersion, err := g.GetDatabaseVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	targetVersion := max(currentVersion-steps, 0)
+	runnable, err := g.Plan(ctx, strconv.Itoa(targetVersion))
+	if err != nil {
+		return nil, err
+	}
+	applied, err := g.GetAppliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	appliedByVersion := make(map[int]AppliedMigration)
+	for _, a := range applied {
+		appliedByVersion[a.Version] = a
+	}
+
+	var impacts []RollbackImpact
+	for _, undo := range runnable {
+		sqlScript, err := g.sql(undo)
+		if err != nil {
+			return nil, err
+		}
+		impact := RollbackImpact{Migration: undo, Tables: touchedTables(sqlScript)}
+		rolledBack, ok := appliedByVersion[undo.Version]
+		for _, m := range g.migrations {
+			if !ok || len(impact.Tables) == 0 || m.Action != "do" {
+				continue
+			}
+			later, found := appliedByVersion[m.Version]
+			if !found || !appliedAfter(later, rolledBack) {
+				continue
+			}
+			referencing, err := g.referencesAny(m, impact.Tables)
+			if err != nil {
+				return nil, err
+			}
+			if referencing {
+				impact.Dependents = append(impact.Dependents, m)
+			}
+		}
+		sortMigrationsAsc(impact.Dependents)
+		if g.cfg.CheckDataLoss {
+			if impact.DataLoss, err = g.dataLoss(ctx, []Migration{undo}); err != nil {
+				return nil, err
+			}
+		}
+		impacts = append(impacts, impact)
+	}
+	return impacts, nil
+}
+
+// referencesAny reports whether the SQL of m references any of tables.
+func (g *Gostgrator) referencesAny(m Migration, tables []string) (bool, error) {
+	sqlScript, err := g.sql(m)
+	if err != nil {
+		return false, err
+	}
+	for _, ref := range referencedTables(sqlScript) {
+		for _, table := range tables {
+			if sameTable(ref, table) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// appliedAfter reports whether a ran after b, ordering by run_at and falling
+// back to the version when both ran at the same recorded time.
+func appliedAfter(a, b AppliedMigration) bool {
+	if !a.RunAt.Equal(b.RunAt) {
+		return a.RunAt.After(b.RunAt)
+	}
+	return a.Version > b.Version
+}
@@ -0,0 +1,134 @@
+// Package plan decides which migrations move a database from one version to
+// another. It has no dependencies and never touches a database, so the
+// ordering of an application's migrations can be unit and property tested
+// on its own:
+//
+//	files := []plan.File{
+//		{Version: 1, Action: plan.Do},
+//		{Version: 2, Action: plan.Do, DependsOn: []int{1}},
+//		{Version: 2, Action: plan.Undo},
+//	}
+//	steps, err := plan.Compute(files, 0, "max") // 1 and 2, in that order
+//
+// gostgrator plans every Migrate, Down and Plan call with this package.
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Actions of the files the planner schedules. Files with other actions, such
+// as test migrations, only count towards the highest version.
+const (
+	Do   = "do"
+	Undo = "undo"
+)
+
+// File is a migration file as seen by the planner.
+type File struct {
+	// Version of the migration.
+	Version int
+	// Action is Do or Undo.
+	Action string
+	// Name is an optional descriptive name, carried through unchanged.
+	Name string
+	// DependsOn lists the versions a Do file requires to be applied before
+	// it, as declared by a "depends-on" directive.
+	DependsOn []int
+}
+
+// Compute returns the files that move a database at currentVersion to
+// target, in the order they run. target is a version number, or "max" or
+// empty for the highest version in files.
+func Compute(files []File, currentVersion int, target string) ([]File, error) {
+	targetVersion, err := ResolveTarget(files, target)
+	if err != nil {
+		return nil, err
+	}
+	return Runnable(files, currentVersion, targetVersion)
+}
+
+// ResolveTarget converts a target into a version number. "max" or an empty
+// target, ignoring case and surrounding space, resolves to MaxVersion.
+func ResolveTarget(files []File, target string) (int, error) {
+	cleaned := strings.ToLower(strings.TrimSpace(target))
+	if cleaned == "max" || cleaned == "" {
+		return MaxVersion(files), nil
+	}
+	targetVersion, err := strconv.Atoi(cleaned)
+	if err != nil {
+		return 0, fmt.Errorf("invalid target version: %v", err)
+	}
+	return targetVersion, nil
+}
+
+// MaxVersion returns the highest version of any file, or 0 if there are none.
+func MaxVersion(files []File) int {
+	max := 0
+	for _, f := range files {
+		if f.Version > max {
+			max = f.Version
+		}
+	}
+	return max
+}
+
+// Runnable returns the files that move a database from currentVersion to
+// targetVersion: Do files numbered above currentVersion up to targetVersion
+// in ascending order, or Undo files numbered at or below currentVersion and
+// above targetVersion in descending order. Versions are compared as plain
+// integers, so a Do file numbered at or below currentVersion is never run
+// even if it was never applied.
+//
+// Moving up fails if a Do file depends on a version that has no Do file, or
+// on one above currentVersion that is not scheduled before it.
+func Runnable(files []File, currentVersion, targetVersion int) ([]File, error) {
+	var runnable []File
+	switch {
+	case targetVersion > currentVersion:
+		for _, f := range files {
+			if f.Action == Do && f.Version > currentVersion && f.Version <= targetVersion {
+				runnable = append(runnable, f)
+			}
+		}
+		sort.SliceStable(runnable, func(i, j int) bool { return runnable[i].Version < runnable[j].Version })
+		if err := checkDependencies(files, currentVersion, runnable); err != nil {
+			return nil, err
+		}
+	case targetVersion < currentVersion:
+		for _, f := range files {
+			if f.Action == Undo && f.Version <= currentVersion && f.Version > targetVersion {
+				runnable = append(runnable, f)
+			}
+		}
+		sort.SliceStable(runnable, func(i, j int) bool { return runnable[i].Version > runnable[j].Version })
+	}
+	return runnable, nil
+}
+
+// checkDependencies verifies that every file about to run has its
+// dependencies either already applied or scheduled earlier in the same run.
+func checkDependencies(files []File, currentVersion int, runnable []File) error {
+	available := make(map[int]bool)
+	for _, f := range files {
+		if f.Action == Do {
+			available[f.Version] = true
+		}
+	}
+	scheduled := make(map[int]bool)
+	for _, f := range runnable {
+		for _, dep := range f.DependsOn {
+			switch {
+			case !available[dep]:
+				return fmt.Errorf("migration [%d] depends on missing migration [%d]", f.Version, dep)
+			case dep > currentVersion && !scheduled[dep]:
+				return fmt.Errorf("migration [%d] depends on unapplied migration [%d]", f.Version, dep)
+			}
+		}
+		scheduled[f.Version] = true
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package plan_test
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bcomnes/gostgrator/plan"
+)
+
+// pairs returns a do and undo file for each version.
+func pairs(versions ...int) []plan.File {
+	var files []plan.File
+	for _, v := range versions {
+		files = append(files, plan.File{Version: v, Action: plan.Do}, plan.File{Version: v, Action: plan.Undo})
+	}
+	return files
+}
+
+// steps describes files as "do 1", "undo 2" and so on.
+func steps(files []plan.File) []string {
+	var out []string
+	for _, f := range files {
+		out = append(out, fmt.Sprintf("%s %d", f.Action, f.Version))
+	}
+	return out
+}
+
+func TestCompute(t *testing.T) {
+	files := append(pairs(3, 1, 2), plan.File{Version: 4, Action: "test"})
+	for _, tt := range []struct {
+		name    string
+		current int
+		target  string
+		want    []string
+	}{
+		{"up to max", 0, "max", []string{"do 1", "do 2", "do 3"}},
+		{"empty target is max", 1, "", []string{"do 2", "do 3"}},
+		{"max ignores case and space", 1, " MAX ", []string{"do 2", "do 3"}},
+		{"up to a version", 0, "002", []string{"do 1", "do 2"}},
+		{"down", 3, "1", []string{"undo 3", "undo 2"}},
+		{"down to zero", 3, "0", []string{"undo 3", "undo 2", "undo 1"}},
+		{"already there", 2, "2", nil},
+		{"past the last file", 3, "9", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := plan.Compute(files, tt.current, tt.target)
+			if err != nil {
+				t.Fatalf("Compute failed: %v", err)
+			}
+			if !reflect.DeepEqual(steps(got), tt.want) {
+				t.Errorf("Compute(%d, %q) = %v, want %v", tt.current, tt.target, steps(got), tt.want)
+			}
+		})
+	}
+	if _, err := plan.Compute(files, 0, "latest"); err == nil || !strings.Contains(err.Error(), "invalid target version") {
+		t.Errorf("expected an invalid target to fail, got %v", err)
+	}
+	if got := plan.MaxVersion(files); got != 4 {
+		t.Errorf("expected test files to count towards the max version, got %d", got)
+	}
+}
+
+func TestRunnableDependencies(t *testing.T) {
+	files := []plan.File{
+		{Version: 1, Action: plan.Do},
+		{Version: 2, Action: plan.Do, DependsOn: []int{1}},
+		{Version: 3, Action: plan.Do, DependsOn: []int{2}},
+		{Version: 4, Action: plan.Do, DependsOn: []int{7}},
+	}
+	if _, err := plan.Runnable(files, 0, 3); err != nil {
+		t.Errorf("expected dependencies scheduled earlier in the run to pass, got %v", err)
+	}
+	if _, err := plan.Runnable(files, 2, 3); err != nil {
+		t.Errorf("expected applied dependencies to pass, got %v", err)
+	}
+	if _, err := plan.Runnable(files, 0, 4); err == nil || !strings.Contains(err.Error(), "depends on missing migration [7]") {
+		t.Errorf("expected a missing dependency to fail, got %v", err)
+	}
+	files[0].DependsOn = []int{2}
+	if _, err := plan.Runnable(files, 0, 2); err == nil || !strings.Contains(err.Error(), "depends on unapplied migration [2]") {
+		t.Errorf("expected a dependency scheduled later to fail, got %v", err)
+	}
+}
+
+// TestRunnableProperties checks, over random sets of files, that moving up
+// runs each do file between the versions once in ascending order, moving
+// down runs the matching undo files in reverse, and a round trip returns to
+// where it started.
+func TestRunnableProperties(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for range 500 {
+		seen := make(map[int]bool)
+		var versions []int
+		for range rng.Intn(20) {
+			v := 1 + rng.Intn(50)
+			if !seen[v] {
+				seen[v] = true
+				versions = append(versions, v)
+			}
+		}
+		files := pairs(versions...)
+		rng.Shuffle(len(files), func(i, j int) { files[i], files[j] = files[j], files[i] })
+		from, to := rng.Intn(55), rng.Intn(55)
+		if from > to {
+			from, to = to, from
+		}
+
+		up, err := plan.Runnable(files, from, to)
+		if err != nil {
+			t.Fatalf("Runnable failed: %v", err)
+		}
+		want := 0
+		for _, v := range versions {
+			if v > from && v <= to {
+				want++
+			}
+		}
+		if len(up) != want {
+			t.Fatalf("moving from %d to %d over %v ran %d files, want %d", from, to, versions, len(up), want)
+		}
+		for i, f := range up {
+			if f.Action != plan.Do || f.Version <= from || f.Version > to || (i > 0 && f.Version <= up[i-1].Version) {
+				t.Fatalf("moving from %d to %d produced out of order or out of range steps %v", from, to, up)
+			}
+		}
+
+		down, err := plan.Runnable(files, to, from)
+		if err != nil {
+			t.Fatalf("Runnable failed: %v", err)
+		}
+		if len(down) != len(up) {
+			t.Fatalf("moving down from %d to %d ran %d files, up ran %d", to, from, len(down), len(up))
+		}
+		for i, f := range down {
+			if f.Action != plan.Undo || f.Version != up[len(up)-1-i].Version {
+				t.Fatalf("moving down from %d to %d did not reverse %v: %v", to, from, up, down)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package gostgrator
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// filenamePolicyPresets are the named policies Config.FilenamePolicy accepts
+// in place of a regular expression.
+var filenamePolicyPresets = map[string]string{
+	// The name is lowercase words separated by hyphens, as new produces.
+	"kebab-case": `^\d+\.(do|undo|up|down)\.[a-z0-9]+(-[a-z0-9]+)*\.sql$`,
+	// The name starts with an issue key such as ABC-123.
+	"ticket": `(?i)^\d+\.(do|undo|up|down)\.[a-z][a-z0-9]*-\d+([-.].*)?\.sql$`,
+}
+
+// filenamePolicy compiles cfg.FilenamePolicy, returning nil if no policy is set.
+func filenamePolicy(cfg Config) (*regexp.Regexp, error) {
+	if cfg.FilenamePolicy == "" {
+		return nil, nil
+	}
+	expr, ok := filenamePolicyPresets[cfg.FilenamePolicy]
+	if !ok {
+		expr = cfg.FilenamePolicy
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename policy %q: %v", cfg.FilenamePolicy, err)
+	}
+	return re, nil
+}
+
+// CheckFilename reports whether the base name of filename satisfies
+// cfg.FilenamePolicy. It always succeeds when no policy is set.
+func CheckFilename(cfg Config, filename string) error {
+	policy, err := filenamePolicy(cfg)
+	if err != nil || policy == nil {
+		return err
+	}
+	if base := filepath.Base(filename); !policy.MatchString(base) {
+		return fmt.Errorf("migration file %s does not match filename policy %q", base, cfg.FilenamePolicy)
+	}
+	return nil
+}
+
+// CheckFilenames loads the migrations and checks every filename against
+// Config.FilenamePolicy. The error lists each file that breaks the policy.
+func (g *Gostgrator) CheckFilenames() error {
+	policy, err := filenamePolicy(g.cfg)
+	if err != nil || policy == nil {
+		return err
+	}
+	migs, err := g.GetMigrations()
+	if err != nil {
+		return err
+	}
+	var violations []string
+	for _, m := range migs {
+		if base := filepath.Base(m.Filename); !policy.MatchString(base) {
+			violations = append(violations, base)
+		}
+	}
+	if len(violations) > 0 {
+		sort.Strings(violations)
+		return fmt.Errorf("migrations do not match filename policy %q: %s", g.cfg.FilenamePolicy, strings.Join(violations, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package gostgrator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCheckFilename verifies presets and custom expressions.
+func TestCheckFilename(t *testing.T) {
+	cases := []struct {
+		policy   string
+		filename string
+		ok       bool
+	}{
+		{"", "anything.sql", true},
+		{"kebab-case", "migrations/001.do.add-users.sql", true},
+		{"kebab-case", "001.undo.add_users.sql", false},
+		{"kebab-case", "001.do.Add-Users.sql", false},
+		{"ticket", "001.do.abc-123-add-users.sql", true},
+		{"ticket", "001.do.ABC-123.sql", true},
+		{"ticket", "001.do.add-users.sql", false},
+		{`^\d{14}\.`, "20240101120000.do.users.sql", true},
+		{`^\d{14}\.`, "001.do.users.sql", false},
+	}
+	for _, c := range cases {
+		err := CheckFilename(Config{FilenamePolicy: c.policy}, c.filename)
+		if c.ok && err != nil {
+			t.Errorf("policy %q: expected %s to pass, got %v", c.policy, c.filename, err)
+		}
+		if !c.ok && (err == nil || !strings.Contains(err.Error(), "does not match filename policy")) {
+			t.Errorf("policy %q: expected %s to be rejected, got %v", c.policy, c.filename, err)
+		}
+	}
+	if err := CheckFilename(Config{FilenamePolicy: "("}, "001.do.sql"); err == nil || !strings.Contains(err.Error(), "invalid filename policy") {
+		t.Errorf("expected invalid policy error, got %v", err)
+	}
+}
+
+// TestCheckFilenames verifies that every violating file is reported.
+func TestCheckFilenames(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"001.do.abc-1-first.sql", "001.undo.abc-1-first.sql", "002.do.second.sql", "002.undo.second.sql"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("SELECT 1;"), 0644); err != nil {
+			t.Fatalf("failed to write migration: %v", err)
+		}
+	}
+	g := &Gostgrator{cfg: Config{MigrationPattern: filepath.Join(tmpDir, "*.sql"), FilenamePolicy: "ticket"}}
+	err := g.CheckFilenames()
+	if err == nil || !strings.HasSuffix(err.Error(), ": 002.do.second.sql, 002.undo.second.sql") {
+		t.Fatalf("expected both version 2 files to be reported, got %v", err)
+	}
+}
+
+// TestCreateMigrationFilenamePolicy verifies that new refuses names that
+// break the policy and writes nothing.
+func TestCreateMigrationFilenamePolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{
+		MigrationPattern: filepath.Join(tmpDir, "*.sql"),
+		FilenamePolicy:   "ticket",
+	}
+	if err := CreateMigration(cfg, "add users", "int"); err == nil {
+		t.Fatal("expected a name without a ticket to be rejected")
+	}
+	if files, _ := filepath.Glob(cfg.MigrationPattern); len(files) != 0 {
+		t.Fatalf("expected no files to be written, got %v", files)
+	}
+	if err := CreateMigration(cfg, "ABC-42 add users", "int"); err != nil {
+		t.Fatalf("expected a name with a ticket to be accepted, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "001.do.abc-42-add-users.sql")); err != nil {
+		t.Fatalf("expected do file to exist: %v", err)
+	}
+}
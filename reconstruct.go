@@ -0,0 +1,182 @@
+package gostgrator
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ReconstructedMigration is the evidence Reconstruct found in the database
+// for one do migration.
+type ReconstructedMigration struct {
+	Migration
+	// Found lists the objects the migration creates that exist, such as
+	// "table users", "column users.email" or "index users_email_idx".
+	Found []string
+	// Missing lists the objects the migration creates that do not exist.
+	Missing []string
+	// Applied reports whether the migration is proposed as applied: it is at
+	// or below the highest version whose objects were all found.
+	Applied bool
+}
+
+// createdTablePattern finds tables a statement creates.
+var createdTablePattern = regexp.MustCompile(`(?i)\bCREATE\s+(?:UNLOGGED\s+)?TABLE(?:\s+IF\s+NOT\s+EXISTS)?\s+` + tableName)
+
+// createdIndexPattern finds indexes a statement creates and their tables.
+var createdIndexPattern = regexp.MustCompile(`(?i)\bCREATE\s+(?:UNIQUE\s+)?INDEX\s+(?:CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?("[^"]+"|[\w$]+)\s+ON(?:\s+ONLY)?\s+` + tableName)
+
+// addedColumnPattern finds columns a statement adds and their tables.
+var addedColumnPattern = regexp.MustCompile(`(?i)\bALTER\s+TABLE(?:\s+IF\s+EXISTS)?(?:\s+ONLY)?\s+` + tableName + `\s+ADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?("[^"]+"|[\w$]+)`)
+
+// notColumns are the words after ADD that start a constraint, not a column.
+var notColumns = []string{"constraint", "primary", "unique", "foreign", "check", "exclude"}
+
+// Reconstruct proposes the schema table rows of a database whose schema
+// table was lost while its migrations stayed applied. For each do migration
+// it looks for the tables, indexes and columns the migration creates in the
+// live schema, using simple pattern matching rather than a full SQL parser.
+// Every migration at or below the highest version whose objects were all
+// found is proposed as applied, since later migrations may have dropped what
+// earlier ones created; migrations that create nothing, such as data
+// changes, leave no evidence of their own. It is supported by the pg and
+// sqlite3 drivers, does not change the database and fails if the schema
+// table already records a version. Record the proposal with RecordApplied.
+func (g *Gostgrator) Reconstruct(ctx context.Context) ([]ReconstructedMigration, error) {
+	if version, err := g.GetDatabaseVersion(ctx); err != nil {
+		return nil, err
+	} else if version != 0 {
+		return nil, fmt.Errorf("the schema table already records version %d; reconstruct only rebuilds a missing or empty schema table", version)
+	}
+	migs, err := g.GetMigrations()
+	if err != nil {
+		return nil, err
+	}
+	schema, err := g.DescribeSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var proposed []ReconstructedMigration
+	highest := -1
+	for _, m := range migs {
+		if m.Action != "do" {
+			continue
+		}
+		script, err := g.sql(m)
+		if err != nil {
+			return nil, err
+		}
+		r := ReconstructedMigration{Migration: m}
+		for _, object := range createdObjects(stripComments(script)) {
+			if schema.has(object) {
+				r.Found = append(r.Found, object.String())
+			} else {
+				r.Missing = append(r.Missing, object.String())
+			}
+		}
+		if len(r.Found) > 0 && len(r.Missing) == 0 {
+			highest = len(proposed)
+		}
+		proposed = append(proposed, r)
+	}
+	for i := 0; i <= highest; i++ {
+		proposed[i].Applied = true
+	}
+	return proposed, nil
+}
+
+// RecordApplied records migrations in the schema table as applied without
+// running them, creating the table if needed, for rebuilding a lost schema
+// table from Reconstruct's proposal. It holds the migration lock and fails,
+// recording nothing, if any of the versions is already recorded.
+func (g *Gostgrator) RecordApplied(ctx context.Context, migrations []Migration) error {
+	return g.withLock(ctx, func() error {
+		if err := g.EnsureSchemaTable(ctx); err != nil {
+			return err
+		}
+		applied, err := g.GetAppliedMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if m.Action != "do" {
+				return fmt.Errorf("migration [%d] (%s) is not a do migration", m.Version, m.Filename)
+			}
+			if slices.ContainsFunc(applied, func(a AppliedMigration) bool { return a.Version == m.Version }) {
+				return fmt.Errorf("migration [%d] is already recorded", m.Version)
+			}
+		}
+		for _, m := range migrations {
+			if err := g.persistAction(ctx, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// schemaObject is a table, index or column a migration creates.
+type schemaObject struct {
+	kind, table, name string
+}
+
+func (o schemaObject) String() string {
+	switch o.kind {
+	case "index":
+		return "index " + o.name
+	case "column":
+		return "column " + o.table + "." + o.name
+	}
+	return "table " + o.table
+}
+
+// createdObjects returns the tables, indexes and columns a script creates, in
+// the order they first appear.
+func createdObjects(script string) []schemaObject {
+	type found struct {
+		at     int
+		object schemaObject
+	}
+	var objects []found
+	for _, loc := range createdTablePattern.FindAllStringSubmatchIndex(script, -1) {
+		objects = append(objects, found{loc[0], schemaObject{kind: "table", table: normalizeTable(script[loc[2]:loc[3]])}})
+	}
+	for _, loc := range createdIndexPattern.FindAllStringSubmatchIndex(script, -1) {
+		objects = append(objects, found{loc[0], schemaObject{kind: "index", name: normalizeTable(script[loc[2]:loc[3]]), table: normalizeTable(script[loc[4]:loc[5]])}})
+	}
+	for _, loc := range addedColumnPattern.FindAllStringSubmatchIndex(script, -1) {
+		name := normalizeTable(script[loc[4]:loc[5]])
+		if !slices.Contains(notColumns, strings.ToLower(name)) {
+			objects = append(objects, found{loc[0], schemaObject{kind: "column", table: normalizeTable(script[loc[2]:loc[3]]), name: name}})
+		}
+	}
+	slices.SortStableFunc(objects, func(a, b found) int { return a.at - b.at })
+	var created []schemaObject
+	for _, o := range objects {
+		if !slices.Contains(created, o.object) {
+			created = append(created, o.object)
+		}
+	}
+	return created
+}
+
+// has reports whether the schema holds object. Names are compared without
+// regard to case, and an unqualified table matches in any schema.
+func (s Schema) has(object schemaObject) bool {
+	for _, t := range s.Tables {
+		if !sameTable(strings.ToLower(t.Name), strings.ToLower(object.table)) {
+			continue
+		}
+		switch object.kind {
+		case "table":
+			return true
+		case "index":
+			return slices.ContainsFunc(t.Indexes, func(i IndexInfo) bool { return strings.EqualFold(i.Name, object.name) })
+		case "column":
+			return slices.ContainsFunc(t.Columns, func(c ColumnInfo) bool { return strings.EqualFold(c.Name, object.name) })
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestReconstruct verifies that versions are proposed up to the highest one
+// whose objects exist, and that RecordApplied records them without running
+// them.
+func TestReconstruct(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "reconstruct.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	pattern := writeDriftedMigrations(t, map[string]string{
+		"001.do.users.sql":  "CREATE TABLE users (id INTEGER);\nCREATE INDEX users_id_idx ON users (id);",
+		"002.do.seed.sql":   "INSERT INTO users VALUES (1);",
+		"003.do.old.sql":    "CREATE TABLE old (id INTEGER);",
+		"004.do.email.sql":  "ALTER TABLE users ADD COLUMN email TEXT;\nDROP TABLE old;",
+		"005.do.orders.sql": "CREATE TABLE orders (id INTEGER);",
+	})
+	g, err := NewGostgrator(Config{Driver: "sqlite3", MigrationPattern: pattern}, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "4"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if _, err := db.Exec(`DROP TABLE "schemaversion"`); err != nil {
+		t.Fatal(err)
+	}
+
+	proposed, err := g.Reconstruct(ctx)
+	if err != nil {
+		t.Fatalf("reconstruct failed: %v", err)
+	}
+	var applied []Migration
+	for _, r := range proposed {
+		if r.Applied {
+			applied = append(applied, r.Migration)
+		}
+	}
+	if len(proposed) != 5 || len(applied) != 4 || applied[3].Version != 4 {
+		t.Fatalf("expected versions 1 through 4 to be proposed, got %+v", proposed)
+	}
+	if got := strings.Join(proposed[0].Found, ", "); got != "table users, index users_id_idx" {
+		t.Errorf("unexpected evidence for 1: %s", got)
+	}
+	if len(proposed[2].Missing) != 1 || len(proposed[4].Missing) != 1 {
+		t.Errorf("expected the dropped table and the pending one to be missing, got %+v", proposed)
+	}
+
+	if err := g.RecordApplied(ctx, applied); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+	if version, err := g.GetDatabaseVersion(ctx); err != nil || version != 4 {
+		t.Errorf("expected version 4, got %d (%v)", version, err)
+	}
+	var users int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&users); err != nil || users != 1 {
+		t.Errorf("expected the seed not to run again, got %d rows (%v)", users, err)
+	}
+	if err := g.RecordApplied(ctx, applied[:1]); err == nil || !strings.Contains(err.Error(), "already recorded") {
+		t.Errorf("expected recording a version twice to fail, got %v", err)
+	}
+	if _, err := g.Reconstruct(ctx); err == nil {
+		t.Error("expected reconstruct to refuse a schema table that records a version")
+	}
+}
@@ -0,0 +1,49 @@
+package gostgrator
+
+import (
+	"regexp"
+)
+
+// redactedPassword replaces masked passwords, matching url.URL.Redacted.
+const redactedPassword = "xxxxx"
+
+var (
+	// urlPasswordPattern matches the password in the userinfo of a URL.
+	urlPasswordPattern = regexp.MustCompile(`(\b[a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]*:)[^@\s/]*@`)
+
+	// keywordPasswordPattern matches a password keyword/value pair, as used by
+	// PostgreSQL DSNs ("password=secret") and URL query parameters.
+	keywordPasswordPattern = regexp.MustCompile(`(?i)(\bpassword\s*=\s*)(?:'(?:[^'\\]|\\.)*'|[^\s'&]+)`)
+)
+
+// RedactCredentials masks passwords in s, which may be a connection string in
+// URL or keyword/value form, or any text such as an error message that embeds
+// one. The rest of s is returned unchanged.
+func RedactCredentials(s string) string {
+	s = urlPasswordPattern.ReplaceAllString(s, "${1}"+redactedPassword+"@")
+	return keywordPasswordPattern.ReplaceAllString(s, "${1}"+redactedPassword)
+}
+
+// redactedError wraps an error whose message contained credentials. Unwrap
+// returns the original error so errors.Is and errors.As keep working.
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactError masks credentials in the message of err, returning err itself
+// when there is nothing to mask.
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := RedactCredentials(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{err: err, msg: msg}
+}
@@ -0,0 +1,325 @@
+package gostgrator
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// scanChunkSize is how much of a migration file scanMigration reads at a time.
+var scanChunkSize = 64 << 10
+
+// scanBuffers reuses read buffers across files, since loading thousands of
+// small migrations would otherwise allocate a chunk for each one.
+var scanBuffers = sync.Pool{New: func() any { return new([]byte) }}
+
+// Checksum returns the MD5 checksum gostgrator records for a migration with
+// the given content, as a hex string, so other tools can compute the sums
+// they expect to find in the schema table. newline is Config.Newline: "LF",
+// "CR" or "CRLF" converts line endings first, and "" hashes the content as
+// it is, as does any other value, since Config.Validate rejects those. A
+// leading UTF-8 byte order mark is hashed with the rest. Content that is not
+// UTF-8 is hashed too, although gostgrator refuses to load such migrations.
+func Checksum(content []byte, newline string) string {
+	return ChecksumCompat(content, newline, "")
+}
+
+// ChecksumFile is like Checksum for the migration file at path, read as it
+// is streamed rather than all at once. The error is from reading the file.
+func ChecksumFile(path, newline string) (string, error) {
+	return ChecksumFileCompat(path, newline, "")
+}
+
+// ChecksumCompat is like Checksum with compat as Config.ChecksumCompat:
+// "postgrator" for the checksums node-postgrator records, and "",
+// "gostgrator" or any other value for gostgrator's.
+func ChecksumCompat(content []byte, newline, compat string) string {
+	// Reading from memory cannot fail.
+	sum, _, _ := scanMigration(bytes.NewReader(content), "content", publicChecksumStyle(newline, compat))
+	return sum
+}
+
+// ChecksumFileCompat is like ChecksumFile with compat as in ChecksumCompat.
+func ChecksumFileCompat(path, newline, compat string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sum, _, err := scanMigration(f, path, publicChecksumStyle(newline, compat))
+	return sum, err
+}
+
+// checksumStyle is how migration files are hashed: Config.Newline and
+// Config.ChecksumCompat. anyEncoding hashes content that is not UTF-8
+// instead of rejecting it.
+type checksumStyle struct {
+	newline, compat string
+	anyEncoding     bool
+}
+
+// publicChecksumStyle returns the checksumStyle Checksum and ChecksumFile
+// hash with, using the defaults for values Config.Validate would reject.
+func publicChecksumStyle(newline, compat string) checksumStyle {
+	switch newline {
+	case "LF", "CR", "CRLF":
+	default:
+		newline = ""
+	}
+	if compat != "postgrator" {
+		compat = ""
+	}
+	return checksumStyle{newline: newline, compat: compat, anyEncoding: true}
+}
+
+// newChecksumStyle returns the checksumStyle for Config.Newline and
+// Config.ChecksumCompat values, checking compat as Config.Validate does.
+func newChecksumStyle(newline, compat string) (checksumStyle, error) {
+	switch compat {
+	case "", "gostgrator", "postgrator":
+	default:
+		return checksumStyle{}, fmt.Errorf("unknown checksum compatibility %q, must be one of: gostgrator or postgrator", compat)
+	}
+	return checksumStyle{newline: newline, compat: compat}, nil
+}
+
+// checksumStyle returns how cfg hashes migration files.
+func (cfg Config) checksumStyle() checksumStyle {
+	return checksumStyle{newline: cfg.Newline, compat: cfg.ChecksumCompat}
+}
+
+// scanMigration streams a migration file and returns the same checksum as
+// passing its content to checksum, and the same directives as decoding it with
+// decodeMigration and passing that to parseDirectives, without ever holding
+// the whole file in memory. A leading UTF-8 byte order mark is hashed but
+// stripped before directives are parsed, as it is from the SQL that runs.
+// Only the leading comment block is kept, for parsing directives. With the
+// "postgrator" compat style, the checksum is the one node-postgrator records,
+// with its newline conversion; see Config.ChecksumCompat.
+func scanMigration(r io.Reader, filename string, style checksumStyle) (string, map[string]string, error) {
+	postgrator := style.compat == "postgrator"
+	var newline, loneCR []byte
+	switch style.newline {
+	case "":
+	case "LF":
+		newline = []byte("\n")
+	case "CR":
+		newline = []byte("\r")
+	case "CRLF":
+		newline = []byte("\r\n")
+	default:
+		return "", nil, fmt.Errorf("newline must be one of: LF, CR, CRLF")
+	}
+	loneCR = newline
+	if postgrator {
+		// postgrator converts "\r\n" and "\n" but leaves a lone "\r".
+		loneCR = []byte("\r")
+	}
+
+	buf := scanBuffers.Get().(*[]byte)
+	defer scanBuffers.Put(buf)
+	if len(*buf) != scanChunkSize {
+		*buf = make([]byte, scanChunkSize)
+	}
+	chunk := *buf
+
+	h := md5.New()
+	var header strings.Builder
+	started, headerDone, pendingCR := false, false, false
+	var carry []byte
+	for {
+		n, readErr := r.Read(chunk)
+		data := chunk[:n]
+		if len(carry) > 0 {
+			data = append(carry, data...)
+			carry = nil
+		}
+		if readErr != nil && readErr != io.EOF {
+			return "", nil, readErr
+		}
+		if !started {
+			// Wait for enough bytes to recognize a byte order mark.
+			if len(data) < 4 && readErr == nil {
+				carry = append([]byte(nil), data...)
+				continue
+			}
+			started = true
+			if content, ok := bytes.CutPrefix(data, []byte{0xEF, 0xBB, 0xBF}); ok {
+				// The byte order mark is hashed, as it always has been,
+				// but directives are parsed without it.
+				h.Write(data[:3])
+				data = content
+			}
+			for _, b := range byteOrderMarks {
+				if bytes.HasPrefix(data, b.bom) && !postgrator && !style.anyEncoding {
+					return "", nil, fmt.Errorf("migration file %s is encoded as %s; only UTF-8 is supported", filename, b.encoding)
+				}
+			}
+		}
+		if readErr == nil {
+			// Hold back an incomplete rune split across reads.
+			if i := lastRuneStart(data); i >= 0 && !utf8.FullRune(data[i:]) {
+				carry = append([]byte(nil), data[i:]...)
+				data = data[:i]
+			}
+		}
+		switch {
+		case postgrator:
+			// postgrator reads files as UTF-8 text, which replaces invalid
+			// bytes, and hashes that text.
+			data = replaceInvalidUTF8(data)
+		case style.anyEncoding:
+		case bytes.IndexByte(data, 0) >= 0:
+			return "", nil, fmt.Errorf("migration file %s contains NUL bytes; it may be UTF-16 encoded, only UTF-8 is supported", filename)
+		case !utf8.Valid(data):
+			return "", nil, fmt.Errorf("migration file %s is not valid UTF-8", filename)
+		}
+
+		if newline == nil {
+			h.Write(data)
+		} else {
+			pendingCR = writeNormalized(h, data, newline, loneCR, pendingCR)
+		}
+		if !headerDone {
+			header.Write(data)
+			headerDone = leadingCommentsEnded(header.String())
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+	if pendingCR {
+		h.Write(loneCR)
+	}
+	return hex.EncodeToString(h.Sum(nil)), parseDirectives(header.String()), nil
+}
+
+// writeNormalized writes data to w with every "\r\n" and "\n" replaced by
+// newline and every other "\r" by loneCR. pendingCR reports that the previous
+// data ended in "\r", which is only resolved once it is known whether a "\n"
+// follows; the returned value carries that state to the next call.
+func writeNormalized(w io.Writer, data, newline, loneCR []byte, pendingCR bool) bool {
+	if pendingCR {
+		if len(data) == 0 {
+			return true
+		}
+		if data[0] == '\n' {
+			w.Write(newline)
+			data = data[1:]
+		} else {
+			w.Write(loneCR)
+		}
+	}
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			w.Write(data)
+			return false
+		}
+		w.Write(data[:i])
+		if data[i] == '\r' {
+			if i+1 == len(data) {
+				return true
+			}
+			if data[i+1] != '\n' {
+				w.Write(loneCR)
+				data = data[i+1:]
+				continue
+			}
+			i++
+		}
+		w.Write(newline)
+		data = data[i+1:]
+	}
+	return false
+}
+
+// replaceInvalidUTF8 returns data with each maximal invalid UTF-8 subpart
+// replaced by U+FFFD, the way the WHATWG decoder Node.js reads text files
+// with does it, so "\xE2\x82A" becomes "\uFFFDA" rather than two
+// replacement characters. Valid data is returned as it is.
+func replaceInvalidUTF8(data []byte) []byte {
+	if utf8.Valid(data) {
+		return data
+	}
+	out := make([]byte, 0, len(data)+8)
+	for i := 0; i < len(data); {
+		b := data[i]
+		if b < utf8.RuneSelf {
+			out = append(out, b)
+			i++
+			continue
+		}
+		var need int
+		lower, upper := byte(0x80), byte(0xBF)
+		switch {
+		case b >= 0xC2 && b <= 0xDF:
+			need = 1
+		case b == 0xE0:
+			need, lower = 2, 0xA0
+		case b == 0xED:
+			need, upper = 2, 0x9F
+		case b >= 0xE1 && b <= 0xEF:
+			need = 2
+		case b == 0xF0:
+			need, lower = 3, 0x90
+		case b == 0xF4:
+			need, upper = 3, 0x8F
+		case b >= 0xF1 && b <= 0xF3:
+			need = 3
+		default:
+			out = utf8.AppendRune(out, utf8.RuneError)
+			i++
+			continue
+		}
+		j := i + 1
+		for ; j < len(data) && j-i <= need; j++ {
+			if data[j] < lower || data[j] > upper {
+				break
+			}
+			lower, upper = 0x80, 0xBF
+		}
+		if j-i == need+1 {
+			out = append(out, data[i:j]...)
+		} else {
+			out = utf8.AppendRune(out, utf8.RuneError)
+		}
+		i = j
+	}
+	return out
+}
+
+// lastRuneStart returns the index of the last rune start in the final
+// utf8.UTFMax bytes of data, or -1 if there is none.
+func lastRuneStart(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// leadingCommentsEnded reports whether s contains a complete line that ends
+// the leading comment block parseDirectives reads, i.e. a line that is
+// neither blank nor a "--" comment.
+func leadingCommentsEnded(s string) bool {
+	for {
+		line, rest, complete := strings.Cut(s, "\n")
+		if !complete {
+			return false
+		}
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return true
+		}
+		s = rest
+	}
+}
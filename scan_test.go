@@ -0,0 +1,168 @@
+package gostgrator
+
+import (
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestScanMigration verifies that streaming a file in chunks of any size gives
+// the same checksum, directives and errors as decoding it in one piece.
+func TestScanMigration(t *testing.T) {
+	files := map[string]string{
+		"plain":        "-- gostgrator: separator=GO\nCREATE TABLE t (id int);\nGO\nSELECT 1;\n",
+		"crlf":         "-- gostgrator: depends-on=1,\r\n--   2\r\nCREATE TABLE t (id int);\r\nINSERT INTO t VALUES (1);\r",
+		"mixed":        "-- a\r\r\n\n\rSELECT 'héllo wörld ✓ 𝄞';\r\n",
+		"bom":          "\xEF\xBB\xBF-- gostgrator: environments=dev\nSELECT 1;",
+		"utf16":        "\xFF\xFEC\x00R\x00",
+		"nul":          "SELECT 1;\x00",
+		"invalid":      "SELECT '\xC3\x28';",
+		"truncated":    "SELECT 'caf\xC3",
+		"comment only": "-- gostgrator: separator=GO\n-- nothing else",
+		"empty":        "",
+	}
+	defer func(size int) { scanChunkSize = size }(scanChunkSize)
+	for name, content := range files {
+		for _, lineEnding := range []string{"", "LF", "CR", "CRLF"} {
+			wantErr := ""
+			decoded, err := decodeMigration(name, []byte(content))
+			var wantMd5 string
+			var wantDirectives map[string]string
+			if err == nil {
+				wantMd5, _ = checksum(content, lineEnding)
+				wantDirectives = parseDirectives(decoded)
+			} else {
+				wantErr = err.Error()
+			}
+			for _, size := range []int{1, 2, 3, 5, 16, 4096} {
+				scanChunkSize = size
+				md5, directives, err := scanMigration(strings.NewReader(content), name, checksumStyle{newline: lineEnding})
+				if wantErr != "" {
+					if err == nil || err.Error() != wantErr {
+						t.Errorf("%s/%q/%d: expected error %q, got %v", name, lineEnding, size, wantErr, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("%s/%q/%d: unexpected error: %v", name, lineEnding, size, err)
+					continue
+				}
+				if md5 != wantMd5 {
+					t.Errorf("%s/%q/%d: expected md5 %s, got %s", name, lineEnding, size, wantMd5, md5)
+				}
+				if !reflect.DeepEqual(directives, wantDirectives) {
+					t.Errorf("%s/%q/%d: expected directives %v, got %v", name, lineEnding, size, wantDirectives, directives)
+				}
+			}
+		}
+	}
+}
+
+// TestChecksum verifies that the public helpers agree with the checksums
+// recorded for loaded migrations.
+func TestChecksum(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("\xEF\xBB\xBF-- gostgrator: tags=reporting\r\nCREATE TABLE t (id int);\rSELECT 1;\r\n")
+	path := filepath.Join(dir, "001.do.t.sql")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, compat := range []string{"", "postgrator"} {
+		for _, newline := range []string{"", "LF", "CRLF"} {
+			migs, err := getMigrations(Config{MigrationPattern: filepath.Join(dir, "*.sql"), Newline: newline, ChecksumCompat: compat})
+			if err != nil || len(migs) != 1 {
+				t.Fatalf("failed to load the migration: %v", err)
+			}
+			if sum := ChecksumCompat(content, newline, compat); sum != migs[0].Md5 {
+				t.Errorf("ChecksumCompat(%q, %q) = %s, want %s", newline, compat, sum, migs[0].Md5)
+			}
+			if sum, err := ChecksumFileCompat(path, newline, compat); err != nil || sum != migs[0].Md5 {
+				t.Errorf("ChecksumFileCompat(%q, %q) = %s (%v), want %s", newline, compat, sum, err, migs[0].Md5)
+			}
+			if compat != "" {
+				continue
+			}
+			if sum := Checksum(content, newline); sum != migs[0].Md5 {
+				t.Errorf("Checksum(%q) = %s, want %s", newline, sum, migs[0].Md5)
+			}
+			if sum, err := ChecksumFile(path, newline); err != nil || sum != migs[0].Md5 {
+				t.Errorf("ChecksumFile(%q) = %s (%v), want %s", newline, sum, err, migs[0].Md5)
+			}
+		}
+	}
+	asIs := Checksum(content, "")
+	if sum := Checksum(content, "LFCR"); sum != asIs {
+		t.Errorf("expected an unknown newline to hash the content as it is, got %s, want %s", sum, asIs)
+	}
+	if sum := ChecksumCompat(content, "", "flyway"); sum != asIs {
+		t.Errorf("expected an unknown compatibility to hash as gostgrator does, got %s, want %s", sum, asIs)
+	}
+	utf16 := []byte("\xFF\xFEC\x00")
+	if sum, want := Checksum(utf16, ""), fmt.Sprintf("%x", md5.Sum(utf16)); sum != want {
+		t.Errorf("expected UTF-16 content to be hashed as it is, got %s, want %s", sum, want)
+	}
+	if _, err := ChecksumFile(filepath.Join(dir, "missing.sql"), ""); err == nil {
+		t.Error("expected a missing file to fail")
+	}
+}
+
+// TestChecksumKeepsByteOrderMark verifies that a file starting with a UTF-8
+// byte order mark keeps the checksum earlier versions recorded for it, which
+// hashed the file as it is, while its directives are still read.
+func TestChecksumKeepsByteOrderMark(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("\xEF\xBB\xBF-- gostgrator: tags=a\r\nCREATE TABLE t (id int);\r\n")
+	if err := os.WriteFile(filepath.Join(dir, "001.do.t.sql"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// md5 of the raw bytes, and with CRLF converted to LF.
+	for newline, want := range map[string]string{"": "eaa6385a0e44d1924456764babab8e55", "LF": "68362bfae1327cb44746f67ee316427c"} {
+		migs, err := getMigrations(Config{MigrationPattern: filepath.Join(dir, "*.sql"), Newline: newline})
+		if err != nil || len(migs) != 1 {
+			t.Fatalf("failed to load the migration: %v", err)
+		}
+		if migs[0].Md5 != want {
+			t.Errorf("%q: expected md5 %s, got %s", newline, want, migs[0].Md5)
+		}
+		if migs[0].Directives["tags"] != "a" {
+			t.Errorf("%q: expected the tags directive after the byte order mark, got %v", newline, migs[0].Directives)
+		}
+	}
+}
+
+// TestPostgratorChecksum checks the "postgrator" checksum compatibility
+// against sums computed by node-postgrator's algorithm, whatever the chunk
+// size the file is streamed in. postgrator decodes the file as UTF-8 and,
+// with a newline option, replaces each "\r\n" and "\n" but not a lone "\r".
+func TestPostgratorChecksum(t *testing.T) {
+	defer func(size int) { scanChunkSize = size }(scanChunkSize)
+	cases := []struct {
+		name, content, newline, want string
+	}{
+		{"bom", "\xEF\xBB\xBF-- gostgrator: tags=a\r\nSELECT 1;\r\n", "", "0db2941176a4cb9f2e9623790e1a805c"},
+		{"bom", "\xEF\xBB\xBF-- gostgrator: tags=a\r\nSELECT 1;\r\n", "LF", "116dfc06aa3b009e07fd562ebe6c089d"},
+		{"invalid", "SELECT \xE2\x82A \xF0\x80\x80 \xED\xA0\x80 \xFF;\n\xE2", "", "cb4f3fbaddec7c35495a27fc5f5878aa"},
+		{"invalid", "SELECT \xE2\x82A \xF0\x80\x80 \xED\xA0\x80 \xFF;\n\xE2", "CRLF", "c7215ab26aeacca97f188e047070df13"},
+		{"plain", "SELECT 1;\r\nSELECT 2;\r", "", "5e2c5c2d4aef4682453abe9b82df8eaf"},
+		{"plain", "SELECT 1;\r\nSELECT 2;\r", "LF", "f4d907c7086eb255dfdfb1ecf54cf11a"},
+		{"mixed", "SELECT 1;\rSELECT 2;\n\rSELECT 3;\r\r\n", "LF", "8543158bcb1f33cd6c3ea6e197e4173b"},
+		{"mixed", "SELECT 1;\rSELECT 2;\n\rSELECT 3;\r\r\n", "CR", "c74ca63becd838e4cc3085b7f18ee45c"},
+		{"mixed", "SELECT 1;\rSELECT 2;\n\rSELECT 3;\r\r\n", "CRLF", "b33cf0192959fd14b4938ccd899252bc"},
+	}
+	for _, c := range cases {
+		for _, size := range []int{1, 2, 3, 5, 4096} {
+			scanChunkSize = size
+			sum, directives, err := scanMigration(strings.NewReader(c.content), c.name, checksumStyle{newline: c.newline, compat: "postgrator"})
+			if err != nil || sum != c.want {
+				t.Errorf("%s/%q/%d: expected md5 %s, got %s (%v)", c.name, c.newline, size, c.want, sum, err)
+			}
+			if c.name == "bom" && directives["tags"] != "a" {
+				t.Errorf("%s/%d: expected the tags directive after the byte order mark, got %v", c.name, size, directives)
+			}
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Schema describes the tables of a database, as returned by DescribeSchema.
+type Schema struct {
+	Tables []TableInfo `json:"tables"`
+}
+
+// TableInfo describes one table, qualified with its schema on PostgreSQL
+// unless it lives in "public".
+type TableInfo struct {
+	Name    string       `json:"name"`
+	Columns []ColumnInfo `json:"columns"`
+	Indexes []IndexInfo  `json:"indexes"`
+}
+
+// ColumnInfo describes one column of a table.
+type ColumnInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	// Default is the column's default expression, or empty if it has none.
+	Default string `json:"default,omitempty"`
+}
+
+// IndexInfo describes one index of a table. Columns of an expression index
+// are listed as "(expression)".
+type IndexInfo struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+// pgColumnsSql lists the columns of every user table on PostgreSQL.
+const pgColumnsSql = `
+      SELECT c.table_schema, c.table_name, c.column_name, c.data_type, c.is_nullable = 'YES', COALESCE(c.column_default, '')
+      FROM INFORMATION_SCHEMA.COLUMNS c
+      JOIN INFORMATION_SCHEMA.TABLES t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+      WHERE t.table_type = 'BASE TABLE'
+        AND c.table_schema NOT IN ('pg_catalog', 'information_schema')
+      ORDER BY c.table_schema, c.table_name, c.ordinal_position;
+    `
+
+// pgIndexesSql lists the columns of every index of a user table on
+// PostgreSQL, in index order, with NULL for expression columns.
+const pgIndexesSql = `
+      SELECT n.nspname, t.relname, i.relname, ix.indisunique, a.attname
+      FROM pg_index ix
+      JOIN pg_class t ON t.oid = ix.indrelid
+      JOIN pg_class i ON i.oid = ix.indexrelid
+      JOIN pg_namespace n ON n.oid = t.relnamespace
+      CROSS JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord)
+      LEFT JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+      WHERE n.nspname NOT IN ('pg_catalog', 'information_schema')
+        AND n.nspname NOT LIKE 'pg_toast%'
+      ORDER BY n.nspname, t.relname, i.relname, k.ord;
+    `
+
+// DescribeSchema introspects the tables of the database with their columns
+// and indexes, sorted by name, for generating schema documentation. The
+// tables gostgrator keeps its own state in are left out. It is supported by
+// the pg and sqlite3 drivers.
+func (g *Gostgrator) DescribeSchema(ctx context.Context) (Schema, error) {
+	switch g.client.(type) {
+	case *PostgresClient:
+		return g.describePostgres(ctx)
+	case *Sqlite3Client:
+		return g.describeSqlite(ctx)
+	}
+	return Schema{}, fmt.Errorf("describing the schema is not supported for %s", g.cfg.Driver)
+}
+
+// describePostgres reads the schema from PostgreSQL's catalogs.
+func (g *Gostgrator) describePostgres(ctx context.Context) (Schema, error) {
+	var schema Schema
+	// Tables are found by index, as appending may move the slice.
+	byName := make(map[string]int)
+	table := func(schemaName, name string) *TableInfo {
+		if schemaName != "public" {
+			name = schemaName + "." + name
+		}
+		i, ok := byName[name]
+		if !ok {
+			i = len(schema.Tables)
+			schema.Tables = append(schema.Tables, TableInfo{Name: name})
+			byName[name] = i
+		}
+		return &schema.Tables[i]
+	}
+	err := g.queryRows(ctx, pgColumnsSql, func(rows *sql.Rows) error {
+		var schemaName, tableName string
+		var c ColumnInfo
+		if err := rows.Scan(&schemaName, &tableName, &c.Name, &c.Type, &c.Nullable, &c.Default); err != nil {
+			return err
+		}
+		if !g.ownTable(schemaName, tableName) {
+			t := table(schemaName, tableName)
+			t.Columns = append(t.Columns, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return Schema{}, err
+	}
+	err = g.queryRows(ctx, pgIndexesSql, func(rows *sql.Rows) error {
+		var schemaName, tableName, indexName string
+		var unique bool
+		var column sql.NullString
+		if err := rows.Scan(&schemaName, &tableName, &indexName, &unique, &column); err != nil {
+			return err
+		}
+		if g.ownTable(schemaName, tableName) {
+			return nil
+		}
+		t := table(schemaName, tableName)
+		if len(t.Indexes) == 0 || t.Indexes[len(t.Indexes)-1].Name != indexName {
+			t.Indexes = append(t.Indexes, IndexInfo{Name: indexName, Unique: unique})
+		}
+		name := column.String
+		if !column.Valid {
+			name = "(expression)"
+		}
+		index := &t.Indexes[len(t.Indexes)-1]
+		index.Columns = append(index.Columns, name)
+		return nil
+	})
+	return schema, err
+}
+
+// describeSqlite reads the schema from SQLite's table-valued pragmas. Each
+// query is read to the end before the next runs, as SQLite connections may
+// be limited to one at a time.
+func (g *Gostgrator) describeSqlite(ctx context.Context) (Schema, error) {
+	var names []string
+	err := g.queryRows(ctx, `
+      SELECT name
+      FROM sqlite_master
+      WHERE type = 'table' AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+      ORDER BY name;
+    `, func(rows *sql.Rows) error {
+		var name string
+		err := rows.Scan(&name)
+		names = append(names, name)
+		return err
+	})
+	if err != nil {
+		return Schema{}, err
+	}
+	var schema Schema
+	for _, name := range names {
+		if g.ownTable("", name) {
+			continue
+		}
+		t := TableInfo{Name: name}
+		err := g.queryRows(ctx, fmt.Sprintf(`
+      SELECT name, type, "notnull" = 0 AND pk = 0, COALESCE(dflt_value, '')
+      FROM pragma_table_info(%s)
+      ORDER BY cid;
+    `, quoteLiteral("sqlite3", name)), func(rows *sql.Rows) error {
+			var c ColumnInfo
+			err := rows.Scan(&c.Name, &c.Type, &c.Nullable, &c.Default)
+			t.Columns = append(t.Columns, c)
+			return err
+		})
+		if err != nil {
+			return Schema{}, err
+		}
+		err = g.queryRows(ctx, fmt.Sprintf(`
+      SELECT name, "unique"
+      FROM pragma_index_list(%s)
+      ORDER BY name;
+    `, quoteLiteral("sqlite3", name)), func(rows *sql.Rows) error {
+			var index IndexInfo
+			err := rows.Scan(&index.Name, &index.Unique)
+			t.Indexes = append(t.Indexes, index)
+			return err
+		})
+		if err != nil {
+			return Schema{}, err
+		}
+		for i := range t.Indexes {
+			err := g.queryRows(ctx, fmt.Sprintf(`
+      SELECT COALESCE(name, '(expression)')
+      FROM pragma_index_info(%s)
+      ORDER BY seqno;
+    `, quoteLiteral("sqlite3", t.Indexes[i].Name)), func(rows *sql.Rows) error {
+				var column string
+				err := rows.Scan(&column)
+				t.Indexes[i].Columns = append(t.Indexes[i].Columns, column)
+				return err
+			})
+			if err != nil {
+				return Schema{}, err
+			}
+		}
+		schema.Tables = append(schema.Tables, t)
+	}
+	return schema, nil
+}
+
+// queryRows runs query and calls scan for every row it returns.
+func (g *Gostgrator) queryRows(ctx context.Context, query string, scan func(rows *sql.Rows) error) error {
+	rows, err := g.client.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ownTable reports whether the table is one gostgrator keeps its state in:
+// the schema table or its _lock, _history, _progress and _snapshot
+// companions. An
+// unqualified Config.SchemaTable matches in any PostgreSQL schema.
+func (g *Gostgrator) ownTable(schemaName, name string) bool {
+	qualified := name
+	if schemaName != "" {
+		qualified = schemaName + "." + name
+	}
+	for _, suffix := range append([]string{""}, companionTables...) {
+		own := g.cfg.SchemaTable + suffix
+		if own == qualified || own == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Markdown renders the schema as a Markdown document with a section per
+// table listing its columns and indexes.
+func (s Schema) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# Database schema\n")
+	if len(s.Tables) == 0 {
+		b.WriteString("\nThe database has no tables.\n")
+	}
+	for _, t := range s.Tables {
+		fmt.Fprintf(&b, "\n## %s\n\n", t.Name)
+		b.WriteString("| Column | Type | Nullable | Default |\n")
+		b.WriteString("| ------ | ---- | -------- | ------- |\n")
+		for _, c := range t.Columns {
+			nullable := "no"
+			if c.Nullable {
+				nullable = "yes"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", markdownCell(c.Name), markdownCell(c.Type), nullable, markdownCell(c.Default))
+		}
+		if len(t.Indexes) > 0 {
+			b.WriteString("\nIndexes:\n\n")
+		}
+		for _, index := range t.Indexes {
+			unique := ""
+			if index.Unique {
+				unique = " unique"
+			}
+			fmt.Fprintf(&b, "- `%s` (%s)%s\n", index.Name, strings.Join(index.Columns, ", "), unique)
+		}
+	}
+	return b.String()
+}
+
+// markdownCell escapes text for a Markdown table cell, wrapping non-empty
+// values as code.
+func markdownCell(s string) string {
+	if s == "" {
+		return ""
+	}
+	s = strings.ReplaceAll(s, "|", `\|`)
+	s = strings.ReplaceAll(s, "\n", " ")
+	return "`" + s + "`"
+}
@@ -0,0 +1,424 @@
+package gostgrator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SignatureNamespace is the namespace migration signatures are made in:
+//
+//	ssh-keygen -Y sign -f ~/.ssh/id_ed25519 -n gostgrator migrations/*.sql
+//
+// Signatures made for another purpose, such as git commits, are rejected.
+const SignatureNamespace = "gostgrator"
+
+// ErrSignature is wrapped by the errors Migrate, Down, DownAll, Reset and
+// CheckSignatures return when a migration is unsigned, signed by a key that
+// is not trusted, or changed since it was signed.
+var ErrSignature = errors.New("migration signature check failed")
+
+// CheckSignatures loads the migrations and checks that every file, including
+// test migrations, has a valid "<file>.sig" signature from a key in
+// Config.TrustedKeysFile. It does nothing unless Config.VerifySignatures is
+// set or Config.Environment is listed in Config.SignedEnvironments. The error
+// lists each file that fails.
+func (g *Gostgrator) CheckSignatures() error {
+	if !g.signaturesRequired() {
+		return nil
+	}
+	migs, err := g.GetMigrations()
+	if err != nil {
+		return err
+	}
+	return g.checkSignatures(migs)
+}
+
+// signaturesRequired reports whether migrations must be signed before they
+// run.
+func (g *Gostgrator) signaturesRequired() bool {
+	return g.cfg.VerifySignatures || (g.cfg.Environment != "" && slices.Contains(g.cfg.SignedEnvironments, g.cfg.Environment))
+}
+
+// checkSignatures verifies the signature of each of migs against the trusted
+// keys, reporting every failure at once so a release can be fixed in one go.
+func (g *Gostgrator) checkSignatures(migs []Migration) error {
+	if len(migs) == 0 {
+		return nil
+	}
+	if g.cfg.TrustedKeysFile == "" {
+		return fmt.Errorf("%w: no trusted keys file is configured", ErrSignature)
+	}
+	trusted, err := loadTrustedKeys(g.cfg.TrustedKeysFile)
+	if err != nil {
+		return err
+	}
+	var failures []string
+	for _, m := range migs {
+		if err := verifyMigrationSignature(m, trusted, g.cfg.TrustedSigners, g.cfg.now()); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", m.Filename, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%w for %d file(s):\n  %s", ErrSignature, len(failures), strings.Join(failures, "\n  "))
+	}
+	return nil
+}
+
+// verifyMigrationSignature checks the "<file>.sig" signature of m, streaming
+// the file through the signature's hash so large migrations are never held
+// in memory. The signing key must be allowed by a line of trusted at now and,
+// if signers is not empty, for one of signers.
+func verifyMigrationSignature(m Migration, trusted []trustedKey, signers []string, now time.Time) error {
+	armored, err := readMigrationFile(m.fsys, m.Filename+".sig")
+	if errors.Is(err, os.ErrNotExist) {
+		return errors.New("not signed")
+	}
+	if err != nil {
+		return err
+	}
+	sig, err := parseSSHSignature(armored)
+	if err != nil {
+		return err
+	}
+	if err := allowSigner(trusted, sig.publicKey, signers, now); err != nil {
+		return err
+	}
+	f, err := openMigrationFile(m.fsys, m.Filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return sig.verify(f)
+}
+
+// trustedKey is a key from the trusted keys file with the restrictions of its
+// line. principals and namespaces are comma-separated pattern lists, empty
+// when the line does not set them.
+type trustedKey struct {
+	key         ssh.PublicKey
+	principals  string
+	namespaces  string
+	validAfter  time.Time
+	validBefore time.Time
+}
+
+// allowSigner returns nil if a line of trusted allows key to sign in
+// SignatureNamespace at now, for one of signers if any are given, or the
+// reason none does.
+func allowSigner(trusted []trustedKey, key ssh.PublicKey, signers []string, now time.Time) error {
+	reason := errors.New("signed by a key that is not trusted")
+	for _, t := range trusted {
+		if !bytes.Equal(t.key.Marshal(), key.Marshal()) {
+			continue
+		}
+		switch {
+		case t.namespaces != "" && !matchPatternList(t.namespaces, SignatureNamespace):
+			reason = fmt.Errorf("signing key is not allowed to sign in namespace %q", SignatureNamespace)
+		case !t.validAfter.IsZero() && now.Before(t.validAfter):
+			reason = fmt.Errorf("signing key is not valid before %s", t.validAfter.Format(time.RFC3339))
+		case !t.validBefore.IsZero() && !now.Before(t.validBefore):
+			reason = fmt.Errorf("signing key expired at %s", t.validBefore.Format(time.RFC3339))
+		case len(signers) > 0 && !slices.ContainsFunc(signers, func(s string) bool { return matchPatternList(t.principals, s) }):
+			reason = fmt.Errorf("signing key does not belong to any of %s", strings.Join(signers, ", "))
+		default:
+			return nil
+		}
+	}
+	return reason
+}
+
+// loadTrustedKeys reads SSH public keys from an authorized_keys or
+// allowed_signers style file. An authorized_keys line is a key such as
+// "ssh-ed25519 AAAA... alice@example.com", optionally preceded by options.
+// An allowed_signers line starts with the principals allowed to use the key,
+// then its options, of which namespaces, valid-after and valid-before are
+// enforced. Blank lines and lines starting with "#" are skipped.
+func loadTrustedKeys(path string) ([]trustedKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trusted keys: %w", err)
+	}
+	var trusted []trustedKey
+	for n, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := parseTrustedKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n+1, err)
+		}
+		trusted = append(trusted, key)
+	}
+	if len(trusted) == 0 {
+		return nil, fmt.Errorf("%s contains no trusted keys", path)
+	}
+	return trusted, nil
+}
+
+// parseTrustedKey parses a line of the trusted keys file: a supported key
+// type followed by its base64 encoding, preceded by principals and options.
+// A first field that is not a list of options is the principals of an
+// allowed_signers line.
+func parseTrustedKey(line string) (trustedKey, error) {
+	fields := splitKeyFields(line)
+	for i := 0; i+1 < len(fields); i++ {
+		if !supportedKeyType(fields[i]) {
+			continue
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[i+1])
+		if err != nil {
+			return trustedKey{}, fmt.Errorf("invalid %s key: %v", fields[i], err)
+		}
+		key, err := ssh.ParsePublicKey(blob)
+		if err != nil || key.Type() != fields[i] {
+			return trustedKey{}, fmt.Errorf("invalid %s key", fields[i])
+		}
+		t := trustedKey{key: key}
+		prefix := fields[:i]
+		if len(prefix) > 0 && !isOptions(prefix[0]) {
+			t.principals = strings.Trim(prefix[0], `"`)
+			prefix = prefix[1:]
+		}
+		if len(prefix) > 1 {
+			return trustedKey{}, fmt.Errorf("unexpected %q before the key", prefix[1])
+		}
+		if len(prefix) == 1 {
+			if err := t.setOptions(prefix[0]); err != nil {
+				return trustedKey{}, err
+			}
+		}
+		return t, nil
+	}
+	return trustedKey{}, errors.New("no ssh-ed25519, ecdsa-sha2-nistp256/384/521 or ssh-rsa public key found")
+}
+
+// setOptions applies the comma-separated options of a trusted key line.
+// Options only meaningful to sshd, such as no-pty, are ignored.
+func (t *trustedKey) setOptions(options string) error {
+	for _, option := range splitOptions(options) {
+		name, value, _ := strings.Cut(option, "=")
+		value = strings.Trim(value, `"`)
+		var err error
+		switch strings.ToLower(name) {
+		case "cert-authority":
+			return errors.New("cert-authority keys are not supported")
+		case "namespaces":
+			t.namespaces = value
+		case "valid-after":
+			t.validAfter, err = parseKeyTime(value)
+		case "valid-before":
+			t.validBefore, err = parseKeyTime(value)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s option: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// isOptions reports whether field is a list of key options, each either
+// name=value or a bare flag such as cert-authority, restrict or no-pty, rather
+// than a list of principals.
+func isOptions(field string) bool {
+	for _, option := range splitOptions(field) {
+		if !strings.Contains(option, "=") && option != "cert-authority" && option != "restrict" && !strings.HasPrefix(option, "no-") {
+			return false
+		}
+	}
+	return true
+}
+
+// parseKeyTime parses the YYYYMMDD[HHMM[SS]] times of the valid-after and
+// valid-before options, in UTC when followed by "Z" and local time otherwise.
+func parseKeyTime(s string) (time.Time, error) {
+	loc := time.Local
+	if rest, ok := strings.CutSuffix(s, "Z"); ok {
+		s, loc = rest, time.UTC
+	}
+	layout := map[int]string{8: "20060102", 12: "200601021504", 14: "20060102150405"}[len(s)]
+	if layout == "" {
+		return time.Time{}, fmt.Errorf("%q is not YYYYMMDD[HHMM[SS]][Z]", s)
+	}
+	return time.ParseInLocation(layout, s, loc)
+}
+
+// splitKeyFields splits a trusted key line at whitespace outside double
+// quotes.
+func splitKeyFields(line string) []string {
+	var fields []string
+	quoted := false
+	start := -1
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t'):
+			if start >= 0 {
+				fields = append(fields, line[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, line[start:])
+	}
+	return fields
+}
+
+// splitOptions splits an options field at commas outside double quotes.
+func splitOptions(options string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, r := range options {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			parts = append(parts, options[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, options[start:])
+}
+
+// matchPatternList reports whether s matches the comma-separated patterns,
+// which may use the * and ? wildcards, as OpenSSH matches principals and
+// namespaces. A match on a pattern negated with "!" rejects s.
+func matchPatternList(patterns, s string) bool {
+	matched := false
+	for _, pattern := range strings.Split(patterns, ",") {
+		negated := strings.HasPrefix(pattern, "!")
+		if ok, _ := path.Match(strings.TrimPrefix(pattern, "!"), s); ok {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// supportedKeyType reports whether signatures from keys of keyType can be
+// verified.
+func supportedKeyType(keyType string) bool {
+	switch keyType {
+	case "ssh-ed25519", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521", "ssh-rsa":
+		return true
+	}
+	return false
+}
+
+// sshSignature is a detached signature in the SSHSIG format written by
+// "ssh-keygen -Y sign", as described in OpenSSH's PROTOCOL.sshsig.
+type sshSignature struct {
+	publicKey ssh.PublicKey
+	namespace string
+	reserved  []byte
+	hashAlg   string
+	signature *ssh.Signature
+}
+
+const (
+	sshsigMagic = "SSHSIG"
+	sshsigBegin = "-----BEGIN SSH SIGNATURE-----"
+	sshsigEnd   = "-----END SSH SIGNATURE-----"
+)
+
+// parseSSHSignature decodes an armored SSHSIG signature made in
+// SignatureNamespace.
+func parseSSHSignature(armored []byte) (*sshSignature, error) {
+	text := strings.TrimSpace(string(armored))
+	if !strings.HasPrefix(text, sshsigBegin) || !strings.HasSuffix(text, sshsigEnd) {
+		return nil, errors.New("signature is not an SSH signature")
+	}
+	body := strings.Join(strings.Fields(text[len(sshsigBegin):len(text)-len(sshsigEnd)]), "")
+	raw, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %v", err)
+	}
+	raw, ok := bytes.CutPrefix(raw, []byte(sshsigMagic))
+	if !ok {
+		return nil, errors.New("invalid SSH signature")
+	}
+	var wire struct {
+		Version   uint32
+		PublicKey []byte
+		Namespace string
+		Reserved  []byte
+		HashAlg   string
+		Signature []byte
+	}
+	if err := ssh.Unmarshal(raw, &wire); err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %v", err)
+	}
+	if wire.Version != 1 {
+		return nil, fmt.Errorf("unsupported SSH signature version %d", wire.Version)
+	}
+	key, err := ssh.ParsePublicKey(wire.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH signature key: %v", err)
+	}
+	signature := new(ssh.Signature)
+	if err := ssh.Unmarshal(wire.Signature, signature); err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %v", err)
+	}
+	if wire.Namespace != SignatureNamespace {
+		return nil, fmt.Errorf("signature was made for namespace %q, not %q", wire.Namespace, SignatureNamespace)
+	}
+	return &sshSignature{
+		publicKey: key,
+		namespace: wire.Namespace,
+		reserved:  wire.Reserved,
+		hashAlg:   wire.HashAlg,
+		signature: signature,
+	}, nil
+}
+
+// verify checks that s signs the content of message. RSA signatures must
+// use SHA-2, as PROTOCOL.sshsig requires.
+func (s *sshSignature) verify(message io.Reader) error {
+	var h hash.Hash
+	switch s.hashAlg {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("unsupported signature hash %q", s.hashAlg)
+	}
+	if s.signature.Format == ssh.KeyAlgoRSA {
+		return errors.New("unsupported SHA-1 rsa signature")
+	}
+	if _, err := io.Copy(h, message); err != nil {
+		return err
+	}
+	signed := append([]byte(sshsigMagic), ssh.Marshal(struct {
+		Namespace string
+		Reserved  []byte
+		HashAlg   string
+		Hash      []byte
+	}{s.namespace, s.reserved, s.hashAlg, h.Sum(nil)})...)
+	if err := s.publicKey.Verify(signed, s.signature); err != nil {
+		return errors.New("content does not match its signature")
+	}
+	return nil
+}
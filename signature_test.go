@@ -0,0 +1,247 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copySignedMigrations copies the migrations in testdata/signed, signed by
+// ssh-keygen with an ed25519, an ecdsa and an rsa key listed in its
+// trusted_keys, into a temporary directory and returns it.
+func copySignedMigrations(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	entries, err := os.ReadDir("testdata/signed")
+	if err != nil {
+		t.Fatalf("failed to read fixtures: %v", err)
+	}
+	for _, e := range entries {
+		content, err := os.ReadFile(filepath.Join("testdata/signed", e.Name()))
+		if err != nil {
+			t.Fatalf("failed to read fixture: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, e.Name()), content, 0o644); err != nil {
+			t.Fatalf("failed to copy fixture: %v", err)
+		}
+	}
+	return dir
+}
+
+func newSignedGostgrator(t *testing.T, dir string, cfg Config) (*Gostgrator, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "signed.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	cfg.Driver = "sqlite3"
+	cfg.MigrationPattern = filepath.Join(dir, "*.sql")
+	cfg.TrustedKeysFile = filepath.Join(dir, "trusted_keys")
+	g, err := NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	return g, db
+}
+
+// TestVerifySignatures verifies that signed migrations run and that an
+// unsigned, untrusted or edited file stops the run before anything is
+// applied.
+func TestVerifySignatures(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("signed", func(t *testing.T) {
+		g, _ := newSignedGostgrator(t, copySignedMigrations(t), Config{VerifySignatures: true})
+		if err := g.CheckSignatures(); err != nil {
+			t.Fatalf("expected all fixtures to verify, got %v", err)
+		}
+		if applied, err := g.Migrate(ctx, "max"); err != nil || len(applied) != 3 {
+			t.Fatalf("expected 3 signed migrations to run, got %d (%v)", len(applied), err)
+		}
+		if _, err := g.Migrate(ctx, "0"); err != nil {
+			t.Fatalf("expected the signed undo migration to run, got %v", err)
+		}
+	})
+
+	for _, tt := range []struct {
+		name   string
+		change func(t *testing.T, dir string)
+		want   string
+	}{
+		{"edited", func(t *testing.T, dir string) {
+			if err := os.WriteFile(filepath.Join(dir, "002.do.b.sql"), []byte("CREATE TABLE signed_b (id INTEGER, extra TEXT);\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}, "002.do.b.sql: content does not match its signature"},
+		{"unsigned", func(t *testing.T, dir string) {
+			if err := os.Remove(filepath.Join(dir, "003.do.c.sql.sig")); err != nil {
+				t.Fatal(err)
+			}
+		}, "003.do.c.sql: not signed"},
+		{"untrusted", func(t *testing.T, dir string) {
+			for _, ext := range []string{"", ".sig"} {
+				content, err := os.ReadFile("testdata/signed-untrusted.sql" + ext)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "004.do.d.sql"+ext), content, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}, "004.do.d.sql: signed by a key that is not trusted"},
+		{"signature swapped", func(t *testing.T, dir string) {
+			content, err := os.ReadFile(filepath.Join(dir, "001.do.a.sql.sig"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "001.undo.a.sql.sig"), content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}, "001.undo.a.sql: content does not match its signature"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := copySignedMigrations(t)
+			tt.change(t, dir)
+			g, db := newSignedGostgrator(t, dir, Config{VerifySignatures: true})
+			err := g.CheckSignatures()
+			if !errors.Is(err, ErrSignature) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected CheckSignatures to report %q, got %v", tt.want, err)
+			}
+			if tt.name == "signature swapped" {
+				// Undo files only run on the way down.
+				return
+			}
+			if _, err := g.Migrate(ctx, "max"); !errors.Is(err, ErrSignature) {
+				t.Fatalf("expected Migrate to refuse, got %v", err)
+			}
+			if tableExists(t, db, "signed_a") {
+				t.Error("expected no migration to run before the signatures were checked")
+			}
+		})
+	}
+}
+
+// TestSignedEnvironments verifies that signatures are only required in the
+// environments listed in SignedEnvironments.
+func TestSignedEnvironments(t *testing.T) {
+	ctx := context.Background()
+	dir := copySignedMigrations(t)
+	if err := os.Remove(filepath.Join(dir, "001.do.a.sql.sig")); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{Environment: "dev", SignedEnvironments: []string{"production"}}
+	g, _ := newSignedGostgrator(t, dir, cfg)
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("expected unsigned migrations to run in dev, got %v", err)
+	}
+	cfg.Environment = "production"
+	g, _ = newSignedGostgrator(t, dir, cfg)
+	if _, err := g.Migrate(ctx, "max"); !errors.Is(err, ErrSignature) || !strings.Contains(err.Error(), "001.do.a.sql: not signed") {
+		t.Fatalf("expected an unsigned migration to be refused in production, got %v", err)
+	}
+}
+
+func TestLoadTrustedKeys(t *testing.T) {
+	keys, err := os.ReadFile("testdata/signed/trusted_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := strings.SplitN(string(keys), "\n", 2)[0]
+	path := filepath.Join(t.TempDir(), "allowed_signers")
+	content := "# release managers\n\nci@example.com namespaces=\"gostgrator\" " + first + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := loadTrustedKeys(path)
+	if err != nil || len(trusted) != 1 {
+		t.Fatalf("expected one key from allowed_signers format, got %d (%v)", len(trusted), err)
+	}
+	if trusted[0].principals != "ci@example.com" || trusted[0].namespaces != "gostgrator" {
+		t.Errorf("expected the principal and namespaces of the line, got %q and %q", trusted[0].principals, trusted[0].namespaces)
+	}
+	if err := os.WriteFile(path, []byte("ssh-dss AAAAB3NzaC1kc3MAAACBAP\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadTrustedKeys(path); err == nil || !strings.Contains(err.Error(), ":1: no ssh-ed25519") {
+		t.Errorf("expected an unsupported key to be reported with its line, got %v", err)
+	}
+	if _, err := NewGostgrator(Config{Driver: "sqlite3", VerifySignatures: true}, nil); err == nil {
+		t.Error("expected VerifySignatures without TrustedKeysFile to be rejected")
+	}
+}
+
+// TestTrustedKeyRestrictions verifies that the principals, namespaces and
+// validity of an allowed_signers line are enforced.
+func TestTrustedKeyRestrictions(t *testing.T) {
+	keys, err := os.ReadFile("testdata/signed/trusted_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := strings.SplitN(string(keys), "\n", 2)[0]
+	for _, tt := range []struct {
+		name, line string
+		signers    []string
+		want       string
+	}{
+		{"authorized_keys", first, nil, ""},
+		{"principal", `"ci@example.com,ops@example.com" ` + first, []string{"ops@example.com"}, ""},
+		{"principal pattern", "*@example.com " + first, []string{"ci@example.com"}, ""},
+		{"other principal", "ci@example.com " + first, []string{"release@example.com"}, "signing key does not belong to any of release@example.com"},
+		{"no principal", first, []string{"ci@example.com"}, "signing key does not belong"},
+		{"negated principal", `"*@example.com,!ci@example.com" ` + first, []string{"ci@example.com"}, "signing key does not belong"},
+		{"namespace", `ci@example.com namespaces="git,gostgrator" ` + first, nil, ""},
+		{"other namespace", `ci@example.com namespaces="git" ` + first, nil, `signing key is not allowed to sign in namespace "gostgrator"`},
+		{"expired", `ci@example.com valid-before="20200101Z" ` + first, nil, "signing key expired at 2020-01-01T00:00:00Z"},
+		{"not yet valid", `ci@example.com valid-after="29990101Z" ` + first, nil, "signing key is not valid before"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := copySignedMigrations(t)
+			if err := os.WriteFile(filepath.Join(dir, "trusted_keys"), []byte(tt.line+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			g, _ := newSignedGostgrator(t, dir, Config{VerifySignatures: true, TrustedSigners: tt.signers})
+			// Only 001.do.a.sql is signed by the first key.
+			err := g.CheckSignatures()
+			if err == nil {
+				t.Fatal("expected the files signed by other keys to fail")
+			}
+			line := "001.do.a.sql: " + tt.want
+			if tt.want == "" && strings.Contains(err.Error(), "001.do.a.sql:") {
+				t.Errorf("expected 001.do.a.sql to verify, got %v", err)
+			} else if tt.want != "" && !strings.Contains(err.Error(), line) {
+				t.Errorf("expected %q, got %v", line, err)
+			}
+		})
+	}
+	if _, err := parseTrustedKey("cert-authority " + first); err == nil {
+		t.Error("expected a cert-authority line to be rejected")
+	}
+}
+
+func TestParseSSHSignatureNamespace(t *testing.T) {
+	armored, err := os.ReadFile("testdata/signed/001.do.a.sql.sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := parseSSHSignature(armored)
+	if err != nil {
+		t.Fatalf("failed to parse fixture: %v", err)
+	}
+	if _, err := parseSSHSignature([]byte("-----BEGIN PGP SIGNATURE-----\n")); err == nil {
+		t.Error("expected a non-SSH signature to be rejected")
+	}
+	sig.namespace = "git"
+	f, err := os.Open("testdata/signed/001.do.a.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := sig.verify(f); err == nil {
+		t.Error("expected a signature checked against another namespace to fail")
+	}
+}
@@ -0,0 +1,59 @@
+package gostgrator
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// startSlowWarning warns once m has run for Config.WarnAfter, unless the
+// returned function is called first: it logs a warning, calls
+// Config.OnSlowMigration and posts a "slow" notification to
+// Config.WebhookURL. The migration carries on; only the run's context stops
+// it.
+func (g *Gostgrator) startSlowWarning(ctx context.Context, m Migration) (stop func()) {
+	if g.cfg.WarnAfter <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		timer := time.NewTimer(g.cfg.WarnAfter)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		g.logger.WarnContext(ctx, "migration running longer than expected", "version", m.Version, "action", m.Action, "name", m.Name, "elapsed", g.cfg.WarnAfter)
+		if g.cfg.OnSlowMigration != nil {
+			g.cfg.OnSlowMigration(m)
+		}
+		if g.cfg.WebhookURL != "" {
+			if err := g.postWebhook(ctx, g.slowPayload(m)); err != nil {
+				g.logger.WarnContext(ctx, "failed to notify webhook", "error", err)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// slowPayload describes m, still running after Config.WarnAfter, for
+// Config.WebhookURL. It is posted whatever Config.NotifyOn says, as it is
+// an alert rather than a summary.
+func (g *Gostgrator) slowPayload(m Migration) WebhookPayload {
+	slow := webhookMigration(m)
+	slow.DurationMs = g.cfg.WarnAfter.Milliseconds()
+	return WebhookPayload{
+		Text:       fmt.Sprintf("gostgrator %s on %s: version %d (%s) has been running for %s and is still going", g.reporting, lockHolder, m.Version, m.Name, g.cfg.WarnAfter),
+		Command:    g.reporting,
+		Status:     "slow",
+		Host:       lockHolder,
+		DurationMs: g.cfg.WarnAfter.Milliseconds(),
+		Migrations: []WebhookMigration{slow},
+	}
+}
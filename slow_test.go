@@ -0,0 +1,72 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSlowMigrationWarning verifies that a migration running longer than
+// WarnAfter is reported to OnSlowMigration and the webhook, even with
+// NotifyOn "failure", and still completes.
+func TestSlowMigrationWarning(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"001.do.backfill.sql": "CREATE TABLE numbers AS WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n WHERE x < 3000000) SELECT x FROM n;",
+		"002.do.flags.sql":    "CREATE TABLE flags (id INTEGER);",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hook := &webhookRecorder{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "slow.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	var mu sync.Mutex
+	var slow []int
+	cfg := Config{
+		Driver:           "sqlite3",
+		MigrationPattern: filepath.Join(dir, "*.sql"),
+		WebhookURL:       server.URL,
+		NotifyOn:         NotifyFailure,
+		WarnAfter:        20 * time.Millisecond,
+		OnSlowMigration: func(m Migration) {
+			mu.Lock()
+			defer mu.Unlock()
+			slow = append(slow, m.Version)
+		},
+	}
+	g, err := NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	ran, err := g.Migrate(context.Background(), "max")
+	if err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if len(ran) != 2 {
+		t.Fatalf("expected both migrations to run, got %d", len(ran))
+	}
+	if len(slow) == 0 || slow[0] != 1 {
+		t.Fatalf("expected version 1 to be reported as slow, got %v", slow)
+	}
+	p := hook.payloads[0]
+	if p.Command != "migrate" || p.Status != "slow" || len(p.Migrations) != 1 || p.Migrations[0].Version != 1 || p.DurationMs != 20 {
+		t.Errorf("unexpected slow payload: %+v", p)
+	}
+	if len(hook.payloads) != len(slow) {
+		t.Errorf("expected one payload per slow migration and none for the successful run, got %+v", hook.payloads)
+	}
+}
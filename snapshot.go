@@ -0,0 +1,234 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrNoSnapshot is returned by DetectDrift when no schema snapshot has been
+// taken yet; see Config.SnapshotSchema.
+var ErrNoSnapshot = errors.New("no schema snapshot has been taken; run migrate with schema snapshots enabled first")
+
+// Drift is the result of DetectDrift.
+type Drift struct {
+	// Version is the database version the snapshot was taken at.
+	Version int `json:"version"`
+	// TakenAt is when the snapshot was taken.
+	TakenAt time.Time `json:"takenAt"`
+	// Differences describes each change from the snapshot to the live
+	// database, such as "column orders.note was added", sorted by table.
+	// It is empty when the database matches the snapshot.
+	Differences []string `json:"differences"`
+}
+
+// quotedSnapshotTable quotes the table holding the schema snapshot, which
+// lives next to the schema table with a "_snapshot" suffix.
+func (g *Gostgrator) quotedSnapshotTable() string {
+	return quoteQualified(g.cfg.SchemaTable + "_snapshot")
+}
+
+// SnapshotSchema stores the structure of the database, as DescribeSchema
+// returns it, in "<SchemaTable>_snapshot" together with the database version,
+// replacing the previous snapshot. With Config.SnapshotSchema it is taken
+// after every run that applied or undid a migration.
+func (g *Gostgrator) SnapshotSchema(ctx context.Context) error {
+	schema, err := g.DescribeSchema(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	version, err := g.GetDatabaseVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := g.client.ExecContext(ctx, fmt.Sprintf(`
+      CREATE TABLE IF NOT EXISTS %s (
+        version BIGINT NOT NULL,
+        structure TEXT NOT NULL,
+        taken_at TIMESTAMP WITH TIME ZONE
+      );
+    `, g.quotedSnapshotTable())); err != nil {
+		return err
+	}
+	if _, err := g.client.ExecContext(ctx, "DELETE FROM "+g.quotedSnapshotTable()+";"); err != nil {
+		return err
+	}
+	ac, bind := g.client.(ArgsClient)
+	v := &sqlValues{driver: g.cfg.Driver, bind: bind}
+	insert := fmt.Sprintf(`
+      INSERT INTO %s (version, structure, taken_at)
+      VALUES (%d, %s, %s);
+    `, g.quotedSnapshotTable(), version, v.text(string(data)), v.time(g.cfg.now()))
+	if bind {
+		_, err = ac.ExecArgsContext(ctx, insert, v.args...)
+	} else {
+		_, err = g.client.ExecContext(ctx, insert)
+	}
+	return err
+}
+
+// DetectDrift compares the live structure of the database with the snapshot
+// taken by SnapshotSchema, reporting tables, columns and indexes changed
+// outside of migrations. It returns ErrNoSnapshot if there is none.
+func (g *Gostgrator) DetectDrift(ctx context.Context) (Drift, error) {
+	checker, ok := g.client.(interface {
+		tableExists(ctx context.Context, table string) (bool, error)
+	})
+	if !ok {
+		return Drift{}, fmt.Errorf("detecting drift is not supported for %s", g.cfg.Driver)
+	}
+	exists, err := checker.tableExists(ctx, g.cfg.SchemaTable+"_snapshot")
+	if err != nil {
+		return Drift{}, err
+	}
+	if !exists {
+		return Drift{}, ErrNoSnapshot
+	}
+	var drift Drift
+	var data string
+	var found bool
+	err = g.queryRows(ctx, "SELECT version, structure, taken_at FROM "+g.quotedSnapshotTable()+";", func(rows *sql.Rows) error {
+		var takenAt any
+		if err := rows.Scan(&drift.Version, &data, &takenAt); err != nil {
+			return err
+		}
+		found = true
+		var err error
+		drift.TakenAt, err = parseRunAt(takenAt)
+		return err
+	})
+	if err != nil {
+		return Drift{}, err
+	}
+	if !found {
+		return Drift{}, ErrNoSnapshot
+	}
+	var expected Schema
+	if err := json.Unmarshal([]byte(data), &expected); err != nil {
+		return Drift{}, fmt.Errorf("invalid schema snapshot: %w", err)
+	}
+	actual, err := g.DescribeSchema(ctx)
+	if err != nil {
+		return Drift{}, err
+	}
+	drift.Differences = diffSchema(expected, actual)
+	return drift, nil
+}
+
+// diffSchema describes how actual differs from expected, table by table.
+func diffSchema(expected, actual Schema) []string {
+	differences := []string{}
+	tables := func(s Schema) map[string]TableInfo {
+		m := make(map[string]TableInfo, len(s.Tables))
+		for _, t := range s.Tables {
+			m[t.Name] = t
+		}
+		return m
+	}
+	want, have := tables(expected), tables(actual)
+	for _, name := range sortedKeys(want, have) {
+		w, inWant := want[name]
+		h, inHave := have[name]
+		switch {
+		case !inHave:
+			differences = append(differences, fmt.Sprintf("table %s was dropped", name))
+		case !inWant:
+			differences = append(differences, fmt.Sprintf("table %s was added", name))
+		default:
+			differences = append(differences, diffTable(w, h)...)
+		}
+	}
+	return differences
+}
+
+// diffTable describes how the columns and indexes of actual differ from
+// those of expected.
+func diffTable(expected, actual TableInfo) []string {
+	var differences []string
+	wantColumns, haveColumns := make(map[string]ColumnInfo), make(map[string]ColumnInfo)
+	for _, c := range expected.Columns {
+		wantColumns[c.Name] = c
+	}
+	for _, c := range actual.Columns {
+		haveColumns[c.Name] = c
+	}
+	for _, name := range sortedKeys(wantColumns, haveColumns) {
+		w, inWant := wantColumns[name]
+		h, inHave := haveColumns[name]
+		switch {
+		case !inHave:
+			differences = append(differences, fmt.Sprintf("column %s.%s was dropped", expected.Name, name))
+		case !inWant:
+			differences = append(differences, fmt.Sprintf("column %s.%s was added", expected.Name, name))
+		case w != h:
+			differences = append(differences, fmt.Sprintf("column %s.%s changed from %s to %s", expected.Name, name, describeColumn(w), describeColumn(h)))
+		}
+	}
+	wantIndexes, haveIndexes := make(map[string]IndexInfo), make(map[string]IndexInfo)
+	for _, i := range expected.Indexes {
+		wantIndexes[i.Name] = i
+	}
+	for _, i := range actual.Indexes {
+		haveIndexes[i.Name] = i
+	}
+	for _, name := range sortedKeys(wantIndexes, haveIndexes) {
+		w, inWant := wantIndexes[name]
+		h, inHave := haveIndexes[name]
+		switch {
+		case !inHave:
+			differences = append(differences, fmt.Sprintf("index %s on %s was dropped", name, expected.Name))
+		case !inWant:
+			differences = append(differences, fmt.Sprintf("index %s on %s was added", name, expected.Name))
+		case w.Unique != h.Unique || !slices.Equal(w.Columns, h.Columns):
+			differences = append(differences, fmt.Sprintf("index %s on %s changed from %s to %s", name, expected.Name, describeIndex(w), describeIndex(h)))
+		}
+	}
+	return differences
+}
+
+// describeColumn renders a column's type, nullability and default for a
+// drift report.
+func describeColumn(c ColumnInfo) string {
+	s := c.Type
+	if !c.Nullable {
+		s += " NOT NULL"
+	}
+	if c.Default != "" {
+		s += " DEFAULT " + c.Default
+	}
+	return s
+}
+
+// describeIndex renders an index's columns and uniqueness for a drift
+// report.
+func describeIndex(i IndexInfo) string {
+	s := "(" + strings.Join(i.Columns, ", ") + ")"
+	if i.Unique {
+		s = "UNIQUE " + s
+	}
+	return s
+}
+
+// sortedKeys returns the keys of both maps, sorted and without duplicates.
+func sortedKeys[V any](a, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,63 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestDetectDrift verifies that a snapshot is taken after a run that applied
+// migrations and that changes made outside of migrations are reported.
+func TestDetectDrift(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "drift.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := NewGostgrator(Config{Driver: "sqlite3", MigrationPattern: writeTransactionMigrations(t), SnapshotSchema: true}, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.DetectDrift(ctx); !errors.Is(err, ErrNoSnapshot) {
+		t.Errorf("expected ErrNoSnapshot before any run, got %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	drift, err := g.DetectDrift(ctx)
+	if err != nil || drift.Version != 2 || len(drift.Differences) != 0 {
+		t.Fatalf("expected no drift at version 2, got %+v (%v)", drift, err)
+	}
+
+	for _, stmt := range []string{
+		"ALTER TABLE a ADD COLUMN note TEXT",
+		"CREATE UNIQUE INDEX a_id_idx ON a (id)",
+		"DROP TABLE b",
+		"CREATE TABLE c (id INTEGER)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	drift, err = g.DetectDrift(ctx)
+	want := []string{
+		"column a.note was added",
+		"index a_id_idx on a was added",
+		"table b was dropped",
+		"table c was added",
+	}
+	if err != nil || !slices.Equal(drift.Differences, want) {
+		t.Errorf("expected %q, got %q (%v)", want, drift.Differences, err)
+	}
+
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if drift, err := g.DetectDrift(ctx); err != nil || len(drift.Differences) != len(want) {
+		t.Errorf("expected a run that applied nothing to keep the snapshot, got %q (%v)", drift.Differences, err)
+	}
+}
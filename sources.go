@@ -0,0 +1,96 @@
+package gostgrator
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// SourceMigration is a migration supplied in memory through Config.Sources
+// instead of read from files, for systems that generate their schema at
+// runtime. Its SQL is checksummed, parsed for directives and recorded like
+// that of a migration file.
+type SourceMigration struct {
+	// Version of the migration.
+	Version int
+	// Name is an optional descriptive name of the migration.
+	Name string
+	// UpSQL is the "do" script.
+	UpSQL string
+	// DownSQL is the optional "undo" script.
+	DownSQL string
+}
+
+// filename returns the name a migration of s is listed under, as if it had
+// been read from a file.
+func (s SourceMigration) filename(action string) string {
+	if s.Name == "" {
+		return fmt.Sprintf("%d.%s.sql", s.Version, action)
+	}
+	return fmt.Sprintf("%d.%s.%s.sql", s.Version, action, s.Name)
+}
+
+// sourceMigrations returns the do and undo migrations of cfg.Sources, read
+// from an in-memory file system so they run like migration files.
+func sourceMigrations(cfg Config) ([]Migration, error) {
+	fsys := make(sourceFS)
+	var migrations []Migration
+	for _, s := range cfg.Sources {
+		if s.Version <= 0 {
+			return nil, fmt.Errorf("source migration %q must have a positive version, not %d", s.Name, s.Version)
+		}
+		if strings.Contains(s.Name, "/") {
+			return nil, fmt.Errorf("source migration %d has an invalid name %q", s.Version, s.Name)
+		}
+		if strings.TrimSpace(s.UpSQL) == "" {
+			return nil, fmt.Errorf("source migration %d has no UpSQL", s.Version)
+		}
+		for _, script := range []struct{ action, sql string }{{"do", s.UpSQL}, {"undo", s.DownSQL}} {
+			if script.sql == "" {
+				continue
+			}
+			file := s.filename(script.action)
+			fsys[file] = script.sql
+			md5sum, directives, err := parseMigrationFile(fsys, file, cfg.checksumStyle())
+			if err != nil {
+				return nil, err
+			}
+			migrations = append(migrations, Migration{
+				Version:    s.Version,
+				Action:     script.action,
+				Filename:   file,
+				Name:       s.Name,
+				Md5:        md5sum,
+				Directives: directives,
+				fsys:       fsys,
+			})
+		}
+	}
+	return migrations, nil
+}
+
+// sourceFS serves the SQL of source migrations as read-only files, by name.
+type sourceFS map[string]string
+
+func (s sourceFS) Open(name string) (fs.File, error) {
+	content, ok := s[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &sourceFile{name: name, Reader: strings.NewReader(content)}, nil
+}
+
+// sourceFile is an open file of a sourceFS. It is its own fs.FileInfo.
+type sourceFile struct {
+	name string
+	*strings.Reader
+}
+
+func (f *sourceFile) Stat() (fs.FileInfo, error) { return f, nil }
+func (f *sourceFile) Close() error               { return nil }
+func (f *sourceFile) Name() string               { return f.name }
+func (f *sourceFile) Mode() fs.FileMode          { return 0o444 }
+func (f *sourceFile) ModTime() time.Time         { return time.Time{} }
+func (f *sourceFile) IsDir() bool                { return false }
+func (f *sourceFile) Sys() any                   { return nil }
@@ -14,28 +14,233 @@
 // # Commands
 //
 //	migrate [target]    Apply all pending migrations up to *target* (default "max").
-//	down   [steps]      Roll back the last *steps* migrations (default 1).
+//	down   [steps|all]  Roll back the last *steps* migrations (default 1), or all of
+//	                    them after confirmation. With -dry-run, only report the undo
+//	                    files, the tables they touch and any later-applied migrations
+//	                    that reference those tables.
+//	reset               Roll back every migration, then migrate to the latest version,
+//	                    after confirmation.
 //	new    <desc>       Scaffold an empty migration pair labelled *desc*.
-//	drop-schema         Delete the migration‑tracking table.
+//	drop-schema         Delete the migration‑tracking table and the lock, history,
+//	                    progress and snapshot tables next to it.
+//	upgrade-schema-table
+//	                    Create the migration-tracking table or add the columns newer
+//	                    versions need; see -auto-upgrade-schema-table.
+//	unlock              Release a migration lock left behind by a killed process.
+//	freeze [reason]     Make migrate, down and reset fail with exit code 4 until
+//	                    unfreeze runs, e.g. during an incident.
+//	unfreeze            Lift a freeze so migrations can run again.
 //	list                List available migrations and highlight the current version.
+//	                    Narrow the list with -pending, -applied, -since and -grep,
+//	                    show applied migrations in the order they ran with
+//	                    -order run_at, and print bare version numbers for scripts
+//	                    with -versions-only.
+//	explain-version <v> Print everything about one version for triage: its do, undo
+//	                    and test files with checksums, the checksum recorded in the
+//	                    database, whether and when it was applied, its directives,
+//	                    recorded metadata and full SQL.
+//	reconstruct [plan]  Rebuild a lost schema table: look for the tables, indexes and
+//	                    columns each migration creates, propose the version rows and
+//	                    record them after confirmation, or write them to -o for review;
+//	                    with *plan*, record a reviewed plan file.
+//	drift-check         Compare the tables, columns and indexes of the database with the
+//	                    snapshot taken after the last migrate with -snapshot-schema and
+//	                    list changes made outside of migrations; exits 1 on drift.
+//	exec <file.sql>     Run an operational SQL script under the migration lock, in the
+//	                    -transaction mode, honoring directives and "-- gostgrator:only"
+//	                    blocks and posting to -webhook-url, without recording a version.
+//	batch  [file]       Run migrate, down, verify, lint and version commands read
+//	                    from *file* or stdin (one per line, or a JSON array) in order
+//	                    over one connection, stopping at the first failure.
+//	export-undo         Write a script of the undo migrations from -from down to -to,
+//	                    newest first, each in a transaction with its schema table
+//	                    update, for a DBA to review and run. No connection is needed.
+//	lint                Check every migration filename against the filename policy,
+//	                    and signatures with -verify-signatures.
+//	verify              Check filenames, signatures with -verify-signatures, that
+//	                    applied migrations still match the
+//	                    checksums recorded when they ran and that no migration was
+//	                    skipped below the current version. With -with-tests, also run
+//	                    the test migrations (001.test.sql) of applied versions.
+//	ui                  Full-screen terminal UI listing applied and pending migrations;
+//	                    read a migration's SQL and step up, down or to the selected
+//	                    migration while the running step is shown live.
+//	fleet-status <file> Compare the version of every database listed in *file* (one
+//	                    connection per line, '#' comments allowed) with the latest
+//	                    migration and flag the ones lagging behind.
+//	postgrator [version] [options]
+//	                    Migrate with postgrator-cli's options (--to, --database,
+//	                    --migration-pattern, --config and the rest) and checksums,
+//	                    as a drop-in replacement; it must be the first argument, or
+//	                    the binary named postgrator.
+//	help [command]      Show only the options, examples and exit codes of *command*;
+//	                    "<command> -help" and "-help <command>" do the same.
+//	config show         Print every setting of the effective configuration with
+//	                    where its value came from (flag, env, file or default);
+//	                    -json prints it as JSON. Credentials are redacted.
+//	<alias> [args]      Run an alias from the "aliases" field of -config, such as
+//	                    "deploy": ["migrate", "max"]. Flags in the alias apply before
+//	                    those on the command line, and args are appended to it.
 //
 // # Global flags
 //
 //	-conn string               SQLite connection string (file path). Overrides $SQLITE_URL
-//	                           and the "conn" field in -config.
-//	-config string             Optional JSON file that mirrors gostgrator.Config.
+//	                           and the "conn" field in -config. "-" reads it from the
+//	                           first line of stdin.
+//	-conn-file string          Read the connection string from a file such as a mounted
+//	                           secret, keeping it out of process arguments.
+//	-conn-env string           Read the connection string from the named environment variable.
+//	-verify-conn string        Read-only connection used by *list*, *explain-version*, *verify*
+//	                           and *drift-check*, opened with mode=ro so it is never created or
+//	                           written. Overrides $SQLITE_VERIFY_URL and the "verifyConn" field
+//	                           in -config; falls back to the main connection when unset.
+//	-config string             Optional JSON file that mirrors gostgrator.Config; its
+//	                           relative paths resolve from the file's directory, and
+//	                           unknown keys are an error unless it sets "strictConfig": false.
+//	-C, -chdir string          Change to this directory first, so -config, -migration-pattern
+//	                           and other relative paths resolve from it, like git -C.
+//	-project string            Run for this project of the workspace file, with its
+//	                           migration pattern, schema table and connection variable.
+//	-all-projects              Run the command once for every project of the workspace file.
+//	-workspace string          Workspace file listing a monorepo's projects (default
+//	                           gostgrator.work.json in the working directory or a parent).
+//	-sqlite-driver string      "mattn" (mattn/go-sqlite3, needs cgo) or "modernc"
+//	                           (modernc.org/sqlite, pure Go); default "mattn", or
+//	                           "modernc" in binaries built without cgo.
 //	-migration-pattern string  Glob for locating *.sql migrations (default "migrations/*.sql").
+//	-exclude-pattern string    Glob of migration files to ignore, such as drafts; "**" matches
+//	                           any directories and a pattern without "/" matches base names.
 //	-schema-table string       Table used to track migration state (default "schemaversion").
 //	-mode string               Numbering mode for *new*: "int" or "timestamp" (default "int").
+//	-style string              Naming for *new*: "do-undo", "up-down" or "golang-migrate"
+//	                           (default "do-undo").
+//	-migration-format string   "golang-migrate" also reads 001_name.up.sql and .down.sql files.
+//	-checksum-compat string    "postgrator" computes checksums as node-postgrator does, so
+//	                           the md5 values it recorded validate without a repair step.
+//	-golang-migrate-table string
+//	                           Count the version golang-migrate recorded in this table
+//	                           (e.g. schema_migrations) as applied; it is never written.
+//	-cache-file string         Cache migration checksums between runs so large migration
+//	                           sets start instantly; entries are invalidated when a file's
+//	                           modification time or size changes.
+//	-pending                   With list, only show migrations not applied yet.
+//	-applied                   With list, only show applied migrations.
+//	-since string              With list, only show migrations applied on or after a date
+//	                           (YYYY-MM-DD or RFC 3339).
+//	-grep string               With list, only show migrations whose name or filename
+//	                           contains the text, ignoring case.
+//	-order string              With list, "version" (default) or "run_at" to show applied
+//	                           migrations in the order they ran, then the rest by version.
+//	-versions-only             With list, print only the version numbers, one per line.
+//	-backup-dir string         Back up the database into this directory before down,
+//	                           drop-schema and migrations that drop, truncate or delete.
+//	-backup-keep int           Backups to keep in -backup-dir, oldest removed first (0 all).
+//	-compact                   After down or drop-schema, run VACUUM to shrink the file and
+//	                           report its size before and after.
+//	-with-tests                With verify, run each applied version's test migration in a
+//	                           rolled-back transaction and report each file's result. Runs on
+//	                           the main connection, since tests write fixtures.
+//	-dry-run                   With down, print the rollback plan and impact summary
+//	                           without touching the database.
+//	-check-data-loss           Count the rows in tables and columns undo migrations drop;
+//	                           down -dry-run and verify report them, and rollbacks that
+//	                           would destroy data are refused.
+//	-data-loss-threshold int   Rows a dropped table or column may hold before
+//	                           -check-data-loss reports it (default 0).
+//	-acknowledge-data-loss     Let a rollback refused by -check-data-loss run anyway.
+//	-from int                  With export-undo, the version to roll back from.
+//	-to int                    With export-undo, the version to roll back to.
+//	-o string                  With export-undo, write the script to this file instead of
+//	                           stdout; with reconstruct, write the proposed rows to it.
+//	-filename-policy string    Regular expression, or preset "kebab-case" or "ticket",
+//	                           that migration filenames must match. Checked by *new*,
+//	                           *lint* and *verify*.
+//	-verify-signatures         Refuse to run migrations without a valid <file>.sig SSH
+//	                           signature from a key in -trusted-keys. Also checked by
+//	                           *lint* and *verify*.
+//	-trusted-keys string       File of SSH public keys allowed to sign migrations, in
+//	                           authorized_keys or allowed_signers format.
+//	-env string                Environment name (e.g. "staging"). Migrations whose
+//	                           "environments" directive does not list it are recorded
+//	                           without running, or skipped with "skipGatedMigrations".
+//	-include-tag string        Comma-separated tags; migrate only runs files whose "tags"
+//	                           directive lists one of them.
+//	-exclude-tag string        Comma-separated tags; migrate leaves out files whose "tags"
+//	                           directive lists one of them.
+//	-allow-out-of-order        Let migrate apply files above ones the tag filters leave
+//	                           pending, run pending files below the database version and
+//	                           skip unapplied versions when rolling back.
+//	-to-date string            With migrate, target the highest timestamp version at or
+//	                           before a YYYY-MM-DD day (UTC) or RFC 3339 time.
+//	-max-apply int             Apply at most this many migrations per migrate; exits 5
+//	                           while more are pending.
+//	-expect-version int        With migrate, fail without changing anything unless the
+//	                           database is at this version once the lock is taken.
+//	-ignore-windows            Run migrations outside their "window" directive's
+//	                           maintenance window instead of deferring them.
+//	-translate-sql             Rewrite SERIAL, TIMESTAMPTZ and AUTOINCREMENT columns
+//	                           written for the other database (best effort).
+//	-auto-upgrade-schema-table
+//	                           Let migrate and down add missing columns to an older schema
+//	                           table (default true). With =false they fail until
+//	                           upgrade-schema-table has run.
+//	-transaction string        "each" commits every migration with its version row in one
+//	                           transaction, "all" the whole command; "none" (default) runs
+//	                           files as they are. Files opt out with transaction=none.
+//	-record-progress           Run migrations statement by statement, recording each one
+//	                           so a failed migration resumes after its last good statement.
+//	-best-effort               Treat errors about objects that already exist or do not
+//	                           exist as warnings, recording migrations as applied and
+//	                           listing the warnings at the end. Files opt out with
+//	                           "-- gostgrator: best-effort=false".
+//	-audit-history             Mark undone migrations with undone_at instead of deleting
+//	                           their rows, and log every do and undo to <table>_history.
+//	-snapshot-schema           After each run that changes the database, store its tables,
+//	                           columns and indexes in <table>_snapshot for *drift-check*.
+//	-emit-schema string        After a successful migrate, down or reset, write the tables,
+//	                           columns and indexes to a Markdown (or .json) file.
+//	-capture-env string        Comma-separated environment variables (e.g. GIT_SHA) recorded
+//	                           with the hostname as JSON in the schema table's metadata column.
+//	-if-exists                 With drop-schema, succeed when the table is already gone.
+//	-only-core                 With drop-schema, keep the lock, history, progress and
+//	                           snapshot tables.
+//	-cascade                   Accepted for parity with gostgrator-pg; SQLite has no CASCADE.
+//	-wait-for-lock duration    How long migrate, down and batch wait for another process
+//	                           to release the migration lock (default: fail at once).
+//	-timeout duration          How long a command may run before it is canceled, stopping
+//	                           the migration it is running (default 10m).
+//	-warn-after duration       Warn on stderr and through -webhook-url when a migration has
+//	                           run this long, letting it run on until -timeout.
+//	-webhook-url string        Post a JSON summary of each migrate, down and reset to this
+//	                           webhook, signed with $GOSTGRATOR_WEBHOOK_SECRET when set.
+//	-notify-on string          When to post to -webhook-url: "always" (default) or "failure".
+//	-non-interactive           Never prompt; ui fails with exit status 2 instead, for
+//	                           schedulers and systemd timers.
+//	-yes                       Skip the confirmation prompt of reset, down all and
+//	                           reconstruct; needed with -non-interactive.
+//	-log-file string           Also append each output line, timestamped, to this file.
+//	-log-max-size int          Rotate -log-file past this many megabytes (default 10, 0 never).
+//	-log-max-files int         Rotated -log-file copies to keep as <file>.1, ... (default 5).
 //	-help                      Show built‑in help.
 //	-version                   Print gostgrator‑sqlite version.
+//	-json                      Print JSON: with -version, the version, git commit, Go version
+//	                           and supported drivers; with migrate and down, the run summary
+//	                           (count, total and slowest time, final version) instead of text.
+//	-format string             "github" also prints lint, verify, migrate, down and reset
+//	                           failures as ::error annotations on the migration files.
 //
-// *Precedence:* -conn flag ➜ $SQLITE_URL ➜ "conn" in -config
+// *Precedence:* -conn, -conn-file or -conn-env flag ➜ the -project's "connEnv", or $SQLITE_URL ➜ "conn" in -config
+//
+// Any connection value may be written as "env://NAME" to read it from the
+// environment variable NAME. "file:" values are passed to SQLite unchanged as
+// URI filenames. Passwords are masked in all output, including driver errors.
 //
 // # Environment
 //
 //	SQLITE_URL  Connection string used when -conn is omitted; overrides the "conn"
 //	            value defined in a JSON config file.
+//	SQLITE_VERIFY_URL  Read-only connection string used by *list*, *verify* and the other read-only commands;
+//	                   overrides the "verifyConn" value defined in a JSON config file.
 //
 // Example:
 //
@@ -50,12 +255,27 @@
 //	# Roll back the two most recent migrations
 //	gostgrator-sqlite down 2
 //
+//	# Preview what rolling back two migrations would affect
+//	gostgrator-sqlite -dry-run down 2
+//
+//	# Rebuild the database from scratch without a prompt
+//	gostgrator-sqlite -yes reset
+//
 //	# Create a timestamp‑based migration called create-users
 //	gostgrator-sqlite new "create-users" -mode timestamp
 //
 //	# Print migrations with the current version highlighted
 //	gostgrator-sqlite list
 //
+//	# Which migrations touching users are not applied yet?
+//	gostgrator-sqlite -pending -grep users list
+//
+//	# Loop over the pending versions in a script
+//	for v in $(gostgrator-sqlite -pending -versions-only list); do echo "$v"; done
+//
+//	# Show which databases in fleet.txt lag behind the latest migration
+//	gostgrator-sqlite fleet-status fleet.txt
+//
 // # Configuration file
 //
 // A JSON config file can replace most flags:
@@ -73,8 +293,15 @@
 //
 // # Exit status
 //
-// The program exits non‑zero on any error. Each command runs with a context that
-// times out after ten minutes.
+//	0  The command succeeded.
+//	1  The command ran but failed, e.g. a migration error.
+//	2  Invalid flags, arguments or configuration file.
+//	3  Another process holds the migration lock.
+//	4  Migrations are frozen.
+//	5  migrate stopped at -max-apply with migrations still pending.
+//
+// Output is line-buffered. Each command runs with a context that times out
+// after -timeout, ten minutes by default.
 //
 // For driver‑agnostic details see the root gostgrator package.
 //
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver using cgo
+	_ "modernc.org/sqlite"          // SQLite driver in pure Go
+)
+
+// sqliteDrivers maps the names accepted by -sqlite-driver to the
+// database/sql drivers they register.
+var sqliteDrivers = map[string]string{
+	"mattn":   "sqlite3", // github.com/mattn/go-sqlite3, which needs cgo
+	"modernc": "sqlite",  // modernc.org/sqlite, a translation of SQLite to Go
+}
+
+// sqliteDriver is the database/sql driver databases are opened with, set from
+// -sqlite-driver. It defaults to mattn/go-sqlite3 unless the binary was built
+// without cgo, where that driver cannot open databases.
+var sqliteDriver = sqliteDrivers[defaultSQLiteDriver]
+
+// setSQLiteDriver selects the driver named by -sqlite-driver or the
+// "sqliteDriver" config field. An empty name keeps the default.
+func setSQLiteDriver(name string) error {
+	if name == "" {
+		return nil
+	}
+	driver, ok := sqliteDrivers[name]
+	if !ok {
+		return fmt.Errorf("unknown SQLite driver %q, must be one of: mattn or modernc", name)
+	}
+	sqliteDriver = driver
+	return nil
+}
+
+// openConn returns the data source name conn is opened with. modernc.org/sqlite
+// does not wait for locks by default, so it is given the five second busy
+// timeout mattn/go-sqlite3 uses unless conn sets its own.
+func openConn(conn string) string {
+	if sqliteDriver != sqliteDrivers["modernc"] || strings.Contains(conn, "busy_timeout") {
+		return conn
+	}
+	sep := "?"
+	if strings.Contains(conn, "?") {
+		sep = "&"
+	}
+	return conn + sep + "_pragma=busy_timeout(5000)"
+}
+
+// readOnlyConn returns conn as a file: URI opened with mode=ro, so SQLite
+// refuses writes and reports a missing database instead of creating it. Both
+// drivers read the mode parameter only from file: URIs.
+func readOnlyConn(conn string) string {
+	if !strings.HasPrefix(conn, "file:") {
+		conn = "file:" + conn
+	}
+	sep := "?"
+	if strings.Contains(conn, "?") {
+		sep = "&"
+	}
+	return conn + sep + "mode=ro"
+}
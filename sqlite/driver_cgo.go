@@ -0,0 +1,6 @@
+//go:build cgo
+
+package main
+
+// defaultSQLiteDriver is the -sqlite-driver used when none is given.
+const defaultSQLiteDriver = "mattn"
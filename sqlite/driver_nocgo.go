@@ -0,0 +1,7 @@
+//go:build !cgo
+
+package main
+
+// defaultSQLiteDriver is the -sqlite-driver used when none is given. Without
+// cgo, mattn/go-sqlite3 only returns errors, so the pure Go driver is used.
+const defaultSQLiteDriver = "modernc"
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -108,6 +109,10 @@ func TestCLIDown(t *testing.T) {
 // TestCLIDropSchema tests the "drop-schema" command.
 func TestCLIDropSchema(t *testing.T) {
 	connArg := makeTestConnURL()
+	// Roll back first so later tests can re-apply migrations to a clean database.
+	if _, err := helperRun([]string{"-conn", connArg, "-migration-pattern", testMigrationsPath, "migrate", "0"}); err != nil {
+		t.Fatalf("SQLite CLI reset (migrate 0) failed: %v", err)
+	}
 	args := []string{
 		"-conn", connArg,
 		"drop-schema",
@@ -119,6 +124,15 @@ func TestCLIDropSchema(t *testing.T) {
 	if !strings.Contains(out, "Dropping schema table") {
 		t.Errorf("expected drop schema message, got:\n%s", out)
 	}
+
+	db, err := sql.Open("sqlite3", connArg)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if ok, _ := tableExists(db, "schemaversion"); ok {
+		t.Errorf("expected schemaversion table to be dropped")
+	}
 }
 
 // TestCLINew tests the "new" command which creates migration files.
@@ -130,9 +144,9 @@ func TestCLINew(t *testing.T) {
 	defer os.RemoveAll(tmpDir)
 
 	cfg := map[string]interface{}{
-		"MigrationPattern": filepath.Join(tmpDir, "*.sql"),
-		"Driver":           "sqlite3",
-		"SchemaTable":      "schemaversion",
+		"MigrationPattern":  filepath.Join(tmpDir, "*.sql"),
+		"Driver":            "sqlite3",
+		"SchemaTable":       "schemaversion",
 		"ValidateChecksums": true,
 	}
 	cfgPath := filepath.Join(tmpDir, "config.json")
@@ -350,3 +364,299 @@ func TestCLIListChain(t *testing.T) {
 		t.Errorf("expected migration version 5 to be annotated as current, got:\n%s", out)
 	}
 }
+
+// TestCLIFleetStatus migrates one of two databases and checks that fleet-status
+// reports the other one as lagging.
+func TestCLIFleetStatus(t *testing.T) {
+	tmpDir := t.TempDir()
+	currentDB := filepath.Join(tmpDir, "current.db")
+	staleDB := filepath.Join(tmpDir, "stale.db")
+
+	_, err := helperRun([]string{"-conn", currentDB, "-migration-pattern", testMigrationsPath, "migrate", "max"})
+	if err != nil {
+		t.Fatalf("SQLite CLI migrate command failed: %v", err)
+	}
+	_, err = helperRun([]string{"-conn", staleDB, "-migration-pattern", testMigrationsPath, "migrate", "2"})
+	if err != nil {
+		t.Fatalf("SQLite CLI migrate command failed: %v", err)
+	}
+
+	fleetFile := filepath.Join(tmpDir, "fleet.txt")
+	if err := os.WriteFile(fleetFile, []byte(currentDB+"\n"+staleDB+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write fleet file: %v", err)
+	}
+
+	out, err := helperRun([]string{"-migration-pattern", testMigrationsPath, "fleet-status", fleetFile})
+	if err != nil {
+		t.Fatalf("SQLite CLI fleet-status command failed: %v; output: %s", err, out)
+	}
+	if !strings.Contains(out, "Latest available migration version: 6") {
+		t.Errorf("expected latest version 6, got:\n%s", out)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, currentDB) && !strings.Contains(line, "up to date") {
+			t.Errorf("expected %s to be up to date, got: %s", currentDB, line)
+		}
+		if strings.HasPrefix(line, staleDB) && !strings.Contains(line, "behind by 4") {
+			t.Errorf("expected %s to be behind by 4, got: %s", staleDB, line)
+		}
+	}
+}
+
+// TestCLIDropSchemaIfExists checks that -if-exists makes drop-schema idempotent.
+func TestCLIDropSchemaIfExists(t *testing.T) {
+	conn := filepath.Join(t.TempDir(), "drop.db")
+	if _, err := helperRun([]string{"-conn", conn, "list"}); err != nil {
+		t.Fatalf("SQLite CLI list command failed: %v", err)
+	}
+
+	out, err := helperRun([]string{"-conn", conn, "drop-schema"})
+	if err == nil {
+		t.Fatalf("expected drop-schema without -if-exists to fail for a missing table, got:\n%s", out)
+	}
+
+	for i := 0; i < 2; i++ {
+		out, err = helperRun([]string{"-conn", conn, "-if-exists", "-cascade", "drop-schema"})
+		if err != nil {
+			t.Fatalf("SQLite CLI drop-schema -if-exists failed: %v; output: %s", err, out)
+		}
+		if !strings.Contains(out, "Schema table dropped.") {
+			t.Errorf("expected schema table dropped message, got:\n%s", out)
+		}
+	}
+}
+
+// TestCLIDownDryRun checks that down -dry-run reports the rollback plan
+// without changing the database version.
+func TestCLIDownDryRun(t *testing.T) {
+	conn := filepath.Join(t.TempDir(), "dryrun.db")
+	if out, err := helperRun([]string{"-conn", conn, "-migration-pattern", testMigrationsPath, "migrate"}); err != nil {
+		t.Fatalf("SQLite CLI migrate command failed: %v; output: %s", err, out)
+	}
+
+	out, err := helperRun([]string{"-conn", conn, "-migration-pattern", testMigrationsPath, "-dry-run", "down", "2"})
+	if err != nil {
+		t.Fatalf("SQLite CLI down -dry-run failed: %v; output: %s", err, out)
+	}
+	for _, want := range []string{
+		"Dry run: would roll back 2 migration(s):",
+		"Version 6:",
+		"Version 5:",
+		"touches tables: person",
+		"warning: version 6",
+		"applied after version 5",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in dry-run output, got:\n%s", want, out)
+		}
+	}
+
+	out, err = helperRun([]string{"-conn", conn, "-migration-pattern", testMigrationsPath, "list"})
+	if err != nil {
+		t.Fatalf("SQLite CLI list command failed: %v; output: %s", err, out)
+	}
+	if !strings.Contains(out, "Current database migration version: 6") {
+		t.Errorf("expected dry run to leave version 6, got:\n%s", out)
+	}
+}
+
+// TestCLIListFilters checks the -pending, -applied, -since and -grep list filters.
+func TestCLIListFilters(t *testing.T) {
+	conn := filepath.Join(t.TempDir(), "filters.db")
+	base := []string{"-conn", conn, "-migration-pattern", testMigrationsPath}
+	if out, err := helperRun(append(base, "migrate", "3")); err != nil {
+		t.Fatalf("SQLite CLI migrate command failed: %v; output: %s", err, out)
+	}
+
+	list := func(filters ...string) string {
+		args := append(append(append([]string{}, base...), filters...), "list")
+		out, err := helperRun(args)
+		if err != nil {
+			t.Fatalf("SQLite CLI list %v failed: %v; output: %s", filters, err, out)
+		}
+		return out
+	}
+
+	out := list("-pending")
+	if strings.Contains(out, "Version 3:") || !strings.Contains(out, "Version 4:") || !strings.Contains(out, "Matching migrations:") {
+		t.Errorf("expected only pending migrations, got:\n%s", out)
+	}
+
+	out = list("-applied")
+	if !strings.Contains(out, "Version 3: ") || !strings.Contains(out, "<== current") || strings.Contains(out, "Version 4:") {
+		t.Errorf("expected only applied migrations with the current annotation, got:\n%s", out)
+	}
+
+	out = list("-grep", "SOME-desc")
+	if !strings.Contains(out, "Version 2: some-description") || strings.Contains(out, "Version 1:") {
+		t.Errorf("expected only the matching migration, got:\n%s", out)
+	}
+
+	out = list("-since", "2000-01-01")
+	if !strings.Contains(out, "Version 1:") || strings.Contains(out, "Version 4:") {
+		t.Errorf("expected applied migrations since 2000, got:\n%s", out)
+	}
+	out = list("-since", "2999-01-01")
+	if strings.Contains(out, "Version 1:") {
+		t.Errorf("expected no migrations applied since 2999, got:\n%s", out)
+	}
+
+	out, err := helperRun(append(base, "-pending", "-applied", "list"))
+	if err == nil || !strings.Contains(out, "cannot be used together") {
+		t.Errorf("expected -pending and -applied to conflict, got:\n%s", out)
+	}
+	out, err = helperRun(append(base, "-since", "last week", "list"))
+	if err == nil || !strings.Contains(out, "invalid -since date") {
+		t.Errorf("expected an invalid -since error, got:\n%s", out)
+	}
+}
+
+// TestCLIEnvFlag checks that -env controls whether gated migrations run.
+func TestCLIEnvFlag(t *testing.T) {
+	for env, expected := range map[string]int{"dev": 1, "production": 0} {
+		conn := filepath.Join(t.TempDir(), env+".db")
+		out, err := helperRun([]string{"-conn", conn, "-migration-pattern", "../../testdata/envMigrations/*.sql", "-env", env, "migrate"})
+		if err != nil {
+			t.Fatalf("SQLite CLI migrate -env %s failed: %v; output: %s", env, err, out)
+		}
+		if !strings.Contains(out, "Applied 3 migrations") {
+			t.Errorf("expected all 3 versions to be recorded in %s, got:\n%s", env, out)
+		}
+
+		db, err := sql.Open("sqlite3", conn)
+		if err != nil {
+			t.Fatalf("open db: %v", err)
+		}
+		var cnt int
+		if err := db.QueryRow("SELECT COUNT(*) FROM seeds").Scan(&cnt); err != nil {
+			t.Fatalf("count seeds: %v", err)
+		}
+		db.Close()
+		if cnt != expected {
+			t.Errorf("expected %d seed rows in %s, got %d", expected, env, cnt)
+		}
+	}
+}
+
+// TestCLIMigrateReportsPartialApply checks that a failed migrate lists the
+// migrations applied before the failure.
+func TestCLIMigrateReportsPartialApply(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, content := range map[string]string{
+		"001.do.sql": "CREATE TABLE users (id INTEGER);\n",
+		"002.do.sql": "INSERT INTO missing_table VALUES (1);\n",
+	} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write migration: %v", err)
+		}
+	}
+	out, err := helperRun([]string{"-conn", filepath.Join(tmpDir, "partial.db"), "-migration-pattern", filepath.Join(tmpDir, "*.sql"), "migrate"})
+	if err == nil {
+		t.Fatalf("expected migrate to fail, got:\n%s", out)
+	}
+	for _, want := range []string{"Migration error:", "Applied 1 migration(s) before", "002.do.sql failed", "Version 1 do"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got:\n%s", want, out)
+		}
+	}
+}
+
+// TestCLICompact checks that -compact vacuums after down and reports sizes.
+func TestCLICompact(t *testing.T) {
+	conn := filepath.Join(t.TempDir(), "compact.db")
+	base := []string{"-conn", conn, "-migration-pattern", testMigrationsPath}
+	if out, err := helperRun(append(base, "migrate")); err != nil {
+		t.Fatalf("SQLite CLI migrate command failed: %v; output: %s", err, out)
+	}
+	out, err := helperRun(append(base, "-compact", "down", "6"))
+	if err != nil {
+		t.Fatalf("SQLite CLI -compact down failed: %v; output: %s", err, out)
+	}
+	if !strings.Contains(out, "Compacting database...") || !strings.Contains(out, "Compacted database from") {
+		t.Errorf("expected compaction to be reported, got:\n%s", out)
+	}
+}
+
+// TestCLILogFile verifies that -log-file receives a timestamped copy of the
+// CLI output.
+func TestCLILogFile(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "gostgrator.log")
+	args := []string{"-conn", filepath.Join(dir, "log.db"), "-migration-pattern", testMigrationsPath, "-log-file", logPath, "-non-interactive", "migrate"}
+	out, err := helperRun(args)
+	if err != nil {
+		t.Fatalf("SQLite CLI migrate with -log-file failed: %v; output: %s", err, out)
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != len(strings.Split(strings.TrimSpace(out), "\n")) {
+		t.Fatalf("expected every output line in the log, got:\n%s", data)
+	}
+	for _, line := range lines {
+		stamp, _, _ := strings.Cut(line, " ")
+		if _, err := time.Parse(time.RFC3339, stamp); err != nil {
+			t.Errorf("expected log line to start with a timestamp, got %q", line)
+		}
+	}
+}
+
+// TestCLILintAndVerify checks the filename policy with lint and verify, and
+// that verify catches an applied migration edited after it ran.
+func TestCLILintAndVerify(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"001.do.abc-1-first.sql", "001.undo.abc-1-first.sql", "002.do.second.sql", "002.undo.second.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1;\n"), 0644); err != nil {
+			t.Fatalf("failed to write migration: %v", err)
+		}
+	}
+	base := []string{"-conn", filepath.Join(dir, "verify.db"), "-migration-pattern", filepath.Join(dir, "*.sql")}
+
+	out, err := helperRun(append(base, "-filename-policy", "ticket", "lint"))
+	if err == nil || !strings.Contains(out, "002.do.second.sql, 002.undo.second.sql") {
+		t.Fatalf("expected lint to report version 2 files, got %v; output: %s", err, out)
+	}
+	if out, err := helperRun(append(base, "-filename-policy", "kebab-case", "lint")); err != nil {
+		t.Fatalf("expected kebab-case lint to pass: %v; output: %s", err, out)
+	}
+
+	if out, err := helperRun(append(base, "migrate")); err != nil {
+		t.Fatalf("SQLite CLI migrate command failed: %v; output: %s", err, out)
+	}
+	if out, err := helperRun(append(base, "verify")); err != nil || !strings.Contains(out, "Verified migrations up to version 2") {
+		t.Fatalf("expected verify to pass: %v; output: %s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "001.do.abc-1-first.sql"), []byte("SELECT 2;\n"), 0644); err != nil {
+		t.Fatalf("failed to edit migration: %v", err)
+	}
+	out, err = helperRun(append(base, "verify"))
+	if err == nil || !strings.Contains(out, "MD5 checksum failed for migration [1]") {
+		t.Fatalf("expected verify to catch the edited migration, got %v; output: %s", err, out)
+	}
+}
+
+// TestCLIBatch runs a batch from stdin and checks that it stops at the first
+// failing step.
+func TestCLIBatch(t *testing.T) {
+	base := []string{"-conn", filepath.Join(t.TempDir(), "batch.db"), "-migration-pattern", testMigrationsPath, "batch"}
+	cmd := exec.Command(cliBinary, base...)
+	cmd.Stdin = strings.NewReader("migrate 3\nverify\nversion\nmigrate max\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("SQLite CLI batch failed: %v; output: %s", err, out)
+	}
+	for _, want := range []string{"Batch step 1/4: migrate 3", "Current database migration version: 3", "Batch completed 4 step(s)."} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+
+	cmd = exec.Command(cliBinary, base...)
+	cmd.Stdin = strings.NewReader(`["down 1", "migrate latest", "version"]`)
+	out, err = cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "Batch stopped at step 2 (migrate latest); 1 later step(s) were not run.") {
+		t.Fatalf("expected batch to stop at step 2, got %v; output: %s", err, out)
+	}
+}
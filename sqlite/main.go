@@ -6,266 +6,83 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"os"
-	"sort"
-	"strconv"
-	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3" // SQLite driver
-
 	"github.com/bcomnes/gostgrator"
+	"github.com/bcomnes/gostgrator/clitool"
 )
 
-var versionString = gostgrator.Version
-
-// usage prints the help text.
-func usage() {
-	header := `Usage:
-  gostgrator-sqlite [command] [arguments] [options]
-
-Commands:
-  migrate [target]    Migrate the schema to a target version (default: "max").
-  down [steps]        Roll back the specified number of migrations (default: 1).
-  new <desc>          Create a new empty migration pair with the provided description.
-  drop-schema         Drop the schema version table.
-  list                List available migrations and annotate the migration matching the database version.
-
-Options:`
-	fmt.Fprintln(os.Stderr, header)
-	flag.PrintDefaults()
-}
+var (
+	driverName = flag.String("sqlite-driver", "", "SQLite driver: \"mattn\" (mattn/go-sqlite3, needs cgo) or \"modernc\" (modernc.org/sqlite, pure Go) (overrides \"sqliteDriver\" in -config; default \"mattn\", or \"modernc\" in binaries built without cgo)")
+	backupDir  = flag.String("backup-dir", "", "Back up the database into this directory before down, drop-schema and migrations that drop, truncate or delete (overrides \"sqliteBackupDir\" in -config)")
+	backupKeep = flag.Int("backup-keep", 0, "Number of backups to keep in -backup-dir, removing the oldest first; 0 keeps all (overrides \"sqliteBackupKeep\" in -config)")
+	compact    = flag.Bool("compact", false, "Run VACUUM after down and drop-schema to shrink the database file, reporting its size before and after")
+)
 
 func main() {
-	// Define global flags.
-	connStr := flag.String("conn", "", "SQLite connection URL (file path). Overrides SQLITE_URL and the \"conn\" field in -config.")
-	configPath := flag.String("config", "", "Path to JSON configuration file (optional)")
-	migrationPattern := flag.String("migration-pattern", "", "Glob pattern for migration files (default \"migrations/*.sql\")")
-	schemaTable := flag.String("schema-table", "", "Name of the schema table (default \"schemaversion\")")
-	mode := flag.String("mode", "int", "Migration numbering mode (\"int\" or \"timestamp\") for new command")
-	helpFlag := flag.Bool("help", false, "Show help message")
-	versionFlag := flag.Bool("version", false, "Show version")
-
-	flag.Usage = usage
-	flag.Parse()
-
-	// Safeguard: check for any flag-like arguments after positional arguments.
-	for _, arg := range flag.Args() {
-		if strings.HasPrefix(arg, "-") {
-			fmt.Fprintln(os.Stderr, "Error: Flags must be specified before the command. Please reorder your arguments.")
-			usage()
-			os.Exit(1)
-		}
-	}
-
-	// Process global flags.
-	if *helpFlag {
-		usage()
-		os.Exit(0)
-	}
-	if *versionFlag {
-		fmt.Println("gostgrator-sqlite version:", versionString)
-		os.Exit(0)
-	}
-
-	// ------------------------------------------------------------------
-	// Configuration precedence:
-	//   1. Flags supplied by the user
-	//   2. Values from the JSON config file
-	//   3. Built‑in defaults
-	// ------------------------------------------------------------------
-
-	cliConfig := gostgrator.Config{Driver: "sqlite3"}
-
-	// 2. Load JSON config if provided.
-	if *configPath != "" {
-		if err := loadConfig(*configPath, &cliConfig); err != nil {
-			fmt.Fprintf(os.Stderr, "Error loading config file: %v\n", err)
-			os.Exit(1)
-		}
-	}
-
-	// 3. Fill defaults.
-	if cliConfig.SchemaTable == "" {
-		cliConfig.SchemaTable = "schemaversion"
-	}
-	if cliConfig.MigrationPattern == "" {
-		cliConfig.MigrationPattern = "migrations/*.sql"
-	}
-
-	// 1. Let explicitly‑passed flags win (empty means the user didn't set it).
-    if *schemaTable != "" {
-        cliConfig.SchemaTable = *schemaTable
-    }
-    if *migrationPattern != "" {
-        cliConfig.MigrationPattern = *migrationPattern
-    }
-
-	// Process positional arguments.
-	args := flag.Args()
-	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Error: no command provided.")
-		usage()
-		os.Exit(1)
-	}
-	command := args[0]
-
-	switch command {
-	case "migrate":
-		target := "max"
-		if len(args) > 1 {
-			target = args[1]
-		}
-		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
-			fmt.Printf("[%s] Starting migration to version %s...\n", time.Now().Format(time.Kitchen), target)
-			applied, err := g.Migrate(ctx, target)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Migration error: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Printf("[%s] Applied %d migrations:\n", time.Now().Format(time.Kitchen), len(applied))
-			for _, m := range applied {
-				fmt.Printf("  - Version %d: %s (%s)\n", m.Version, m.Name, m.Filename)
-			}
-		})
-	case "down":
-		steps := 1
-		if len(args) > 1 {
-			var err error
-			steps, err = strconv.Atoi(args[1])
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Invalid rollback steps: %s\n", args[1])
-				os.Exit(1)
-			}
-		}
-		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
-			fmt.Printf("[%s] Rolling back %d migration(s)...\n", time.Now().Format(time.Kitchen), steps)
-			applied, err := g.Down(ctx, steps)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Rollback error: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Printf("[%s] Rolled back %d migration(s):\n", time.Now().Format(time.Kitchen), len(applied))
-			for _, m := range applied {
-				fmt.Printf("  - Rolled back version %d: %s (%s)\n", m.Version, m.Name, m.Filename)
-			}
-		})
-	case "drop-schema":
-		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
-			fmt.Printf("[%s] Dropping schema table...\n", time.Now().Format(time.Kitchen))
-			if err := dropSchema(ctx, cliConfig, g); err != nil {
-				fmt.Fprintf(os.Stderr, "Error dropping schema table: %v\n", err)
-				os.Exit(1)
+	clitool.Main(clitool.Tool{
+		Name:          "gostgrator-sqlite",
+		Driver:        "sqlite3",
+		Database:      "SQLite",
+		ConnEnv:       "SQLITE_URL",
+		VerifyConnEnv: "SQLITE_VERIFY_URL",
+		Open: func(conn string) (*sql.DB, error) {
+			return sql.Open(sqliteDriver, openConn(conn))
+		},
+		OpenReadOnly: func(conn string) (*sql.DB, error) {
+			return sql.Open(sqliteDriver, openConn(readOnlyConn(conn)))
+		},
+		Configure: configure,
+		AfterDrop: func(g *gostgrator.Gostgrator, ctx context.Context) error {
+			if !*compact {
+				return nil
 			}
-			fmt.Printf("[%s] Schema table dropped.\n", time.Now().Format(time.Kitchen))
-		})
-	case "new":
-		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "Error: a description is required for the new command.")
-			usage()
-			os.Exit(1)
-		}
-		description := args[1]
-		g, err := gostgrator.NewGostgrator(cliConfig, nil)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error initializing gostgrator: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Printf("[%s] Creating new migration with description '%s' in %s mode...\n", time.Now().Format(time.Kitchen), description, *mode)
-		if err := g.CreateMigration(description, *mode); err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating new migration: %v\n", err)
-			os.Exit(1)
-		}
-		fmt.Printf("[%s] New migration created successfully.\n", time.Now().Format(time.Kitchen))
-	case "list":
-		withDB(cliConfig, *connStr, func(g *gostgrator.Gostgrator, ctx context.Context) {
-			current, err := g.GetDatabaseVersion(ctx)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error fetching current database version: %v\n", err)
-				os.Exit(1)
-			}
-			migs, err := g.GetMigrations()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error loading migrations: %v\n", err)
-				os.Exit(1)
-			}
-			sort.Slice(migs, func(i, j int) bool { return migs[i].Version < migs[j].Version })
-			fmt.Printf("Current database migration version: %d\n", current)
-			fmt.Println("Available migrations:")
-			for _, m := range migs {
-				annot := ""
-				if m.Version == current {
-					annot = " <== current"
-				}
-				fmt.Printf("Version %d: %s (%s)%s\n", m.Version, m.Name, m.Filename, annot)
-			}
-		})
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
-		usage()
-		os.Exit(1)
-	}
+			return compactDatabase(g, ctx)
+		},
+	})
 }
 
-func withDB(cliConfig gostgrator.Config, flagConn string, f func(g *gostgrator.Gostgrator, ctx context.Context)) {
-	// Precedence: flag > env > config file
-	connStr := firstNonEmpty(
-		flagConn,
-		os.Getenv("SQLITE_URL"),
-		cliConfig.Conn,
-	)
-
-	if connStr == "" {
-		fmt.Fprintln(os.Stderr, "Error: connection URL must be provided via -conn flag, SQLITE_URL env var, or \"conn\" in config file")
-		usage()
-		os.Exit(1)
+// configure applies the SQLite flags to cfg and selects the driver.
+func configure(cfg *gostgrator.Config) error {
+	if *backupDir != "" {
+		cfg.SQLiteBackupDir = *backupDir
 	}
-
-	db, err := sql.Open("sqlite3", connStr)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening database: %v\n", err)
-		os.Exit(1)
-	}
-	defer db.Close()
-
-	g, err := gostgrator.NewGostgrator(cliConfig, db)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error initializing gostgrator: %v\n", err)
-		os.Exit(1)
+	if *backupKeep != 0 {
+		cfg.SQLiteBackupKeep = *backupKeep
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancel()
-
-	f(g, ctx)
+	return setSQLiteDriver(cmp.Or(*driverName, cfg.SQLiteDriver))
 }
 
-func loadConfig(path string, cfg *gostgrator.Config) error {
-	f, err := os.Open(path)
+// compactDatabase runs VACUUM and reports how much the database shrank.
+func compactDatabase(g *gostgrator.Gostgrator, ctx context.Context) error {
+	stdout, stderr := clitool.Stdout(), clitool.Stderr()
+	fmt.Fprintf(stdout, "[%s] Compacting database...\n", time.Now().Format(time.Kitchen))
+	start := time.Now()
+	stats, err := g.Compact(ctx)
 	if err != nil {
+		fmt.Fprintf(stderr, "Error compacting database: %v\n", err)
 		return err
 	}
-	defer f.Close()
-	return json.NewDecoder(f).Decode(cfg)
+	fmt.Fprintf(stdout, "[%s] Compacted database from %s to %s in %s.\n", time.Now().Format(time.Kitchen),
+		formatBytes(stats.SizeBefore), formatBytes(stats.SizeAfter), time.Since(start).Round(time.Millisecond))
+	return nil
 }
 
-func dropSchema(ctx context.Context, cfg gostgrator.Config, g *gostgrator.Gostgrator) error {
-	query := fmt.Sprintf("DROP TABLE %s", cfg.SchemaTable)
-	_, err := g.QueryContext(ctx, query)
-	return err
-}
-
-// firstNonEmpty returns the first non-empty string in vals.
-func firstNonEmpty(vals ...string) string {
-	for _, v := range vals {
-		if v != "" {
-			return v
-		}
+// formatBytes formats a byte count using binary units, e.g. "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
 	}
-	return ""
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
 }
@@ -2,12 +2,19 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/bcomnes/gostgrator"
+	"github.com/bcomnes/gostgrator/clitool"
 )
 
 // -----------------------------------------------------------------------------
@@ -65,6 +72,40 @@ func TestCLIHelp(t *testing.T) {
 	}
 }
 
+// TestCLICommandHelp checks that help <command>, -help <command> and
+// <command> -help print only the options, examples and exit codes of the
+// command.
+func TestCLICommandHelp(t *testing.T) {
+	for _, args := range [][]string{{"help", "list"}, {"-help", "list"}, {"list", "-help"}} {
+		out, err := runCLI(args)
+		if err != nil {
+			t.Fatalf("%v: %v\n%s", args, err, out)
+		}
+		for _, want := range []string{"gostgrator-sqlite [options] list", "-pending", "-versions-only", "gostgrator-sqlite -pending list", "Exit codes:"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("%v: expected %q in:\n%s", args, want, out)
+			}
+		}
+		if strings.Contains(out, "-max-apply") || strings.Contains(out, "migrate [target]") {
+			t.Errorf("%v: expected only the options of list, got:\n%s", args, out)
+		}
+	}
+	out, err := runCLI([]string{"migrate", "-help"})
+	if err != nil || !strings.Contains(out, "-max-apply") || !strings.Contains(out, "5  migrate stopped at -max-apply") {
+		t.Errorf("expected the options and exit codes of migrate, got %v:\n%s", err, out)
+	}
+	if strings.Contains(out, "-secondary-conn") {
+		t.Errorf("expected no -secondary-conn in gostgrator-sqlite, got:\n%s", out)
+	}
+	var exitErr *exec.ExitError
+	if out, err := runCLI([]string{"help", "foobar"}); !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitUsage || !strings.Contains(out, "unknown command: foobar") {
+		t.Errorf("expected help for an unknown command to exit with %d, got %v:\n%s", clitool.ExitUsage, err, out)
+	}
+	if out, _ := runCLI([]string{"help"}); !strings.Contains(out, "help [command]") {
+		t.Errorf("expected help to print the usage info, got:\n%s", out)
+	}
+}
+
 // TestCLIVersion checks that -version prints version string.
 func TestCLIVersion(t *testing.T) {
 	out, _ := runCLI([]string{"-version"})
@@ -106,6 +147,76 @@ func TestCLIConfigLoadError(t *testing.T) {
 	}
 }
 
+// TestCLIStrictConfig checks that a misspelled key in the config file is an
+// error naming the key it was probably meant to be, unless the file sets
+// "strictConfig": false.
+func TestCLIStrictConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gostgrator.json")
+	if err := os.WriteFile(path, []byte(`{"schmaTable": "versions"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := runCLI([]string{"-config", path, "lint"})
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitUsage || !strings.Contains(out, `"schmaTable" (did you mean "schemaTable"?)`) {
+		t.Errorf("expected an unknown key to exit with %d and a suggestion, got %v:\n%s", clitool.ExitUsage, err, out)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"schmaTable": "versions", "strictConfig": false, "migrationPattern": "none/*.sql"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := runCLI([]string{"-config", path, "lint"}); err != nil {
+		t.Errorf("expected strictConfig false to ignore the key, got %v:\n%s", err, out)
+	}
+}
+
+// TestCLIInvalidConfig checks that a bad configuration is reported before the
+// database is opened.
+func TestCLIInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "invalid.db")
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"newline": "LFCR", "transaction": "all", "recordProgress": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := runCLI([]string{"-conn", dbFile, "-config", cfgPath, "migrate"})
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitUsage {
+		t.Errorf("expected exit code %d, got %v:\n%s", clitool.ExitUsage, err, out)
+	}
+	for _, want := range []string{"Error: invalid configuration:", `unknown newline "LFCR"`, "RecordProgress cannot be used"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if fileExists(dbFile) {
+		t.Error("expected the database not to be opened")
+	}
+}
+
+// TestCLIConfigShow checks that config show prints the effective settings
+// and their sources, and still prints an invalid configuration.
+func TestCLIConfigShow(t *testing.T) {
+	out, err := runCLI([]string{"-schema-table", "flag_versions", "-transaction", "bogus", "config", "show"}, "SQLITE_URL=app.db")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitUsage {
+		t.Errorf("expected an invalid configuration to exit with %d, got %v:\n%s", clitool.ExitUsage, err, out)
+	}
+	for _, pattern := range []string{
+		`(?m)^KEY +VALUE +SOURCE$`,
+		`(?m)^schemaTable +"flag_versions" +flag -schema-table$`,
+		`(?m)^conn +"app.db" +env SQLITE_URL$`,
+		`(?m)^validateChecksums +true +default$`,
+		`Error: invalid configuration: unknown transaction mode "bogus"`,
+	} {
+		if !regexp.MustCompile(pattern).MatchString(out) {
+			t.Errorf("expected output to match %s:\n%s", pattern, out)
+		}
+	}
+	if out, err := runCLI([]string{"config"}); err == nil || !strings.Contains(out, "requires the subcommand show") {
+		t.Errorf("expected config without show to fail, got %v:\n%s", err, out)
+	}
+}
+
 // -----------------------------------------------------------------------------
 // New connection‑precedence tests
 // -----------------------------------------------------------------------------
@@ -192,3 +303,1125 @@ func TestConnPrecedence_MissingEverywhere(t *testing.T) {
 		t.Errorf("expected missing conn error, got:\n%s", out)
 	}
 }
+
+// TestVerifyConnUsedByList ensures list opens -verify-conn instead of -conn,
+// read-only, so it neither creates nor writes the verify database.
+func TestVerifyConnUsedByList(t *testing.T) {
+	tmpDir := t.TempDir()
+	mainDB := filepath.Join(tmpDir, "main.db")
+	verifyDB := filepath.Join(tmpDir, "verify.db")
+
+	if out, err := runCLI([]string{"-conn", mainDB, "-verify-conn", verifyDB, "list"}, "SQLITE_URL=", "SQLITE_VERIFY_URL="); err == nil {
+		t.Errorf("expected list to fail on a missing verify DB, got:\n%s", out)
+	}
+	if fileExists(verifyDB) || fileExists(mainDB) {
+		t.Fatalf("expected list to create neither database")
+	}
+
+	// An empty file is an empty SQLite database.
+	if err := os.WriteFile(verifyDB, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := runCLI([]string{"-conn", mainDB, "-verify-conn", verifyDB, "list"}, "SQLITE_URL=", "SQLITE_VERIFY_URL="); err != nil {
+		t.Fatalf("CLI run: %v\n%s", err, out)
+	}
+	if fileExists(mainDB) {
+		t.Errorf("expected verify DB to be used over main DB")
+	}
+	if info, err := os.Stat(verifyDB); err != nil || info.Size() != 0 {
+		t.Errorf("expected the verify DB to be left unwritten, got %v, %v", info, err)
+	}
+}
+
+// TestFleetStatusMissingFile ensures fleet-status requires a file argument.
+func TestFleetStatusMissingFile(t *testing.T) {
+	out, _ := runCLI([]string{"fleet-status"})
+	if !strings.Contains(out, "Error: a file of connection URLs is required") {
+		t.Errorf("expected missing file error, got:\n%s", out)
+	}
+}
+
+// TestConnFileAndEnvIndirection checks that -conn-file and env:// resolve to the database path.
+func TestConnFileAndEnvIndirection(t *testing.T) {
+	tmpDir := t.TempDir()
+	fileDB := filepath.Join(tmpDir, "file.db")
+	envDB := filepath.Join(tmpDir, "env.db")
+	secretFile := filepath.Join(tmpDir, "db_url")
+	if err := os.WriteFile(secretFile, []byte(fileDB+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret file: %v", err)
+	}
+
+	if out, err := runCLI([]string{"-conn-file", secretFile, "list"}, "SQLITE_URL=", "SQLITE_VERIFY_URL="); err != nil {
+		t.Fatalf("CLI run with -conn-file: %v\n%s", err, out)
+	}
+	if !fileExists(fileDB) {
+		t.Errorf("expected -conn-file database to be created")
+	}
+
+	if out, err := runCLI([]string{"-conn", "env://GOSTGRATOR_TEST_DB", "list"}, "GOSTGRATOR_TEST_DB="+envDB, "SQLITE_VERIFY_URL="); err != nil {
+		t.Fatalf("CLI run with env:// connection: %v\n%s", err, out)
+	}
+	if !fileExists(envDB) {
+		t.Errorf("expected env:// database to be created")
+	}
+
+	out, err := runCLI([]string{"-conn", "env://GOSTGRATOR_TEST_UNSET", "list"}, "SQLITE_VERIFY_URL=")
+	if err == nil || !strings.Contains(out, "GOSTGRATOR_TEST_UNSET") {
+		t.Errorf("expected an unset variable error, got:\n%s", out)
+	}
+}
+
+// TestConnStdinAndConnEnv checks that "-conn -" reads the connection from the
+// first line of stdin, leaving the rest for confirmation prompts, and that
+// -conn-env reads it from the named environment variable.
+func TestConnStdinAndConnEnv(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbFile := filepath.Join(tmpDir, "stdin.db")
+	pattern := filepath.Join(tmpDir, "*.sql")
+	if err := os.WriteFile(filepath.Join(tmpDir, "001.do.create.sql"), []byte("CREATE TABLE t (id INTEGER);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "001.undo.create.sql"), []byte("DROP TABLE t;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-conn", "-", "-migration-pattern", pattern, "migrate")
+	cmd.Env = append(os.Environ(), "GO_HELPER_PROCESS=1", "SQLITE_URL=")
+	cmd.Stdin = strings.NewReader(dbFile + "\n")
+	if raw, err := cmd.CombinedOutput(); err != nil || !fileExists(dbFile) {
+		t.Fatalf("expected migrate to use the connection from stdin, got %v:\n%s", err, raw)
+	}
+	cmd = exec.Command(os.Args[0], "-conn", "-", "-migration-pattern", pattern, "down", "all")
+	cmd.Env = append(os.Environ(), "GO_HELPER_PROCESS=1", "SQLITE_URL=")
+	cmd.Stdin = strings.NewReader(dbFile + "\nyes\n")
+	if raw, err := cmd.CombinedOutput(); err != nil || !strings.Contains(string(raw), "final version: 0") {
+		t.Errorf("expected down all to read its confirmation after the connection, got %v:\n%s", err, raw)
+	}
+
+	if out, err := runCLI([]string{"-conn-env", "GOSTGRATOR_TEST_DB", "-migration-pattern", pattern, "list"}, "GOSTGRATOR_TEST_DB="+dbFile, "SQLITE_URL=", "SQLITE_VERIFY_URL="); err != nil || !strings.Contains(out, "Current database migration version: 0") {
+		t.Errorf("expected list to use the connection from -conn-env, got %v:\n%s", err, out)
+	}
+	var exitErr *exec.ExitError
+	if out, err := runCLI([]string{"-conn", dbFile, "-conn-env", "GOSTGRATOR_TEST_DB", "list"}); !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitUsage || !strings.Contains(out, "cannot be used together") {
+		t.Errorf("expected -conn and -conn-env to conflict, got %v:\n%s", err, out)
+	}
+}
+
+// TestCLIExitCodes verifies that usage errors and failures exit with their
+// documented codes.
+func TestCLIExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "exit.db")
+	if err := os.WriteFile(filepath.Join(dir, "001.do.sql"), []byte("NOT SQL;"), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	cases := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"foobar"}, clitool.ExitUsage},
+		{[]string{"-conn", dbFile, "-non-interactive", "ui"}, clitool.ExitUsage},
+		{[]string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql"), "migrate"}, clitool.ExitFailure},
+	}
+	for _, c := range cases {
+		out, err := runCLI(c.args)
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != c.code {
+			t.Errorf("%v: expected exit code %d, got %v; output:\n%s", c.args, c.code, err, out)
+		}
+	}
+}
+
+// TestCLIVersionJSON checks the machine-readable -version output.
+func TestCLIVersionJSON(t *testing.T) {
+	out, err := runCLI([]string{"-version", "-json"})
+	if err != nil {
+		t.Fatalf("-version -json failed: %v; output: %s", err, out)
+	}
+	var info struct {
+		Version   string   `json:"version"`
+		GitCommit *string  `json:"gitCommit"`
+		GoVersion string   `json:"goVersion"`
+		Drivers   []string `json:"drivers"`
+	}
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatalf("expected JSON, got %q: %v", out, err)
+	}
+	if info.Version != gostgrator.Version || info.GitCommit == nil || !strings.HasPrefix(info.GoVersion, "go") || strings.Join(info.Drivers, ",") != "pg,sqlite3" {
+		t.Errorf("unexpected version info: %s", out)
+	}
+}
+
+// TestCLIRunSummary checks the summary footer and its -json form.
+func TestCLIRunSummary(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"001.do.a.sql":   "CREATE TABLE a (id INTEGER);",
+		"001.undo.a.sql": "DROP TABLE a;",
+		"002.do.b.sql":   "CREATE TABLE b (id INTEGER);",
+		"002.undo.b.sql": "DROP TABLE b;",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write migration: %v", err)
+		}
+	}
+	base := []string{"-conn", filepath.Join(dir, "summary.db"), "-migration-pattern", filepath.Join(dir, "*.sql")}
+
+	out, err := runCLI(append(base, "migrate", "1"))
+	if err != nil {
+		t.Fatalf("migrate failed: %v; output:\n%s", err, out)
+	}
+	if !strings.Contains(out, "Summary: 1 applied in ") || !strings.Contains(out, "slowest: version 1 (a)") || !strings.Contains(out, "final version: 1") {
+		t.Errorf("expected a summary footer, got:\n%s", out)
+	}
+
+	out, err = runCLI(append(append([]string{"-json"}, base...), "migrate"))
+	if err != nil {
+		t.Fatalf("migrate -json failed: %v; output:\n%s", err, out)
+	}
+	var summary struct {
+		Command      string `json:"command"`
+		Count        int    `json:"count"`
+		FinalVersion *int   `json:"finalVersion"`
+		Slowest      *struct {
+			Version int `json:"version"`
+		} `json:"slowest"`
+		Migrations []struct {
+			Version int    `json:"version"`
+			Action  string `json:"action"`
+		} `json:"migrations"`
+	}
+	if err := json.Unmarshal([]byte(out), &summary); err != nil {
+		t.Fatalf("expected only JSON on stdout, got %q: %v", out, err)
+	}
+	if summary.Command != "migrate" || summary.Count != 1 || summary.FinalVersion == nil || *summary.FinalVersion != 2 ||
+		summary.Slowest == nil || summary.Slowest.Version != 2 || len(summary.Migrations) != 1 || summary.Migrations[0].Action != "do" {
+		t.Errorf("unexpected summary: %s", out)
+	}
+}
+
+// TestCLIUpgradeSchemaTable checks that -auto-upgrade-schema-table=false
+// blocks migrate on an older schema table until upgrade-schema-table runs.
+func TestCLIUpgradeSchemaTable(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "upgrade.db")
+	if err := os.WriteFile(filepath.Join(dir, "001.do.sql"), []byte("CREATE TABLE a (id INTEGER);"), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE schemaversion (version INTEGER PRIMARY KEY); INSERT INTO schemaversion VALUES (0);"); err != nil {
+		t.Fatalf("failed to create legacy schema table: %v", err)
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql"), "-auto-upgrade-schema-table=false"}
+
+	if out, err := runCLI(append(base, "migrate")); err == nil || !strings.Contains(out, "upgrade-schema-table") {
+		t.Fatalf("expected migrate to fail until the table is upgraded, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "upgrade-schema-table")); err != nil {
+		t.Fatalf("upgrade-schema-table failed: %v\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "migrate")); err != nil {
+		t.Fatalf("migrate after the upgrade failed: %v\n%s", err, out)
+	}
+}
+
+// TestCLIMigrationLock checks that migrate exits with clitool.ExitLocked while another
+// process holds the lock, also after waiting, and succeeds once unlock clears it.
+func TestCLIMigrationLock(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "lock.db")
+	if err := os.WriteFile(filepath.Join(dir, "001.do.sql"), []byte("CREATE TABLE a (id INTEGER);"), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE schemaversion_lock (id INTEGER PRIMARY KEY, holder TEXT NOT NULL, locked_at TIMESTAMP WITH TIME ZONE); INSERT INTO schemaversion_lock VALUES (1, 'elsewhere:1', '2024-01-02 03:04:05');"); err != nil {
+		t.Fatalf("failed to take the lock: %v", err)
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+
+	for _, args := range [][]string{
+		append(base, "migrate"),
+		append(base, "-wait-for-lock", "1500ms", "migrate"),
+	} {
+		out, err := runCLI(args)
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitLocked {
+			t.Fatalf("%v: expected exit code %d, got %v; output:\n%s", args, clitool.ExitLocked, err, out)
+		}
+		if !strings.Contains(out, "held by elsewhere:1") {
+			t.Errorf("expected the lock holder to be reported, got:\n%s", out)
+		}
+	}
+	if out, err := runCLI(append(base, "unlock")); err != nil {
+		t.Fatalf("unlock failed: %v\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "migrate")); err != nil {
+		t.Fatalf("migrate after unlock failed: %v\n%s", err, out)
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schemaversion_lock").Scan(&n); err != nil || n != 0 {
+		t.Errorf("expected migrate to release the lock, got %d rows (%v)", n, err)
+	}
+}
+
+// TestCLIVerifyWithTests checks that verify -with-tests reports each test
+// file and fails when an assertion does.
+func TestCLIVerifyWithTests(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "tests.db")
+	files := map[string]string{
+		"001.do.items.sql":  "CREATE TABLE items (id INTEGER);",
+		"001.test.sql":      "SELECT count(*) = 0 FROM items;",
+		"002.do.more.sql":   "INSERT INTO items VALUES (1);",
+		"002.test.more.sql": "SELECT count(*) = 2 FROM items;",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+
+	if out, err := runCLI(append(base, "migrate", "1")); err != nil {
+		t.Fatalf("migrate failed: %v\n%s", err, out)
+	}
+	out, err := runCLI(append(base, "-with-tests", "verify"))
+	if err != nil || !strings.Contains(out, "ok   "+filepath.Join(dir, "001.test.sql")) {
+		t.Fatalf("expected verify -with-tests to pass, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "migrate")); err != nil {
+		t.Fatalf("migrate failed: %v\n%s", err, out)
+	}
+	out, err = runCLI(append(base, "-with-tests", "verify"))
+	if err == nil || !strings.Contains(out, "FAIL "+filepath.Join(dir, "002.test.more.sql")) {
+		t.Fatalf("expected verify -with-tests to report the failing test, got %v:\n%s", err, out)
+	}
+}
+
+// TestCLIVerifyWithTestsIgnoresVerifyConn checks that verify -with-tests
+// runs on the main connection, since tests that write fixtures would fail on
+// the read-only -verify-conn one.
+func TestCLIVerifyWithTestsIgnoresVerifyConn(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "tests.db")
+	files := map[string]string{
+		"001.do.items.sql": "CREATE TABLE items (id INTEGER);",
+		"001.test.sql":     "INSERT INTO items VALUES (1);\nSELECT count(*) = 1 FROM items;",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	base := []string{"-conn", dbFile, "-verify-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+
+	if out, err := runCLI(append(base, "migrate")); err != nil {
+		t.Fatalf("migrate failed: %v\n%s", err, out)
+	}
+	out, err := runCLI(append(base, "-with-tests", "verify"))
+	if err != nil || !strings.Contains(out, "ok   "+filepath.Join(dir, "001.test.sql")) {
+		t.Fatalf("expected verify -with-tests to write fixtures on the main connection, got %v:\n%s", err, out)
+	}
+}
+
+// TestCLIResetAndDownAll checks that reset and down all ask for confirmation,
+// are refused with -non-interactive unless -yes is passed, and then run.
+func TestCLIResetAndDownAll(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "reset.db")
+	for name, content := range map[string]string{
+		"001.do.a.sql":   "CREATE TABLE a (id INTEGER);",
+		"001.undo.a.sql": "DROP TABLE a;",
+		"002.do.b.sql":   "CREATE TABLE b (id INTEGER);",
+		"002.undo.b.sql": "DROP TABLE b;",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	if out, err := runCLI(append(base, "migrate", "1")); err != nil {
+		t.Fatalf("migrate failed: %v\n%s", err, out)
+	}
+
+	out, err := runCLI(append(base, "-non-interactive", "reset"))
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitUsage {
+		t.Fatalf("expected reset to be refused with -non-interactive, got %v:\n%s", err, out)
+	}
+	out, err = runCLI(append(base, "-yes", "reset"))
+	if err != nil || !strings.Contains(out, "Summary: 3 run") || !strings.Contains(out, "final version: 2") {
+		t.Fatalf("expected reset to roll back 1 and apply 2 migrations, got %v:\n%s", err, out)
+	}
+
+	cmd := exec.Command(os.Args[0], append(base, "down", "all")...)
+	cmd.Env = append(os.Environ(), "GO_HELPER_PROCESS=1")
+	cmd.Stdin = strings.NewReader("yes\n")
+	raw, err := cmd.CombinedOutput()
+	if out := string(raw); err != nil || !strings.Contains(out, `Type "yes"`) || !strings.Contains(out, "final version: 0") {
+		t.Fatalf("expected down all to roll back everything after confirmation, got %v:\n%s", err, out)
+	}
+}
+
+// TestCLIListOrderRunAtAndSkipped verifies list -order run_at and that
+// verify fails on a migration numbered below the current version.
+func TestCLIListOrderRunAtAndSkipped(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "order.db")
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	write("001.do.a.sql", "CREATE TABLE a (id INTEGER);")
+	write("20240101000000.do.b.sql", "CREATE TABLE b (id INTEGER);")
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	if out, err := runCLI(append(base, "migrate")); err != nil {
+		t.Fatalf("migrate failed: %v\n%s", err, out)
+	}
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("UPDATE schemaversion SET run_at = '2030-01-01 00:00:00' WHERE version = 1;"); err != nil {
+		t.Fatalf("failed to update run_at: %v", err)
+	}
+	write("002.do.c.sql", "CREATE TABLE c (id INTEGER);")
+
+	out, err := runCLI(append(base, "-order", "run_at", "list"))
+	if err != nil {
+		t.Fatalf("list failed: %v\n%s", err, out)
+	}
+	b, a, c := strings.Index(out, "Version 20240101000000"), strings.Index(out, "Version 1:"), strings.Index(out, "Version 2:")
+	if b < 0 || a < b || c < a {
+		t.Errorf("expected versions in run order 20240101000000, 1, then 2, got:\n%s", out)
+	}
+	if out, err := runCLI(append(base, "-order", "run_at", "-versions-only", "list")); err != nil || out != "20240101000000\n1\n2\n" {
+		t.Errorf("expected bare versions in run order, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "-grep", "do.c", "-versions-only", "list")); err != nil || out != "2\n" {
+		t.Errorf("expected only the matching version, got %v:\n%s", err, out)
+	}
+	out, err = runCLI(append(base, "-order", "name", "list"))
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitUsage {
+		t.Errorf("expected an unknown -order to exit with %d, got %v:\n%s", clitool.ExitUsage, err, out)
+	}
+
+	out, err = runCLI(append(base, "verify"))
+	if err == nil || !strings.Contains(out, "Version 2: c (") {
+		t.Errorf("expected verify to report the skipped migration, got %v:\n%s", err, out)
+	}
+}
+
+// TestCLIFreeze verifies that migrate exits with clitool.ExitFrozen while migrations
+// are frozen and runs again after unfreeze.
+func TestCLIFreeze(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "freeze.db")
+	if err := os.WriteFile(filepath.Join(dir, "001.do.a.sql"), []byte("CREATE TABLE a (id INTEGER);"), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	if out, err := runCLI(append(base, "freeze", "incident", "42")); err != nil {
+		t.Fatalf("freeze failed: %v\n%s", err, out)
+	}
+	out, err := runCLI(append(base, "migrate"))
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitFrozen || !strings.Contains(out, "incident 42") {
+		t.Fatalf("expected migrate to exit with %d naming the reason, got %v:\n%s", clitool.ExitFrozen, err, out)
+	}
+	if out, err := runCLI(append(base, "unfreeze")); err != nil {
+		t.Fatalf("unfreeze failed: %v\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "migrate")); err != nil {
+		t.Fatalf("expected migrate to succeed after unfreeze, got %v:\n%s", err, out)
+	}
+}
+
+// TestCLIEmitSchema verifies that migrate -emit-schema writes the schema as
+// JSON or Markdown depending on the file extension.
+func TestCLIEmitSchema(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "schema.db")
+	if err := os.WriteFile(filepath.Join(dir, "001.do.users.sql"), []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT);"), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	jsonFile := filepath.Join(dir, "docs", "schema.json")
+	if out, err := runCLI(append(base, "-emit-schema", jsonFile, "migrate")); err != nil {
+		t.Fatalf("migrate failed: %v\n%s", err, out)
+	}
+	data, err := os.ReadFile(jsonFile)
+	if err != nil {
+		t.Fatalf("expected the schema to be written: %v", err)
+	}
+	var schema gostgrator.Schema
+	if err := json.Unmarshal(data, &schema); err != nil || len(schema.Tables) != 1 || schema.Tables[0].Name != "users" || len(schema.Tables[0].Columns) != 2 {
+		t.Fatalf("expected the users table in the JSON schema, got %+v (%v):\n%s", schema, err, data)
+	}
+
+	mdFile := filepath.Join(dir, "schema.md")
+	if out, err := runCLI(append(base, "-emit-schema", mdFile, "migrate")); err != nil {
+		t.Fatalf("migrate failed: %v\n%s", err, out)
+	}
+	if data, err := os.ReadFile(mdFile); err != nil || !strings.Contains(string(data), "## users") {
+		t.Fatalf("expected a Markdown schema with the users table, got %v:\n%s", err, data)
+	}
+}
+
+// TestCLIExplainVersion verifies that explain-version prints a version's
+// status, checksums and SQL, and flags a changed file.
+func TestCLIExplainVersion(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "explain.db")
+	doFile := filepath.Join(dir, "001.do.users.sql")
+	if err := os.WriteFile(doFile, []byte("CREATE TABLE users (id INTEGER);"), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	if out, err := runCLI(append(base, "migrate")); err != nil {
+		t.Fatalf("migrate failed: %v\n%s", err, out)
+	}
+	out, err := runCLI(append(base, "explain-version", "1"))
+	if err != nil || !strings.Contains(out, "Status: applied at") || !strings.Contains(out, "matches the do file") || !strings.Contains(out, "CREATE TABLE users") {
+		t.Fatalf("expected the applied version's details, got %v:\n%s", err, out)
+	}
+
+	if err := os.WriteFile(doFile, []byte("CREATE TABLE users (id INTEGER, email TEXT);"), 0644); err != nil {
+		t.Fatalf("failed to change migration: %v", err)
+	}
+	if out, err := runCLI(append(base, "explain-version", "1")); err != nil || !strings.Contains(out, "MISMATCH") {
+		t.Errorf("expected a checksum mismatch, got %v:\n%s", err, out)
+	}
+	out, err = runCLI(append(base, "explain-version", "9"))
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitFailure {
+		t.Errorf("expected an unknown version to exit with %d, got %v:\n%s", clitool.ExitFailure, err, out)
+	}
+}
+
+// TestCLISQLiteDriver verifies that a database migrated with the pure Go
+// driver reads the same with mattn/go-sqlite3, and that an unknown driver is
+// a usage error.
+func TestCLISQLiteDriver(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "driver.db")
+	for name, content := range map[string]string{
+		"001.do.users.sql":   "CREATE TABLE users (id INTEGER);",
+		"001.undo.users.sql": "DROP TABLE users;",
+		"002.do.posts.sql":   "CREATE TABLE posts (id INTEGER);",
+		"002.undo.posts.sql": "DROP TABLE posts;",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	if out, err := runCLI(append(base, "-sqlite-driver", "modernc", "-audit-history", "migrate")); err != nil {
+		t.Fatalf("migrate with modernc failed: %v\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "-sqlite-driver", "mattn", "verify")); err != nil {
+		t.Fatalf("verify with mattn failed: %v\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "-sqlite-driver", "modernc", "-audit-history", "down", "2")); err != nil {
+		t.Fatalf("down with modernc failed: %v\n%s", err, out)
+	}
+	out, err := runCLI(append(base, "-sqlite-driver", "mattn", "-applied", "list"))
+	if err != nil || strings.Contains(out, "users") || strings.Contains(out, "posts") {
+		t.Fatalf("expected nothing applied after down, got %v:\n%s", err, out)
+	}
+
+	out, err = runCLI(append(base, "-sqlite-driver", "cgo", "list"))
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitUsage || !strings.Contains(out, "unknown SQLite driver") {
+		t.Errorf("expected an unknown driver to exit with %d, got %v:\n%s", clitool.ExitUsage, err, out)
+	}
+}
+
+// TestCLIVerifySignatures verifies that -verify-signatures runs the signed
+// fixtures and refuses them, from lint and migrate alike, once one is edited.
+func TestCLIVerifySignatures(t *testing.T) {
+	dir := t.TempDir()
+	fixtures := filepath.Join("..", "testdata", "signed")
+	entries, err := os.ReadDir(fixtures)
+	if err != nil {
+		t.Fatalf("failed to read fixtures: %v", err)
+	}
+	for _, e := range entries {
+		content, err := os.ReadFile(filepath.Join(fixtures, e.Name()))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", e.Name(), err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, e.Name()), content, 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", e.Name(), err)
+		}
+	}
+	base := []string{"-conn", filepath.Join(dir, "signed.db"), "-migration-pattern", filepath.Join(dir, "*.sql"), "-verify-signatures", "-trusted-keys", filepath.Join(dir, "trusted_keys")}
+	if out, err := runCLI(append(base, "lint")); err != nil {
+		t.Fatalf("lint of signed migrations failed: %v\n%s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "003.do.c.sql"), []byte("DROP TABLE signed_a;\n"), 0644); err != nil {
+		t.Fatalf("failed to edit migration: %v", err)
+	}
+	for _, command := range []string{"lint", "migrate"} {
+		out, err := runCLI(append(base, command))
+		if err == nil || !strings.Contains(out, "003.do.c.sql: content does not match its signature") {
+			t.Errorf("expected %s to refuse the edited migration, got %v:\n%s", command, err, out)
+		}
+	}
+	if out, err := runCLI(append(base, "-applied", "list")); err != nil || strings.Contains(out, "signed") {
+		t.Errorf("expected nothing applied, got %v:\n%s", err, out)
+	}
+}
+
+// TestCLIBestEffort verifies that -best-effort applies migrations over a
+// drifted database and reports the tolerated errors.
+func TestCLIBestEffort(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "drifted.db")
+	content := "CREATE TABLE users (id INTEGER);\nCREATE TABLE posts (id INTEGER);"
+	if err := os.WriteFile(filepath.Join(dir, "001.do.init.sql"), []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER);"); err != nil {
+		t.Fatalf("failed to drift the database: %v", err)
+	}
+	db.Close()
+
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	if out, err := runCLI(append(base, "migrate")); err == nil {
+		t.Fatalf("expected migrate to fail on drift without -best-effort:\n%s", out)
+	}
+	out, err := runCLI(append(base, "-best-effort", "migrate"))
+	if err != nil {
+		t.Fatalf("migrate -best-effort failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "1 error(s) were tolerated") || !strings.Contains(out, "statement 1 [42P07]: table users already exists") {
+		t.Errorf("expected a warning report, got:\n%s", out)
+	}
+	if out, err := runCLI(append(base, "-applied", "list")); err != nil || !strings.Contains(out, "init") {
+		t.Errorf("expected the migration to be recorded, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIExportUndo(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "export.db")
+	files := map[string]string{
+		"001.do.users.sql":   "CREATE TABLE users (id INTEGER);",
+		"001.undo.users.sql": "DROP TABLE users;",
+		"002.do.posts.sql":   "CREATE TABLE posts (id INTEGER);",
+		"002.undo.posts.sql": "DROP TABLE posts;",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	if out, err := runCLI(append(base, "migrate")); err != nil {
+		t.Fatalf("migrate failed: %v\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "-from", "2", "export-undo")); err == nil || !strings.Contains(out, "requires -from and -to") {
+		t.Errorf("expected export-undo without -to to fail, got %v:\n%s", err, out)
+	}
+
+	script := filepath.Join(dir, "rollback.sql")
+	out, err := runCLI(append(base, "-from", "2", "-to", "1", "-o", script, "export-undo"))
+	if err != nil || !strings.Contains(out, "Wrote 1 undo migration(s)") {
+		t.Fatalf("export-undo failed: %v\n%s", err, out)
+	}
+	data, err := os.ReadFile(script)
+	if err != nil {
+		t.Fatalf("failed to read the script: %v", err)
+	}
+	if !strings.Contains(string(data), "DROP TABLE posts;") || strings.Contains(string(data), "DROP TABLE users;") {
+		t.Errorf("expected only the undo of version 2 in the script:\n%s", data)
+	}
+	db, err := sql.Open("sqlite3", dbFile)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(string(data)); err != nil {
+		t.Fatalf("failed to run the script: %v\n%s", err, data)
+	}
+	if out, err := runCLI(append(base, "list")); err != nil || !strings.Contains(out, "Current database migration version: 1") {
+		t.Errorf("expected version 1 after the script, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIAliases(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "aliases.db")
+	for name, content := range map[string]string{
+		"001.do.users.sql": "CREATE TABLE users (id INTEGER);",
+		"002.do.posts.sql": "CREATE TABLE posts (id INTEGER);",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	cfgPath := filepath.Join(dir, "cfg.json")
+	cfg := map[string]any{
+		"conn":             dbFile,
+		"migrationPattern": filepath.Join(dir, "*.sql"),
+		"aliases": map[string][]string{
+			"deploy":  {"migrate"},
+			"todo":    {"list", "-pending"},
+			"summary": {"-json", "deploy"},
+			"loop":    {"loop"},
+		},
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfgPath, data, 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	out, err := runCLI([]string{"-config", cfgPath, "deploy", "1"})
+	if err != nil || !strings.Contains(out, "Applied 1 migrations") {
+		t.Fatalf("expected deploy 1 to run migrate 1, got %v:\n%s", err, out)
+	}
+	out, err = runCLI([]string{"-config", cfgPath, "todo"})
+	if err != nil || !strings.Contains(out, "posts") || strings.Contains(out, "users") {
+		t.Errorf("expected todo to list pending migrations, got %v:\n%s", err, out)
+	}
+	out, err = runCLI([]string{"-config", cfgPath, "summary"})
+	if err != nil || !strings.Contains(out, `"command":"migrate"`) {
+		t.Errorf("expected summary to run deploy with -json, got %v:\n%s", err, out)
+	}
+	out, err = runCLI([]string{"-config", cfgPath, "-json=false", "summary"})
+	if err != nil || strings.Contains(out, `"command"`) {
+		t.Errorf("expected command line flags to override the alias, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI([]string{"-config", cfgPath, "loop"}); err == nil || !strings.Contains(out, `alias "loop" expands to itself`) {
+		t.Errorf("expected a looping alias to fail, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLITags(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "tags.db")
+	for name, content := range map[string]string{
+		"001.do.users.sql":    "CREATE TABLE users (id INTEGER);",
+		"002.do.backfill.sql": "-- gostgrator: tags=slow\nCREATE TABLE backfill (id INTEGER);",
+		"003.do.posts.sql":    "CREATE TABLE posts (id INTEGER);",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	if out, err := runCLI(append(base, "-exclude-tag", "slow", "migrate")); err == nil || !strings.Contains(out, "AllowOutOfOrder") {
+		t.Fatalf("expected leaving out 2 below 3 to fail, got %v:\n%s", err, out)
+	}
+	out, err := runCLI(append(base, "-exclude-tag", "slow", "-allow-out-of-order", "migrate"))
+	if err != nil || !strings.Contains(out, "Applied 2 migrations") || strings.Contains(out, "backfill") {
+		t.Fatalf("expected 1 and 3 to be applied, got %v:\n%s", err, out)
+	}
+	out, err = runCLI(append(base, "-include-tag", "slow", "-allow-out-of-order", "migrate"))
+	if err != nil || !strings.Contains(out, "Version 2: backfill") {
+		t.Errorf("expected the slow migration to run in its window, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIMaxApply(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "capped.db")
+	for name, content := range map[string]string{
+		"001.do.users.sql": "CREATE TABLE users (id INTEGER);",
+		"002.do.posts.sql": "CREATE TABLE posts (id INTEGER);",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	args := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql"), "-max-apply", "1", "migrate"}
+	out, err := runCLI(args)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitPending {
+		t.Fatalf("expected exit code %d, got %v:\n%s", clitool.ExitPending, err, out)
+	}
+	if !strings.Contains(out, "Version 1: users") || strings.Contains(out, "Version 2") || !strings.Contains(out, "1 still pending") {
+		t.Errorf("expected only version 1 with 1 still pending, got:\n%s", out)
+	}
+	out, err = runCLI(args)
+	if err != nil || !strings.Contains(out, "Version 2: posts") || strings.Contains(out, "still pending") {
+		t.Errorf("expected the second run to apply version 2 and finish, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIDataLoss(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "loss.db")
+	for name, content := range map[string]string{
+		"001.do.users.sql":   "CREATE TABLE users (id INTEGER);\nINSERT INTO users VALUES (1), (2);",
+		"001.undo.users.sql": "DROP TABLE users;",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql"), "-check-data-loss"}
+	if out, err := runCLI(append(base, "migrate")); err != nil {
+		t.Fatalf("migrate failed: %v:\n%s", err, out)
+	}
+	out, err := runCLI(append(base, "-dry-run", "down"))
+	if err != nil || !strings.Contains(out, "DATA LOSS: drops table users holding 2 rows") || !strings.Contains(out, "will destroy 2 rows") {
+		t.Errorf("expected the plan to warn about 2 rows, got %v:\n%s", err, out)
+	}
+	out, err = runCLI(append(base, "verify"))
+	if err != nil || !strings.Contains(out, "WARNING: rolling back version 1 drops table users holding 2 rows") {
+		t.Errorf("expected verify to warn about 2 rows, got %v:\n%s", err, out)
+	}
+	out, err = runCLI(append(base, "down"))
+	if err == nil || !strings.Contains(out, "rolling back would destroy data") || !strings.Contains(out, "-acknowledge-data-loss") {
+		t.Errorf("expected down to be refused, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "-acknowledge-data-loss", "down")); err != nil || !strings.Contains(out, "Rolled back version 1") {
+		t.Errorf("expected an acknowledged down to roll back, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"services/billing/migrations/001.do.invoices.sql": "CREATE TABLE invoices (id INTEGER);",
+		"services/users/migrations/001.do.users.sql":      "CREATE TABLE users (id INTEGER);",
+		"services/users/migrations/002.do.email.sql":      "ALTER TABLE users ADD COLUMN email TEXT;",
+		"gostgrator.work.json": `{"projects": [
+  {"name": "billing", "migrationPattern": "services/billing/migrations/*.sql", "schemaTable": "billing_schemaversion", "connEnv": "BILLING_DB"},
+  {"name": "users", "migrationPattern": "services/users/migrations/*.sql", "connEnv": "USERS_DB"}
+]}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	shared := filepath.Join(dir, "shared.db")
+	env := []string{"BILLING_DB=" + shared, "USERS_DB=" + shared}
+	out, err := runCLI([]string{"-C", filepath.Join(dir, "services"), "-all-projects", "migrate"}, env...)
+	if err != nil || !strings.Contains(out, "Project billing:") || !strings.Contains(out, "Version 1: invoices") ||
+		!strings.Contains(out, "Project users:") || !strings.Contains(out, "Version 2: email") || !strings.Contains(out, "All 2 projects succeeded") {
+		t.Fatalf("expected both projects to migrate, got %v:\n%s", err, out)
+	}
+	base := []string{"-C", dir, "-project", "billing"}
+	if out, err := runCLI(append(base, "-versions-only", "-applied", "list"), env...); err != nil || strings.TrimSpace(out) != "1" {
+		t.Errorf("expected billing to list version 1, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "config", "show"), env...); err != nil || !regexp.MustCompile(`schemaTable\s+"billing_schemaversion"\s+project billing`).MatchString(out) {
+		t.Errorf("expected the schema table to come from the project, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI([]string{"-C", dir, "-project", "orders", "list"}, env...); err == nil || !strings.Contains(out, `unknown project "orders"; the workspace lists: billing, users`) {
+		t.Errorf("expected an unknown project to fail, got %v:\n%s", err, out)
+	}
+	out, err = runCLI([]string{"-C", dir, "-all-projects", "verify"}, "BILLING_DB="+shared)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitUsage || !strings.Contains(out, "1 of 2 projects failed: users") {
+		t.Errorf("expected the project without a connection to fail, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIExpectVersion(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "expected.db")
+	for name, content := range map[string]string{
+		"001.do.users.sql": "CREATE TABLE users (id INTEGER);",
+		"002.do.posts.sql": "CREATE TABLE posts (id INTEGER);",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	if out, err := runCLI(append(base, "-expect-version", "0", "migrate", "1")); err != nil || !strings.Contains(out, "Version 1: users") {
+		t.Fatalf("expected version 1 to be applied, got %v:\n%s", err, out)
+	}
+	out, err := runCLI(append(base, "-expect-version", "0", "migrate"))
+	if err == nil || !strings.Contains(out, "expected version 0, but the database is at version 1") || strings.Contains(out, "Version 2") {
+		t.Errorf("expected a stale -expect-version to fail without migrating, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "-expect-version", "1", "migrate")); err != nil || !strings.Contains(out, "Version 2: posts") {
+		t.Errorf("expected version 2 to be applied, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIWarnAfter(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "slow.db")
+	backfill := "CREATE TABLE numbers AS WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n WHERE x < 3000000) SELECT x FROM n;"
+	if err := os.WriteFile(filepath.Join(dir, "001.do.backfill.sql"), []byte(backfill), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	if out, err := runCLI(append(base, "-timeout", "0", "migrate")); err == nil || !strings.Contains(out, "-timeout must be positive") {
+		t.Errorf("expected -timeout 0 to be rejected, got %v:\n%s", err, out)
+	}
+	out, err := runCLI(append(base, "-warn-after", "20ms", "-timeout", "1m", "migrate"))
+	if err != nil || !strings.Contains(out, "WARNING: version 1 (backfill) has been running for 20ms; letting it continue until -timeout 1m0s") || !strings.Contains(out, "Version 1: backfill") {
+		t.Errorf("expected a warning while version 1 ran to completion, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIPostgrator(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "postgrator.db")
+	pattern := filepath.Join(dir, "*.sql")
+	for name, content := range map[string]string{
+		"001.do.users.sql":    "CREATE TABLE users (id INTEGER);",
+		"002.do.posts.sql":    "CREATE TABLE posts (id INTEGER);",
+		"003.do.comments.sql": "CREATE TABLE comments (id INTEGER);",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	if out, err := runCLI([]string{"postgrator", "--to", "1", "-r", "sqlite3", "--database", dbFile, "-m", pattern}); err != nil || !strings.Contains(out, "Version 1: users") || strings.Contains(out, "Version 2") {
+		t.Fatalf("expected version 1 to be applied, got %v:\n%s", err, out)
+	}
+	configFile := filepath.Join(dir, "postgrator.json")
+	config, _ := json.Marshal(map[string]string{"driver": "sqlite3", "database": dbFile, "migrationPattern": pattern})
+	if err := os.WriteFile(configFile, config, 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	out, err := runCLI([]string{"postgrator", "-c", configFile, "--max-apply", "1"})
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitPending || !strings.Contains(out, "Version 2: posts") || strings.Contains(out, "Version 3") {
+		t.Errorf("expected -max-apply to pass through and stop after version 2, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI([]string{"postgrator", "--driver", "pg", "-c", configFile}); err == nil || !strings.Contains(out, "runs the sqlite3 driver, not pg") {
+		t.Errorf("expected another driver to be refused, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI([]string{"-conn", dbFile, "postgrator"}); err == nil || !strings.Contains(out, "postgrator must be the first argument") {
+		t.Errorf("expected postgrator after other options to be refused, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIIgnoreWindows(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "windows.db")
+	now := time.Now().UTC()
+	window := now.Add(2*time.Hour).Format("15:04") + "-" + now.Add(3*time.Hour).Format("15:04")
+	for name, content := range map[string]string{
+		"001.do.users.sql":    "CREATE TABLE users (id INTEGER);",
+		"002.do.backfill.sql": "-- gostgrator: window=" + window + "\nCREATE TABLE backfill (id INTEGER);",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	out, err := runCLI(append(base, "migrate"))
+	if err != nil || !strings.Contains(out, "Deferred 1 migration(s)") || !strings.Contains(out, "Version 2: backfill (window "+window+")") || !strings.Contains(out, "1 deferred") {
+		t.Fatalf("expected 2 to be deferred, got %v:\n%s", err, out)
+	}
+	out, err = runCLI(append(base, "-ignore-windows", "migrate"))
+	if err != nil || !strings.Contains(out, "Version 2: backfill (") || strings.Contains(out, "Deferred") {
+		t.Errorf("expected -ignore-windows to run 2, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIGitHubFormat(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "annotate.db")
+	for name, content := range map[string]string{
+		"001.do.users.sql":  "CREATE TABLE users (id INTEGER);",
+		"002.do.Broken.sql": "CREATE TABLE broken (id INTEGER;",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql"), "-format", "github"}
+	env := "GITHUB_WORKSPACE=" + dir
+	out, err := runCLI(append(base, "-filename-policy", "kebab-case", "lint"), env)
+	if err == nil || !strings.Contains(out, "::error file=002.do.Broken.sql,title=gostgrator lint::") || strings.Contains(out, "file=001") {
+		t.Errorf("expected a lint annotation on the misnamed file, got %v:\n%s", err, out)
+	}
+	out, err = runCLI(append(base, "migrate"), env)
+	if err == nil || !strings.Contains(out, "::error file=002.do.Broken.sql,title=gostgrator migrate::migration ") {
+		t.Errorf("expected a migrate annotation on the failed file, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI([]string{"-format", "xml", "lint"}); err == nil || !strings.Contains(out, "unknown -format") {
+		t.Errorf("expected an unknown format to fail, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIToDate(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "dated.db")
+	for name, content := range map[string]string{
+		"20240601090000.do.users.sql": "CREATE TABLE users (id INTEGER);",
+		"20240602090000.do.posts.sql": "CREATE TABLE posts (id INTEGER);",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	base := []string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.sql")}
+	out, err := runCLI(append(base, "-to-date", "2024-06-01", "migrate"))
+	if err != nil || !strings.Contains(out, "Version 20240601090000 is the latest") || !strings.Contains(out, "Applied 1 migrations") {
+		t.Fatalf("expected only the first day's migration, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "-to-date", "June 1", "migrate")); err == nil || !strings.Contains(out, "invalid -to-date") {
+		t.Errorf("expected an invalid date to fail, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI(append(base, "-to-date", "2024-06-01", "migrate", "max")); err == nil || !strings.Contains(out, "cannot be used with a target") {
+		t.Errorf("expected -to-date with a target to fail, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIExec(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "exec.db")
+	script := filepath.Join(dir, "cleanup.sql")
+	if err := os.WriteFile(script, []byte("CREATE TABLE audit (id INTEGER);\nINSERT INTO audit VALUES (1);\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := runCLI([]string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.do.sql"), "exec", script})
+	if err != nil || !strings.Contains(out, "Ran "+script+" in") {
+		t.Fatalf("expected exec to run the script, got %v:\n%s", err, out)
+	}
+	out, err = runCLI([]string{"-conn", dbFile, "-migration-pattern", filepath.Join(dir, "*.do.sql"), "list"})
+	if err != nil || strings.Contains(out, "cleanup") {
+		t.Errorf("expected the script not to be listed as a migration, got %v:\n%s", err, out)
+	}
+	out, err = runCLI([]string{"-conn", dbFile, "exec", script})
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitFailure || !strings.Contains(out, "Exec error:") {
+		t.Errorf("expected rerunning the script to fail, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI([]string{"-conn", dbFile, "exec"}); !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitUsage {
+		t.Errorf("expected exec without a file to exit with %d, got %v:\n%s", clitool.ExitUsage, err, out)
+	}
+}
+
+func TestCLIDriftCheck(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "drift.db")
+	if err := os.WriteFile(filepath.Join(dir, "001.do.users.sql"), []byte("CREATE TABLE users (id INTEGER);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pattern := filepath.Join(dir, "*.sql")
+	var exitErr *exec.ExitError
+	if out, err := runCLI([]string{"-conn", dbFile, "drift-check"}); !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitFailure || !strings.Contains(out, "no schema snapshot") {
+		t.Errorf("expected drift-check without a snapshot to fail, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI([]string{"-conn", dbFile, "-migration-pattern", pattern, "-snapshot-schema", "migrate"}); err != nil {
+		t.Fatalf("migrate failed: %v:\n%s", err, out)
+	}
+	if out, err := runCLI([]string{"-conn", dbFile, "drift-check"}); err != nil || !strings.Contains(out, "No drift") {
+		t.Errorf("expected no drift after migrate, got %v:\n%s", err, out)
+	}
+	hotfix := filepath.Join(dir, "hotfix.sql")
+	if err := os.WriteFile(hotfix, []byte("ALTER TABLE users ADD COLUMN email TEXT;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := runCLI([]string{"-conn", dbFile, "exec", hotfix}); err != nil {
+		t.Fatalf("exec failed: %v:\n%s", err, out)
+	}
+	out, err := runCLI([]string{"-conn", dbFile, "drift-check"})
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitFailure || !strings.Contains(out, "column users.email was added") {
+		t.Errorf("expected the added column to be reported as drift, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIReconstruct(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "reconstruct.db")
+	if err := os.WriteFile(filepath.Join(dir, "001.do.users.sql"), []byte("CREATE TABLE users (id INTEGER);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pattern := filepath.Join(dir, "*.sql")
+	if out, err := runCLI([]string{"-conn", dbFile, "-migration-pattern", pattern, "migrate"}); err != nil {
+		t.Fatalf("migrate failed: %v:\n%s", err, out)
+	}
+	if out, err := runCLI([]string{"-conn", dbFile, "-yes", "drop-schema"}); err != nil {
+		t.Fatalf("drop-schema failed: %v:\n%s", err, out)
+	}
+
+	var exitErr *exec.ExitError
+	if out, err := runCLI([]string{"-conn", dbFile, "-migration-pattern", pattern, "-non-interactive", "reconstruct"}); !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitUsage {
+		t.Errorf("expected reconstruct to need -yes with -non-interactive, got %v:\n%s", err, out)
+	}
+	plan := filepath.Join(dir, "plan.json")
+	out, err := runCLI([]string{"-conn", dbFile, "-migration-pattern", pattern, "-o", plan, "reconstruct"})
+	if err != nil || !strings.Contains(out, "Version 1: users (applied): found table users") {
+		t.Fatalf("expected version 1 to be proposed, got %v:\n%s", err, out)
+	}
+	out, err = runCLI([]string{"-conn", dbFile, "-migration-pattern", pattern, "reconstruct", plan})
+	if err != nil || !strings.Contains(out, "the database is at version 1") {
+		t.Errorf("expected the plan to be recorded, got %v:\n%s", err, out)
+	}
+	if out, err := runCLI([]string{"-conn", dbFile, "-migration-pattern", pattern, "migrate"}); err != nil || !strings.Contains(out, "Applied 0 migrations") {
+		t.Errorf("expected nothing left to apply, got %v:\n%s", err, out)
+	}
+}
+
+func TestCLIChdir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "migrations"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "migrations", "001.do.users.sql"), []byte("CREATE TABLE users (id INTEGER);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "gostgrator.json"), []byte(`{"conn": "app.db", "migrationPattern": "migrations/*.sql"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := runCLI([]string{"-C", dir, "-config", "gostgrator.json", "migrate"})
+	if err != nil || !strings.Contains(out, "Version 1: users") {
+		t.Fatalf("expected migrate to resolve paths from -C, got %v:\n%s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app.db")); err != nil {
+		t.Errorf("expected the database to be created in the -C directory: %v", err)
+	}
+	var exitErr *exec.ExitError
+	if out, err := runCLI([]string{"--chdir", filepath.Join(dir, "missing"), "list"}); !errors.As(err, &exitErr) || exitErr.ExitCode() != clitool.ExitUsage {
+		t.Errorf("expected a missing directory to exit with %d, got %v:\n%s", clitool.ExitUsage, err, out)
+	}
+}
+
+func TestCLIConfigRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	infra := filepath.Join(dir, "infra")
+	if err := os.MkdirAll(filepath.Join(infra, "migrations"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(infra, "migrations", "001.do.users.sql"), []byte("CREATE TABLE users (id INTEGER);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(infra, "gostgrator.json"), []byte(`{"migrationPattern": "migrations/*.sql"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dbFile := filepath.Join(dir, "app.db")
+	out, err := runCLI([]string{"-C", dir, "-conn", dbFile, "-config", "infra/gostgrator.json", "migrate"})
+	if err != nil || !strings.Contains(out, "Version 1: users") {
+		t.Fatalf("expected the pattern to resolve from the config file, got %v:\n%s", err, out)
+	}
+	out, err = runCLI([]string{"-C", dir, "-conn", dbFile, "-config", "infra/gostgrator.json", "config", "show"})
+	if err != nil || !regexp.MustCompile(`(?m)^migrationPattern +"infra/migrations/\*\.sql" +file$`).MatchString(out) {
+		t.Errorf("expected config show to list the resolved pattern from the file, got %v:\n%s", err, out)
+	}
+}
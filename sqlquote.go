@@ -0,0 +1,118 @@
+package gostgrator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The helpers in this file are the only way identifiers and values are
+// embedded in the SQL gostgrator builds, so quoting rules live in one place.
+// Values a Client records are passed as arguments where it is an ArgsClient;
+// literals remain for scripts, catalog lookups and other Clients.
+
+// quoteIdentifier quotes an SQL identifier, doubling any double quotes in it.
+// NUL bytes, which neither database accepts in an identifier, are dropped.
+func quoteIdentifier(name string) string {
+	name = strings.ReplaceAll(name, "\x00", "")
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// splitQualified splits a possibly schema-qualified table name, such as
+// "app.schemaversion", at its first dot. It is the only parser of such names,
+// so the quoted name and the catalog lookups always agree on the parts.
+func splitQualified(name string) (schema, table string, qualified bool) {
+	schema, table, qualified = strings.Cut(name, ".")
+	if !qualified {
+		return "", name, false
+	}
+	return schema, table, true
+}
+
+// checkQualified returns an error if name has more than a schema and a table
+// part, which would otherwise name a table in another database on PostgreSQL.
+func checkQualified(field, name string) error {
+	if _, table, _ := splitQualified(name); strings.Contains(table, ".") {
+		return fmt.Errorf("%s %q has more than two parts, must be a table or schema.table", field, name)
+	}
+	return nil
+}
+
+// quoteQualified quotes each part of a possibly schema-qualified name, such
+// as "app.schemaversion", so mixed case names, keywords and names with
+// spaces or quotes work.
+func quoteQualified(name string) string {
+	schema, table, qualified := splitQualified(name)
+	if !qualified {
+		return quoteIdentifier(table)
+	}
+	return quoteIdentifier(schema) + "." + quoteIdentifier(table)
+}
+
+// quoteLiteral returns s as a string literal in driver's SQL, doubling any
+// single quotes in it. For PostgreSQL, a value holding a backslash or NUL
+// byte becomes an escape string, E'...', which reads the same whatever
+// standard_conforming_strings is set to; its \000 for a NUL byte fails the
+// statement, as PostgreSQL text cannot hold one. SQLite has no escapes, so a
+// NUL byte is spliced in with char(0) rather than ending the statement.
+func quoteLiteral(driver, s string) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	if !strings.EqualFold(driver, "pg") {
+		return "'" + strings.ReplaceAll(s, "\x00", "'||char(0)||'") + "'"
+	}
+	if !strings.ContainsAny(s, "\\\x00") {
+		return "'" + s + "'"
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "E'" + strings.ReplaceAll(s, "\x00", `\000`) + "'"
+}
+
+// timestampLiteral returns t as a quoted ISO-8601 literal in UTC to the
+// second, such as '2024-01-02T03:04:05Z'. The explicit zone keeps PostgreSQL
+// from reading it in the session's time zone and makes the text SQLite
+// stores unambiguous.
+func timestampLiteral(t time.Time) string {
+	return "'" + t.UTC().Format(time.RFC3339) + "'"
+}
+
+// sqlValues writes the values of a statement for a driver, either as quoted
+// literals or, when bind is set, as numbered placeholders with the values
+// collected in args. Placeholders are $1 on PostgreSQL and ?1 on SQLite,
+// where ?NNN binds by number wherever it appears in the statement.
+type sqlValues struct {
+	driver string
+	bind   bool
+	args   []any
+}
+
+// text returns the SQL for the string s.
+func (v *sqlValues) text(s string) string {
+	if !v.bind {
+		return quoteLiteral(v.driver, s)
+	}
+	return v.add(s)
+}
+
+// time returns the SQL for t, to the second in UTC. SQLite is given the
+// ISO-8601 text timestampLiteral writes, the format its run_at values have
+// always had.
+func (v *sqlValues) time(t time.Time) string {
+	if !v.bind {
+		return timestampLiteral(t)
+	}
+	t = t.UTC().Truncate(time.Second)
+	if !strings.EqualFold(v.driver, "pg") {
+		return v.add(t.Format(time.RFC3339))
+	}
+	return v.add(t)
+}
+
+func (v *sqlValues) add(value any) string {
+	v.args = append(v.args, value)
+	prefix := "?"
+	if strings.EqualFold(v.driver, "pg") {
+		prefix = "$"
+	}
+	return prefix + strconv.Itoa(len(v.args))
+}
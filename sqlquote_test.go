@@ -0,0 +1,191 @@
+package gostgrator
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// trickyStrings are values that break naive SQL string building.
+var trickyStrings = []string{
+	"",
+	"plain",
+	"it's",
+	"''",
+	"'; DROP TABLE users; --",
+	`back\slash`,
+	`trailing\`,
+	`"double" quotes`,
+	"new\nline",
+	"tab\tand\r\ncrlf",
+	"nul\x00byte",
+	"emoji 🦫",
+	"semi;colon",
+	"/* comment */",
+	"$$dollar$$",
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"users", `"users"`},
+		{"Users", `"Users"`},
+		{"select", `"select"`},
+		{"with space", `"with space"`},
+		{`a"b`, `"a""b"`},
+		{`""`, `""""""`},
+		{"a.b", `"a.b"`},
+		{"nul\x00", `"nul"`},
+		{"", `""`},
+	} {
+		if got := quoteIdentifier(tt.in); got != tt.want {
+			t.Errorf("quoteIdentifier(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteQualified(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"schemaversion", `"schemaversion"`},
+		{"app.schemaversion", `"app"."schemaversion"`},
+		{`My App.Schema "Version"`, `"My App"."Schema ""Version"""`},
+		{"a.b", `"a"."b"`},
+	} {
+		if got := quoteQualified(tt.in); got != tt.want {
+			t.Errorf("quoteQualified(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheckQualified(t *testing.T) {
+	for _, name := range []string{"", "schemaversion", "app.schemaversion", `My App.Schema "Version"`} {
+		if err := checkQualified("SchemaTable", name); err != nil {
+			t.Errorf("checkQualified(%q) = %v, want nil", name, err)
+		}
+	}
+	for _, name := range []string{"a.b.c", "db.app.schemaversion", "app.schema.version."} {
+		if err := checkQualified("SchemaTable", name); err == nil {
+			t.Errorf("checkQualified(%q) = nil, want an error", name)
+		}
+	}
+}
+
+func TestPgTableFilter(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"schemaversion", "table_name = 'schemaversion'\n      AND table_schema = current_schema()"},
+		{"app.schemaversion", "table_name = 'schemaversion'\n      AND table_schema = 'app'"},
+		{"it's.v", "table_name = 'v'\n      AND table_schema = 'it''s'"},
+	} {
+		if got := pgTableFilter(tt.in); got != tt.want {
+			t.Errorf("pgTableFilter(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"", `''`},
+		{"abc", `'abc'`},
+		{"it's", `'it''s'`},
+		{"'", `''''`},
+		{`back\slash`, `'back\slash'`},
+		{"nul\x00byte", `'nul'||char(0)||'byte'`},
+		{"'; DROP TABLE users; --", `'''; DROP TABLE users; --'`},
+	} {
+		if got := quoteLiteral("sqlite3", tt.in); got != tt.want {
+			t.Errorf("quoteLiteral(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestQuoteLiteralPg verifies that PostgreSQL literals with backslashes are
+// escape strings, which do not depend on standard_conforming_strings.
+func TestQuoteLiteralPg(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"abc", `'abc'`},
+		{"it's", `'it''s'`},
+		{`back\slash`, `E'back\\slash'`},
+		{`it's\`, `E'it''s\\'`},
+		{"nul\x00byte", `E'nul\000byte'`},
+	} {
+		if got := quoteLiteral("pg", tt.in); got != tt.want {
+			t.Errorf("quoteLiteral(pg, %q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSqlValues(t *testing.T) {
+	at := time.Date(2024, 1, 2, 8, 4, 5, 999, time.FixedZone("EST", -5*60*60))
+	v := &sqlValues{driver: "pg", bind: true}
+	if got := v.text("a") + ", " + v.time(at); got != "$1, $2" {
+		t.Errorf("expected PostgreSQL placeholders, got %s", got)
+	}
+	if want := []any{"a", time.Date(2024, 1, 2, 13, 4, 5, 0, time.UTC)}; !reflect.DeepEqual(v.args, want) {
+		t.Errorf("args = %#v, want %#v", v.args, want)
+	}
+	v = &sqlValues{driver: "sqlite3", bind: true}
+	if got := v.text("a") + ", " + v.time(at); got != "?1, ?2" {
+		t.Errorf("expected SQLite placeholders, got %s", got)
+	}
+	if want := []any{"a", "2024-01-02T13:04:05Z"}; !reflect.DeepEqual(v.args, want) {
+		t.Errorf("args = %#v, want %#v", v.args, want)
+	}
+	v = &sqlValues{driver: "sqlite3"}
+	if got := v.text("it's") + ", " + v.time(at); got != `'it''s', '2024-01-02T13:04:05Z'` || v.args != nil {
+		t.Errorf("expected literals, got %s with args %v", got, v.args)
+	}
+}
+
+func TestTimestampLiteral(t *testing.T) {
+	at := time.Date(2024, 1, 2, 8, 4, 5, 999, time.FixedZone("EST", -5*60*60))
+	if got, want := timestampLiteral(at), `'2024-01-02T13:04:05Z'`; got != want {
+		t.Errorf("timestampLiteral = %s, want %s", got, want)
+	}
+}
+
+// TestQuotingRoundTrip verifies that quoted and bound values and quoted
+// identifiers read back unchanged from SQLite, apart from the NUL bytes
+// dropped from identifiers.
+func TestQuotingRoundTrip(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "quote.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	for _, s := range trickyStrings {
+		var got string
+		if err := db.QueryRow("SELECT " + quoteLiteral("sqlite3", s) + ";").Scan(&got); err != nil {
+			t.Errorf("selecting %q failed: %v", s, err)
+		} else if got != s {
+			t.Errorf("literal %q read back as %q", s, got)
+		}
+		v := &sqlValues{driver: "sqlite3", bind: true}
+		if err := db.QueryRow("SELECT "+v.text(s)+";", v.args...).Scan(&got); err != nil || got != s {
+			t.Errorf("argument %q read back as %q, %v", s, got, err)
+		}
+		name := stripNUL(s)
+		if name == "" {
+			continue
+		}
+		table := quoteIdentifier(s)
+		column := quoteIdentifier(s + " column")
+		if _, err := db.Exec(fmt.Sprintf("CREATE TABLE %s (%s TEXT); INSERT INTO %s VALUES (%s);", table, column, table, quoteLiteral("sqlite3", s))); err != nil {
+			t.Errorf("creating table %q failed: %v", s, err)
+			continue
+		}
+		if err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = " + quoteLiteral("sqlite3", name) + ";").Scan(&name); err != nil {
+			t.Errorf("table %q was not found by name: %v", s, err)
+		}
+		if err := db.QueryRow(fmt.Sprintf("SELECT %s FROM %s;", column, table)).Scan(&got); err != nil || got != s {
+			t.Errorf("table %q read back %q, %v", s, got, err)
+		}
+	}
+}
+
+// stripNUL drops NUL bytes from s, as quoteIdentifier does.
+func stripNUL(s string) string {
+	return strings.ReplaceAll(s, "\x00", "")
+}
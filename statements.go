@@ -0,0 +1,269 @@
+package gostgrator
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// splitStatements splits a SQL script into individual statements on top-level
+// semicolons. Semicolons inside quoted strings and identifiers, comments,
+// PostgreSQL dollar-quoted bodies and SQLite trigger BEGIN … END blocks do not
+// end a statement. Each statement keeps its terminating semicolon and any
+// comments preceding it; fragments containing only whitespace or comments are
+// dropped.
+func splitStatements(script string) []string {
+	var stmts []string
+	for script != "" {
+		end, hasCode := nextStatement(script)
+		if end < 0 {
+			end = len(script)
+		}
+		if hasCode {
+			stmts = append(stmts, strings.TrimSpace(script[:end]))
+		}
+		script = script[end:]
+	}
+	return stmts
+}
+
+// nextStatement scans script for the end of its first statement and returns
+// the index just past the terminating top-level semicolon, or -1 if script
+// holds no complete statement. hasCode reports whether the scanned text
+// contains anything other than whitespace and comments.
+//
+// A semicolon is only reported once every quote, comment and block before it
+// has closed, so scanning a prefix of a longer script finds the same end as
+// scanning the whole script; statementReader relies on this to split a file
+// as it is read.
+func nextStatement(script string) (end int, hasCode bool) {
+	// Leading words of the statement, used to detect CREATE TRIGGER.
+	var words []string
+	trigger := false
+	depth := 0
+
+	n := len(script)
+	for i := 0; i < n; {
+		c := script[i]
+		switch {
+		case c == '-' && i+1 < n && script[i+1] == '-':
+			if j := strings.IndexByte(script[i:], '\n'); j >= 0 {
+				i += j + 1
+			} else {
+				i = n
+			}
+		case c == '/' && i+1 < n && script[i+1] == '*':
+			if j := strings.Index(script[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = n
+			}
+		case c == '\'' || c == '"' || c == '`':
+			hasCode = true
+			i = skipQuoted(script, i)
+		case c == '$':
+			hasCode = true
+			tag := dollarTag(script[i:])
+			if tag == "" {
+				i++
+				continue
+			}
+			if j := strings.Index(script[i+len(tag):], tag); j >= 0 {
+				i += len(tag) + j + len(tag)
+			} else {
+				i = n
+			}
+		case c == ';':
+			i++
+			if depth == 0 {
+				return i, hasCode
+			}
+		case isWordStart(c):
+			hasCode = true
+			j := i + 1
+			for j < n && isWordChar(script[j]) {
+				j++
+			}
+			word := strings.ToUpper(script[i:j])
+			if len(words) < 4 {
+				words = append(words, word)
+				trigger = words[0] == "CREATE" && word == "TRIGGER" || trigger
+			}
+			if trigger {
+				switch word {
+				case "BEGIN", "CASE":
+					depth++
+				case "END":
+					if depth > 0 {
+						depth--
+					}
+				}
+			}
+			i = j
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				hasCode = true
+			}
+			i++
+		}
+	}
+	return -1, hasCode
+}
+
+// skipQuoted returns the index just past the quoted section starting at i.
+// A doubled quote character inside the section is treated as an escape.
+func skipQuoted(s string, i int) int {
+	q := s[i]
+	for j := i + 1; j < len(s); j++ {
+		if s[j] != q {
+			continue
+		}
+		if j+1 < len(s) && s[j+1] == q {
+			j++
+			continue
+		}
+		return j + 1
+	}
+	return len(s)
+}
+
+// dollarTag returns the PostgreSQL dollar-quote tag ("$$" or "$name$") at the
+// start of s, or an empty string if s does not start with one.
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		switch c := s[j]; {
+		case c == '$':
+			return s[:j+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || j > 1 && c >= '0' && c <= '9':
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isWordChar(c byte) bool {
+	return isWordStart(c) || c == '$' || c >= '0' && c <= '9'
+}
+
+// utf8BOM is the UTF-8 byte order mark, which is dropped from the start of a file.
+const utf8BOM = "\uFEFF"
+
+// statementReaderChunkSize is how much a statementReader reads at a time.
+var statementReaderChunkSize = 64 << 10
+
+// statementReader splits a migration into statements as it is read, so a file
+// too large to hold in memory can be executed one statement at a time. Only
+// the statement being assembled is buffered. With a batch separator or
+// delimiter it yields batches instead, with the same boundaries as
+// splitBatches.
+type statementReader struct {
+	r        *bufio.Reader
+	filename string
+	batches  batchSplitter
+	pending  string
+	started  bool
+	eof      bool
+}
+
+// newStatementReader returns a statementReader for the migration file read
+// from r. A splitter that splits yields batches instead of statements.
+func newStatementReader(r io.Reader, filename string, batches batchSplitter) *statementReader {
+	return &statementReader{
+		r:        bufio.NewReaderSize(r, statementReaderChunkSize),
+		filename: filename,
+		batches:  batches,
+	}
+}
+
+// Next returns the next statement, or io.EOF once the file is exhausted.
+func (s *statementReader) Next() (string, error) {
+	for {
+		stmt, ok, err := s.next()
+		if err != nil || ok {
+			return stmt, err
+		}
+	}
+}
+
+// next returns a statement, ok set to false if more input had to be read
+// first, or io.EOF.
+func (s *statementReader) next() (string, bool, error) {
+	if s.batches.splits() {
+		return s.nextBatch()
+	}
+	end, hasCode := -1, false
+	if !s.started && (len(s.pending) >= len(utf8BOM) || s.eof) {
+		s.started = true
+		s.pending = strings.TrimPrefix(s.pending, utf8BOM)
+	}
+	if s.started {
+		end, hasCode = nextStatement(s.pending)
+	}
+	if end < 0 && s.eof {
+		if s.pending == "" {
+			return "", false, io.EOF
+		}
+		end = len(s.pending)
+	}
+	if end >= 0 {
+		stmt := s.pending[:end]
+		s.pending = s.pending[end:]
+		if !hasCode {
+			return "", false, nil
+		}
+		return s.decode(strings.TrimSpace(stmt))
+	}
+	// Read at least as much as is already pending, so a single huge statement
+	// is rescanned a logarithmic rather than linear number of times.
+	buf := make([]byte, max(statementReaderChunkSize, len(s.pending)))
+	n, err := io.ReadFull(s.r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		s.eof = true
+	} else if err != nil {
+		return "", false, err
+	}
+	s.pending += string(buf[:n])
+	return "", false, nil
+}
+
+// nextBatch returns the next batch, reading the file line by line.
+func (s *statementReader) nextBatch() (string, bool, error) {
+	var batch strings.Builder
+	for !s.eof {
+		line, err := s.r.ReadString('\n')
+		if err == io.EOF {
+			s.eof = true
+		} else if err != nil {
+			return "", false, err
+		}
+		if !s.started {
+			s.started = true
+			line = strings.TrimPrefix(line, utf8BOM)
+		}
+		text, end := s.batches.line(line)
+		batch.WriteString(text)
+		if end {
+			break
+		}
+	}
+	if strings.TrimSpace(batch.String()) != "" {
+		return s.decode(batch.String())
+	}
+	if s.eof {
+		return "", false, io.EOF
+	}
+	return "", false, nil
+}
+
+// decode applies decodeMigration's encoding checks to a statement.
+func (s *statementReader) decode(stmt string) (string, bool, error) {
+	if _, err := decodeMigration(s.filename, []byte(stmt)); err != nil {
+		return "", false, err
+	}
+	return stmt, true, nil
+}
@@ -0,0 +1,108 @@
+package gostgrator
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSplitStatements verifies splitting on top-level semicolons only.
+func TestSplitStatements(t *testing.T) {
+	script := `-- create things
+CREATE TABLE a (name TEXT DEFAULT 'x;y');
+INSERT INTO "odd;table" VALUES ('it''s; fine'); /* ; */
+CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;
+DO $$ BEGIN PERFORM 1; END $$;
+CREATE TRIGGER t AFTER INSERT ON a BEGIN
+  UPDATE a SET name = CASE WHEN 1 THEN 'z' END;
+  DELETE FROM a;
+END;
+SELECT 1
+-- trailing comment`
+
+	got := splitStatements(script)
+	expected := []string{
+		"-- create things\nCREATE TABLE a (name TEXT DEFAULT 'x;y');",
+		`INSERT INTO "odd;table" VALUES ('it''s; fine');`,
+		"/* ; */\nCREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;",
+		"DO $$ BEGIN PERFORM 1; END $$;",
+		"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE a SET name = CASE WHEN 1 THEN 'z' END;\n  DELETE FROM a;\nEND;",
+		"SELECT 1\n-- trailing comment",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d statements, got %d: %q", len(expected), len(got), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected statement %d to be %q, got %q", i, expected[i], got[i])
+		}
+	}
+}
+
+// TestSplitStatementsCommentsOnly verifies that comment-only scripts produce no statements.
+func TestSplitStatementsCommentsOnly(t *testing.T) {
+	if got := splitStatements("-- nothing here\n/* or here */\n"); len(got) != 0 {
+		t.Errorf("Expected no statements, got %q", got)
+	}
+}
+
+// TestStatementReader verifies that reading a script in chunks of any size
+// yields the same statements and batches as splitting it whole.
+func TestStatementReader(t *testing.T) {
+	scripts := []string{
+		utf8BOM + `-- create things
+CREATE TABLE a (name TEXT DEFAULT 'x;y');
+INSERT INTO "odd;table" VALUES ('it''s; fine'); /* ; */
+CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;
+CREATE TRIGGER t AFTER INSERT ON a BEGIN
+  UPDATE a SET name = CASE WHEN 1 THEN 'ünïcödé' END;
+  DELETE FROM a;
+END;
+SELECT 1
+-- trailing comment`,
+		"CREATE TABLE w (id INT);\nGO\n\ngo\nINSERT INTO w VALUES (1);\nGO",
+		"CREATE PROCEDURE p() BEGIN\n  SELECT 1;\nEND$$\nDELIMITER ;\nCALL p();\nCALL p();",
+		"-- nothing here\n/* or here */\n",
+		"",
+	}
+	defer func(size int) { statementReaderChunkSize = size }(statementReaderChunkSize)
+	for _, script := range scripts {
+		for _, batches := range []batchSplitter{{}, {separator: "GO"}, {delimiter: "$$"}} {
+			want := splitBatches(strings.TrimPrefix(script, utf8BOM), batches)
+			if !batches.splits() {
+				want = splitStatements(strings.TrimPrefix(script, utf8BOM))
+			}
+			for _, size := range []int{1, 2, 7, 64, 4096} {
+				statementReaderChunkSize = size
+				r := newStatementReader(strings.NewReader(script), "test.sql", batches)
+				var got []string
+				for {
+					stmt, err := r.Next()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatalf("chunk size %d: unexpected error: %v", size, err)
+					}
+					got = append(got, stmt)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("chunk size %d, splitter %+v: expected %q, got %q", size, batches, want, got)
+				}
+			}
+		}
+	}
+}
+
+// TestStatementReaderRejectsInvalidUTF8 verifies that streamed statements get
+// the same encoding checks as files loaded whole.
+func TestStatementReaderRejectsInvalidUTF8(t *testing.T) {
+	r := newStatementReader(strings.NewReader("SELECT 1;\nSELECT '\xC3\x28';"), "bad.sql", batchSplitter{})
+	if _, err := r.Next(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := r.Next(); err == nil || !strings.Contains(err.Error(), "bad.sql is not valid UTF-8") {
+		t.Fatalf("expected UTF-8 error, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package gostgrator
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// tableName matches a possibly schema-qualified and quoted table name.
+const tableName = `((?:"[^"]+"|[\w$]+)(?:\.(?:"[^"]+"|[\w$]+))?)`
+
+// touchedTablePattern finds tables a statement creates, changes or writes to.
+var touchedTablePattern = regexp.MustCompile(`(?i)\b(?:` +
+	`(?:CREATE|DROP|ALTER)\s+(?:TEMP(?:ORARY)?\s+)?(?:TABLE|VIEW)(?:\s+IF\s+(?:NOT\s+)?EXISTS)?(?:\s+ONLY)?` +
+	`|TRUNCATE(?:\s+TABLE)?(?:\s+ONLY)?` +
+	`|INSERT\s+(?:OR\s+\w+\s+)?INTO` +
+	`|DELETE\s+FROM` +
+	`|UPDATE(?:\s+ONLY)?` +
+	`|(?:CREATE|DROP)\s+(?:UNIQUE\s+)?INDEX\s+(?:CONCURRENTLY\s+)?(?:IF\s+(?:NOT\s+)?EXISTS\s+)?[\w$"]+\s+ON(?:\s+ONLY)?` +
+	`)\s+` + tableName)
+
+// referencedTablePattern finds tables a statement reads from or points at.
+var referencedTablePattern = regexp.MustCompile(`(?i)\b(?:FROM|JOIN|REFERENCES)\s+` + tableName)
+
+// touchedTables returns the tables a SQL script creates, alters, drops or
+// writes to, using simple pattern matching rather than a full SQL parser.
+func touchedTables(script string) []string {
+	return matchTables(touchedTablePattern, stripComments(script))
+}
+
+// referencedTables returns every table a SQL script touches or reads from.
+func referencedTables(script string) []string {
+	script = stripComments(script)
+	tables := append(matchTables(touchedTablePattern, script), matchTables(referencedTablePattern, script)...)
+	return uniqueSorted(tables)
+}
+
+// matchTables returns the normalized table names captured by pattern.
+func matchTables(pattern *regexp.Regexp, script string) []string {
+	var tables []string
+	for _, match := range pattern.FindAllStringSubmatch(script, -1) {
+		tables = append(tables, normalizeTable(match[1]))
+	}
+	return uniqueSorted(tables)
+}
+
+// normalizeTable lowercases unquoted names and strips identifier quotes.
+func normalizeTable(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if strings.HasPrefix(part, `"`) {
+			parts[i] = strings.Trim(part, `"`)
+		} else {
+			parts[i] = strings.ToLower(part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// sameTable reports whether two normalized table names refer to the same
+// table, treating an unqualified name as matching any schema.
+func sameTable(a, b string) bool {
+	if a == b {
+		return true
+	}
+	_, aTable, aQualified := strings.Cut(a, ".")
+	_, bTable, bQualified := strings.Cut(b, ".")
+	switch {
+	case aQualified && !bQualified:
+		return aTable == b
+	case bQualified && !aQualified:
+		return a == bTable
+	}
+	return false
+}
+
+// commentPattern matches SQL line and block comments.
+var commentPattern = regexp.MustCompile(`(?s)--[^\n]*|/\*.*?\*/`)
+
+// stripComments removes comments so commented-out SQL is not matched.
+func stripComments(script string) string {
+	return commentPattern.ReplaceAllString(script, " ")
+}
+
+func uniqueSorted(values []string) []string {
+	sort.Strings(values)
+	var unique []string
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,82 @@
+package gostgrator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestTouchedTables verifies detection of tables a script changes.
+func TestTouchedTables(t *testing.T) {
+	script := `-- DROP TABLE commented_out;
+DROP TABLE IF EXISTS animal;
+ALTER TABLE ONLY public."Person" ADD COLUMN x INT;
+CREATE INDEX CONCURRENTLY idx_owner ON pets (owner);
+INSERT INTO audit (msg) SELECT name FROM person;
+UPDATE Accounts SET active = true;
+DELETE FROM sessions /* DROP TABLE nope; */ WHERE 1 = 1;
+TRUNCATE TABLE logs;`
+
+	got := touchedTables(script)
+	expected := []string{"accounts", "animal", "audit", "logs", "pets", "public.Person", "sessions"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected touched tables %v, got %v", expected, got)
+	}
+}
+
+// TestReferencedTables verifies that reads and foreign keys count as references.
+func TestReferencedTables(t *testing.T) {
+	script := `CREATE TABLE pets (owner INT REFERENCES person (id));
+CREATE VIEW adults AS SELECT p.name FROM person p JOIN ages a ON a.id = p.id;`
+
+	got := referencedTables(script)
+	expected := []string{"adults", "ages", "person", "pets"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected referenced tables %v, got %v", expected, got)
+	}
+}
+
+// TestSameTable verifies that unqualified names match any schema.
+func TestSameTable(t *testing.T) {
+	cases := []struct {
+		a, b string
+		same bool
+	}{
+		{"person", "person", true},
+		{"public.person", "person", true},
+		{"person", "public.person", true},
+		{"public.person", "other.person", false},
+		{"person", "people", false},
+	}
+	for _, c := range cases {
+		if got := sameTable(c.a, c.b); got != c.same {
+			t.Errorf("sameTable(%q, %q) = %v, expected %v", c.a, c.b, got, c.same)
+		}
+	}
+}
+
+// TestParseRunAt verifies the run_at formats returned by the drivers.
+func TestParseRunAt(t *testing.T) {
+	expected := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	for _, v := range []any{
+		expected,
+		"2024-05-06 07:08:09",
+		[]byte("2024-05-06T07:08:09Z"),
+		"2024-05-06 07:08:09+00:00",
+	} {
+		got, err := parseRunAt(v)
+		if err != nil {
+			t.Errorf("parseRunAt(%v) failed: %v", v, err)
+			continue
+		}
+		if !got.Equal(expected) {
+			t.Errorf("parseRunAt(%v) = %v, expected %v", v, got, expected)
+		}
+	}
+	if got, err := parseRunAt(nil); err != nil || !got.IsZero() {
+		t.Errorf("Expected zero time for nil run_at, got %v, %v", got, err)
+	}
+	if _, err := parseRunAt("yesterday"); err == nil {
+		t.Error("Expected an error for an unrecognized run_at")
+	}
+}
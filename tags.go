@@ -0,0 +1,97 @@
+package gostgrator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// tagSelected reports whether m passes Config.IncludeTags and
+// Config.ExcludeTags.
+func (g *Gostgrator) tagSelected(m Migration) bool {
+	tags := m.tags()
+	listed := func(list []string) bool {
+		return slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(list, tag) })
+	}
+	if len(g.cfg.IncludeTags) > 0 && !listed(g.cfg.IncludeTags) {
+		return false
+	}
+	return !listed(g.cfg.ExcludeTags)
+}
+
+// selectRunnable returns the migrations Migrate runs to move the database
+// from dbVersion to targetVersion, and those it defers. These are the ones
+// GetRunnableMigrations returns, narrowed by the tag filters. With
+// Config.AllowOutOfOrder, pending migrations below dbVersion run first, and
+// undo migrations of versions that were never applied are dropped. Otherwise
+// it fails rather than apply a migration above one the tag filters leave out,
+// since Migrate would never run that one afterwards.
+//
+// Do migrations whose "window" directive is closed are deferred to a later
+// run, along with those that depend on them and, without AllowOutOfOrder,
+// every migration above them.
+func (g *Gostgrator) selectRunnable(ctx context.Context, dbVersion, targetVersion int) ([]Migration, []Migration, error) {
+	runnable, err := g.GetRunnableMigrations(dbVersion, targetVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	windowed := !g.cfg.IgnoreWindows && slices.ContainsFunc(runnable, func(m Migration) bool {
+		_, ok := m.Directives["window"]
+		return ok
+	})
+	if !g.cfg.AllowOutOfOrder && len(g.cfg.IncludeTags) == 0 && len(g.cfg.ExcludeTags) == 0 && !windowed {
+		return runnable, nil, nil
+	}
+	if targetVersion < dbVersion {
+		if !g.cfg.AllowOutOfOrder {
+			return runnable, nil, nil
+		}
+		applied, err := g.GetAppliedMigrations(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		recorded := make(map[int]bool, len(applied))
+		for _, a := range applied {
+			recorded[a.Version] = true
+		}
+		return slices.DeleteFunc(runnable, func(m Migration) bool { return !recorded[m.Version] }), nil, nil
+	}
+	if g.cfg.AllowOutOfOrder {
+		skipped, err := g.GetSkippedMigrations(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		skipped = slices.DeleteFunc(skipped, func(m Migration) bool { return m.Version > targetVersion })
+		runnable = append(skipped, runnable...)
+	}
+	var selected, left, deferred []Migration
+	for _, m := range runnable {
+		if !g.tagSelected(m) {
+			left = append(left, m)
+			continue
+		}
+		deps, err := m.dependencies()
+		if err != nil {
+			return nil, nil, err
+		}
+		open, err := g.windowOpen(m)
+		if err != nil {
+			return nil, nil, err
+		}
+		waits := slices.ContainsFunc(deferred, func(d Migration) bool { return slices.Contains(deps, d.Version) })
+		if !open || waits || len(deferred) > 0 && !g.cfg.AllowOutOfOrder {
+			deferred = append(deferred, m)
+			continue
+		}
+		if len(left) > 0 && !g.cfg.AllowOutOfOrder {
+			return nil, nil, fmt.Errorf("migration [%d] (%s) matches the tag filters but migration [%d] (%s) below it does not, and would never run once [%d] is applied; set AllowOutOfOrder to run it later anyway", m.Version, m.Filename, left[0].Version, left[0].Filename, m.Version)
+		}
+		for _, dep := range deps {
+			if slices.ContainsFunc(left, func(l Migration) bool { return l.Version == dep }) {
+				return nil, nil, fmt.Errorf("migration [%d] depends on migration [%d], which the tag filters leave out", m.Version, dep)
+			}
+		}
+		selected = append(selected, m)
+	}
+	return selected, deferred, nil
+}
@@ -0,0 +1,125 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTagFilters verifies that the tag filters narrow Migrate, and that
+// leaving a migration behind below an applied one needs AllowOutOfOrder.
+func TestTagFilters(t *testing.T) {
+	ctx := context.Background()
+	pattern := writeDriftedMigrations(t, map[string]string{
+		"001.do.a.sql":   "-- gostgrator: tags=reporting\nCREATE TABLE a (id INTEGER);",
+		"001.undo.a.sql": "DROP TABLE a;",
+		"002.do.b.sql":   "CREATE TABLE b (id INTEGER);",
+		"002.undo.b.sql": "DROP TABLE b;",
+		"003.do.c.sql":   "-- gostgrator: tags=reporting,slow\nCREATE TABLE c (id INTEGER);",
+		"003.undo.c.sql": "DROP TABLE c;",
+	})
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "tags.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	open := func(cfg Config) *Gostgrator {
+		t.Helper()
+		cfg.Driver = "sqlite3"
+		cfg.MigrationPattern = pattern
+		g, err := NewGostgrator(cfg, db)
+		if err != nil {
+			t.Fatalf("failed to create gostgrator: %v", err)
+		}
+		return g
+	}
+	versions := func(migs []Migration) []int {
+		var v []int
+		for _, m := range migs {
+			v = append(v, m.Version)
+		}
+		return v
+	}
+
+	_, err = open(Config{IncludeTags: []string{"reporting"}}).Migrate(ctx, "max")
+	if err == nil || !strings.Contains(err.Error(), "migration [3]") || !strings.Contains(err.Error(), "migration [2]") {
+		t.Errorf("expected skipping 2 to need AllowOutOfOrder, got %v", err)
+	}
+	if planned, err := open(Config{ExcludeTags: []string{"slow"}}).Plan(ctx, "max"); err != nil || len(planned) != 2 || planned[1].Version != 2 {
+		t.Errorf("expected the plan to leave out 3, got %v (%v)", versions(planned), err)
+	}
+
+	applied, err := open(Config{IncludeTags: []string{"reporting"}, AllowOutOfOrder: true}).Migrate(ctx, "max")
+	if err != nil || len(applied) != 2 || applied[1].Version != 3 {
+		t.Fatalf("expected 1 and 3 to be applied, got %v (%v)", versions(applied), err)
+	}
+	if tableExists(t, db, "b") {
+		t.Error("expected 2 to be left out")
+	}
+	undone, err := open(Config{AllowOutOfOrder: true}).Migrate(ctx, "0")
+	if err != nil || len(undone) != 2 || undone[0].Version != 3 || undone[1].Version != 1 {
+		t.Fatalf("expected only the applied 3 and 1 to be undone, got %v (%v)", versions(undone), err)
+	}
+
+	if _, err := open(Config{IncludeTags: []string{"reporting"}, AllowOutOfOrder: true}).Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if applied, err := open(Config{}).Migrate(ctx, "max"); err != nil || len(applied) != 0 {
+		t.Errorf("expected 2 to stay pending without AllowOutOfOrder, got %v (%v)", versions(applied), err)
+	}
+	applied, err = open(Config{AllowOutOfOrder: true}).Migrate(ctx, "max")
+	if err != nil || len(applied) != 1 || applied[0].Version != 2 {
+		t.Errorf("expected AllowOutOfOrder to run the pending 2, got %v (%v)", versions(applied), err)
+	}
+}
+
+func TestTagFiltersDependencies(t *testing.T) {
+	pattern := writeDriftedMigrations(t, map[string]string{
+		"001.do.a.sql": "CREATE TABLE a (id INTEGER);",
+		"002.do.b.sql": "-- gostgrator: tags=reporting depends-on=1\nCREATE TABLE b (id INTEGER);",
+	})
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "deps.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	cfg := Config{Driver: "sqlite3", MigrationPattern: pattern, IncludeTags: []string{"reporting"}, AllowOutOfOrder: true}
+	g, err := NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(context.Background(), "max"); err == nil || !strings.Contains(err.Error(), "depends on migration [1]") {
+		t.Errorf("expected a dependency left out by the filters to fail, got %v", err)
+	}
+}
+
+func TestMaxApplyPerRun(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "capped.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	g, err := NewGostgrator(Config{Driver: "sqlite3", MigrationPattern: writeTransactionMigrations(t), MaxApplyPerRun: 1}, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	applied, err := g.Migrate(ctx, "max")
+	if err != nil || len(applied) != 1 || applied[0].Version != 1 {
+		t.Fatalf("expected only version 1 to be applied, got %v (%v)", applied, err)
+	}
+	if pending, err := g.Plan(ctx, "max"); err != nil || len(pending) != 1 || pending[0].Version != 2 {
+		t.Errorf("expected the plan to list 2 as pending, got %v (%v)", pending, err)
+	}
+	if applied, err := g.Migrate(ctx, "max"); err != nil || len(applied) != 1 || applied[0].Version != 2 {
+		t.Fatalf("expected version 2 on the next run, got %v (%v)", applied, err)
+	}
+	if undone, err := g.Migrate(ctx, "0"); err != nil || len(undone) != 2 {
+		t.Errorf("expected rollbacks not to be capped, got %v (%v)", undone, err)
+	}
+	if _, err := NewGostgrator(Config{Driver: "sqlite3", MaxApplyPerRun: -1}, db); err == nil {
+		t.Error("expected a negative MaxApplyPerRun to fail")
+	}
+}
@@ -0,0 +1,8 @@
+-- gostgrator: separator=GO
+CREATE TABLE batch_widgets (
+  id INTEGER PRIMARY KEY,
+  name TEXT
+);
+GO
+INSERT INTO batch_widgets (name) VALUES ('sprocket');
+go
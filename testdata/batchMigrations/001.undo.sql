@@ -0,0 +1,3 @@
+-- gostgrator: separator=GO
+DROP TABLE batch_widgets;
+GO
@@ -0,0 +1 @@
+CREATE TABLE seeds (name TEXT);
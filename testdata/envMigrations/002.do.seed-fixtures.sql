@@ -0,0 +1,2 @@
+-- gostgrator: environments=dev, staging
+INSERT INTO seeds (name) VALUES ('fixture');
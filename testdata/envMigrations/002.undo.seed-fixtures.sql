@@ -0,0 +1 @@
+DELETE FROM seeds WHERE name = 'fixture';
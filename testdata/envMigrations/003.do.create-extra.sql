@@ -0,0 +1 @@
+CREATE TABLE extra (id INT);
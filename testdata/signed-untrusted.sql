@@ -0,0 +1 @@
+CREATE TABLE signed_d (id INTEGER);
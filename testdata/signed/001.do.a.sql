@@ -0,0 +1 @@
+CREATE TABLE signed_a (id INTEGER);
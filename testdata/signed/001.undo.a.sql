@@ -0,0 +1 @@
+DROP TABLE signed_a;
@@ -0,0 +1 @@
+CREATE TABLE signed_b (id INTEGER);
@@ -0,0 +1 @@
+CREATE TABLE signed_c (id INTEGER);
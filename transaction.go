@@ -0,0 +1,94 @@
+package gostgrator
+
+import (
+	"context"
+	"fmt"
+)
+
+// transactionModes are the accepted values of Config.Transaction; empty
+// means "none".
+var transactionModes = []string{"", "none", "each", "all"}
+
+// afterMigrationSQL, when set by tests, is called between running a
+// migration's SQL and recording it in the schema table.
+var afterMigrationSQL func(m Migration)
+
+// runMigrationInTransaction runs m with runMigration, in its own transaction
+// when the transaction mode is "each" and the file allows it.
+func (g *Gostgrator) runMigrationInTransaction(ctx context.Context, m *Migration) (bool, error) {
+	if g.cfg.Transaction != "each" {
+		return g.runMigration(ctx, m)
+	}
+	transactional, err := m.transactional()
+	if err != nil {
+		return false, err
+	}
+	if !transactional {
+		return g.runMigration(ctx, m)
+	}
+	var recorded bool
+	err = g.inTransaction(ctx, func(tg *Gostgrator) error {
+		var err error
+		recorded, err = tg.runMigration(ctx, m)
+		return err
+	})
+	return recorded, err
+}
+
+// runAllInTransaction runs every migration in one transaction. On failure
+// nothing is applied, so the *PartialApplyError lists no applied migrations.
+func (g *Gostgrator) runAllInTransaction(ctx context.Context, migrations []Migration) ([]Migration, error) {
+	for _, m := range migrations {
+		transactional, err := m.transactional()
+		if err != nil {
+			return nil, err
+		}
+		if !transactional {
+			return nil, fmt.Errorf("migration [%d] (%s) cannot run in a transaction; use transaction mode \"each\" to apply it", m.Version, m.Filename)
+		}
+	}
+	var applied []Migration
+	current := migrations[0]
+	err := g.inTransaction(ctx, func(tg *Gostgrator) error {
+		for i, m := range migrations {
+			current = m
+			if err := tg.injectedFailure(i); err != nil {
+				return err
+			}
+			recorded, err := tg.observe(ctx, &m, func() (bool, error) {
+				start := tg.cfg.now()
+				recorded, err := tg.runMigration(ctx, &m)
+				m.Duration = tg.cfg.now().Sub(start)
+				return recorded, err
+			})
+			if err != nil {
+				return err
+			}
+			if recorded {
+				applied = append(applied, m)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &PartialApplyError{Failed: current, Err: err}
+	}
+	return applied, nil
+}
+
+// inTransaction calls f with a copy of g whose client runs every query in a
+// new transaction, committing it if f succeeds and rolling it back otherwise.
+func (g *Gostgrator) inTransaction(ctx context.Context, f func(tg *Gostgrator) error) error {
+	client, tx, err := g.client.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	tg := *g
+	tg.client = client
+	tg.inTx = true
+	if err := f(&tg); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return redactError(tx.Commit())
+}
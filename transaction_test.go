@@ -0,0 +1,186 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// writeTransactionMigrations writes two migrations creating tables a and b
+// and returns their glob pattern.
+func writeTransactionMigrations(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"001.do.a.sql":   "CREATE TABLE a (id INTEGER);",
+		"001.undo.a.sql": "DROP TABLE a;",
+		"002.do.b.sql":   "CREATE TABLE b (id INTEGER);",
+		"002.undo.b.sql": "DROP TABLE b;",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, "*.sql")
+}
+
+// tableExists reports whether the SQLite table name exists.
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n); err != nil {
+		t.Fatalf("failed to look up table %s: %v", name, err)
+	}
+	return n > 0
+}
+
+// TestSqliteTransactionCancelBeforePersist cancels the run after a
+// migration's SQL has executed but before its version is recorded, and checks
+// that the transaction modes keep the two consistent while "none" does not.
+func TestSqliteTransactionCancelBeforePersist(t *testing.T) {
+	defer func() { afterMigrationSQL = nil }()
+
+	cases := []struct {
+		mode        string
+		action      string
+		wantVersion int
+		wantA       bool
+		wantB       bool
+	}{
+		// Without transactions the schema changes but the version does not.
+		{"none", "do", 1, true, true},
+		{"none", "undo", 2, true, false},
+		{"each", "do", 1, true, false},
+		{"each", "undo", 2, true, true},
+		{"all", "do", 0, false, false},
+		{"all", "undo", 2, true, true},
+	}
+	for _, c := range cases {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "tx.db"))
+		if err != nil {
+			t.Fatalf("failed to open sqlite3 db: %v", err)
+		}
+		defer db.Close()
+		g, err := NewGostgrator(Config{
+			Driver:           "sqlite3",
+			MigrationPattern: writeTransactionMigrations(t),
+			Transaction:      c.mode,
+		}, db)
+		if err != nil {
+			t.Fatalf("failed to create gostgrator: %v", err)
+		}
+
+		target := "max"
+		if c.action == "undo" {
+			afterMigrationSQL = nil
+			if _, err := g.Migrate(context.Background(), "max"); err != nil {
+				t.Fatalf("%s: migrate failed: %v", c.mode, err)
+			}
+			target = "0"
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		afterMigrationSQL = func(m Migration) {
+			if m.Version == 2 && m.Action == c.action {
+				cancel()
+			}
+		}
+		_, err = g.Migrate(ctx, target)
+		cancel()
+		afterMigrationSQL = nil
+		if err == nil {
+			t.Fatalf("%s %s: expected the canceled run to fail", c.mode, c.action)
+		}
+
+		version, err := g.GetDatabaseVersion(context.Background())
+		if err != nil {
+			t.Fatalf("%s %s: failed to get version: %v", c.mode, c.action, err)
+		}
+		if version != c.wantVersion {
+			t.Errorf("%s %s: expected version %d, got %d", c.mode, c.action, c.wantVersion, version)
+		}
+		if got := tableExists(t, db, "a"); got != c.wantA {
+			t.Errorf("%s %s: expected table a to exist: %v, got %v", c.mode, c.action, c.wantA, got)
+		}
+		if got := tableExists(t, db, "b"); got != c.wantB {
+			t.Errorf("%s %s: expected table b to exist: %v, got %v", c.mode, c.action, c.wantB, got)
+		}
+	}
+}
+
+// TestTransactionAllHidesIntermediateVersions checks that another connection
+// reading the schema table during an "all" run sees the version it started
+// at until the whole run commits.
+func TestTransactionAllHidesIntermediateVersions(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "observed.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	observer, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer observer.Close()
+
+	var seen []int
+	g, err := New(db, WithConfig(Config{Driver: "sqlite3", MigrationPattern: writeTransactionMigrations(t), Transaction: "all"}), WithHooks(Hooks{
+		AfterMigration: func(ctx context.Context, m Migration, err error) {
+			var version int
+			if err := observer.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM "schemaversion"`).Scan(&version); err != nil {
+				t.Errorf("observer failed to read the version: %v", err)
+			}
+			seen = append(seen, version)
+		},
+	}))
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if applied, err := g.Migrate(ctx, "max"); err != nil || len(applied) != 2 {
+		t.Fatalf("migrate failed: %v (%v)", applied, err)
+	}
+	if len(seen) != 2 || seen[0] != 0 || seen[1] != 0 {
+		t.Errorf("expected the observer to see version 0 during the run, got %v", seen)
+	}
+}
+
+// TestTransactionModeValidation checks unknown modes and directives are rejected.
+func TestTransactionModeValidation(t *testing.T) {
+	if _, err := NewGostgrator(Config{Driver: "sqlite3", Transaction: "always"}, nil); err == nil {
+		t.Error("expected an unknown transaction mode to be rejected")
+	}
+
+	pattern := writeTransactionMigrations(t)
+	dir := filepath.Dir(pattern)
+	if err := os.WriteFile(filepath.Join(dir, "003.do.c.sql"), []byte("-- gostgrator: transaction=none\nCREATE TABLE c (id INTEGER);"), 0644); err != nil {
+		t.Fatalf("failed to write migration: %v", err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "tx.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+
+	g, err := NewGostgrator(Config{Driver: "sqlite3", MigrationPattern: pattern, Transaction: "all"}, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(context.Background(), "max"); err == nil || !strings.Contains(err.Error(), "cannot run in a transaction") {
+		t.Errorf("expected transaction=none to be refused in mode all, got %v", err)
+	}
+
+	g, err = NewGostgrator(Config{Driver: "sqlite3", MigrationPattern: pattern, Transaction: "each"}, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if applied, err := g.Migrate(context.Background(), "max"); err != nil || len(applied) != 3 {
+		t.Errorf("expected 3 migrations applied in mode each, got %d (%v)", len(applied), err)
+	}
+}
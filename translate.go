@@ -0,0 +1,83 @@
+package gostgrator
+
+import (
+	"regexp"
+	"strings"
+)
+
+// translation rewrites one construct into its equivalent for a driver.
+type translation struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// translations lists, by the driver a migration runs on, the constructs
+// written for the other dialect that Config.TranslateSQL rewrites. Order
+// matters: the primary key forms are rewritten before the bare types.
+var translations = map[string][]translation{
+	"sqlite3": {
+		{regexp.MustCompile(`(?i)\b(?:big|small)?serial\s+primary\s+key\b`), "INTEGER PRIMARY KEY AUTOINCREMENT"},
+		{regexp.MustCompile(`(?i)\b(?:big|small)?serial\b`), "INTEGER"},
+		{regexp.MustCompile(`(?i)\btimestamptz\b|\btimestamp\s+with\s+time\s+zone\b`), "TEXT"},
+	},
+	"pg": {
+		{regexp.MustCompile(`(?i)\binteger\s+primary\s+key\s+autoincrement\b`), "SERIAL PRIMARY KEY"},
+	},
+}
+
+// translateSQL rewrites the column types in script that translations lists
+// for driver. Quoted strings, identifiers, comments and dollar-quoted bodies
+// are left as they are.
+func translateSQL(script, driver string) string {
+	rules := translations[driver]
+	if len(rules) == 0 {
+		return script
+	}
+	translate := func(code string) string {
+		for _, t := range rules {
+			code = t.pattern.ReplaceAllString(code, t.replacement)
+		}
+		return code
+	}
+
+	var b strings.Builder
+	start, n := 0, len(script)
+	for i := 0; i < n; {
+		end := i
+		switch c := script[i]; {
+		case c == '-' && i+1 < n && script[i+1] == '-':
+			if j := strings.IndexByte(script[i:], '\n'); j >= 0 {
+				end = i + j + 1
+			} else {
+				end = n
+			}
+		case c == '/' && i+1 < n && script[i+1] == '*':
+			if j := strings.Index(script[i+2:], "*/"); j >= 0 {
+				end = i + j + 4
+			} else {
+				end = n
+			}
+		case c == '\'' || c == '"' || c == '`':
+			end = skipQuoted(script, i)
+		case c == '$':
+			tag := dollarTag(script[i:])
+			if tag == "" {
+				break
+			}
+			if j := strings.Index(script[i+len(tag):], tag); j >= 0 {
+				end = i + len(tag) + j + len(tag)
+			} else {
+				end = n
+			}
+		}
+		if end == i {
+			i++
+			continue
+		}
+		b.WriteString(translate(script[start:i]))
+		b.WriteString(script[i:end])
+		start, i = end, end
+	}
+	b.WriteString(translate(script[start:]))
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestTranslateSQL(t *testing.T) {
+	for _, tc := range []struct {
+		driver, script, want string
+	}{
+		{"sqlite3", "CREATE TABLE a (id serial primary key, n BIGSERIAL, at TIMESTAMP WITH TIME ZONE);",
+			"CREATE TABLE a (id INTEGER PRIMARY KEY AUTOINCREMENT, n INTEGER, at TEXT);"},
+		{"sqlite3", "-- SERIAL ids\nINSERT INTO a (note) VALUES ('TIMESTAMPTZ'); CREATE TABLE \"serial\" (at timestamptz);",
+			"-- SERIAL ids\nINSERT INTO a (note) VALUES ('TIMESTAMPTZ'); CREATE TABLE \"serial\" (at TEXT);"},
+		{"sqlite3", "CREATE TABLE serials (serial_no INTEGER);", "CREATE TABLE serials (serial_no INTEGER);"},
+		{"pg", "CREATE TABLE a (id INTEGER PRIMARY KEY AUTOINCREMENT, at TEXT);", "CREATE TABLE a (id SERIAL PRIMARY KEY, at TEXT);"},
+		{"pg", "CREATE TABLE a (id SERIAL PRIMARY KEY, at TIMESTAMPTZ);", "CREATE TABLE a (id SERIAL PRIMARY KEY, at TIMESTAMPTZ);"},
+		{"mysql", "CREATE TABLE a (id SERIAL);", "CREATE TABLE a (id SERIAL);"},
+	} {
+		if got := translateSQL(tc.script, tc.driver); got != tc.want {
+			t.Errorf("%s: translateSQL(%q) = %q, want %q", tc.driver, tc.script, got, tc.want)
+		}
+	}
+}
+
+// TestTranslateSQLMigrate verifies that a migration written for PostgreSQL
+// runs on SQLite with TranslateSQL, streamed or not.
+func TestTranslateSQLMigrate(t *testing.T) {
+	pattern := writeDriftedMigrations(t, map[string]string{
+		"001.do.users.sql": "CREATE TABLE users (id SERIAL PRIMARY KEY, created_at TIMESTAMPTZ);\nINSERT INTO users (created_at) VALUES ('2024-01-02T03:04:05Z');",
+	})
+	for _, threshold := range []int64{-1, 1} {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "translate.db"))
+		if err != nil {
+			t.Fatalf("failed to open sqlite3 db: %v", err)
+		}
+		defer db.Close()
+		g, err := NewGostgrator(Config{Driver: "sqlite3", MigrationPattern: pattern, StreamThreshold: threshold, TranslateSQL: true}, db)
+		if err != nil {
+			t.Fatalf("failed to create gostgrator: %v", err)
+		}
+		if _, err := g.Migrate(context.Background(), "max"); err != nil {
+			t.Fatalf("migrate failed (stream threshold %d): %v", threshold, err)
+		}
+		var ddl string
+		if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'users'").Scan(&ddl); err != nil {
+			t.Fatal(err)
+		}
+		if want := "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, created_at TEXT)"; ddl != want {
+			t.Errorf("expected %q, got %q (stream threshold %d)", want, ddl, threshold)
+		}
+	}
+}
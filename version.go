@@ -1,5 +1,92 @@
 package gostgrator
 
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
 var (
-	Version = "1.0.7"
+	// Version is the version of gostgrator, e.g. "1.0.7". Release builds may
+	// set it with -ldflags "-X github.com/bcomnes/gostgrator.Version=<version>";
+	// otherwise it is the module version Go records in the binary, as for
+	// binaries built with go install or programs that depend on gostgrator,
+	// or "(devel)" when there is none.
+	Version = ""
+
+	// GitCommit is the commit gostgrator was built from. Release builds set it
+	// with -ldflags "-X github.com/bcomnes/gostgrator.GitCommit=<sha>";
+	// otherwise VersionInfo falls back to the VCS revision Go records in the
+	// binary, if any.
+	GitCommit = ""
 )
+
+// modulePath is the path of the gostgrator module, looked up in the build
+// information of the running binary.
+const modulePath = "github.com/bcomnes/gostgrator"
+
+func init() {
+	if Version == "" {
+		info, _ := debug.ReadBuildInfo()
+		Version = moduleVersion(info)
+	}
+}
+
+// moduleVersion returns the version of the gostgrator module recorded in
+// info, whether it is the main module or a dependency, without its "v"
+// prefix. A replaced module reports its replacement's version. It returns
+// "(devel)" when info has no version, as for tests and local replacements.
+func moduleVersion(info *debug.BuildInfo) string {
+	if info == nil {
+		return "(devel)"
+	}
+	module := &info.Main
+	if module.Path != modulePath {
+		module = nil
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				module = dep
+			}
+		}
+	}
+	if module != nil && module.Replace != nil {
+		module = module.Replace
+	}
+	if module == nil || module.Version == "" || module.Version == "(devel)" {
+		return "(devel)"
+	}
+	return strings.TrimPrefix(module.Version, "v")
+}
+
+// drivers lists the driver names Config.Driver accepts.
+var drivers = []string{"pg", "sqlite3"}
+
+// BuildInfo describes a gostgrator build so tooling can assert which
+// migrator is deployed. Its JSON form is stable.
+type BuildInfo struct {
+	Version   string   `json:"version"`
+	GitCommit string   `json:"gitCommit"`
+	GoVersion string   `json:"goVersion"`
+	Drivers   []string `json:"drivers"`
+}
+
+// VersionInfo returns the version, commit, Go version and supported drivers
+// of the running build.
+func VersionInfo() BuildInfo {
+	commit := GitCommit
+	if commit == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range info.Settings {
+				if s.Key == "vcs.revision" {
+					commit = s.Value
+				}
+			}
+		}
+	}
+	return BuildInfo{
+		Version:   Version,
+		GitCommit: commit,
+		GoVersion: runtime.Version(),
+		Drivers:   append([]string(nil), drivers...),
+	}
+}
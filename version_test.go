@@ -0,0 +1,38 @@
+package gostgrator
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+// TestModuleVersion verifies that the version is read from the build
+// information whether gostgrator is the main module, a dependency or
+// replaced.
+func TestModuleVersion(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		info *debug.BuildInfo
+		want string
+	}{
+		{"no build info", nil, "(devel)"},
+		{"go install", &debug.BuildInfo{Main: debug.Module{Path: modulePath, Version: "v1.2.3"}}, "1.2.3"},
+		{"checkout", &debug.BuildInfo{Main: debug.Module{Path: modulePath, Version: "(devel)"}}, "(devel)"},
+		{"dependency", &debug.BuildInfo{
+			Main: debug.Module{Path: "example.com/app", Version: "v0.4.0"},
+			Deps: []*debug.Module{{Path: "github.com/jackc/pgx/v5", Version: "v5.7.0"}, {Path: modulePath, Version: "v1.2.3"}},
+		}, "1.2.3"},
+		{"replaced", &debug.BuildInfo{
+			Main: debug.Module{Path: "example.com/app"},
+			Deps: []*debug.Module{{Path: modulePath, Version: "v1.2.3", Replace: &debug.Module{Path: "example.com/fork", Version: "v1.2.4-fix"}}},
+		}, "1.2.4-fix"},
+		{"local replacement", &debug.BuildInfo{
+			Main: debug.Module{Path: "example.com/app"},
+			Deps: []*debug.Module{{Path: modulePath, Version: "v1.2.3", Replace: &debug.Module{Path: "../gostgrator"}}},
+		}, "(devel)"},
+		{"not a dependency", &debug.BuildInfo{Main: debug.Module{Path: "example.com/app", Version: "v0.4.0"}}, "(devel)"},
+	} {
+		if got := moduleVersion(tt.info); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package gostgrator
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Notification policies accepted by Config.NotifyOn.
+const (
+	// NotifyAlways posts every migrate, down and reset to Config.WebhookURL.
+	NotifyAlways = "always"
+	// NotifyFailure only posts runs that failed.
+	NotifyFailure = "failure"
+)
+
+// webhookAttempts is how many times a notification is posted before giving
+// up, waiting webhookRetryDelay, doubled each time, between attempts.
+const webhookAttempts = 3
+
+// webhookRetryDelay is the wait before the first retry of a notification.
+var webhookRetryDelay = time.Second
+
+// webhookClient posts notifications.
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// WebhookPayload is the JSON object posted to Config.WebhookURL after a run,
+// or with the status "slow" while a migration outlasts Config.WarnAfter.
+// Text summarizes it for Slack-compatible webhooks; the other fields are for
+// generic receivers.
+type WebhookPayload struct {
+	Text       string             `json:"text"`
+	Command    string             `json:"command"`
+	Status     string             `json:"status"`
+	Host       string             `json:"host"`
+	DurationMs int64              `json:"durationMs"`
+	Version    *int               `json:"version,omitempty"`
+	Migrations []WebhookMigration `json:"migrations"`
+	Failed     *WebhookMigration  `json:"failed,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// WebhookMigration is a migration listed in a WebhookPayload.
+type WebhookMigration struct {
+	Version    int    `json:"version"`
+	Action     string `json:"action"`
+	Name       string `json:"name"`
+	Filename   string `json:"filename"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// NotifyError is returned when a run succeeded but its notification could
+// not be delivered to Config.WebhookURL. The migrations returned with it did
+// run.
+type NotifyError struct {
+	Err error
+}
+
+func (e *NotifyError) Error() string { return "failed to notify webhook: " + e.Err.Error() }
+
+func (e *NotifyError) Unwrap() error { return e.Err }
+
+// report runs f, the command named command, counts it in the metrics served
+// by MetricsHandler and posts its outcome to Config.WebhookURL according to
+// Config.NotifyOn. Commands run by another command, such as the Migrate
+// inside Down, are reported only once, by the outer command.
+func (g *Gostgrator) report(ctx context.Context, command string, f func() ([]Migration, error)) ([]Migration, error) {
+	if g.reporting != "" {
+		return f()
+	}
+	g.reporting = command
+	start := g.cfg.now()
+	ran, err := f()
+	g.reporting = ""
+	elapsed := g.cfg.now().Sub(start)
+	g.metrics.record(command, start.Add(elapsed), elapsed, err)
+	if g.cfg.WebhookURL == "" || (err == nil && g.cfg.NotifyOn == NotifyFailure) {
+		return ran, err
+	}
+	payload := g.webhookPayload(ctx, command, ran, elapsed, err)
+	if nerr := g.postWebhook(ctx, payload); nerr != nil {
+		if err != nil {
+			return ran, errors.Join(err, &NotifyError{Err: nerr})
+		}
+		return ran, &NotifyError{Err: nerr}
+	}
+	return ran, err
+}
+
+// webhookPayload describes a run of command that ran migrations in elapsed
+// time and ended with err.
+func (g *Gostgrator) webhookPayload(ctx context.Context, command string, ran []Migration, elapsed time.Duration, err error) WebhookPayload {
+	payload := WebhookPayload{
+		Command:    command,
+		Status:     "success",
+		Host:       lockHolder,
+		DurationMs: elapsed.Milliseconds(),
+		Migrations: []WebhookMigration{},
+	}
+	for _, m := range ran {
+		payload.Migrations = append(payload.Migrations, webhookMigration(m))
+	}
+	// The version is read without the run's context, which may be the
+	// reason it failed.
+	if version, verr := g.GetDatabaseVersion(context.WithoutCancel(ctx)); verr == nil {
+		payload.Version = &version
+	}
+	payload.Text = fmt.Sprintf("gostgrator %s succeeded on %s: %d migration(s) ran", command, lockHolder, len(ran))
+	if err != nil {
+		payload.Status = "failure"
+		payload.Error = err.Error()
+		payload.Text = fmt.Sprintf("gostgrator %s failed on %s after %d migration(s): %v", command, lockHolder, len(ran), err)
+		var partial *PartialApplyError
+		if errors.As(err, &partial) {
+			failed := webhookMigration(partial.Failed)
+			payload.Failed = &failed
+		}
+	}
+	if payload.Version != nil {
+		payload.Text += fmt.Sprintf(" (version %d)", *payload.Version)
+	}
+	return payload
+}
+
+// webhookMigration lists m in a WebhookPayload.
+func webhookMigration(m Migration) WebhookMigration {
+	return WebhookMigration{
+		Version:    m.Version,
+		Action:     m.Action,
+		Name:       m.Name,
+		Filename:   m.Filename,
+		DurationMs: m.Duration.Milliseconds(),
+	}
+}
+
+// postWebhook posts payload to Config.WebhookURL, retrying network errors,
+// rate limits and server errors. With Config.WebhookSecret, the body is
+// signed with HMAC-SHA256 in the X-Gostgrator-Signature header as
+// "sha256=<hex>". Errors never include the URL, as it is often a secret.
+func (g *Gostgrator) postWebhook(ctx context.Context, payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx = context.WithoutCancel(ctx)
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := g.sendWebhook(ctx, body)
+		if err == nil || !retry || attempt == webhookAttempts {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// sendWebhook makes one attempt at posting body, reporting whether a failure
+// is worth retrying.
+func (g *Gostgrator) sendWebhook(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.New("invalid webhook URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gostgrator/"+Version)
+	if g.cfg.WebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(g.cfg.WebhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Gostgrator-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return false, nil
+}
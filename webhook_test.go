@@ -0,0 +1,130 @@
+package gostgrator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRecorder is a test webhook that records the payloads it receives and
+// fails the first failures requests with a server error.
+type webhookRecorder struct {
+	mu       sync.Mutex
+	payloads []WebhookPayload
+	sigs     []string
+	failures int
+}
+
+func (w *webhookRecorder) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failures > 0 {
+		w.failures--
+		rw.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if r.Header.Get("X-Gostgrator-Signature") == "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		w.sigs = append(w.sigs, "valid")
+	} else {
+		w.sigs = append(w.sigs, r.Header.Get("X-Gostgrator-Signature"))
+	}
+	w.payloads = append(w.payloads, payload)
+}
+
+// TestWebhook verifies that Migrate, Down and Reset post one signed payload
+// each, that failed deliveries are retried, and that NotifyOn "failure"
+// skips successful runs.
+func TestWebhook(t *testing.T) {
+	defer func(delay time.Duration) { webhookRetryDelay = delay }(webhookRetryDelay)
+	webhookRetryDelay = 0
+	ctx := context.Background()
+	hook := &webhookRecorder{failures: 2}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "webhook.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	cfg := Config{
+		Driver:           "sqlite3",
+		MigrationPattern: writeTransactionMigrations(t),
+		WebhookURL:       server.URL,
+		WebhookSecret:    "s3cret",
+	}
+	g, err := NewGostgrator(cfg, db)
+	if err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if _, err := g.Down(ctx, 1); err != nil {
+		t.Fatalf("down failed: %v", err)
+	}
+	if _, err := g.Reset(ctx); err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	if len(hook.payloads) != 3 {
+		t.Fatalf("expected one payload per command, got %+v", hook.payloads)
+	}
+	for i, want := range []struct {
+		command    string
+		migrations int
+		version    int
+	}{{"migrate", 2, 2}, {"down", 1, 1}, {"reset", 3, 2}} {
+		p := hook.payloads[i]
+		if p.Command != want.command || p.Status != "success" || len(p.Migrations) != want.migrations || p.Version == nil || *p.Version != want.version {
+			t.Errorf("unexpected %s payload: %+v", want.command, p)
+		}
+		if hook.sigs[i] != "valid" {
+			t.Errorf("expected a valid signature on the %s payload, got %q", want.command, hook.sigs[i])
+		}
+	}
+
+	cfg.NotifyOn = NotifyFailure
+	if g, err = NewGostgrator(cfg, db); err != nil {
+		t.Fatalf("failed to create gostgrator: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "max"); err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if _, err := g.Migrate(ctx, "nope"); err == nil {
+		t.Fatal("expected an invalid target to fail")
+	}
+	if len(hook.payloads) != 4 || hook.payloads[3].Status != "failure" || hook.payloads[3].Error == "" {
+		t.Fatalf("expected only the failed run to be posted, got %+v", hook.payloads[3:])
+	}
+
+	server.Close()
+	_, err = g.Migrate(ctx, "nope")
+	var notifyErr *NotifyError
+	if !errors.As(err, &notifyErr) {
+		t.Errorf("expected an unreachable webhook to return a *NotifyError, got %v", err)
+	}
+
+	cfg.NotifyOn = "sometimes"
+	if _, err := NewGostgrator(cfg, db); err == nil {
+		t.Error("expected an unknown notify policy to be rejected")
+	}
+}
@@ -0,0 +1,72 @@
+package gostgrator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maintenanceWindow is the daily time span of a "window" directive, e.g.
+// "-- gostgrator: window=02:00-04:00 UTC".
+type maintenanceWindow struct {
+	start, end time.Duration // since midnight in loc
+	loc        *time.Location
+}
+
+// parseWindow parses "HH:MM-HH:MM" followed by an optional time zone, "UTC"
+// or an IANA name such as "Europe/Berlin". Without a zone the window is in
+// UTC. A window whose end is before its start runs past midnight.
+func parseWindow(value string) (maintenanceWindow, error) {
+	span, zone, _ := strings.Cut(strings.TrimSpace(value), " ")
+	from, to, ok := strings.Cut(span, "-")
+	if !ok {
+		return maintenanceWindow{}, fmt.Errorf("expected HH:MM-HH:MM, got %q", value)
+	}
+	var w maintenanceWindow
+	for _, part := range []struct {
+		text string
+		into *time.Duration
+	}{{from, &w.start}, {to, &w.end}} {
+		t, err := time.Parse("15:04", part.text)
+		if err != nil {
+			return maintenanceWindow{}, fmt.Errorf("expected HH:MM-HH:MM, got %q", value)
+		}
+		*part.into = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if w.start == w.end {
+		return maintenanceWindow{}, fmt.Errorf("window %q is empty", value)
+	}
+	w.loc = time.UTC
+	if zone = strings.TrimSpace(zone); zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return maintenanceWindow{}, err
+		}
+		w.loc = loc
+	}
+	return w, nil
+}
+
+// contains reports whether t falls inside the window.
+func (w maintenanceWindow) contains(t time.Time) bool {
+	t = t.In(w.loc)
+	d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.start < w.end {
+		return d >= w.start && d < w.end
+	}
+	return d >= w.start || d < w.end
+}
+
+// windowOpen reports whether m may run now: it has no "window" directive,
+// its window is open, or Config.IgnoreWindows is set.
+func (g *Gostgrator) windowOpen(m Migration) (bool, error) {
+	value, ok := m.Directives["window"]
+	if !ok || g.cfg.IgnoreWindows {
+		return true, nil
+	}
+	w, err := parseWindow(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid window directive in %s: %v", m.Filename, err)
+	}
+	return w.contains(g.cfg.now()), nil
+}
@@ -0,0 +1,102 @@
+package gostgrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		t.Helper()
+		ts, err := time.Parse(time.RFC3339, "2024-01-02T"+clock+":00Z")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	cases := []struct {
+		value string
+		at    string
+		open  bool
+	}{
+		{"02:00-04:00 UTC", "02:00", true},
+		{"02:00-04:00", "03:59", true},
+		{"02:00-04:00 UTC", "04:00", false},
+		{"22:00-02:00", "23:30", true},
+		{"22:00-02:00", "01:00", true},
+		{"22:00-02:00", "12:00", false},
+		{"02:00-04:00 Etc/GMT-2", "01:00", true},
+	}
+	for _, c := range cases {
+		w, err := parseWindow(c.value)
+		if err != nil {
+			t.Errorf("parseWindow(%q) failed: %v", c.value, err)
+			continue
+		}
+		if got := w.contains(at(c.at)); got != c.open {
+			t.Errorf("window %q at %s: got open=%v, want %v", c.value, c.at, got, c.open)
+		}
+	}
+	for _, value := range []string{"", "02:00", "2am-4am", "02:00-02:00", "02:00-04:00 Nowhere/Zone"} {
+		if _, err := parseWindow(value); err == nil {
+			t.Errorf("expected parseWindow(%q) to fail", value)
+		}
+	}
+}
+
+// TestMaintenanceWindows verifies that a migration outside its window is
+// deferred with the ones above it, and runs with IgnoreWindows.
+func TestMaintenanceWindows(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	span := func(from, to time.Duration) string {
+		return fmt.Sprintf("%s-%s UTC", now.Add(from).Format("15:04"), now.Add(to).Format("15:04"))
+	}
+	pattern := writeDriftedMigrations(t, map[string]string{
+		"001.do.a.sql": "CREATE TABLE a (id INTEGER);",
+		"002.do.b.sql": "-- gostgrator: window=" + span(2*time.Hour, 3*time.Hour) + "\nCREATE TABLE b (id INTEGER);",
+		"003.do.c.sql": "CREATE TABLE c (id INTEGER);",
+		"004.do.d.sql": "-- gostgrator: window=" + span(-time.Hour, time.Hour) + "\nCREATE TABLE d (id INTEGER);",
+	})
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "windows.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite3 db: %v", err)
+	}
+	defer db.Close()
+	open := func(cfg Config) *Gostgrator {
+		t.Helper()
+		cfg.Driver = "sqlite3"
+		cfg.MigrationPattern = pattern
+		g, err := NewGostgrator(cfg, db)
+		if err != nil {
+			t.Fatalf("failed to create gostgrator: %v", err)
+		}
+		return g
+	}
+
+	g := open(Config{})
+	if deferred, err := g.Deferred(ctx, "max"); err != nil || len(deferred) != 3 || deferred[0].Version != 2 {
+		t.Errorf("expected 2 and the migrations above it to be deferred, got %v (%v)", deferred, err)
+	}
+	applied, err := g.Migrate(ctx, "max")
+	if err != nil || len(applied) != 1 || applied[0].Version != 1 {
+		t.Fatalf("expected only 1 to be applied, got %v (%v)", applied, err)
+	}
+
+	applied, err = open(Config{AllowOutOfOrder: true}).Migrate(ctx, "max")
+	if err != nil || len(applied) != 2 || applied[0].Version != 3 || applied[1].Version != 4 {
+		t.Fatalf("expected AllowOutOfOrder to run 3 and 4 around the deferred 2, got %v (%v)", applied, err)
+	}
+	if tableExists(t, db, "b") {
+		t.Error("expected 2 to stay deferred")
+	}
+
+	applied, err = open(Config{AllowOutOfOrder: true, IgnoreWindows: true}).Migrate(ctx, "max")
+	if err != nil || len(applied) != 1 || applied[0].Version != 2 {
+		t.Errorf("expected IgnoreWindows to run 2, got %v (%v)", applied, err)
+	}
+}